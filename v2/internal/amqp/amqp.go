@@ -0,0 +1,6 @@
+// Package amqp selects the AMQP client library tcr is built on. The default is github.com/streadway/amqp.
+// Build with -tags amqp091 to use the maintained github.com/rabbitmq/amqp091-go fork instead.
+//
+// The names here are aliases, so tcr signatures use the selected driver's own types and callers
+// pass values from whichever library they import, which must match the build tag.
+package amqp
@@ -0,0 +1,54 @@
+//go:build !amqp091
+
+package amqp
+
+import (
+	driver "github.com/streadway/amqp"
+)
+
+// Driver names the AMQP client library compiled in.
+const Driver = "github.com/streadway/amqp"
+
+type (
+	Acknowledger = driver.Acknowledger
+	Blocking     = driver.Blocking
+	Channel      = driver.Channel
+	Config       = driver.Config
+	Confirmation = driver.Confirmation
+	Connection   = driver.Connection
+	Delivery     = driver.Delivery
+	Error        = driver.Error
+	Publishing   = driver.Publishing
+	Return       = driver.Return
+	Table        = driver.Table
+)
+
+const (
+	Transient  = driver.Transient
+	Persistent = driver.Persistent
+
+	ContentTooLarge    = driver.ContentTooLarge
+	NoRoute            = driver.NoRoute
+	NoConsumers        = driver.NoConsumers
+	ConnectionForced   = driver.ConnectionForced
+	InvalidPath        = driver.InvalidPath
+	AccessRefused      = driver.AccessRefused
+	NotFound           = driver.NotFound
+	ResourceLocked     = driver.ResourceLocked
+	PreconditionFailed = driver.PreconditionFailed
+	FrameError         = driver.FrameError
+	SyntaxError        = driver.SyntaxError
+	CommandInvalid     = driver.CommandInvalid
+	ChannelError       = driver.ChannelError
+	UnexpectedFrame    = driver.UnexpectedFrame
+	ResourceError      = driver.ResourceError
+	NotAllowed         = driver.NotAllowed
+	NotImplemented     = driver.NotImplemented
+	InternalError      = driver.InternalError
+)
+
+var (
+	Dial        = driver.Dial
+	DialConfig  = driver.DialConfig
+	DefaultDial = driver.DefaultDial
+)
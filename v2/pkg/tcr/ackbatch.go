@@ -0,0 +1,370 @@
+package tcr
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const (
+	defaultAckBatchSize     = 100
+	defaultAckBatchInterval = 100 * time.Millisecond
+)
+
+// the settlement of a delivery tag held by an ackWindow
+const (
+	tagUnsettled = iota
+	tagAcked
+	tagSettled // nacked or rejected, already sent
+)
+
+// ackBatcher holds back a Consumer's acks and sends them as multiple-acks, once size acks have accumulated on
+// a channel or every interval. A multiple-ack only covers a run of delivery tags that are all settled, so a
+// message still being handled is never acked along with the ones before it and is redelivered if the consumer
+// dies first. Nacks and rejects are sent right away.
+type ackBatcher struct {
+	size      int
+	interval  time.Duration
+	errors    *errorBuffer
+	windows   map[amqp.Acknowledger]*ackWindow
+	running   bool
+	stop      chan struct{}
+	done      chan struct{}
+	batchLock *sync.Mutex
+}
+
+// newAckBatcher creates an ackBatcher from config. Returns nil when not enabled.
+func newAckBatcher(config *AckBatchConfig, errors *errorBuffer) *ackBatcher {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	ab := &ackBatcher{
+		size:      int(config.Size),
+		interval:  time.Duration(config.Interval) * time.Millisecond,
+		errors:    errors,
+		windows:   make(map[amqp.Acknowledger]*ackWindow),
+		batchLock: &sync.Mutex{},
+	}
+
+	if ab.size <= 0 {
+		ab.size = defaultAckBatchSize
+	}
+
+	if ab.interval <= 0 {
+		ab.interval = defaultAckBatchInterval
+	}
+
+	return ab
+}
+
+// start begins the periodic flushes, for the consume loop.
+func (ab *ackBatcher) start() {
+	ab.batchLock.Lock()
+	defer ab.batchLock.Unlock()
+
+	if ab.running {
+		return
+	}
+
+	ab.running = true
+	ab.stop = make(chan struct{})
+	ab.done = make(chan struct{})
+	go ab.flushLoop(ab.stop, ab.done)
+}
+
+// stopAndFlush ends the periodic flushes, sends every ack held back, and forgets the windows. Acks made
+// afterwards, by handlers still running when the consume loop ended, are sent right away.
+func (ab *ackBatcher) stopAndFlush() {
+	ab.batchLock.Lock()
+
+	if !ab.running {
+		ab.batchLock.Unlock()
+		return
+	}
+
+	ab.running = false
+	close(ab.stop)
+	done := ab.done
+	ab.batchLock.Unlock()
+
+	<-done
+
+	ab.batchLock.Lock()
+	defer ab.batchLock.Unlock()
+
+	for acknowledger, window := range ab.windows {
+		ab.retireLocked(acknowledger, window)
+	}
+}
+
+func (ab *ackBatcher) flushLoop(stop chan struct{}, done chan struct{}) {
+
+	defer close(done)
+
+	ticker := time.NewTicker(ab.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ab.flush(false)
+		}
+	}
+}
+
+// flush sends the acks held back on every channel. Final also sends the acks stuck behind an unsettled message,
+// one at a time.
+func (ab *ackBatcher) flush(final bool) {
+	ab.batchLock.Lock()
+	defer ab.batchLock.Unlock()
+
+	for acknowledger, window := range ab.windows {
+		if err := window.flushLocked(final); err != nil {
+			delete(ab.windows, acknowledger) // the channel is gone, and its unacked deliveries with it
+			ab.errors.report("ack", 0, fmt.Errorf("consumer unable to send batched acks: %w", err))
+		}
+	}
+}
+
+// retire sends the acks held back on a channel the Consumer hands back to the pool, and forgets its window since
+// the pool may rebuild or replace the channel. Messages from it still being handled settle straight through.
+func (ab *ackBatcher) retire(acknowledger amqp.Acknowledger) {
+	ab.batchLock.Lock()
+	defer ab.batchLock.Unlock()
+
+	if window, ok := ab.windows[acknowledger]; ok {
+		ab.retireLocked(acknowledger, window)
+	}
+}
+
+func (ab *ackBatcher) retireLocked(acknowledger amqp.Acknowledger, window *ackWindow) {
+
+	delete(ab.windows, acknowledger)
+	if err := window.flushLocked(true); err != nil {
+		ab.errors.report("ack", 0, fmt.Errorf("consumer unable to send batched acks: %w", err))
+	}
+
+	window.exclusive = false // no longer flushed, so nothing may be held back
+}
+
+// deliver records the delivery and returns the Acknowledger its message settles through.
+func (ab *ackBatcher) deliver(acknowledger amqp.Acknowledger, deliveryTag uint64) amqp.Acknowledger {
+	ab.batchLock.Lock()
+	defer ab.batchLock.Unlock()
+
+	window, ok := ab.windows[acknowledger]
+	if !ok {
+		window = &ackWindow{
+			batcher:      ab,
+			acknowledger: acknowledger,
+			tags:         make(map[uint64]int),
+			exclusive:    deliveryTag == 1,
+		}
+		ab.windows[acknowledger] = window
+	} else if deliveryTag != window.lastDelivered+1 {
+		window.exclusive = false
+	}
+
+	window.lastDelivered = deliveryTag
+	if window.exclusive {
+		window.tags[deliveryTag] = tagUnsettled
+	}
+
+	return window
+}
+
+// ackWindow is the Acknowledger of the messages delivered on one channel. Multiple-acks are only used while the
+// window is exclusive: every delivery on the channel, from its first, came to this Consumer. A channel taken
+// over from another consumer may still carry that consumer's unsettled deliveries, so its acks are sent singly.
+type ackWindow struct {
+	batcher       *ackBatcher
+	acknowledger  amqp.Acknowledger
+	tags          map[uint64]int // delivery tags not yet acked with the broker, by settlement
+	pendingAcks   int
+	lastDelivered uint64
+	exclusive     bool
+}
+
+// Ack holds the ack back until the window flushes, or sends it right away when batching can't be used.
+func (aw *ackWindow) Ack(tag uint64, multiple bool) error {
+	aw.batcher.batchLock.Lock()
+	defer aw.batcher.batchLock.Unlock()
+
+	if !aw.exclusive || !aw.batcher.running {
+		if err := aw.acknowledger.Ack(tag, multiple); err != nil {
+			return err
+		}
+
+		aw.settleLocked(tag, multiple, tagSettled)
+		return nil
+	}
+
+	aw.settleLocked(tag, multiple, tagAcked)
+	if aw.pendingAcks < aw.batcher.size {
+		return nil
+	}
+
+	return aw.flushLocked(false)
+}
+
+// Nack sends the nack right away. Acks held back for the tags a multiple nack covers are sent first, so they
+// aren't nacked instead.
+func (aw *ackWindow) Nack(tag uint64, multiple bool, requeue bool) error {
+	aw.batcher.batchLock.Lock()
+	defer aw.batcher.batchLock.Unlock()
+
+	if multiple {
+		if err := aw.ackThroughLocked(tag); err != nil {
+			return err
+		}
+	}
+
+	if err := aw.acknowledger.Nack(tag, multiple, requeue); err != nil {
+		return err
+	}
+
+	aw.settleLocked(tag, multiple, tagSettled)
+	return nil
+}
+
+// Reject sends the reject right away.
+func (aw *ackWindow) Reject(tag uint64, requeue bool) error {
+	aw.batcher.batchLock.Lock()
+	defer aw.batcher.batchLock.Unlock()
+
+	if err := aw.acknowledger.Reject(tag, requeue); err != nil {
+		return err
+	}
+
+	aw.settleLocked(tag, false, tagSettled)
+	return nil
+}
+
+// settleLocked marks the tag, or with multiple every unsettled tag up to it, as settled. Windows that aren't
+// exclusive forget settled tags right away, only the acks they still hold back are kept.
+func (aw *ackWindow) settleLocked(tag uint64, multiple bool, settlement int) {
+
+	if !multiple {
+		aw.markLocked(tag, settlement)
+	} else {
+		for deliveryTag, current := range aw.tags {
+			if deliveryTag <= tag && current == tagUnsettled {
+				aw.markLocked(deliveryTag, settlement)
+			}
+		}
+	}
+
+	if !aw.exclusive {
+		for deliveryTag, current := range aw.tags {
+			if current == tagSettled {
+				delete(aw.tags, deliveryTag)
+			}
+		}
+	}
+}
+
+func (aw *ackWindow) markLocked(tag uint64, settlement int) {
+
+	if aw.tags[tag] == tagAcked {
+		aw.pendingAcks--
+	}
+
+	if settlement == tagAcked {
+		aw.pendingAcks++
+	}
+
+	aw.tags[tag] = settlement
+}
+
+// ackThroughLocked sends the acks held back for tags up to tag, one at a time.
+func (aw *ackWindow) ackThroughLocked(tag uint64) error {
+
+	for _, deliveryTag := range aw.sortedTagsLocked() {
+		if deliveryTag > tag {
+			break
+		}
+
+		if aw.tags[deliveryTag] != tagAcked {
+			continue
+		}
+
+		if err := aw.acknowledger.Ack(deliveryTag, false); err != nil {
+			return err
+		}
+
+		aw.markLocked(deliveryTag, tagSettled)
+	}
+
+	return nil
+}
+
+// flushLocked sends one multiple-ack for the settled run of tags at the start of the window. Final, or a window
+// that is no longer exclusive, also sends the acks after the run one at a time.
+func (aw *ackWindow) flushLocked(final bool) error {
+
+	tags := aw.sortedTagsLocked()
+
+	var run int
+	var lastAck uint64
+	if aw.exclusive {
+		for _, tag := range tags {
+			if aw.tags[tag] == tagUnsettled {
+				break
+			}
+
+			if aw.tags[tag] == tagAcked {
+				lastAck = tag
+			}
+			run++
+		}
+	}
+
+	if lastAck > 0 {
+		if err := aw.acknowledger.Ack(lastAck, true); err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range tags[:run] {
+		aw.markLocked(tag, tagSettled)
+		delete(aw.tags, tag)
+	}
+
+	if final || !aw.exclusive {
+		for _, tag := range tags[run:] {
+			if aw.tags[tag] != tagAcked {
+				continue
+			}
+
+			if err := aw.acknowledger.Ack(tag, false); err != nil {
+				return err
+			}
+
+			aw.markLocked(tag, tagSettled)
+			if !aw.exclusive {
+				delete(aw.tags, tag)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (aw *ackWindow) sortedTagsLocked() []uint64 {
+
+	tags := make([]uint64, 0, len(aw.tags))
+	for tag := range aw.tags {
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	return tags
+}
@@ -0,0 +1,91 @@
+package tcr
+
+import (
+	"context"
+	"time"
+)
+
+// autoScaleDrainTimeout bounds how long a member removed by scaling down gets to settle its messages.
+const autoScaleDrainTimeout = 30 * time.Second
+
+// QueueDepthFunc reads how many messages are waiting in a queue.
+type QueueDepthFunc func(ctx context.Context, queueName string) (int, error)
+
+// autoScalePolicy sizes a ConsumerGroup from its queue's depth.
+type autoScalePolicy struct {
+	min                 int
+	max                 int
+	messagesPerConsumer int
+	pollInterval        time.Duration
+	queueDepth          QueueDepthFunc
+}
+
+// newAutoScalePolicy creates an autoScalePolicy from config, nil when not enabled.
+func newAutoScalePolicy(config *AutoScaleConfig, cp *ConnectionPool) *autoScalePolicy {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	asp := &autoScalePolicy{
+		min:                 int(config.MinConsumers),
+		max:                 int(config.MaxConsumers),
+		messagesPerConsumer: int(config.MessagesPerConsumer),
+		pollInterval:        time.Duration(config.PollInterval) * time.Second,
+		queueDepth:          config.QueueDepth,
+	}
+
+	if asp.min < 1 {
+		asp.min = 1
+	}
+
+	if asp.max < asp.min {
+		if asp.max > 0 && cp != nil {
+			cp.logger.Warn("auto scale MaxConsumers %d is below MinConsumers %d, using %d", asp.max, asp.min, asp.min)
+		}
+		asp.max = asp.min
+	}
+
+	if asp.messagesPerConsumer < 1 {
+		asp.messagesPerConsumer = 1000
+	}
+
+	if asp.pollInterval <= 0 {
+		asp.pollInterval = 10 * time.Second
+	}
+
+	if asp.queueDepth == nil {
+		topologer := NewTopologer(cp)
+		asp.queueDepth = func(ctx context.Context, queueName string) (int, error) {
+			return topologer.QueueDepth(queueName)
+		}
+	}
+
+	return asp
+}
+
+// clamp keeps size between the min and max.
+func (asp *autoScalePolicy) clamp(size int) int {
+
+	if size < asp.min {
+		return asp.min
+	}
+
+	if size > asp.max {
+		return asp.max
+	}
+
+	return size
+}
+
+// desired is the member count for the queue depth. Scaling up goes straight to it, scaling down removes one
+// member per poll so a briefly empty queue doesn't tear the group down.
+func (asp *autoScalePolicy) desired(depth int, current int) int {
+
+	size := asp.clamp((depth + asp.messagesPerConsumer - 1) / asp.messagesPerConsumer)
+	if size < current-1 {
+		size = current - 1
+	}
+
+	return size
+}
@@ -0,0 +1,113 @@
+package tcr
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	// BackoffConstant waits the same interval before every retry.
+	BackoffConstant = "constant"
+
+	// BackoffExponential multiplies the interval after every retry.
+	BackoffExponential = "exponential"
+)
+
+// BackoffPolicy decides how long to wait before a retry. Attempt is 1 for the first retry and keeps
+// counting for as long as the same operation fails.
+type BackoffPolicy interface {
+	Delay(attempt int) time.Duration
+}
+
+// ConstantBackoff waits the same Interval before every retry.
+type ConstantBackoff struct {
+	Interval time.Duration
+}
+
+// Delay implements BackoffPolicy.
+func (backoff *ConstantBackoff) Delay(attempt int) time.Duration {
+	return backoff.Interval
+}
+
+// ExponentialBackoff waits Initial before the first retry and Multiplier times longer before each one after,
+// capped at Max when set. Jitter, from 0 to 1, randomly takes up to that fraction off each delay so clients
+// that failed together don't all retry together.
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Multiplier float64 // defaults to 2
+	Max        time.Duration
+	Jitter     float64
+}
+
+// Delay implements BackoffPolicy.
+func (backoff *ExponentialBackoff) Delay(attempt int) time.Duration {
+
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := backoff.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(backoff.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if backoff.Max > 0 && delay > float64(backoff.Max) {
+		delay = float64(backoff.Max)
+	}
+
+	if backoff.Jitter > 0 {
+		delay -= delay * math.Min(backoff.Jitter, 1) * rand.Float64()
+	}
+
+	return time.Duration(delay)
+}
+
+// NewBackoffPolicy creates the BackoffPolicy described by config. Returns nil when config is nil.
+func NewBackoffPolicy(config *BackoffConfig) (BackoffPolicy, error) {
+
+	if config == nil {
+		return nil, nil
+	}
+
+	initial := time.Duration(config.InitialInterval) * time.Millisecond
+
+	switch config.Type {
+	case "", BackoffConstant:
+		return &ConstantBackoff{Interval: initial}, nil
+	case BackoffExponential:
+		return &ExponentialBackoff{
+			Initial:    initial,
+			Multiplier: config.Multiplier,
+			Max:        time.Duration(config.MaxInterval) * time.Millisecond,
+			Jitter:     config.Jitter,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown backoff type %q", config.Type)
+	}
+}
+
+// backoffPolicy is the injected policy, else the one described by config, else a constant sleepOnError.
+func backoffPolicy(injected BackoffPolicy, config *BackoffConfig, sleepOnError time.Duration) (BackoffPolicy, error) {
+
+	if injected != nil {
+		return injected, nil
+	}
+
+	policy, err := NewBackoffPolicy(config)
+	if err != nil || policy != nil {
+		return policy, err
+	}
+
+	return &ConstantBackoff{Interval: sleepOnError}, nil
+}
+
+// sleepBackoff sleeps for the policy's delay before the retry attempt.
+func sleepBackoff(policy BackoffPolicy, attempt int) {
+
+	if delay := policy.Delay(attempt); delay > 0 {
+		time.Sleep(delay)
+	}
+}
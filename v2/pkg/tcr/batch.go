@@ -0,0 +1,115 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// MessageBatch is a slice of messages from ConsumeBatch, settled together with multiple-acks.
+type MessageBatch []*ReceivedMessage
+
+// ConsumeBatch reads up to maxCount messages from ReceivedMessages, returning early once maxWait has elapsed.
+// The batch is empty when no message arrived in time. Start the Consumer with StartConsuming first.
+//
+// Settle each batch, with Acknowledge or Nack, before the next one: a multiple-ack settles every earlier
+// unsettled delivery on the channel, so messages held back from an earlier batch would be settled with it.
+func (con *Consumer) ConsumeBatch(maxCount int, maxWait time.Duration) MessageBatch {
+
+	if maxCount < 1 {
+		maxCount = 1
+	}
+
+	batch := make(MessageBatch, 0, maxCount)
+	timeout := time.NewTimer(maxWait)
+	defer timeout.Stop()
+
+	for len(batch) < maxCount {
+		select {
+		case msg := <-con.receivedMessages:
+			batch = append(batch, msg)
+		case <-timeout.C:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// Acknowledge acknowledges every message of the batch, with one multiple-ack per channel the messages came on.
+func (batch MessageBatch) Acknowledge() error {
+	return batch.settle(true, false)
+}
+
+// Nack negative acknowledges every message of the batch, with one multiple-nack per channel the messages came on.
+func (batch MessageBatch) Nack(requeue bool) error {
+	return batch.settle(false, requeue)
+}
+
+// settle multiple-acks (or nacks) the highest delivery tag of each run of messages from the same channel.
+// Deliveries come in order, so a channel's messages in the batch are consecutive unless it was recovered.
+func (batch MessageBatch) settle(ack bool, requeue bool) error {
+
+	for _, msg := range batch {
+		if !msg.IsAckable {
+			return errors.New("can't settle batch, not every message is ackable")
+		}
+
+		if msg.acknowledger == nil {
+			return errors.New("can't settle batch, internal channel is nil")
+		}
+	}
+
+	var firstErr error
+	for start := 0; start < len(batch); {
+		acknowledger := batch[start].acknowledger
+
+		end := start
+		lastTag := batch[start].deliveryTag
+		for end+1 < len(batch) && batch[end+1].acknowledger == acknowledger {
+			end++
+			if batch[end].deliveryTag > lastTag {
+				lastTag = batch[end].deliveryTag
+			}
+		}
+
+		if err := settleMultiple(acknowledger, lastTag, batch[start:end+1], ack, requeue); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		start = end + 1
+	}
+
+	return firstErr
+}
+
+// settleMultiple settles every delivery up to lastTag on the channel and records the settlement on its messages.
+func settleMultiple(acknowledger amqp.Acknowledger, lastTag uint64, run []*ReceivedMessage, ack bool, requeue bool) error {
+
+	var err error
+	if ack {
+		err = acknowledger.Ack(lastTag, true)
+	} else {
+		err = acknowledger.Nack(lastTag, true, requeue)
+	}
+
+	for _, msg := range run {
+		msg.track(err, ack, requeue)
+	}
+
+	if err != nil || !ack {
+		return err
+	}
+
+	for _, msg := range run {
+		if msg.deduper != nil {
+			if err := msg.deduper.MarkProcessed(msg.dedupKey); err != nil {
+				return fmt.Errorf("batch acknowledged but not marked processed: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
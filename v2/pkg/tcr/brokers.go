@@ -0,0 +1,150 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrBrokerNotFound is returned when no broker target has the requested name.
+var ErrBrokerNotFound = errors.New("broker target not found")
+
+// BrokerTarget is the ConnectionPool, Publisher, and Topologer of one named broker (a vhost or cluster).
+type BrokerTarget struct {
+	Name           string
+	ConnectionPool *ConnectionPool
+	Publisher      *Publisher
+	Topologer      *Topologer
+}
+
+// BrokerRegistry holds a BrokerTarget per name, for services bridging several vhosts or clusters.
+type BrokerRegistry struct {
+	targets      map[string]*BrokerTarget
+	registryLock *sync.Mutex
+}
+
+// NewBrokerRegistry creates a BrokerTarget for every entry of config.BrokerTargets. Targets without their own
+// PublisherConfig use config.PublisherConfig, and all of them use config.NamingConfig.
+func NewBrokerRegistry(config *RabbitSeasoning) (*BrokerRegistry, error) {
+
+	br := &BrokerRegistry{
+		targets:      make(map[string]*BrokerTarget),
+		registryLock: &sync.Mutex{},
+	}
+
+	naming, err := NewNamingConvention(config.NamingConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, targetConfig := range config.BrokerTargets {
+		target, err := newBrokerTarget(name, targetConfig, config.PublisherConfig, naming)
+		if err != nil {
+			br.Shutdown()
+			return nil, err
+		}
+
+		br.targets[name] = target
+	}
+
+	return br, nil
+}
+
+// newBrokerTarget connects to a broker target and creates its Publisher and Topologer.
+func newBrokerTarget(
+	name string,
+	config *BrokerTargetConfig,
+	publisherConfig *PublisherConfig,
+	naming *NamingConvention) (*BrokerTarget, error) {
+
+	if config == nil || config.PoolConfig == nil {
+		return nil, fmt.Errorf("broker target %s has no PoolConfig", name)
+	}
+
+	if config.PublisherConfig != nil {
+		publisherConfig = config.PublisherConfig
+	}
+
+	if publisherConfig == nil {
+		publisherConfig = &PublisherConfig{}
+	}
+
+	connectionPool, err := NewConnectionPool(config.PoolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to broker target %s: %w", name, err)
+	}
+
+	target := &BrokerTarget{
+		Name:           name,
+		ConnectionPool: connectionPool,
+		Publisher:      NewPublisherFromConfig(&RabbitSeasoning{PublisherConfig: publisherConfig}, connectionPool),
+		Topologer:      NewTopologer(connectionPool),
+	}
+
+	target.Publisher.SetNamingConvention(naming)
+	target.Topologer.SetNamingConvention(naming)
+
+	return target, nil
+}
+
+// Target gets the BrokerTarget named name.
+func (br *BrokerRegistry) Target(name string) (*BrokerTarget, error) {
+	br.registryLock.Lock()
+	defer br.registryLock.Unlock()
+
+	target, ok := br.targets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBrokerNotFound, name)
+	}
+
+	return target, nil
+}
+
+// ConnectionPool gets the ConnectionPool of the broker target named name.
+func (br *BrokerRegistry) ConnectionPool(name string) (*ConnectionPool, error) {
+
+	target, err := br.Target(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return target.ConnectionPool, nil
+}
+
+// Publisher gets the Publisher of the broker target named name.
+func (br *BrokerRegistry) Publisher(name string) (*Publisher, error) {
+
+	target, err := br.Target(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return target.Publisher, nil
+}
+
+// Names lists the broker targets, sorted.
+func (br *BrokerRegistry) Names() []string {
+	br.registryLock.Lock()
+	defer br.registryLock.Unlock()
+
+	names := make([]string, 0, len(br.targets))
+	for name := range br.targets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Shutdown shuts down the Publisher and ConnectionPool of every broker target.
+func (br *BrokerRegistry) Shutdown() {
+	br.registryLock.Lock()
+	defer br.registryLock.Unlock()
+
+	for name, target := range br.targets {
+		target.Publisher.Shutdown(true)
+		delete(br.targets, name)
+	}
+}
@@ -0,0 +1,80 @@
+package tcr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+var exceptionNames = map[int]string{
+	amqp.ContentTooLarge:    "CONTENT_TOO_LARGE",
+	amqp.NoRoute:            "NO_ROUTE",
+	amqp.NoConsumers:        "NO_CONSUMERS",
+	amqp.ConnectionForced:   "CONNECTION_FORCED",
+	amqp.InvalidPath:        "INVALID_PATH",
+	amqp.AccessRefused:      "ACCESS_REFUSED",
+	amqp.NotFound:           "NOT_FOUND",
+	amqp.ResourceLocked:     "RESOURCE_LOCKED",
+	amqp.PreconditionFailed: "PRECONDITION_FAILED",
+	amqp.FrameError:         "FRAME_ERROR",
+	amqp.SyntaxError:        "SYNTAX_ERROR",
+	amqp.CommandInvalid:     "COMMAND_INVALID",
+	amqp.ChannelError:       "CHANNEL_ERROR",
+	amqp.UnexpectedFrame:    "UNEXPECTED_FRAME",
+	amqp.ResourceError:      "RESOURCE_ERROR",
+	amqp.NotAllowed:         "NOT_ALLOWED",
+	amqp.NotImplemented:     "NOT_IMPLEMENTED",
+	amqp.InternalError:      "INTERNAL_ERROR",
+}
+
+// ChannelException is a channel closed by the broker, correlated with the operation the library was performing on it.
+type ChannelException struct {
+	ChannelID    uint64
+	ConnectionID uint64
+	Code         int
+	Name         string // ex. PRECONDITION_FAILED
+	Reason       string
+	Server       bool
+	Operation    string // AMQP method in flight, ex. basic.publish
+	Target       string // queue, or exchange and routing key, the operation addressed
+	UTCDateTime  time.Time
+}
+
+// NewChannelException correlates an amqp.Error with the last operation recorded on the ChannelHost.
+func NewChannelException(chanHost *ChannelHost, amqpError *amqp.Error) *ChannelException {
+
+	operation, target := chanHost.lastOperation()
+
+	return &ChannelException{
+		ChannelID:    chanHost.ID,
+		ConnectionID: chanHost.ConnectionID,
+		Code:         amqpError.Code,
+		Name:         ExceptionName(amqpError.Code),
+		Reason:       amqpError.Reason,
+		Server:       amqpError.Server,
+		Operation:    operation,
+		Target:       target,
+		UTCDateTime:  time.Now().UTC(),
+	}
+}
+
+// ExceptionName is the AMQP name of a reply code, ex. 406 is PRECONDITION_FAILED.
+func ExceptionName(code int) string {
+
+	if name, ok := exceptionNames[code]; ok {
+		return name
+	}
+
+	return "UNKNOWN"
+}
+
+// Error allows you to quickly log the ChannelException struct as a string.
+func (ce *ChannelException) Error() string {
+
+	if ce.Operation == "" {
+		return fmt.Sprintf("channel %d closed [%d %s]: %s", ce.ChannelID, ce.Code, ce.Name, ce.Reason)
+	}
+
+	return fmt.Sprintf("channel %d closed during %s on %q [%d %s]: %s", ce.ChannelID, ce.Operation, ce.Target, ce.Code, ce.Name, ce.Reason)
+}
@@ -0,0 +1,78 @@
+package tcr
+
+import (
+	"sync"
+)
+
+// channelHooks holds telemetry callbacks for cached channel lifecycle events.
+type channelHooks struct {
+	created  []func(*ChannelHost)
+	flagged  []func(*ChannelHost)
+	get      []func(*ChannelHost)
+	hookLock *sync.RWMutex
+}
+
+// ChannelHooks are optional telemetry callbacks set in the PoolConfig, so channels created while the
+// ConnectionPool initializes are seen too. More hooks can be added later with OnChannelCreated and friends.
+type ChannelHooks struct {
+	OnChannelCreated func(*ChannelHost)
+	OnChannelFlagged func(*ChannelHost)
+	OnChannelGet     func(*ChannelHost)
+}
+
+func newChannelHooks(config *ChannelHooks) *channelHooks {
+
+	ch := &channelHooks{
+		hookLock: &sync.RWMutex{},
+	}
+
+	if config != nil {
+		if config.OnChannelCreated != nil {
+			ch.created = append(ch.created, config.OnChannelCreated)
+		}
+
+		if config.OnChannelFlagged != nil {
+			ch.flagged = append(ch.flagged, config.OnChannelFlagged)
+		}
+
+		if config.OnChannelGet != nil {
+			ch.get = append(ch.get, config.OnChannelGet)
+		}
+	}
+
+	return ch
+}
+
+func (ch *channelHooks) add(hooks *[]func(*ChannelHost), hook func(*ChannelHost)) {
+	ch.hookLock.Lock()
+	defer ch.hookLock.Unlock()
+
+	*hooks = append(*hooks, hook)
+}
+
+func (ch *channelHooks) run(hooks *[]func(*ChannelHost), chanHost *ChannelHost) {
+	ch.hookLock.RLock()
+	defer ch.hookLock.RUnlock()
+
+	for _, hook := range *hooks {
+		hook(chanHost)
+	}
+}
+
+// OnChannelCreated registers a hook called whenever a cached channel is created or rebuilt after an error.
+// Hooks run synchronously on the pool's goroutine and must not block.
+func (cp *ConnectionPool) OnChannelCreated(hook func(*ChannelHost)) {
+	cp.channelHooks.add(&cp.channelHooks.created, hook)
+}
+
+// OnChannelFlagged registers a hook called when a cached channel is returned in error, before it is rebuilt.
+// Hooks run synchronously on the returning goroutine and must not block.
+func (cp *ConnectionPool) OnChannelFlagged(hook func(*ChannelHost)) {
+	cp.channelHooks.add(&cp.channelHooks.flagged, hook)
+}
+
+// OnChannelGet registers a hook called whenever a cached channel is taken from the pool.
+// Hooks run synchronously on the taking goroutine and must not block.
+func (cp *ConnectionPool) OnChannelGet(hook func(*ChannelHost)) {
+	cp.channelHooks.add(&cp.channelHooks.get, hook)
+}
@@ -3,21 +3,33 @@ package tcr
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 )
 
 // ChannelHost is an internal representation of amqp.Connection.
 type ChannelHost struct {
-	Channel       *amqp.Channel
-	ID            uint64
-	ConnectionID  uint64
-	Ackable       bool
-	CachedChannel bool
-	Confirmations chan amqp.Confirmation
-	Errors        chan *amqp.Error
-	connHost      *ConnectionHost
-	chanLock      *sync.Mutex
+	Channel        *amqp.Channel
+	ID             uint64
+	ConnectionID   uint64
+	Ackable        bool
+	CachedChannel  bool
+	Confirmations  chan amqp.Confirmation
+	Errors         chan *amqp.Error
+	connHost       *ConnectionHost
+	operation      string
+	target         string
+	routingKey     string // of the latest publish, joined to target only when asked to save an allocation per publish
+	published      uint64 // delivery tag of the latest publish since the channel was made
+	madeAt         time.Time
+	generation     uint64 // of the connection the channel was made on
+	lastUsed       time.Time
+	publishStarted time.Time // of the latest publish not yet sampled for SlowChannelConfig
+	cachedAt       time.Time // when the pool last cached the channel, owned by whoever holds the ChannelHost
+	onException    func(*ChannelException)
+	chanLock       *sync.Mutex
 }
 
 // NewChannelHost creates a simple ConnectionHost wrapper for management by end-user developer.
@@ -58,11 +70,16 @@ func (ch *ChannelHost) MakeChannel() (err error) {
 	ch.chanLock.Lock()
 	defer ch.chanLock.Unlock()
 
+	generation := atomic.LoadUint64(&ch.connHost.generation) // before the Connection it belongs to is read
 	ch.Channel, err = ch.connHost.Connection.Channel()
 	if err != nil {
 		return err
 	}
 
+	ch.published = 0 // delivery tags start over on a new channel
+	ch.madeAt = time.Now()
+	ch.generation = generation
+
 	if ch.Ackable {
 		err = ch.Channel.Confirm(false)
 		if err != nil {
@@ -76,9 +93,131 @@ func (ch *ChannelHost) MakeChannel() (err error) {
 	ch.Errors = make(chan *amqp.Error, 100)
 	ch.Channel.NotifyClose(ch.Errors)
 
+	// A second listener so the exception is correlated at the moment of closure, whoever reads Errors.
+	closures := make(chan *amqp.Error, 1)
+	ch.Channel.NotifyClose(closures)
+	go ch.watchForException(closures)
+
 	return nil
 }
 
+// stale reports whether the channel was made on a connection its ConnectionHost has since replaced.
+func (ch *ChannelHost) stale() bool {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	return ch.generation != atomic.LoadUint64(&ch.connHost.generation)
+}
+
+// watchForException reports a broker initiated channel closure, exiting when the channel closes.
+func (ch *ChannelHost) watchForException(closures chan *amqp.Error) {
+
+	amqpError, ok := <-closures
+	if !ok || amqpError == nil {
+		return
+	}
+
+	ch.chanLock.Lock()
+	onException := ch.onException
+	ch.chanLock.Unlock()
+
+	if onException != nil {
+		onException(NewChannelException(ch, amqpError))
+	}
+}
+
+// setOperation records the AMQP method the library is about to perform for exception correlation.
+func (ch *ChannelHost) setOperation(operation, target string) {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	ch.operation = operation
+	ch.target = target
+}
+
+// Publish sends a message on the channel. Calls through the ChannelHost are serialized, so a channel shared
+// between goroutines never interleaves the frames of two messages.
+func (ch *ChannelHost) Publish(exchange, routingKey string, mandatory, immediate bool, msg amqp.Publishing) error {
+
+	_, err := ch.publishMessage(exchange, routingKey, mandatory, immediate, msg)
+	return err
+}
+
+// Ack acknowledges a delivery received on this channel, serialized with other calls through the ChannelHost.
+func (ch *ChannelHost) Ack(deliveryTag uint64, multiple bool) error {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	ch.operation, ch.target = "basic.ack", ""
+	ch.lastUsed = time.Now()
+
+	return ch.Channel.Ack(deliveryTag, multiple)
+}
+
+// Nack negatively acknowledges a delivery received on this channel, serialized with other calls through the ChannelHost.
+func (ch *ChannelHost) Nack(deliveryTag uint64, multiple, requeue bool) error {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	ch.operation, ch.target = "basic.nack", ""
+	ch.lastUsed = time.Now()
+
+	return ch.Channel.Nack(deliveryTag, multiple, requeue)
+}
+
+// LastUsed is when the channel last published, acked, or nacked through the ChannelHost, zero if never.
+func (ch *ChannelHost) LastUsed() time.Time {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	return ch.lastUsed
+}
+
+// ConnectionHost is the connection the channel was made on, for ChannelSelectors weighing its health.
+func (ch *ChannelHost) ConnectionHost() *ConnectionHost {
+	return ch.connHost
+}
+
+// publish sends the letter on the channel and returns its delivery tag, which is only meaningful for Ackable channels.
+func (ch *ChannelHost) publish(letter *Letter) (uint64, error) {
+
+	return ch.publishMessage(
+		letter.Envelope.Exchange,
+		letter.Envelope.RoutingKey,
+		letter.Envelope.Mandatory,
+		letter.Envelope.Immediate,
+		letter.publishing(),
+	)
+}
+
+func (ch *ChannelHost) publishMessage(exchange, routingKey string, mandatory, immediate bool, msg amqp.Publishing) (uint64, error) {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	ch.operation = "basic.publish"
+	ch.target, ch.routingKey = exchange, routingKey
+	ch.lastUsed = time.Now()
+	ch.publishStarted = ch.lastUsed
+
+	if err := ch.Channel.Publish(exchange, routingKey, mandatory, immediate, msg); err != nil {
+		return 0, err
+	}
+
+	ch.published++
+	return ch.published, nil
+}
+
+func (ch *ChannelHost) lastOperation() (string, string) {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	if ch.operation == "basic.publish" {
+		return ch.operation, ch.target + "/" + ch.routingKey
+	}
+
+	return ch.operation, ch.target
+}
+
 // FlushConfirms removes all previous confirmations pending processing.
 func (ch *ChannelHost) FlushConfirms() {
 	ch.chanLock.Lock()
@@ -0,0 +1,108 @@
+package tcr
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// cacheChannel puts the channel back in the cache, marking when its idle time starts.
+func (cp *ConnectionPool) cacheChannel(chanHost *ChannelHost) {
+
+	chanHost.cachedAt = time.Now()
+	cp.channels <- chanHost
+}
+
+// reapIdleChannels closes cached channels idle longer than MaxChannelIdleTime until stopped.
+func (cp *ConnectionPool) reapIdleChannels(stop chan struct{}) {
+
+	interval := cp.maxChannelIdle / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			cp.reapChannels()
+		}
+	}
+}
+
+// reapChannels closes idle channels from the front of the cache, the longest cached, down to MinChannelCount.
+// It stops at the first channel still in use recently since every channel behind it was cached later.
+func (cp *ConnectionPool) reapChannels() {
+
+	for !cp.closed() {
+		count := atomic.LoadUint64(&cp.channelCount)
+		if count <= cp.Config.MinChannelCount {
+			return
+		}
+
+		var chanHost *ChannelHost
+		select {
+		case chanHost = <-cp.channels:
+		default:
+			return
+		}
+
+		if time.Since(chanHost.cachedAt) < cp.maxChannelIdle || !atomic.CompareAndSwapUint64(&cp.channelCount, count, count-1) {
+			cp.channels <- chanHost // keeps its cachedAt, so it is looked at again next time round
+			return
+		}
+
+		cp.logger.Debug("connectionpool %s closing channel %d after %s idle", cp.Config.ConnectionName, chanHost.ID, cp.maxChannelIdle)
+		cp.closeCachedChannel(chanHost)
+	}
+}
+
+// overChannelLimit reserves the removal of one cached channel, returning true, while there are more cached
+// channels than the channel limit.
+func (cp *ConnectionPool) overChannelLimit() bool {
+
+	for {
+		count := atomic.LoadUint64(&cp.channelCount)
+		if count <= atomic.LoadUint64(&cp.channelLimit) {
+			return false
+		}
+
+		if atomic.CompareAndSwapUint64(&cp.channelCount, count, count-1) {
+			return true
+		}
+	}
+}
+
+// retireChannel closes a cached channel already removed from the channel count by overChannelLimit.
+func (cp *ConnectionPool) retireChannel(chanHost *ChannelHost) {
+
+	cp.logger.Debug("connectionpool %s closing channel %d over MaxCacheChannelCount", cp.Config.ConnectionName, chanHost.ID)
+	cp.closeCachedChannel(chanHost)
+}
+
+// dropChannel closes a cached channel the broker refused to recover, removing it from the channel count.
+func (cp *ConnectionPool) dropChannel(chanHost *ChannelHost) {
+
+	cp.logger.Debug("connectionpool %s dropping channel %d", cp.Config.ConnectionName, chanHost.ID)
+	atomic.AddUint64(&cp.channelCount, ^uint64(0))
+	cp.closeCachedChannel(chanHost)
+}
+
+// closeCachedChannel forgets and closes a cached channel already removed from the channel count.
+func (cp *ConnectionPool) closeCachedChannel(chanHost *ChannelHost) {
+
+	atomic.AddUint64(&chanHost.connHost.CachedChannelCount, ^uint64(0))
+	cp.slowChannels.forget(chanHost)
+	cp.poolRWLock.Lock()
+	delete(cp.cachedChannels, chanHost.ID)
+	cp.poolRWLock.Unlock()
+
+	go func(*ChannelHost) {
+		defer func() { _ = recover() }()
+
+		chanHost.Close()
+	}(chanHost)
+}
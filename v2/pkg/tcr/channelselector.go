@@ -0,0 +1,139 @@
+package tcr
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// ChannelSelectionRoundRobin hands out cached channels in the order they were returned.
+	ChannelSelectionRoundRobin = "round-robin"
+
+	// ChannelSelectionLeastErrors hands out cached channels weighted away from connections with recent errors.
+	ChannelSelectionLeastErrors = "least-errors"
+
+	defaultSelectorErrorWindow = 5 * time.Minute
+)
+
+// ChannelSelector picks which of the idle cached channels GetChannelFromPool hands out next, returning its index.
+// It is only asked when there is more than one to choose from.
+type ChannelSelector interface {
+	SelectChannel(idle []*ChannelHost) int
+}
+
+// LeastErrorsSelector favors channels whose connections have been healthy. Each channel is picked with a weight
+// of 1/(1+errors)², counting its connection's errors within ErrorWindow, so traffic shifts away from a flapping
+// connection without starving it. Channels of a connection the broker is blocking are only picked when all are.
+type LeastErrorsSelector struct {
+	ErrorWindow time.Duration // defaults to 5 minutes
+}
+
+// SelectChannel picks an idle channel, weighted by the recent errors of its connection.
+func (selector *LeastErrorsSelector) SelectChannel(idle []*ChannelHost) int {
+
+	window := selector.ErrorWindow
+	if window <= 0 {
+		window = defaultSelectorErrorWindow
+	}
+	since := time.Now().Add(-window)
+
+	weights := make([]float64, len(idle))
+	var total float64
+	for i, chanHost := range idle {
+		weights[i] = channelWeight(chanHost.ConnectionHost(), since)
+		total += weights[i]
+	}
+
+	if total == 0 { // every connection is blocked
+		return rand.Intn(len(idle))
+	}
+
+	pick := rand.Float64() * total
+	for i, weight := range weights {
+		if pick < weight {
+			return i
+		}
+		pick -= weight
+	}
+
+	return len(idle) - 1
+}
+
+// channelWeight is the selection weight of a channel on the connection, zero while the connection is blocked.
+func channelWeight(connHost *ConnectionHost, since time.Time) float64 {
+
+	if connHost == nil {
+		return 1
+	}
+
+	if connHost.Blocked() {
+		return 0
+	}
+
+	var errors float64
+	for _, connErr := range connHost.RecentErrors() {
+		if connErr.At.After(since) {
+			errors++
+		}
+	}
+
+	return 1 / ((1 + errors) * (1 + errors))
+}
+
+// channelSelector creates the pool's ChannelSelector, nil for round robin.
+func channelSelector(injected ChannelSelector, selection string) (ChannelSelector, error) {
+
+	if injected != nil {
+		return injected, nil
+	}
+
+	switch selection {
+	case "", ChannelSelectionRoundRobin:
+		return nil, nil
+	case ChannelSelectionLeastErrors:
+		return &LeastErrorsSelector{}, nil
+	default:
+		return nil, fmt.Errorf("unknown channel selection %q", selection)
+	}
+}
+
+// selectIdleChannel takes the ChannelSelector's pick of the idle cached channels, putting the others back.
+// Returns nil when there is no ChannelSelector or no idle channel.
+func (cp *ConnectionPool) selectIdleChannel() *ChannelHost {
+
+	if cp.selector == nil {
+		return nil
+	}
+
+	idle := make([]*ChannelHost, 0, len(cp.channels))
+IdleLoop:
+	for i := len(cp.channels); i > 0; i-- {
+		select {
+		case chanHost := <-cp.channels:
+			idle = append(idle, chanHost)
+		default:
+			break IdleLoop
+		}
+	}
+
+	if len(idle) == 0 {
+		return nil
+	}
+
+	pick := 0
+	if len(idle) > 1 {
+		pick = cp.selector.SelectChannel(idle)
+		if pick < 0 || pick >= len(idle) {
+			pick = 0
+		}
+	}
+
+	for i, chanHost := range idle {
+		if i != pick {
+			cp.channels <- chanHost // keeps its cachedAt
+		}
+	}
+
+	return idle[pick]
+}
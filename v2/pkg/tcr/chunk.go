@@ -0,0 +1,212 @@
+package tcr
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const (
+	// HeaderChunkID identifies the chunks of one chunked message.
+	HeaderChunkID = "x-chunk-id"
+
+	// HeaderChunkIndex is a chunk's zero based position in its message.
+	HeaderChunkIndex = "x-chunk-index"
+
+	// HeaderChunkCount is the number of chunks in the message.
+	HeaderChunkCount = "x-chunk-count"
+)
+
+// splitLetter splits a letter whose body is larger than chunkSize into chunk letters, published in order.
+// Each chunk carries the letter's properties and headers plus the chunk headers. Smaller letters are returned as is.
+func splitLetter(letter *Letter, chunkSize int) []*Letter {
+
+	if chunkSize <= 0 || len(letter.Body) <= chunkSize {
+		return []*Letter{letter}
+	}
+
+	chunkID := newChunkID(letter.LetterID)
+	count := (len(letter.Body) + chunkSize - 1) / chunkSize
+
+	chunks := make([]*Letter, count)
+	for i := range chunks {
+		end := (i + 1) * chunkSize
+		if end > len(letter.Body) {
+			end = len(letter.Body)
+		}
+
+		envelope := *letter.Envelope
+		envelope.Headers = make(amqp.Table, len(letter.Envelope.Headers)+3)
+		for key, value := range letter.Envelope.Headers {
+			envelope.Headers[key] = value
+		}
+		envelope.Headers[HeaderChunkID] = chunkID
+		envelope.Headers[HeaderChunkIndex] = int32(i)
+		envelope.Headers[HeaderChunkCount] = int32(count)
+
+		chunks[i] = &Letter{
+			LetterID:   letter.LetterID,
+			RetryCount: letter.RetryCount,
+			Body:       letter.Body[i*chunkSize : end],
+			Envelope:   &envelope,
+		}
+	}
+
+	return chunks
+}
+
+func newChunkID(letterID uint64) string {
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%d-%d", time.Now().UnixNano(), letterID)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// chunkSet is a chunked message being reassembled.
+type chunkSet struct {
+	parts        [][]byte
+	received     int
+	deliveryTags []uint64
+	acknowledger amqp.Acknowledger
+	started      time.Time
+	redelivered  bool // every chunk held was redelivered, they timed out before
+}
+
+// chunkAssembler reassembles chunked deliveries for a Consumer. It is only used by the consume loop.
+type chunkAssembler struct {
+	timeout time.Duration
+	sets    map[string]*chunkSet
+}
+
+func newChunkAssembler(timeoutSeconds uint32) *chunkAssembler {
+
+	if timeoutSeconds == 0 {
+		timeoutSeconds = 60
+	}
+
+	return &chunkAssembler{
+		timeout: time.Duration(timeoutSeconds) * time.Second,
+		sets:    make(map[string]*chunkSet),
+	}
+}
+
+// add records a chunk. When it completes its message, the reassembled delivery is returned along with the
+// delivery tags of the earlier chunks, which must be settled with it. Otherwise the delivery is nil.
+func (ca *chunkAssembler) add(delivery *amqp.Delivery, acknowledger amqp.Acknowledger) (*amqp.Delivery, []uint64, error) {
+
+	chunkID, _ := delivery.Headers[HeaderChunkID].(string)
+	index, indexOk := headerInt(delivery.Headers[HeaderChunkIndex])
+	count, countOk := headerInt(delivery.Headers[HeaderChunkCount])
+	if chunkID == "" || !indexOk || !countOk || count < 1 || index < 0 || index >= count {
+		return nil, nil, fmt.Errorf("malformed chunk headers on delivery %d", delivery.DeliveryTag)
+	}
+
+	set, ok := ca.sets[chunkID]
+	if ok && set.acknowledger != acknowledger {
+		ok = false // the channel was replaced, its unacked chunks are being redelivered
+	}
+
+	if !ok {
+		set = &chunkSet{parts: make([][]byte, count), acknowledger: acknowledger, started: time.Now(), redelivered: true}
+		ca.sets[chunkID] = set
+	}
+	set.redelivered = set.redelivered && delivery.Redelivered
+
+	if len(set.parts) != count {
+		return nil, nil, fmt.Errorf("chunk %d of %s has count %d, expected %d", index, chunkID, count, len(set.parts))
+	}
+
+	if set.parts[index] == nil {
+		set.received++
+	}
+	set.parts[index] = delivery.Body
+
+	if set.received < count {
+		set.deliveryTags = append(set.deliveryTags, delivery.DeliveryTag)
+		return nil, nil, nil
+	}
+
+	delete(ca.sets, chunkID)
+
+	assembled := *delivery
+	assembled.Body = bytes.Join(set.parts, nil)
+	assembled.Headers = make(amqp.Table, len(delivery.Headers))
+	for key, value := range delivery.Headers {
+		switch key {
+		case HeaderChunkID, HeaderChunkIndex, HeaderChunkCount:
+		default:
+			assembled.Headers[key] = value
+		}
+	}
+
+	return &assembled, set.deliveryTags, nil
+}
+
+// pending reports whether chunks of the message are already held.
+func (ca *chunkAssembler) pending(chunkID string) bool {
+
+	_, ok := ca.sets[chunkID]
+	return ok
+}
+
+// expire removes and returns, by chunk ID, the messages whose chunks didn't all arrive within the timeout.
+func (ca *chunkAssembler) expire() map[string]*chunkSet {
+
+	if len(ca.sets) == 0 {
+		return nil
+	}
+
+	var expired map[string]*chunkSet
+	for chunkID, set := range ca.sets {
+		if time.Since(set.started) < ca.timeout {
+			continue
+		}
+
+		if expired == nil {
+			expired = make(map[string]*chunkSet)
+		}
+
+		expired[chunkID] = set
+		delete(ca.sets, chunkID)
+	}
+
+	return expired
+}
+
+// isChunk reports whether the delivery is one chunk of a chunked message.
+func isChunk(delivery *amqp.Delivery) bool {
+
+	_, ok := delivery.Headers[HeaderChunkID]
+	return ok
+}
+
+func headerInt(value interface{}) (int, bool) {
+
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case uint16:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	}
+
+	return 0, false
+}
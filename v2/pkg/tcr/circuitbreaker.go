@@ -0,0 +1,199 @@
+package tcr
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned (or sent in a PublishReceipt) when the broker circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// errConfirmationTimeout counts a missing publish confirmation as a circuit breaker failure.
+var errConfirmationTimeout = errors.New("publish confirmation timed out")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed allows all operations.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen fails all operations fast until the open interval elapses.
+	CircuitOpen
+
+	// CircuitHalfOpen allows a limited number of probe operations to test the broker.
+	CircuitHalfOpen
+)
+
+// String allows you to quickly log the CircuitState.
+func (cs CircuitState) String() string {
+
+	switch cs {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// CircuitBreaker stops broker operations after consecutive failures, then probes before resuming.
+type CircuitBreaker struct {
+	failureThreshold uint32
+	openDuration     time.Duration
+	halfOpenProbes   uint32
+	state            CircuitState
+	failures         uint32
+	probes           uint32
+	successes        uint32
+	openedAt         time.Time
+	onStateChange    func(from, to CircuitState)
+	breakerLock      *sync.Mutex
+}
+
+// NewCircuitBreaker creates a CircuitBreaker from config. Returns nil when not enabled.
+func NewCircuitBreaker(config *CircuitBreakerConfig) *CircuitBreaker {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	cb := &CircuitBreaker{
+		failureThreshold: config.FailureThreshold,
+		openDuration:     time.Duration(config.OpenInterval) * time.Millisecond,
+		halfOpenProbes:   config.HalfOpenProbes,
+		state:            CircuitClosed,
+		breakerLock:      &sync.Mutex{},
+	}
+
+	if cb.failureThreshold == 0 {
+		cb.failureThreshold = 5
+	}
+
+	if cb.openDuration == 0 {
+		cb.openDuration = 30 * time.Second
+	}
+
+	if cb.halfOpenProbes == 0 {
+		cb.halfOpenProbes = 1
+	}
+
+	return cb
+}
+
+// State is the current CircuitState.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.breakerLock.Lock()
+	defer cb.breakerLock.Unlock()
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.openDuration {
+		return CircuitHalfOpen
+	}
+
+	return cb.state
+}
+
+// Allow returns ErrCircuitOpen when the operation should fail fast. Every allowed operation must be
+// followed by RecordSuccess or RecordFailure.
+func (cb *CircuitBreaker) Allow() error {
+	cb.breakerLock.Lock()
+	defer cb.breakerLock.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.openDuration {
+			return ErrCircuitOpen
+		}
+
+		cb.transition(CircuitHalfOpen)
+		fallthrough
+
+	case CircuitHalfOpen:
+		if cb.probes >= cb.halfOpenProbes {
+			return ErrCircuitOpen
+		}
+
+		cb.probes++
+	}
+
+	return nil
+}
+
+// RecordSuccess closes a half-open circuit once every probe has succeeded.
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.breakerLock.Lock()
+	defer cb.breakerLock.Unlock()
+
+	switch cb.state {
+	case CircuitClosed:
+		cb.failures = 0
+	case CircuitHalfOpen:
+		cb.successes++
+		if cb.successes >= cb.halfOpenProbes {
+			cb.transition(CircuitClosed)
+		}
+	}
+}
+
+// RecordFailure opens the circuit after FailureThreshold consecutive failures, or on any failed probe.
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.breakerLock.Lock()
+	defer cb.breakerLock.Unlock()
+
+	switch cb.state {
+	case CircuitClosed:
+		cb.failures++
+		if cb.failures >= cb.failureThreshold {
+			cb.transition(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		cb.transition(CircuitOpen)
+	}
+}
+
+// Record calls RecordSuccess or RecordFailure based on err.
+func (cb *CircuitBreaker) Record(err error) {
+
+	if err != nil {
+		cb.RecordFailure()
+		return
+	}
+
+	cb.RecordSuccess()
+}
+
+// retryAfter is how long to wait before an operation may be allowed again.
+func (cb *CircuitBreaker) retryAfter() time.Duration {
+	cb.breakerLock.Lock()
+	defer cb.breakerLock.Unlock()
+
+	if cb.state == CircuitOpen {
+		if remaining := cb.openDuration - time.Since(cb.openedAt); remaining > 0 {
+			return remaining
+		}
+	}
+
+	return 100 * time.Millisecond // waiting on half-open probes
+}
+
+// transition changes state, resetting counters. Must hold breakerLock.
+func (cb *CircuitBreaker) transition(state CircuitState) {
+
+	from := cb.state
+	cb.state = state
+	cb.failures = 0
+	cb.probes = 0
+	cb.successes = 0
+
+	if state == CircuitOpen {
+		cb.openedAt = time.Now()
+	}
+
+	if cb.onStateChange != nil && from != state {
+		cb.onStateChange(from, state)
+	}
+}
@@ -0,0 +1,140 @@
+package tcr
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// ContentTypeJSON identifies the JSONCodec.
+	ContentTypeJSON = "application/json"
+
+	// ContentTypeProtobuf identifies the ProtobufCodec.
+	ContentTypeProtobuf = "application/x-protobuf"
+
+	// ContentTypeMsgPack identifies the MsgPackCodec.
+	ContentTypeMsgPack = "application/msgpack"
+)
+
+// Codec serializes and deserializes message bodies for a specific content type.
+type Codec interface {
+	ContentType() string
+	Marshal(input interface{}) ([]byte, error)
+	Unmarshal(data []byte, output interface{}) error
+}
+
+var (
+	codecs = map[string]Codec{
+		ContentTypeJSON:     JSONCodec{},
+		ContentTypeProtobuf: ProtobufCodec{},
+		ContentTypeMsgPack:  MsgPackCodec{},
+	}
+	codecsRWLock = &sync.RWMutex{}
+)
+
+// RegisterCodec makes the Codec available under a content type, so ReceivedMessage.Decode picks it for messages
+// with that ContentType. Registering a content type again replaces its Codec, the built-in ones included.
+// Publish with CreateEncodedLetter, which sets the letter's ContentType to codec.ContentType().
+func RegisterCodec(contentType string, codec Codec) {
+	codecsRWLock.Lock()
+	defer codecsRWLock.Unlock()
+
+	codecs[normalizeContentType(contentType)] = codec
+}
+
+// GetCodec finds the Codec for a content type (parameters such as charset are ignored).
+// An empty content type is treated as JSON.
+func GetCodec(contentType string) (Codec, error) {
+
+	contentType = normalizeContentType(contentType)
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+
+	codecsRWLock.RLock()
+	codec, ok := codecs[contentType]
+	codecsRWLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no codec found for content type %q", contentType)
+	}
+
+	return codec, nil
+}
+
+// normalizeContentType drops parameters such as charset and lowercases the content type.
+func normalizeContentType(contentType string) string {
+
+	if index := strings.Index(contentType, ";"); index > -1 {
+		contentType = contentType[:index]
+	}
+
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// JSONCodec encodes with JSON.
+type JSONCodec struct{}
+
+// ContentType is application/json.
+func (JSONCodec) ContentType() string { return ContentTypeJSON }
+
+// Marshal encodes input as JSON.
+func (JSONCodec) Marshal(input interface{}) ([]byte, error) {
+	var json = jsoniter.ConfigFastest
+	return json.Marshal(input)
+}
+
+// Unmarshal decodes JSON into output.
+func (JSONCodec) Unmarshal(data []byte, output interface{}) error {
+	var json = jsoniter.ConfigFastest
+	return json.Unmarshal(data, output)
+}
+
+// ProtobufCodec encodes with Protocol Buffers. Values must implement proto.Message.
+type ProtobufCodec struct{}
+
+// ContentType is application/x-protobuf.
+func (ProtobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+// Marshal encodes input, a proto.Message, as protobuf.
+func (ProtobufCodec) Marshal(input interface{}) ([]byte, error) {
+
+	message, ok := input.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("can't protobuf encode %T, it is not a proto.Message", input)
+	}
+
+	return proto.Marshal(message)
+}
+
+// Unmarshal decodes protobuf into output, a proto.Message.
+func (ProtobufCodec) Unmarshal(data []byte, output interface{}) error {
+
+	message, ok := output.(proto.Message)
+	if !ok {
+		return fmt.Errorf("can't protobuf decode into %T, it is not a proto.Message", output)
+	}
+
+	return proto.Unmarshal(data, message)
+}
+
+// MsgPackCodec encodes with MessagePack.
+type MsgPackCodec struct{}
+
+// ContentType is application/msgpack.
+func (MsgPackCodec) ContentType() string { return ContentTypeMsgPack }
+
+// Marshal encodes input as MessagePack.
+func (MsgPackCodec) Marshal(input interface{}) ([]byte, error) {
+	return msgpack.Marshal(input)
+}
+
+// Unmarshal decodes MessagePack into output.
+func (MsgPackCodec) Unmarshal(data []byte, output interface{}) error {
+	return msgpack.Unmarshal(data, output)
+}
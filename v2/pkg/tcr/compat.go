@@ -0,0 +1,152 @@
+package tcr
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// ChannelPool keeps v1 code that used pools.ChannelPool compiling on top of a v2 ConnectionPool, so callers
+// can migrate one call site at a time. Every channel is a cached, ackable ChannelHost of the ConnectionPool.
+//
+// Deprecated: use ConnectionPool.GetChannelFromPool (or GetChannelFromPoolContext) and ConnectionPool.ReturnChannel.
+type ChannelPool struct {
+	ConnectionPool *ConnectionPool // nil until initialized
+	config         *PoolConfig
+	initLock       *sync.Mutex
+}
+
+// NewChannelPool wraps connPool, like the v1 constructor. When connPool is nil one is created from config, right
+// away with initializeNow, otherwise by Initialize or the first GetChannel.
+//
+// Deprecated: use NewConnectionPool.
+func NewChannelPool(config *PoolConfig, connPool *ConnectionPool, initializeNow bool) (*ChannelPool, error) {
+
+	if connPool == nil && config == nil {
+		return nil, errors.New("channelpool requires a config or a connectionpool")
+	}
+
+	cp := &ChannelPool{
+		ConnectionPool: connPool,
+		config:         config,
+		initLock:       &sync.Mutex{},
+	}
+
+	if connPool == nil && initializeNow {
+		if err := cp.Initialize(); err != nil {
+			return nil, err
+		}
+	}
+
+	return cp, nil
+}
+
+// Initialize creates the ConnectionPool from the config, and is safe to call concurrently and repeatedly: callers
+// wait on the one creating it and share its result, and once it is ready every call returns nil. A failure is
+// returned to the callers waiting on it, and the next call tries again. After Shutdown, Initialize creates a new
+// ConnectionPool, unless the ChannelPool wraps one it didn't create, which returns ErrPoolClosed.
+//
+// Deprecated: use NewConnectionPool.
+func (cp *ChannelPool) Initialize() error {
+	cp.initLock.Lock()
+	defer cp.initLock.Unlock()
+
+	if cp.ConnectionPool != nil && !cp.ConnectionPool.closed() {
+		return nil
+	}
+
+	if cp.config == nil {
+		return ErrPoolClosed
+	}
+
+	connPool, err := NewConnectionPool(cp.config)
+	if err != nil {
+		return err
+	}
+
+	cp.ConnectionPool = connPool
+	return nil
+}
+
+// pool is the ConnectionPool, nil until initialized.
+func (cp *ChannelPool) pool() *ConnectionPool {
+	cp.initLock.Lock()
+	defer cp.initLock.Unlock()
+
+	return cp.ConnectionPool
+}
+
+// GetChannel gets a cached channel from the ConnectionPool, blocking until one is available. The ConnectionPool is
+// initialized first if it hasn't been, returning the error when that fails.
+//
+// Deprecated: use ConnectionPool.GetChannelFromPool.
+func (cp *ChannelPool) GetChannel() (*ChannelHost, error) {
+
+	connPool := cp.pool()
+	if connPool == nil {
+		if err := cp.Initialize(); err != nil {
+			return nil, err
+		}
+		connPool = cp.pool()
+	}
+
+	if connPool.State() != PoolReady {
+		return nil, ErrPoolClosed
+	}
+
+	return connPool.getChannel()
+}
+
+// GetAckableChannel is GetChannel, cached channels in v2 are always ackable.
+//
+// Deprecated: use ConnectionPool.GetChannelFromPool.
+func (cp *ChannelPool) GetAckableChannel() (*ChannelHost, error) {
+	return cp.GetChannel()
+}
+
+// GetTransientChannel opens a channel outside the cached ones, for one-off work like changing topology or
+// inspecting a queue without holding up a cached channel. It isn't counted in the pool's channels and the caller
+// must Close it. The ConnectionPool is initialized first if it hasn't been, returning the error when that fails.
+//
+// Deprecated: use ConnectionPool.GetTransientChannel.
+func (cp *ChannelPool) GetTransientChannel(ackable bool) (*amqp.Channel, error) {
+
+	connPool := cp.pool()
+	if connPool == nil {
+		if err := cp.Initialize(); err != nil {
+			return nil, err
+		}
+		connPool = cp.pool()
+	}
+
+	return connPool.createTransientChannel(ackable, false)
+}
+
+// ReturnChannel returns the channel to the ConnectionPool, rebuilding it when flagged. Without a ConnectionPool,
+// never initialized, there is no cache to return it to and the channel is closed.
+//
+// Deprecated: use ConnectionPool.ReturnChannel.
+func (cp *ChannelPool) ReturnChannel(chanHost *ChannelHost, flagChannel bool) {
+
+	if chanHost == nil {
+		return
+	}
+
+	if connPool := cp.pool(); connPool != nil {
+		connPool.ReturnChannel(chanHost, flagChannel)
+		return
+	}
+
+	chanHost.Close()
+}
+
+// Shutdown shuts down the underlying ConnectionPool, if it was initialized.
+//
+// Deprecated: use ConnectionPool.Shutdown.
+func (cp *ChannelPool) Shutdown() {
+
+	if connPool := cp.pool(); connPool != nil {
+		connPool.Shutdown()
+	}
+}
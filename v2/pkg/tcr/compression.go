@@ -3,12 +3,162 @@ package tcr
 import (
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
+	"sync"
 
 	"github.com/klauspost/compress/zstd"
 )
 
+const (
+	// HeaderAcceptEncoding lists the compression types a consumer accepts, comma separated in order of preference.
+	// Consumers advertise it on the messages they send (requests, for example) and the RabbitService honors it
+	// when the header is passed along with a publish.
+	HeaderAcceptEncoding = "x-accept-encoding"
+
+	// IdentityEncoding in an accepted encodings list asks for payloads to be left uncompressed.
+	IdentityEncoding = "identity"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Compressor compresses and decompresses payloads for a compression type.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	compressors = map[string]Compressor{
+		GzipCompressionType: GzipCompressor{},
+		ZstdCompressionType: ZstdCompressor{},
+	}
+	compressorsRWLock = &sync.RWMutex{}
+)
+
+// RegisterCompressor makes the Compressor available as a compression type, for CompressionConfig.Type and
+// HeaderAcceptEncoding. Payloads it compresses are published with the name as their ContentEncoding, which
+// ReadEncodedPayload decompresses by. Registering a name again replaces its Compressor, gzip and zstd included.
+func RegisterCompressor(name string, compressor Compressor) {
+	compressorsRWLock.Lock()
+	defer compressorsRWLock.Unlock()
+
+	compressors[strings.ToLower(strings.TrimSpace(name))] = compressor
+}
+
+// GetCompressor finds the Compressor registered for a compression type.
+func GetCompressor(name string) (Compressor, error) {
+	compressorsRWLock.RLock()
+	defer compressorsRWLock.RUnlock()
+
+	compressor, ok := compressors[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("no compressor registered for %q", name)
+	}
+
+	return compressor, nil
+}
+
+// SelectCompression picks the compression type for a payload of size bytes. Returns "" when the payload should
+// not be compressed: compression isn't enabled, the payload is smaller than MinCompressSize, or nothing in
+// acceptEncoding (a HeaderAcceptEncoding value) is registered. An empty acceptEncoding uses the configured Type,
+// gzip when it isn't registered.
+func SelectCompression(compression *CompressionConfig, size int, acceptEncoding string) string {
+
+	if compression == nil || !compression.Enabled || size < compression.MinCompressSize {
+		return ""
+	}
+
+	if strings.TrimSpace(acceptEncoding) == "" {
+		if _, err := GetCompressor(compression.Type); err == nil {
+			return strings.ToLower(strings.TrimSpace(compression.Type))
+		}
+		return GzipCompressionType
+	}
+
+	for _, encoding := range strings.Split(acceptEncoding, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == IdentityEncoding {
+			return ""
+		}
+
+		if _, err := GetCompressor(encoding); err == nil {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+// GzipCompressor is the Compressor of GzipCompressionType.
+type GzipCompressor struct{}
+
+// Compress compresses data with gzip.
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+
+	buffer := &bytes.Buffer{}
+	if err := CompressWithGzip(data, buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Decompress decompresses gzip data.
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+
+	buffer := bytes.NewBuffer(data)
+	if err := DecompressWithGzip(buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// ZstdCompressor is the Compressor of ZstdCompressionType.
+type ZstdCompressor struct{}
+
+// Compress compresses data with zstd.
+func (ZstdCompressor) Compress(data []byte) ([]byte, error) {
+
+	buffer := &bytes.Buffer{}
+	if err := CompressWithZstd(data, buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Decompress decompresses zstd data.
+func (ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+
+	buffer := bytes.NewBuffer(data)
+	if err := DecompressWithZstd(buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// DetectCompression identifies gzip or zstd compressed data by its magic number. Returns "" for anything else,
+// like the JSON of an uncompressed payload.
+func DetectCompression(data []byte) string {
+
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return GzipCompressionType
+	case bytes.HasPrefix(data, zstdMagic):
+		return ZstdCompressionType
+	default:
+		return ""
+	}
+}
+
 // CompressWithZstd uses an external dependency for Zstd to compress data and places data in the supplied buffer.
 func CompressWithZstd(data []byte, buffer *bytes.Buffer) error {
 
@@ -2,23 +2,62 @@ package tcr
 
 // RabbitSeasoning represents the configuration values.
 type RabbitSeasoning struct {
-	EncryptionConfig  *EncryptionConfig          `json:"EncryptionConfig"`
-	CompressionConfig *CompressionConfig         `json:"CompressionConfig"`
-	PoolConfig        *PoolConfig                `json:"PoolConfig"`
-	ConsumerConfigs   map[string]*ConsumerConfig `json:"ConsumerConfigs"`
-	PublisherConfig   *PublisherConfig           `json:"PublisherConfig"`
+	Profile           string                         `json:"Profile"` // the profile applied when loaded from a file, or the file's default profile
+	ServiceConfig     *ServiceConfig                 `json:"ServiceConfig"`
+	EncryptionConfig  *EncryptionConfig              `json:"EncryptionConfig"`
+	CompressionConfig *CompressionConfig             `json:"CompressionConfig"`
+	PoolConfig        *PoolConfig                    `json:"PoolConfig"`
+	ConsumerConfigs   map[string]*ConsumerConfig     `json:"ConsumerConfigs"`
+	PublisherConfig   *PublisherConfig               `json:"PublisherConfig"`
+	OutboxConfig      *OutboxConfig                  `json:"OutboxConfig"`
+	NamingConfig      *NamingConfig                  `json:"NamingConfig"`
+	TopologyConfig    *TopologyConfig                `json:"TopologyConfig"` // optional, built by NewRabbitService
+	BrokerTargets     map[string]*BrokerTargetConfig `json:"BrokerTargets"`  // optional further vhosts or clusters, by name
+}
+
+// BrokerTargetConfig represents settings for an additional named broker (a vhost or cluster) of a RabbitService.
+type BrokerTargetConfig struct {
+	PoolConfig      *PoolConfig      `json:"PoolConfig"`
+	PublisherConfig *PublisherConfig `json:"PublisherConfig"` // optional, defaults to the RabbitSeasoning's PublisherConfig
+}
+
+// ServiceConfig represents settings for creating RabbitServices.
+type ServiceConfig struct {
+	ErrorBuffer uint32 `json:"ErrorBuffer"` // capacity of CentralErr, oldest errors are dropped when full (default 1000)
 }
 
 // PoolConfig represents settings for creating/configuring pools.
 type PoolConfig struct {
-	ConnectionName       string     `json:"ConnectionName"`
-	URI                  string     `json:"URI"`
-	Heartbeat            uint32     `json:"Heartbeat"`
-	ConnectionTimeout    uint32     `json:"ConnectionTimeout"`
-	SleepOnErrorInterval uint32     `json:"SleepOnErrorInterval"` // sleep length on errors
-	MaxConnectionCount   uint64     `json:"MaxConnectionCount"`   // number of connections to create in the pool
-	MaxCacheChannelCount uint64     `json:"MaxCacheChannelCount"` // number of channels to be cached in the pool
-	TLSConfig            *TLSConfig `json:"TLSConfig"`            // TLS settings for connection with AMQPS.
+	ConnectionName        string                 `json:"ConnectionName"`
+	URI                   string                 `json:"URI"`
+	URIs                  []string               `json:"URIs"`             // optional cluster URIs in order of preference, URI is used when empty
+	FailbackInterval      uint32                 `json:"FailbackInterval"` // seconds between attempts to move back to the first of URIs, 0 disables
+	ClientProperties      map[string]interface{} `json:"ClientProperties"` // optional flat properties shown per connection in the management UI
+	Heartbeat             uint32                 `json:"Heartbeat"`
+	ConnectionTimeout     uint32                 `json:"ConnectionTimeout"`
+	SleepOnErrorInterval  uint32                 `json:"SleepOnErrorInterval"`  // sleep length on errors
+	MaxConnectionCount    uint64                 `json:"MaxConnectionCount"`    // number of connections to create in the pool
+	MaxCacheChannelCount  uint64                 `json:"MaxCacheChannelCount"`  // number of channels to be cached in the pool, 0 for transient channels only
+	LazyChannels          bool                   `json:"LazyChannels"`          // create cached channels on first demand instead of at startup
+	MaxChannelIdleTime    uint32                 `json:"MaxChannelIdleTime"`    // seconds a cached channel may sit unused before it is closed, 0 disables
+	MaxConnectionLifetime uint32                 `json:"MaxConnectionLifetime"` // seconds before a connection is gracefully replaced, 0 disables
+	RecycleGracePeriod    uint32                 `json:"RecycleGracePeriod"`    // seconds channels get to move off a recycled connection before it closes, defaults to 30
+	MinChannelCount       uint64                 `json:"MinChannelCount"`       // cached channels kept open regardless of MaxChannelIdleTime
+	MinReady              uint64                 `json:"MinReady"`              // cached channels WaitForReady requires, defaults to MinChannelCount or 1
+	TLSConfig             *TLSConfig             `json:"TLSConfig"`             // TLS settings for connection with AMQPS.
+	WebhookConfig         *WebhookConfig         `json:"WebhookConfig"`         // optional webhook notifications on connection events.
+	CircuitBreakerConfig  *CircuitBreakerConfig  `json:"CircuitBreakerConfig"`  // optional fail fast during prolonged outages.
+	SlowChannelConfig     *SlowChannelConfig     `json:"SlowChannelConfig"`     // optional replacement of cached channels publishing far slower than the rest
+	ChannelHooks          *ChannelHooks          `json:"-"`                     // optional cached channel telemetry callbacks
+	BackoffConfig         *BackoffConfig         `json:"BackoffConfig"`         // optional reconnect and channel retry delays, defaults to a constant SleepOnErrorInterval
+	DialConfig            *DialConfig            `json:"DialConfig"`            // optional retries of the initial dials, defaults to a single attempt
+	ExpvarNamespace       string                 `json:"ExpvarNamespace"`       // optional, publishes the pool's Counters via expvar under this name, by ConnectionName
+	ChannelSelection      string                 `json:"ChannelSelection"`      // "round-robin" (default) or "least-errors", how cached channels are handed out
+	ChannelSelector       ChannelSelector        `json:"-"`                     // optional, overrides ChannelSelection
+	Backoff               BackoffPolicy          `json:"-"`                     // optional, overrides BackoffConfig
+	FaultInjector         FaultInjector          `json:"-"`                     // optional failures on purpose, for resiliency tests only
+	Logger                Logger                 `json:"-"`                     // optional, defaults to NoOpLogger
+	OnLifecycle           func(*LifecycleEvent)  `json:"-"`                     // optional, called with every LifecycleEvent from initializing on
 }
 
 // TLSConfig represents settings for configuring TLS.
@@ -29,26 +68,225 @@ type TLSConfig struct {
 	CertServerName    string `json:"CertServerName"`
 }
 
+// CircuitBreakerConfig represents settings for failing fast on channel creation and publishes during broker outages.
+type CircuitBreakerConfig struct {
+	Enabled          bool   `json:"Enabled"`
+	FailureThreshold uint32 `json:"FailureThreshold"` // consecutive failures before opening, defaults to 5
+	OpenInterval     uint32 `json:"OpenInterval"`     // ms to stay open before probing, defaults to 30000
+	HalfOpenProbes   uint32 `json:"HalfOpenProbes"`   // successful probes required to close, defaults to 1
+}
+
+// SlowChannelConfig represents settings for finding cached channels whose publishes are far slower, or fail far
+// more, than the rest of the pool's, ex. on a half-dead TCP connection, and replacing them.
+type SlowChannelConfig struct {
+	Enabled         bool    `json:"Enabled"`
+	LatencyMultiple float64 `json:"LatencyMultiple"` // slow once a channel's p99 exceeds this multiple of the rest of the pool's median, defaults to 5
+	MinLatency      uint32  `json:"MinLatency"`      // ms a channel's p99 must exceed too before it's slow, defaults to 100
+	MaxErrorRate    float64 `json:"MaxErrorRate"`    // fraction of failed publishes that makes a channel slow regardless of latency, defaults to 0.5
+	WindowSize      uint32  `json:"WindowSize"`      // latest publishes of each channel the p99 and error rate cover, defaults to 100
+	MinSamples      uint32  `json:"MinSamples"`      // publishes a channel needs before it's judged, defaults to 20
+	CheckInterval   uint32  `json:"CheckInterval"`   // seconds between checks, defaults to 10
+}
+
+// WebhookConfig represents settings for POSTing pool events (connection lost/restored, pool degraded) to a webhook.
+type WebhookConfig struct {
+	Enabled          bool   `json:"Enabled"`
+	URL              string `json:"URL"`
+	Template         string `json:"Template"`         // "slack", "pagerduty", or "generic"
+	CustomTemplate   string `json:"CustomTemplate"`   // optional text/template, overrides Template
+	RoutingKey       string `json:"RoutingKey"`       // PagerDuty integration key
+	TimeoutInterval  uint32 `json:"TimeoutInterval"`  // http timeout in ms, defaults to 5000
+	CooldownInterval uint32 `json:"CooldownInterval"` // minimum ms between repeats of the same event
+}
+
 // ConsumerConfig represents settings for configuring a consumer with ease.
 type ConsumerConfig struct {
 	Enabled              bool                   `json:"Enabled"`
 	QueueName            string                 `json:"QueueName"`
+	QueueNames           []string               `json:"QueueNames"` // optional, more queues consumed along with QueueName into the same stream of messages
 	ConsumerName         string                 `json:"ConsumerName"`
 	AutoAck              bool                   `json:"AutoAck"`
 	Exclusive            bool                   `json:"Exclusive"`
 	NoWait               bool                   `json:"NoWait"`
 	Args                 map[string]interface{} `json:"Args"`
+	Priority             int32                  `json:"Priority"`             // x-priority, messages go to the highest priority consumers with room first, 0 leaves it unset
+	ConsumerTimeout      uint32                 `json:"ConsumerTimeout"`      // ms a delivery may go unacknowledged before the broker closes the channel (x-consumer-timeout), 0 uses the queue's or broker's
+	SingleActiveConsumer bool                   `json:"SingleActiveConsumer"` // the queue has x-single-active-consumer, so consumers past the first wait on standby and ConsumerGroups don't autoscale
 	QosCountOverride     int                    `json:"QosCountOverride"`     // if zero ignored
+	DedupHeader          string                 `json:"DedupHeader"`          // header used as the Deduper key, defaults to MessageId
+	Deduper              Deduper                `json:"-"`                    // optional, skips and acks already processed messages
+	RetryConfig          *RetryConfig           `json:"RetryConfig"`          // optional delayed retries for StartConsumingWithHandler
+	QuarantineConfig     *QuarantineConfig      `json:"QuarantineConfig"`     // optional, moves messages delivered too many times to a quarantine queue
+	StreamConfig         *StreamConfig          `json:"StreamConfig"`         // optional, consumes a stream queue from an offset
+	AutoScaleConfig      *AutoScaleConfig       `json:"AutoScaleConfig"`      // optional, ConsumerGroups add and remove members with the queue depth
+	OnPanic              string                 `json:"OnPanic"`              // "requeue" (default), "dead-letter", or "ack" the message when the handler panics
+	HandlerTimeout       uint32                 `json:"HandlerTimeout"`       // ms a handler gets per message before its ctx is cancelled and the message nacked, 0 waits forever
+	OnHandlerTimeout     string                 `json:"OnHandlerTimeout"`     // "requeue" (default) or "dead-letter" the message when the handler times out
+	AckBatchConfig       *AckBatchConfig        `json:"AckBatchConfig"`       // optional, sends acks as periodic multiple-acks
+	PrefetchByteBudget   uint64                 `json:"PrefetchByteBudget"`   // if set, prefetch is sized from average message size to hold at most this many unacked bytes (overrides QosCountOverride)
+	ErrorBuffer          uint32                 `json:"ErrorBuffer"`          // capacity of Errors(), oldest errors are dropped when full (default 1000)
+	ChunkTimeout         uint32                 `json:"ChunkTimeout"`         // seconds to wait for the rest of a chunked message before requeueing its chunks (rejecting them the second time), defaults to 60
 	SleepOnErrorInterval uint32                 `json:"SleepOnErrorInterval"` // sleep on error
 	SleepOnIdleInterval  uint32                 `json:"SleepOnIdleInterval"`  // sleep on idle
 }
 
+// RetryConfig represents settings for retrying failed handlers through delayed retry queues, then a parking lot queue.
+type RetryConfig struct {
+	Enabled                bool    `json:"Enabled"`
+	MaxAttempts            uint32  `json:"MaxAttempts"`            // retries before parking, defaults to 3
+	InitialDelay           uint32  `json:"InitialDelay"`           // milliseconds before the first retry, defaults to 1000
+	Multiplier             float64 `json:"Multiplier"`             // delay growth per attempt, defaults to 2
+	MaxDelay               uint32  `json:"MaxDelay"`               // milliseconds, caps the delay when set
+	ParkingLotQueue        string  `json:"ParkingLotQueue"`        // defaults to QueueName + ".parkinglot"
+	PublishTimeOutInterval uint32  `json:"PublishTimeOutInterval"` // milliseconds to wait for republish confirmations, defaults to 5000
+}
+
+// QuarantineConfig represents settings for moving poison messages, those delivered too many times, to a quarantine queue.
+type QuarantineConfig struct {
+	Enabled                bool   `json:"Enabled"`
+	MaxProcessAttempts     uint32 `json:"MaxProcessAttempts"`     // deliveries allowed before quarantining, defaults to 5
+	QueueName              string `json:"QueueName"`              // defaults to QueueName + ".quarantine"
+	PublishTimeOutInterval uint32 `json:"PublishTimeOutInterval"` // milliseconds to wait for the quarantine publish confirmation, defaults to 5000
+}
+
+// AutoScaleConfig represents settings for scaling a ConsumerGroup between MinConsumers and MaxConsumers with its queue's depth.
+type AutoScaleConfig struct {
+	Enabled             bool           `json:"Enabled"`
+	MinConsumers        uint32         `json:"MinConsumers"`        // defaults to 1
+	MaxConsumers        uint32         `json:"MaxConsumers"`        // defaults to MinConsumers
+	MessagesPerConsumer uint32         `json:"MessagesPerConsumer"` // backlog each member is expected to keep up with, defaults to 1000
+	PollInterval        uint32         `json:"PollInterval"`        // seconds between queue depth checks, defaults to 10
+	QueueDepth          QueueDepthFunc `json:"-"`                   // optional, like tcrmgmt's Client.QueueDepth, defaults to a passive queue declare
+}
+
+// QueueMonitorConfig represents settings for watching the message and consumer counts of queues.
+type QueueMonitorConfig struct {
+	PollInterval uint32            `json:"PollInterval"` // seconds between checks, defaults to 10
+	Queues       []*QueueThreshold `json:"Queues"`
+	QueueCounts  QueueCountsFunc   `json:"-"` // optional, like tcrmgmt's Client.QueueCounts, defaults to a passive queue declare
+}
+
+// QueueThreshold represents the limits a QueueMonitor watches a queue for. A zero limit isn't watched.
+type QueueThreshold struct {
+	QueueName    string `json:"QueueName"`
+	MaxMessages  uint32 `json:"MaxMessages"`  // a backlog is more messages than this
+	MinConsumers uint32 `json:"MinConsumers"` // too few consumers is fewer than this
+}
+
+// AckBatchConfig represents settings for holding back a consumer's acks and sending them as multiple-acks.
+type AckBatchConfig struct {
+	Enabled  bool   `json:"Enabled"`
+	Size     uint32 `json:"Size"`     // acks held back on a channel before they are sent, defaults to 100
+	Interval uint32 `json:"Interval"` // milliseconds between sends of fewer acks, defaults to 100
+}
+
+// StreamConfig represents settings for consuming a stream queue (x-queue-type stream) from an offset. Streams require AutoAck false.
+type StreamConfig struct {
+	Enabled bool   `json:"Enabled"`
+	Offset  string `json:"Offset"` // first, last, next (default), a numeric offset, an RFC3339 timestamp, or an interval like 7D or 12h
+}
+
 // PublisherConfig represents settings for configuring global settings for all Publishers with ease.
 type PublisherConfig struct {
-	AutoAck                bool   `json:"AutoAck"`
-	SleepOnIdleInterval    uint32 `json:"SleepOnIdleInterval"`
-	SleepOnErrorInterval   uint32 `json:"SleepOnErrorInterval"`
-	PublishTimeOutInterval uint32 `json:"PublishTimeOutInterval"`
+	AutoAck                bool                 `json:"AutoAck"`
+	SleepOnIdleInterval    uint32               `json:"SleepOnIdleInterval"`
+	SleepOnErrorInterval   uint32               `json:"SleepOnErrorInterval"`
+	PublishTimeOutInterval uint32               `json:"PublishTimeOutInterval"`
+	RateLimitConfig        *RateLimitConfig     `json:"RateLimitConfig"`     // optional publish rate limiting
+	StrictOrdering         bool                 `json:"StrictOrdering"`      // auto-publish one confirmed letter at a time on a single channel
+	OrderingShards         uint32               `json:"OrderingShards"`      // with StrictOrdering, spread routing keys over this many channels (at most half the pool), each key keeping its order
+	OrderByKey             bool                 `json:"OrderByKey"`          // direct publishes to an exchange and routing key wait for the one before to be confirmed
+	ChunkSize              uint32               `json:"ChunkSize"`           // bodies larger than this many bytes are published as chunks and reassembled by Consumers, zero disables
+	OnBlocked              string               `json:"OnBlocked"`           // "wait" holds or "fail" rejects publishes while the broker blocks the connection, empty publishes regardless
+	DisableStamping        bool                 `json:"DisableStamping"`     // don't fill in a MessageID, Timestamp, or the context's correlation ID on letters without them
+	BackoffConfig          *BackoffConfig       `json:"BackoffConfig"`       // optional publish retry delays, defaults to a constant SleepOnErrorInterval
+	EventBuffer            uint32               `json:"EventBuffer"`         // capacity of Events(), oldest events are dropped when full, 0 disables events
+	PublishBufferConfig    *PublishBufferConfig `json:"PublishBufferConfig"` // optional, buffers Publish calls in memory to absorb bursts
+	TTLPolicies            []*TTLPolicy         `json:"TTLPolicies"`         // optional, default expirations of letters without one, the first match applies
+	TraceConfig            *TraceConfig         `json:"TraceConfig"`         // optional, appends a hop to the x-trace header of every letter published
+	EnvelopeDefaults       *EnvelopeDefaults    `json:"EnvelopeDefaults"`    // optional, properties of letters published without their own
+	Backoff                BackoffPolicy        `json:"-"`                   // optional, overrides BackoffConfig
+	ReceiptSink            ReceiptSink          `json:"-"`                   // optional, called with the outcome of every publish
+}
+
+// EnvelopeDefaults represents the properties a Publisher gives letters published without their own, so every message
+// of a service is typed and persistent without each call remembering to. Empty fields set nothing.
+type EnvelopeDefaults struct {
+	ContentType     string `json:"ContentType"`     // ex. "application/json"
+	ContentEncoding string `json:"ContentEncoding"` // only when every body is encoded so, Consumers decompress with it
+	DeliveryMode    uint8  `json:"DeliveryMode"`    // 1 transient or 2 persistent
+	AppID           string `json:"AppID"`
+}
+
+// TraceConfig represents the hop a Publisher appends to the x-trace header of the letters it publishes.
+type TraceConfig struct {
+	Enabled bool   `json:"Enabled"`
+	Service string `json:"Service"` // recorded in each hop, defaults to the PoolConfig's ConnectionName
+	MaxHops uint32 `json:"MaxHops"` // the oldest hops are dropped past this many, defaults to 32
+}
+
+// TTLPolicy represents the default per-message TTL of letters published to an exchange with a matching routing key.
+type TTLPolicy struct {
+	Exchange   string `json:"Exchange"`   // "*" for every exchange, empty for the default exchange
+	RoutingKey string `json:"RoutingKey"` // topic style pattern, where * matches one word and # zero or more, empty matches all
+	Expiration uint32 `json:"Expiration"` // milliseconds, 0 exempts matching letters from the policies after it
+}
+
+// PublishBufferConfig represents settings for a bounded in-memory buffer in front of Publish.
+type PublishBufferConfig struct {
+	Size           uint32 `json:"Size"`           // letters held, 0 disables the buffer
+	OverflowPolicy string `json:"OverflowPolicy"` // "block" (default), "drop-new", or "drop-old" when full
+	Workers        uint32 `json:"Workers"`        // goroutines publishing from the buffer, defaults to 1 which keeps letters in order
+}
+
+// BackoffConfig represents settings for the delay between retries of a failing operation.
+type BackoffConfig struct {
+	Type            string  `json:"Type"`            // "constant" (default) or "exponential"
+	InitialInterval uint32  `json:"InitialInterval"` // milliseconds, the constant interval or the first exponential delay
+	Multiplier      float64 `json:"Multiplier"`      // exponential growth per retry, defaults to 2
+	MaxInterval     uint32  `json:"MaxInterval"`     // milliseconds, caps exponential delays when set
+	Jitter          float64 `json:"Jitter"`          // 0 to 1, randomly takes up to this fraction off each delay
+}
+
+// DialConfig represents settings for retrying the dials of a ConnectionPool's initialization.
+type DialConfig struct {
+	MaxAttempts   uint32         `json:"MaxAttempts"`   // dials per connection before initialization fails, defaults to 5
+	BackoffConfig *BackoffConfig `json:"BackoffConfig"` // delays between dials, defaults to exponential from 1s capped at 30s
+}
+
+// RateLimitConfig represents token bucket settings for limiting a Publisher. Zero rates are unlimited.
+type RateLimitConfig struct {
+	MessagesPerSecond float64 `json:"MessagesPerSecond"`
+	BytesPerSecond    uint64  `json:"BytesPerSecond"`
+	MessageBurst      uint32  `json:"MessageBurst"` // defaults to MessagesPerSecond
+	ByteBurst         uint64  `json:"ByteBurst"`    // defaults to BytesPerSecond
+	NonBlocking       bool    `json:"NonBlocking"`  // return ErrRateLimited instead of waiting
+}
+
+// OutboxConfig represents settings for persisting letters that fail to publish after retries and republishing them later.
+type OutboxConfig struct {
+	Enabled                bool   `json:"Enabled"`
+	FilePath               string `json:"FilePath"`               // BoltDB file, created if missing
+	BatchSize              uint32 `json:"BatchSize"`              // letters loaded per drain batch, defaults to 100
+	RetryAttempts          uint32 `json:"RetryAttempts"`          // requeues of a failed letter before it is persisted, defaults to 3
+	RepublishInterval      uint32 `json:"RepublishInterval"`      // ms between drain attempts, defaults to 5000
+	PublishTimeOutInterval uint32 `json:"PublishTimeOutInterval"` // ms to wait for each confirmation, defaults to 5000
+}
+
+// NamingConfig represents naming conventions enforced by the Topologer and Publisher.
+// Patterns are regular expressions or templates with {placeholder} tokens, empty patterns aren't checked.
+type NamingConfig struct {
+	Strict            bool   `json:"Strict"` // error on violations instead of logging a warning
+	ExchangePattern   string `json:"ExchangePattern"`
+	QueuePattern      string `json:"QueuePattern"`
+	RoutingKeyPattern string `json:"RoutingKeyPattern"`
+
+	// Prefix and Suffix decorate every exchange and queue name declared or used, so services sharing a broker
+	// (or a test run's ephemeral topology) don't collide. Both are templates, ex. "{env}.{service}.", filled in
+	// from Variables or else the environment variable of the same name.
+	Prefix    string            `json:"Prefix"`
+	Suffix    string            `json:"Suffix"`
+	Variables map[string]string `json:"Variables"`
 }
 
 // TopologyConfig allows you to build simple toplogies from a JSON file.
@@ -61,8 +299,9 @@ type TopologyConfig struct {
 
 // CompressionConfig allows you to configuration symmetric key encryption based on options
 type CompressionConfig struct {
-	Enabled bool   `json:"Enabled"`
-	Type    string `json:"Type,omitempty"`
+	Enabled         bool   `json:"Enabled"`
+	Type            string `json:"Type,omitempty"`
+	MinCompressSize int    `json:"MinCompressSize,omitempty"` // payloads smaller than this many bytes are not compressed
 }
 
 // EncryptionConfig allows you to configuration symmetric key encryption based on options
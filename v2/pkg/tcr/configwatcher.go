@@ -0,0 +1,104 @@
+package tcr
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configSettleDelay lets an editor finish writing the config file before it is read.
+const configSettleDelay = 100 * time.Millisecond
+
+// ConfigWatcher reloads a RabbitService whenever its JSON config file changes.
+type ConfigWatcher struct {
+	watcher   *fsnotify.Watcher
+	watchDone chan struct{}
+	closeOnce *sync.Once
+}
+
+// WatchConfigFile reloads the RabbitService from the JSON config file whenever the file is written or replaced,
+// passing the result of each ReloadConfig (or the error reading the file) to onReload. Close the ConfigWatcher to
+// stop watching.
+func (rs *RabbitService) WatchConfigFile(fileNamePath string, onReload func(*ReloadResult, error)) (*ConfigWatcher, error) {
+
+	fileNamePath, err := filepath.Abs(fileNamePath)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// The directory is watched as editors often replace the file rather than write to it.
+	if err := watcher.Add(filepath.Dir(fileNamePath)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	cw := &ConfigWatcher{
+		watcher:   watcher,
+		watchDone: make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+
+	go cw.watch(fileNamePath, rs.ConnectionPool.logger, func() {
+		config, err := ConvertJSONFileToConfig(fileNamePath)
+		if err != nil {
+			rs.ConnectionPool.logger.Error("unable to read config file %s for reload: %s", fileNamePath, err)
+			onReload(nil, err)
+			return
+		}
+
+		result, err := rs.ReloadConfig(config)
+		if err == nil && result.RestartRequired() {
+			rs.ConnectionPool.logger.Warn("config file %s changed settings that require a restart: %v", fileNamePath, result.RequiresRestart)
+		}
+
+		onReload(result, err)
+	})
+
+	return cw, nil
+}
+
+// watch calls reload once writes to the file settle, until the watcher is closed.
+func (cw *ConfigWatcher) watch(fileNamePath string, logger Logger, reload func()) {
+	defer close(cw.watchDone)
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case event, ok := <-cw.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if filepath.Clean(event.Name) == fileNamePath && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				settle = time.After(configSettleDelay)
+			}
+		case err, ok := <-cw.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("config file %s watcher error: %s", fileNamePath, err)
+		case <-settle:
+			settle = nil
+			reload()
+		}
+	}
+}
+
+// Close stops watching the config file.
+func (cw *ConfigWatcher) Close() error {
+
+	var err error
+	cw.closeOnce.Do(func() {
+		err = cw.watcher.Close()
+		<-cw.watchDone
+	})
+
+	return err
+}
@@ -1,26 +1,48 @@
 package tcr
 
 import (
-	"crypto/tls"
-	"errors"
+	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 )
 
+// connectionErrorHistory is how many recent close errors a ConnectionHost remembers.
+const connectionErrorHistory = 10
+
+// ConnectionError is why a connection was found closed or unhealthy, and when.
+type ConnectionError struct {
+	Reason string    `json:"Reason"`
+	At     time.Time `json:"At"`
+}
+
 // ConnectionHost is an internal representation of amqp.Connection.
 type ConnectionHost struct {
 	Connection         *amqp.Connection
 	ConnectionID       uint64
 	CachedChannelCount uint64
 	uri                string
+	hosts              *hostList
 	connectionName     string
+	properties         amqp.Table
 	heartbeatInterval  time.Duration
 	connectionTimeout  time.Duration
 	tlsConfig          *TLSConfig
 	Errors             chan *amqp.Error
-	Blockers           chan amqp.Blocking
+	Blockers           chan amqp.Blocking // copies of the broker's blocked notifications, dropped when full
+	blocking           amqp.Blocking
+	onBlocked          func(*ConnectionHost, amqp.Blocking)
+	connectedAt        time.Time
+	reconnects         uint64
+	lastReconnectAt    time.Time
+	flags              uint64 // atomic, times returned to the pool flagged
+	generation         uint64 // atomic, bumped whenever Connection is replaced
+	recentErrors       [connectionErrorHistory]ConnectionError
+	errorCount         uint64      // errors recorded, the next goes in recentErrors[errorCount%connectionErrorHistory]
+	stateLock          *sync.Mutex // blocking, onBlocked, and the statistics above
 	connLock           *sync.Mutex
 }
 
@@ -33,32 +55,63 @@ func NewConnectionHost(
 	connectionTimeout time.Duration,
 	tlsConfig *TLSConfig) (*ConnectionHost, error) {
 
+	if tlsConfig != nil && tlsConfig.EnableTLS {
+		uri = "amqps://" + tlsConfig.CertServerName
+	}
+
+	return newConnectionHost(
+		newHostList([]string{uri}),
+		clientProperties(connectionName, nil),
+		connectionName,
+		connectionID,
+		heartbeatInterval,
+		connectionTimeout,
+		tlsConfig)
+}
+
+// newConnectionHost creates a ConnectionHost that dials the active host of a shared hostList.
+func newConnectionHost(
+	hosts *hostList,
+	properties amqp.Table,
+	connectionName string,
+	connectionID uint64,
+	heartbeatInterval time.Duration,
+	connectionTimeout time.Duration,
+	tlsConfig *TLSConfig) (*ConnectionHost, error) {
+
 	connHost := &ConnectionHost{
-		uri:               uri,
+		hosts:             hosts,
 		connectionName:    connectionName,
+		properties:        properties,
 		ConnectionID:      connectionID,
 		heartbeatInterval: heartbeatInterval,
 		connectionTimeout: connectionTimeout,
 		tlsConfig:         tlsConfig,
 		Errors:            make(chan *amqp.Error, 10),
 		Blockers:          make(chan amqp.Blocking, 10),
+		stateLock:         &sync.Mutex{},
 		connLock:          &sync.Mutex{},
 	}
 
-	ok := connHost.Connect()
-	if !ok {
-		return nil, errors.New("unable to connect")
+	if err := connHost.connect(); err != nil {
+		return nil, fmt.Errorf("unable to connect: %w", err)
 	}
 
 	return connHost, nil
 }
 
 // Connect tries to connect (or reconnect) to the provided properties of the host one time.
+// With multiple hosts, each is tried once starting from the active host, rotating past any that fail to dial.
 func (ch *ConnectionHost) Connect() bool {
+	return ch.connect() == nil
+}
+
+// connect is Connect returning why the dial failed.
+func (ch *ConnectionHost) connect() error {
 
 	// Compare, Lock, Recompare Strategy
 	if ch.Connection != nil && !ch.Connection.IsClosed() /* <- atomic */ {
-		return true
+		return nil
 	}
 
 	ch.connLock.Lock() // Block all but one.
@@ -66,77 +119,255 @@ func (ch *ConnectionHost) Connect() bool {
 
 	// Recompare, check if an operation is still necessary after acquiring lock.
 	if ch.Connection != nil && !ch.Connection.IsClosed() /* <- atomic */ {
-		return true
+		return nil
 	}
 
 	// Proceed with reconnectivity
-	var amqpConn *amqp.Connection
-	var actualTLSConfig *tls.Config
-	var err error
+	amqpConn, uri, err := ch.dialActive()
+	if err != nil {
+		return err
+	}
 
-	if ch.tlsConfig != nil && ch.tlsConfig.EnableTLS {
+	ch.attach(amqpConn, uri, true)
 
-		actualTLSConfig, err = CreateTLSConfig(
-			ch.tlsConfig.PEMCertLocation,
-			ch.tlsConfig.LocalCertLocation)
-		if err != nil {
-			return false
-		}
-	}
+	return nil
+}
 
-	if actualTLSConfig == nil {
-		amqpConn, err = amqp.DialConfig(ch.uri, amqp.Config{
-			Heartbeat: ch.heartbeatInterval,
-			Dial:      amqp.DefaultDial(ch.connectionTimeout),
-			Properties: amqp.Table{
-				"connection_name": ch.connectionName,
-			},
-		})
-	} else {
-		amqpConn, err = amqp.DialConfig("amqps://"+ch.tlsConfig.CertServerName, amqp.Config{
-			Heartbeat:       ch.heartbeatInterval,
-			Dial:            amqp.DefaultDial(ch.connectionTimeout),
-			TLSClientConfig: actualTLSConfig,
-			Properties: amqp.Table{
-				"connection_name": ch.connectionName,
-			},
-		})
-	}
+// replace dials a new connection and swaps it in while the current one is still open, returning the old
+// connection for the caller to close once its channels have moved. Not counted as a reconnect.
+func (ch *ConnectionHost) replace() (*amqp.Connection, error) {
+	ch.connLock.Lock()
+	defer ch.connLock.Unlock()
+
+	amqpConn, uri, err := ch.dialActive()
 	if err != nil {
-		return false
+		return nil, err
+	}
+
+	old := ch.Connection
+	ch.attach(amqpConn, uri, false)
+
+	return old, nil
+}
+
+// dialActive dials the active host, rotating past any that fail until each has been tried once.
+func (ch *ConnectionHost) dialActive() (*amqp.Connection, string, error) {
+
+	var err error
+	for attempt := 0; attempt < ch.hosts.len(); attempt++ {
+		index, uri := ch.hosts.active()
+
+		var amqpConn *amqp.Connection
+		amqpConn, err = dial(uri, ch.properties, ch.heartbeatInterval, ch.connectionTimeout, ch.tlsConfig)
+		if err == nil {
+			return amqpConn, uri, nil
+		}
+
+		ch.hosts.failed(index)
 	}
 
+	return nil, "", err
+}
+
+// attach makes amqpConn the host's connection, under connLock. Channels made on any earlier connection are stale.
+func (ch *ConnectionHost) attach(amqpConn *amqp.Connection, uri string, reconnect bool) {
+
+	ch.uri = uri
 	ch.Connection = amqpConn
 	ch.Errors = make(chan *amqp.Error, 10)
 	ch.Blockers = make(chan amqp.Blocking, 10)
+	atomic.AddUint64(&ch.generation, 1)
+
+	ch.stateLock.Lock()
+	ch.blocking = amqp.Blocking{} // a new connection starts unblocked
+	now := time.Now()
+	if reconnect && !ch.connectedAt.IsZero() {
+		ch.reconnects++
+		ch.lastReconnectAt = now
+	}
+	ch.connectedAt = now
+	ch.stateLock.Unlock()
 
 	ch.Connection.NotifyClose(ch.Errors) // ch.Errors is closed by streadway/amqp in some scenarios :(
-	ch.Connection.NotifyBlocked(ch.Blockers)
+	go ch.watchBlocked(ch.Connection.NotifyBlocked(make(chan amqp.Blocking, 10)), ch.Blockers)
+}
+
+// watchBlocked tracks the broker's flow control of the connection until it closes, which closes blockings.
+func (ch *ConnectionHost) watchBlocked(blockings <-chan amqp.Blocking, blockers chan amqp.Blocking) {
+
+	for blocking := range blockings {
+		ch.stateLock.Lock()
+		ch.blocking = blocking
+		onBlocked := ch.onBlocked
+		ch.stateLock.Unlock()
+
+		select {
+		case blockers <- blocking:
+		default:
+		}
 
-	return true
+		if onBlocked != nil {
+			onBlocked(ch, blocking)
+		}
+	}
 }
 
-// PauseOnFlowControl allows you to wait and sleep while receiving flow control messages.
-func (ch *ConnectionHost) PauseOnFlowControl() {
+// recordError remembers why the connection was found unhealthy, overwriting the oldest of the recent errors.
+func (ch *ConnectionHost) recordError(amqpError *amqp.Error) {
+
+	reason := "connection closed"
+	if amqpError != nil {
+		reason = amqpError.Error()
+	}
 
+	ch.stateLock.Lock()
+	ch.recentErrors[ch.errorCount%connectionErrorHistory] = ConnectionError{Reason: reason, At: time.Now()}
+	ch.errorCount++
+	ch.stateLock.Unlock()
+}
+
+// Reconnects is how many times the connection has been re-established after it was lost.
+func (ch *ConnectionHost) Reconnects() uint64 {
+	ch.stateLock.Lock()
+	defer ch.stateLock.Unlock()
+
+	return ch.reconnects
+}
+
+// LastReconnectAt is when the connection was last re-established, zero if it never has been.
+func (ch *ConnectionHost) LastReconnectAt() time.Time {
+	ch.stateLock.Lock()
+	defer ch.stateLock.Unlock()
+
+	return ch.lastReconnectAt
+}
+
+// RecentErrors are the last few reasons the connection was found closed or unhealthy, oldest first.
+func (ch *ConnectionHost) RecentErrors() []ConnectionError {
+	ch.stateLock.Lock()
+	defer ch.stateLock.Unlock()
+
+	return ch.recentErrorsLocked()
+}
+
+// recentErrorsLocked copies the recent errors oldest first, under stateLock.
+func (ch *ConnectionHost) recentErrorsLocked() []ConnectionError {
+
+	count := ch.errorCount
+	if count > connectionErrorHistory {
+		count = connectionErrorHistory
+	}
+
+	recentErrors := make([]ConnectionError, 0, count)
+	for i := ch.errorCount - count; i < ch.errorCount; i++ {
+		recentErrors = append(recentErrors, ch.recentErrors[i%connectionErrorHistory])
+	}
+
+	return recentErrors
+}
+
+// Blocked reports whether the broker is blocking publishes on the connection, usually for a memory or disk alarm.
+func (ch *ConnectionHost) Blocked() bool {
+	ch.stateLock.Lock()
+	defer ch.stateLock.Unlock()
+
+	return ch.blocking.Active
+}
+
+// BlockedReason is the broker's reason for blocking the connection, empty when it isn't blocked.
+func (ch *ConnectionHost) BlockedReason() string {
+	ch.stateLock.Lock()
+	defer ch.stateLock.Unlock()
+
+	if !ch.blocking.Active {
+		return ""
+	}
+
+	return ch.blocking.Reason
+}
+
+// URI is the broker URI of the most recent successful connection.
+func (ch *ConnectionHost) URI() string {
 	ch.connLock.Lock()
 	defer ch.connLock.Unlock()
 
-	for {
-		// nothing we can do (race condition) Blockers
-		// and will deadlock if it is read from.
-		if ch.Connection.IsClosed( /* atomic */ ) {
-			return
-		}
+	return ch.uri
+}
 
-		select {
-		case blocker := <-ch.Blockers: // Check for flow control issues.
-			if !blocker.Active {
-				return
-			}
-			time.Sleep(time.Second)
-		default:
-			return
+// closed reports whether the connection is missing or closed, under connLock since connect replaces it.
+func (ch *ConnectionHost) closed() bool {
+	ch.connLock.Lock()
+	defer ch.connLock.Unlock()
+
+	return ch.Connection == nil || ch.Connection.IsClosed( /* atomic */ )
+}
+
+// disconnectFrom closes the connection when its URI matches, leaving recovery to the next Connect.
+func (ch *ConnectionHost) disconnectFrom(match func(uri string) bool) {
+	ch.connLock.Lock()
+	defer ch.connLock.Unlock()
+	defer func() { _ = recover() }()
+
+	if ch.Connection != nil && !ch.Connection.IsClosed() && match(ch.uri) {
+		_ = ch.Connection.Close()
+	}
+}
+
+// clientProperties are advertised to the broker and shown in the management UI. Defaults to the product,
+// platform, and hostname (the pod name on Kubernetes), overlaid by extra, and always sets connection_name.
+func clientProperties(connectionName string, extra map[string]interface{}) amqp.Table {
+
+	properties := amqp.Table{
+		"product":  "turbocookedrabbit",
+		"platform": "golang",
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		properties["hostname"] = hostname
+	}
+
+	for key, value := range extra {
+		properties[key] = value
+	}
+
+	properties["connection_name"] = connectionName
+
+	return properties
+}
+
+// dial opens a single amqp.Connection to uri.
+func dial(
+	uri string,
+	properties amqp.Table,
+	heartbeatInterval time.Duration,
+	connectionTimeout time.Duration,
+	tlsConfig *TLSConfig) (*amqp.Connection, error) {
+
+	config := amqp.Config{
+		Heartbeat:  heartbeatInterval,
+		Dial:       amqp.DefaultDial(connectionTimeout),
+		Properties: properties,
+	}
+
+	if tlsConfig != nil && tlsConfig.EnableTLS {
+
+		actualTLSConfig, err := CreateTLSConfig(
+			tlsConfig.PEMCertLocation,
+			tlsConfig.LocalCertLocation)
+		if err != nil {
+			return nil, err
 		}
+
+		config.TLSClientConfig = actualTLSConfig
+	}
+
+	return amqp.DialConfig(uri, config)
+}
+
+// PauseOnFlowControl allows you to wait and sleep while the broker blocks the connection (or it closes).
+func (ch *ConnectionHost) PauseOnFlowControl() {
+
+	for ch.Blocked() && !ch.closed() {
+		time.Sleep(100 * time.Millisecond)
 	}
 }
@@ -1,27 +1,63 @@
 package tcr
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Workiva/go-datastructures/queue"
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 )
 
 // ConnectionPool houses the pool of RabbitMQ connections.
 type ConnectionPool struct {
-	Config               PoolConfig
-	uri                  string
-	heartbeatInterval    time.Duration
-	connectionTimeout    time.Duration
-	connections          *queue.Queue
-	channels             chan *ChannelHost
-	connectionID         uint64
-	poolRWLock           *sync.RWMutex
-	flaggedConnections   map[uint64]bool
-	sleepOnErrorInterval time.Duration
+	Config             PoolConfig
+	state              int32
+	hosts              *hostList
+	connectionHosts    []*ConnectionHost
+	failbackInterval   time.Duration
+	failbackStop       chan struct{}
+	maxChannelIdle     time.Duration
+	reapStop           chan struct{}
+	faultStop          chan struct{}
+	recycleStop        chan struct{}
+	slowStop           chan struct{}
+	connectionLifetime time.Duration
+	recycleGracePeriod time.Duration
+	heartbeatInterval  time.Duration
+	connectionTimeout  time.Duration
+	connections        *queue.Queue
+	channels           chan *ChannelHost
+	closing            chan struct{} // closed when Shutdown begins, waking those waiting on a channel
+	channelCount       uint64
+	channelLimit       uint64 // MaxCacheChannelCount, lowered or raised by ReloadConfig
+	channelID          uint64
+	cachedChannels     map[uint64]*ChannelHost // by ID, for PoolStats
+	consumers          map[string]*Consumer    // started, by ConsumerName, for Counters
+	channelsCreated    uint64
+	channelGets        uint64
+	channelReturns     uint64
+	channelErrors      uint64
+	transientChannels  uint64
+	connectionID       uint64
+	poolRWLock         *sync.RWMutex
+	flaggedConnections map[uint64]bool
+	backoff            BackoffPolicy
+	dialer             *dialer
+	selector           ChannelSelector
+	notifier           *Notifier
+	channelExceptions  chan *ChannelException
+	errors             *errorBuffer
+	shutdownHooks      *shutdownHooks
+	lifecycle          *lifecycle
+	channelHooks       *channelHooks
+	breaker            *CircuitBreaker
+	slowChannels       *slowChannels
+	logger             Logger
 }
 
 // NewConnectionPool creates hosting structure for the ConnectionPool.
@@ -35,69 +71,246 @@ func NewConnectionPool(config *PoolConfig) (*ConnectionPool, error) {
 		return nil, errors.New("connectionpool maxconnectioncount can't be 0")
 	}
 
+	if err := clientProperties(config.ConnectionName, config.ClientProperties).Validate(); err != nil {
+		return nil, fmt.Errorf("connectionpool clientproperties are invalid: %w", err)
+	}
+
 	cp := &ConnectionPool{
-		Config:               *config,
-		uri:                  config.URI,
-		heartbeatInterval:    time.Duration(config.Heartbeat) * time.Second,
-		connectionTimeout:    time.Duration(config.ConnectionTimeout) * time.Second,
-		connections:          queue.New(int64(config.MaxConnectionCount)), // possible overflow error
-		channels:             make(chan *ChannelHost, config.MaxCacheChannelCount),
-		poolRWLock:           &sync.RWMutex{},
-		flaggedConnections:   make(map[uint64]bool),
-		sleepOnErrorInterval: time.Duration(config.SleepOnErrorInterval) * time.Millisecond,
+		Config:             *config,
+		hosts:              newHostList(poolURIs(config)),
+		failbackInterval:   time.Duration(config.FailbackInterval) * time.Second,
+		maxChannelIdle:     time.Duration(config.MaxChannelIdleTime) * time.Second,
+		connectionLifetime: time.Duration(config.MaxConnectionLifetime) * time.Second,
+		recycleGracePeriod: time.Duration(config.RecycleGracePeriod) * time.Second,
+		heartbeatInterval:  time.Duration(config.Heartbeat) * time.Second,
+		connectionTimeout:  time.Duration(config.ConnectionTimeout) * time.Second,
+		connections:        queue.New(int64(config.MaxConnectionCount)), // possible overflow error
+		channels:           make(chan *ChannelHost, config.MaxCacheChannelCount),
+		closing:            make(chan struct{}),
+		channelLimit:       config.MaxCacheChannelCount,
+		poolRWLock:         &sync.RWMutex{},
+		flaggedConnections: make(map[uint64]bool),
+		cachedChannels:     make(map[uint64]*ChannelHost),
+		consumers:          make(map[string]*Consumer),
+		channelExceptions:  make(chan *ChannelException, 1000),
+		errors:             newErrorBuffer(0, SubsystemConnection),
+		shutdownHooks:      newShutdownHooks(),
+		lifecycle:          newLifecycle(config.OnLifecycle),
+		channelHooks:       newChannelHooks(config.ChannelHooks),
+		breaker:            NewCircuitBreaker(config.CircuitBreakerConfig),
+		slowChannels:       newSlowChannels(config.SlowChannelConfig),
+		logger:             config.Logger,
+	}
+
+	if cp.logger == nil {
+		cp.logger = NoOpLogger{}
+	}
+
+	backoff, err := backoffPolicy(config.Backoff, config.BackoffConfig, time.Duration(config.SleepOnErrorInterval)*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("connectionpool backoffconfig is invalid: %w", err)
+	}
+	cp.backoff = backoff
+
+	dialer, err := newDialer(config.DialConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connectionpool dialconfig is invalid: %w", err)
 	}
+	cp.dialer = dialer
+
+	selector, err := channelSelector(config.ChannelSelector, config.ChannelSelection)
+	if err != nil {
+		return nil, fmt.Errorf("connectionpool channelselection is invalid: %w", err)
+	}
+	cp.selector = selector
+
+	if cp.breaker != nil {
+		cp.breaker.onStateChange = func(from, to CircuitState) {
+			cp.logger.Warn("connectionpool %s circuit breaker %s -> %s", config.ConnectionName, from, to)
+		}
+	}
+
+	if config.WebhookConfig != nil && config.WebhookConfig.Enabled {
+		notifier, err := NewNotifier(config.WebhookConfig)
+		if err != nil {
+			return nil, err
+		}
 
-	if ok := cp.initializeConnections(); !ok {
-		return nil, errors.New("initialization failed during connection creation")
+		cp.notifier = notifier
 	}
 
+	cp.logger.Info("connectionpool %s initializing %d connections and %d channels", config.ConnectionName, config.MaxConnectionCount, config.MaxCacheChannelCount)
+	cp.emitLifecycle(LifecycleInitializing, "")
+
+	if err := cp.initializeConnections(); err != nil {
+		cp.logger.Error("connectionpool %s initialization failed during connection creation: %s", config.ConnectionName, err)
+		cp.abandonInitialization()
+		return nil, fmt.Errorf("initialization failed during connection creation: %w", err)
+	}
+
+	if cp.hosts.len() > 1 && cp.failbackInterval > 0 {
+		cp.failbackStop = make(chan struct{})
+		go cp.watchPreferredHost(cp.failbackStop)
+	}
+
+	if cp.maxChannelIdle > 0 {
+		cp.reapStop = make(chan struct{})
+		go cp.reapIdleChannels(cp.reapStop)
+	}
+
+	if cp.recycleGracePeriod == 0 {
+		cp.recycleGracePeriod = 30 * time.Second
+	}
+
+	if cp.connectionLifetime > 0 {
+		cp.recycleStop = make(chan struct{})
+		go cp.recycleConnections(cp.recycleStop)
+	}
+
+	if cp.slowChannels != nil {
+		cp.slowStop = make(chan struct{})
+		go cp.watchSlowChannels(cp.slowStop)
+	}
+
+	if config.FaultInjector != nil && config.FaultInjector.FaultInterval() > 0 {
+		cp.faultStop = make(chan struct{})
+		go cp.injectFaults(config.FaultInjector.FaultInterval(), cp.faultStop)
+	}
+
+	if config.ExpvarNamespace != "" {
+		cp.publishExpvar(config.ExpvarNamespace)
+	}
+
+	cp.transition(PoolUninitialized, PoolReady)
+	cp.logger.Info("connectionpool %s initialized", config.ConnectionName)
+	cp.emitLifecycle(LifecycleInitialized, "")
+
 	return cp, nil
 }
 
-func (cp *ConnectionPool) initializeConnections() bool {
+// abandonInitialization closes the channels and connections created before initialization failed.
+func (cp *ConnectionPool) abandonInitialization() {
+
+	for len(cp.channels) > 0 {
+		chanHost := <-cp.channels
+		func() {
+			defer func() { _ = recover() }()
+			chanHost.Close()
+		}()
+	}
+
+	for _, connHost := range cp.connectionHosts {
+		func() {
+			defer func() { _ = recover() }()
+			if !connHost.Connection.IsClosed() {
+				connHost.Connection.Close()
+			}
+		}()
+	}
+
+	cp.connections.Dispose()
+	cp.connectionHosts = nil
+}
+
+// poolURIs is the URIs list, falling back to the single URI (or the TLS server name when TLS is enabled).
+func poolURIs(config *PoolConfig) []string {
+
+	if len(config.URIs) > 0 {
+		return append([]string{}, config.URIs...)
+	}
+
+	if config.TLSConfig != nil && config.TLSConfig.EnableTLS {
+		return []string{"amqps://" + config.TLSConfig.CertServerName}
+	}
+
+	return []string{config.URI}
+}
+
+// initializeConnections creates the connections, and unless LazyChannels the cached channels. Returns a
+// TerminalError when the broker refuses them, or a DialError when it can't be reached.
+func (cp *ConnectionPool) initializeConnections() error {
 
 	cp.connectionID = 0
 	cp.connections = queue.New(int64(cp.Config.MaxConnectionCount))
+	cp.connectionHosts = make([]*ConnectionHost, 0, cp.Config.MaxConnectionCount)
 
 	for i := uint64(0); i < cp.Config.MaxConnectionCount; i++ {
 
-		connectionHost, err := NewConnectionHost(
-			cp.uri,
-			cp.Config.ConnectionName+"-"+strconv.FormatUint(cp.connectionID, 10),
-			cp.connectionID,
-			cp.heartbeatInterval,
-			cp.connectionTimeout,
-			cp.Config.TLSConfig)
+		connectionName := cp.Config.ConnectionName + "-" + strconv.FormatUint(cp.connectionID, 10)
+		properties := clientProperties(connectionName, cp.Config.ClientProperties)
+		properties["pool_name"] = cp.Config.ConnectionName
+		properties["pool_index"] = int64(cp.connectionID)
+
+		connectionHost, err := cp.dialConnection(cp.connectionID, func() (*ConnectionHost, error) {
+			return newConnectionHost(
+				cp.hosts,
+				properties,
+				connectionName,
+				cp.connectionID,
+				cp.heartbeatInterval,
+				cp.connectionTimeout,
+				cp.Config.TLSConfig)
+		})
 
 		if err != nil {
-			return false
+			cp.logger.Error("connectionpool unable to create connection %d: %s", cp.connectionID, err)
+			return err
 		}
 
+		connectionHost.stateLock.Lock()
+		connectionHost.onBlocked = cp.connectionBlocked
+		connectionHost.stateLock.Unlock()
+
 		if err = cp.connections.Put(connectionHost); err != nil {
-			return false
+			return err
 		}
 
+		cp.connectionHosts = append(cp.connectionHosts, connectionHost)
+
 		cp.connectionID++
 	}
 
+	if cp.Config.LazyChannels {
+		return nil
+	}
+
 	for i := uint64(0); i < cp.Config.MaxCacheChannelCount; i++ {
-		cp.channels <- cp.createCacheChannel(i)
+		chanHost, err := cp.createCacheChannel(cp.channelID)
+		if err != nil {
+			return err
+		}
+
+		cp.cacheChannel(chanHost)
+		cp.channelCount++
+		cp.channelID++
 	}
 
-	return true
+	return nil
 }
 
 // GetConnection gets a connection based on whats in the ConnectionPool (blocking under bad network conditions).
 // Flowcontrol (blocking) or transient network outages will pause here until cleared.
-// Uses the SleepOnErrorInterval to pause between retries.
+// Uses the pool's BackoffPolicy, a constant SleepOnErrorInterval by default, to pause between retries. Returns ErrPoolClosed once Shutdown has begun,
+// or a TerminalError when the broker refuses to reconnect, ex. the credentials were revoked.
 func (cp *ConnectionPool) GetConnection() (*ConnectionHost, error) {
 
+	if cp.closed() {
+		return nil, ErrPoolClosed
+	}
+
 	connHost, err := cp.getConnectionFromPool()
 	if err != nil { // errors on bad data in the queue
+		if cp.closed() {
+			return nil, ErrPoolClosed
+		}
+
 		return nil, err
 	}
 
-	cp.verifyHealthyConnection(connHost)
+	if err = cp.verifyHealthyConnection(connHost); err != nil {
+		cp.ReturnConnection(connHost, true)
+		return nil, err
+	}
 
 	return connHost, nil
 }
@@ -119,69 +332,220 @@ func (cp *ConnectionPool) getConnectionFromPool() (*ConnectionHost, error) {
 	return connHost, nil
 }
 
-func (cp *ConnectionPool) verifyHealthyConnection(connHost *ConnectionHost) {
+func (cp *ConnectionPool) verifyHealthyConnection(connHost *ConnectionHost) error {
 
 	healthy := true
 	select {
-	case <-connHost.Errors:
+	case amqpError := <-connHost.Errors:
 		healthy = false
+		connHost.recordError(amqpError)
 	default:
 		break
 	}
 
 	flagged := cp.isConnectionFlagged(connHost.ConnectionID)
+	closed := connHost.Connection.IsClosed( /* atomic */ )
+	if closed && healthy {
+		connHost.recordError(nil)
+	}
 
 	// Between these three states we do our best to determine that a connection is dead in the various lifecycles.
-	if flagged || !healthy || connHost.Connection.IsClosed( /* atomic */ ) {
-		cp.triggerConnectionRecovery(connHost)
+	if flagged || !healthy || closed {
+		return cp.triggerConnectionRecovery(connHost)
 	}
 
-	connHost.PauseOnFlowControl()
+	// Blocked connections are not paused on here, consumers draining queues is how alarms clear.
+	// Publishers decide for themselves with PublisherConfig.OnBlocked.
+	return nil
 }
 
-func (cp *ConnectionPool) triggerConnectionRecovery(connHost *ConnectionHost) {
+// triggerConnectionRecovery reconnects, retrying until it succeeds, the pool shuts down, or the broker
+// returns a terminal error.
+func (cp *ConnectionPool) triggerConnectionRecovery(connHost *ConnectionHost) error {
 
-	// InfiniteLoop: Stay here till we reconnect.
-	for {
-		ok := connHost.Connect()
-		if !ok {
-			if cp.sleepOnErrorInterval > 0 {
-				time.Sleep(cp.sleepOnErrorInterval)
+	cp.logger.Warn("connection %d is unhealthy, attempting to reconnect", connHost.ConnectionID)
+	cp.notify(EventConnectionLost, connHost.ConnectionID, "connection is unhealthy, attempting to reconnect")
+	cp.degrade(fmt.Sprintf("connection %d lost", connHost.ConnectionID))
+	downSince := time.Now()
+
+	// InfiniteLoop: Stay here till we reconnect (or the pool shuts down).
+	for attempt := 1; !cp.closed(); attempt++ {
+		err := cp.connectionFault(connHost.ConnectionID)
+		if err == nil {
+			err = connHost.connect()
+		}
+		if err != nil {
+			err = fmt.Errorf("connection %d unable to reconnect: %w", connHost.ConnectionID, err)
+			if !IsRetryable(err) {
+				err = newTerminalError("reconnect", err)
+				cp.logger.Error("connection %d reconnect refused, not retrying: %s", connHost.ConnectionID, err)
+				cp.errors.report("reconnect", attempt, err)
+				return err
 			}
+
+			cp.logger.Debug("connection %d reconnect attempt failed, retrying", connHost.ConnectionID)
+			cp.errors.report("reconnect", attempt, err)
+			sleepBackoff(cp.backoff, attempt)
 			continue
 		}
 		break
 	}
 
+	cp.logger.Info("connection %d reconnected after %s", connHost.ConnectionID, time.Since(downSince))
+	cp.notify(EventConnectionRestored, connHost.ConnectionID, fmt.Sprintf("connection restored after %s", time.Since(downSince)))
+	cp.restore(fmt.Sprintf("connection %d restored", connHost.ConnectionID))
+
 	// Flush any pending errors.
 	for {
 		select {
 		case <-connHost.Errors:
 		default:
 			cp.unflagConnection(connHost.ConnectionID)
-			return
+			return nil
 		}
 	}
 }
 
 // ReturnConnection puts the connection back in the queue and flag it for error.
 // This helps maintain a Round Robin on Connections and their resources.
+// Connections returned after Shutdown has begun are closed instead.
 func (cp *ConnectionPool) ReturnConnection(connHost *ConnectionHost, flag bool) {
 
 	if flag {
+		atomic.AddUint64(&connHost.flags, 1)
 		cp.flagConnection(connHost.ConnectionID)
 	}
 
-	cp.connections.Put(connHost)
+	if err := cp.connections.Put(connHost); err != nil { // disposed by Shutdown
+		connHost.disconnectFrom(func(string) bool { return true })
+	}
 }
 
 // GetChannelFromPool gets a cached ackable channel from the Pool if they exist or creates a channel.
 // A non-acked channel is always a transient channel.
 // Blocking if Ackable is true and the cache is empty.
 // If you want a transient Ackable channel (un-managed), use CreateChannel directly.
+// Returns nil once Shutdown has begun, when MaxCacheChannelCount is 0, or when the broker refuses a new channel,
+// GetChannelFromPoolContext returns the error instead.
 func (cp *ConnectionPool) GetChannelFromPool() *ChannelHost {
 
-	return <-cp.channels
+	chanHost, _ := cp.getChannel()
+	return chanHost
+}
+
+// getChannel is GetChannelFromPool returning ErrPoolClosed, ErrNoCachedChannels, or the TerminalError of a refused
+// channel instead of nil.
+func (cp *ConnectionPool) getChannel() (*ChannelHost, error) {
+
+	if cp.closed() {
+		return nil, ErrPoolClosed
+	}
+
+	if cap(cp.channels) == 0 {
+		return nil, ErrNoCachedChannels
+	}
+
+	chanHost := cp.selectIdleChannel()
+	if chanHost == nil {
+		select {
+		case chanHost = <-cp.channels:
+		default:
+			var err error
+			if chanHost, err = cp.createLazyChannel(); err != nil {
+				return nil, err
+			}
+
+			if chanHost == nil {
+				select {
+				case chanHost = <-cp.channels:
+				case <-cp.closing:
+					return nil, ErrPoolClosed
+				}
+			}
+		}
+	}
+
+	atomic.AddUint64(&cp.channelGets, 1)
+	cp.channelHooks.run(&cp.channelHooks.get, chanHost)
+
+	return chanHost, nil
+}
+
+// GetChannelFromPoolContext is GetChannelFromPool that gives up when ctx is done.
+// Returns ErrPoolClosed once Shutdown has begun, ErrNoCachedChannels when MaxCacheChannelCount is 0, or a
+// TerminalError when the broker refuses a new channel.
+func (cp *ConnectionPool) GetChannelFromPoolContext(ctx context.Context) (*ChannelHost, error) {
+
+	if cp.closed() {
+		return nil, ErrPoolClosed
+	}
+
+	if cap(cp.channels) == 0 {
+		return nil, ErrNoCachedChannels
+	}
+
+	chanHost := cp.selectIdleChannel()
+	if chanHost == nil {
+		select {
+		case chanHost = <-cp.channels:
+		default:
+			var err error
+			if chanHost, err = cp.createLazyChannel(); err != nil {
+				return nil, err
+			}
+
+			if chanHost == nil {
+				select {
+				case chanHost = <-cp.channels:
+				case <-cp.closing:
+					return nil, ErrPoolClosed
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+
+	atomic.AddUint64(&cp.channelGets, 1)
+	cp.channelHooks.run(&cp.channelHooks.get, chanHost)
+
+	return chanHost, nil
+}
+
+// createLazyChannel creates another cached channel when the pool has fewer than MaxCacheChannelCount, with
+// LazyChannels, idle reaping, or after channels were dropped on terminal errors, otherwise returns nil.
+// The new channel joins the cache when it is returned.
+func (cp *ConnectionPool) createLazyChannel() (*ChannelHost, error) {
+
+	if cp.closed() {
+		return nil, nil
+	}
+
+	for {
+		count := atomic.LoadUint64(&cp.channelCount)
+		if count >= atomic.LoadUint64(&cp.channelLimit) {
+			return nil, nil
+		}
+
+		if atomic.CompareAndSwapUint64(&cp.channelCount, count, count+1) {
+			id := atomic.AddUint64(&cp.channelID, 1) - 1
+			cp.logger.Debug("connectionpool %s creating channel %d on demand", cp.Config.ConnectionName, id)
+
+			chanHost, err := cp.createCacheChannel(id)
+			if err != nil {
+				atomic.AddUint64(&cp.channelCount, ^uint64(0))
+				return nil, err
+			}
+
+			return chanHost, nil
+		}
+	}
+}
+
+// ChannelCount is the number of cached channels open, which only trails MaxCacheChannelCount with LazyChannels
+// or MaxChannelIdleTime.
+func (cp *ConnectionPool) ChannelCount() uint64 {
+	return atomic.LoadUint64(&cp.channelCount)
 }
 
 // ReturnChannel returns a Channel.
@@ -189,15 +553,42 @@ func (cp *ConnectionPool) GetChannelFromPool() *ChannelHost {
 // If Cache Channel, we check if erred, new Channel is created instead and then returned to the cache.
 func (cp *ConnectionPool) ReturnChannel(chanHost *ChannelHost, erred bool) {
 
-	// If called by user with the wrong channel don't add a non-managed channel back to the channel cache.
+	atomic.AddUint64(&cp.channelReturns, 1)
+	if erred {
+		atomic.AddUint64(&cp.channelErrors, 1)
+	}
+
 	if chanHost.CachedChannel {
+		cp.slowChannels.sample(chanHost, erred)
+	}
+
+	// If called by user with the wrong channel don't add a non-managed channel back to the channel cache.
+	// Once Shutdown has begun the cache has already been flushed, so the channel is closed instead.
+	if chanHost.CachedChannel && !cp.closed() {
+		var err error
 		if erred {
-			cp.reconnectChannel(chanHost) // <- blocking operation
+			cp.logger.Debug("channel %d returned in error, rebuilding", chanHost.ID)
+			cp.channelHooks.run(&cp.channelHooks.flagged, chanHost)
+			err = cp.reconnectChannel(chanHost) // <- blocking operation
+		} else if cp.slowChannels.takeSlow(chanHost) {
+			err = cp.rebuildSlowChannel(chanHost) // found slow while it was out
+		} else if chanHost.stale() {
+			err = cp.migrateChannel(chanHost) // its connection was recycled (or recovered) while it was out
 		} else {
 			chanHost.FlushConfirms()
 		}
 
-		cp.channels <- chanHost
+		if err != nil {
+			cp.dropChannel(chanHost) // the broker refused it, GetChannelFromPool replaces it on demand
+			return
+		}
+
+		if cp.overChannelLimit() {
+			cp.retireChannel(chanHost) // MaxCacheChannelCount was lowered while it was out
+			return
+		}
+
+		cp.cacheChannel(chanHost)
 		return
 	}
 
@@ -208,84 +599,347 @@ func (cp *ConnectionPool) ReturnChannel(chanHost *ChannelHost, erred bool) {
 	}(chanHost)
 }
 
-func (cp *ConnectionPool) reconnectChannel(chanHost *ChannelHost) {
+// reconnectChannel makes the channel again, retrying until it succeeds. Returns a TerminalError when the broker
+// refuses the channel or its connection.
+func (cp *ConnectionPool) reconnectChannel(chanHost *ChannelHost) error {
 
 	// InfiniteLoop: Stay here till we reconnect.
-	for {
-		cp.verifyHealthyConnection(chanHost.connHost) // <- blocking operation
+	for attempt := 1; ; attempt++ {
+		if err := cp.verifyHealthyConnection(chanHost.connHost); err != nil { // <- blocking operation
+			return err
+		}
+		cp.waitForCircuit()
 
-		err := chanHost.MakeChannel() // Creates a new channel and flushes internal buffers automatically.
+		err := cp.channelFault(chanHost.ID)
+		if err == nil {
+			err = chanHost.MakeChannel() // Creates a new channel and flushes internal buffers automatically.
+		}
+		cp.recordCircuit(err)
+		if err != nil && !IsRetryable(err) {
+			err = newTerminalError("recover channel", fmt.Errorf("unable to recover channel %d: %w", chanHost.ID, err))
+			cp.logger.Error("channel %d refused, not retrying: %s", chanHost.ID, err)
+			cp.errors.send(NewErrorEvent(SubsystemChannel, "reconnect", attempt, err))
+			return err
+		}
 		if err != nil {
+			cp.logger.Warn("unable to recover channel %d, retrying: %s", chanHost.ID, err)
+			cp.notify(EventPoolDegraded, chanHost.ConnectionID, fmt.Sprintf("unable to recover channel %d: %s", chanHost.ID, err))
+			cp.degrade(fmt.Sprintf("unable to recover channel %d", chanHost.ID))
+			cp.errors.send(NewErrorEvent(SubsystemChannel, "reconnect", attempt, fmt.Errorf("unable to recover channel %d: %w", chanHost.ID, err)))
+			sleepBackoff(cp.backoff, attempt)
 			continue
 		}
+		if attempt > 1 {
+			cp.restore(fmt.Sprintf("channel %d recovered", chanHost.ID))
+		}
 		break
 	}
+
+	atomic.AddUint64(&cp.channelsCreated, 1)
+
+	cp.channelHooks.run(&cp.channelHooks.created, chanHost)
+
+	return nil
 }
 
 // createCacheChannel allows you create a cached ChannelHost which helps wrap Amqp Channel functionality.
-func (cp *ConnectionPool) createCacheChannel(id uint64) *ChannelHost {
+// Retries until it succeeds, returning ErrPoolClosed once Shutdown has begun, or a TerminalError when the broker
+// refuses the channel or its connection.
+func (cp *ConnectionPool) createCacheChannel(id uint64) (*ChannelHost, error) {
 
 	// InfiniteLoop: Stay till we have a good channel.
-	for {
+	for attempt := 1; ; attempt++ {
 		connHost, err := cp.GetConnection()
+		if err != nil && !IsRetryable(err) {
+			return nil, err
+		}
+
 		if err != nil {
-			if cp.sleepOnErrorInterval > 0 {
-				time.Sleep(cp.sleepOnErrorInterval)
-			}
+			sleepBackoff(cp.backoff, attempt)
 			continue
 		}
 
-		chanHost, err := NewChannelHost(connHost, id, connHost.ConnectionID, true, true)
+		cp.waitForCircuit()
+		var chanHost *ChannelHost
+		err = cp.channelFault(id)
+		if err == nil {
+			chanHost, err = NewChannelHost(connHost, id, connHost.ConnectionID, true, true)
+		}
+		cp.recordCircuit(err)
+		if err != nil && !IsRetryable(err) {
+			err = newTerminalError("create channel", fmt.Errorf("unable to create channel %d: %w", id, err))
+			cp.logger.Error("channel %d refused, not retrying: %s", id, err)
+			cp.notify(EventPoolDegraded, connHost.ConnectionID, err.Error())
+			cp.degrade(fmt.Sprintf("unable to create channel %d", id))
+			cp.errors.send(NewErrorEvent(SubsystemChannel, "create", attempt, err))
+			cp.ReturnConnection(connHost, true)
+			return nil, err
+		}
 		if err != nil {
-			if cp.sleepOnErrorInterval > 0 {
-				time.Sleep(cp.sleepOnErrorInterval)
-			}
+			cp.logger.Warn("unable to create channel %d, retrying: %s", id, err)
+			cp.notify(EventPoolDegraded, connHost.ConnectionID, fmt.Sprintf("unable to create channel %d: %s", id, err))
+			cp.degrade(fmt.Sprintf("unable to create channel %d", id))
+			cp.errors.send(NewErrorEvent(SubsystemChannel, "create", attempt, fmt.Errorf("unable to create channel %d: %w", id, err)))
+			sleepBackoff(cp.backoff, attempt)
 			cp.ReturnConnection(connHost, true)
 			continue
 		}
 
 		cp.ReturnConnection(connHost, false)
-		return chanHost
+		if attempt > 1 {
+			cp.restore(fmt.Sprintf("channel %d created", id))
+		}
+
+		chanHost.chanLock.Lock()
+		chanHost.onException = cp.reportChannelException
+		chanHost.chanLock.Unlock()
+
+		atomic.AddUint64(&connHost.CachedChannelCount, 1)
+		atomic.AddUint64(&cp.channelsCreated, 1)
+		cp.poolRWLock.Lock()
+		cp.cachedChannels[chanHost.ID] = chanHost
+		cp.poolRWLock.Unlock()
+
+		cp.channelHooks.run(&cp.channelHooks.created, chanHost)
+
+		return chanHost, nil
 	}
 }
 
 // GetTransientChannel allows you create an unmanaged amqp Channel with the help of the ConnectionPool.
+// Returns nil once Shutdown has begun, or when the broker refuses the channel with a TerminalError, which is sent
+// to Errors.
 func (cp *ConnectionPool) GetTransientChannel(ackable bool) *amqp.Channel {
 
+	channel, _ := cp.createTransientChannel(ackable, false)
+	return channel
+}
+
+// createTransientChannel is GetTransientChannel returning ErrPoolClosed or the TerminalError instead of nil.
+// An operation the circuit breaker already admitted passes admitted, so the channel doesn't wait on the circuit
+// for a probe of its own: a channel it can't make isn't retried, the failure is recorded as the operation's
+// outcome and returned. The operation records its own success.
+func (cp *ConnectionPool) createTransientChannel(ackable bool, admitted bool) (*amqp.Channel, error) {
+
 	// InfiniteLoop: Stay till we have a good channel.
-	for {
+	for attempt := 1; ; attempt++ {
 		connHost, err := cp.GetConnection()
-		if err != nil {
-			if cp.sleepOnErrorInterval > 0 {
-				time.Sleep(cp.sleepOnErrorInterval)
+		if err != nil && !IsRetryable(err) {
+			if admitted {
+				cp.recordCircuit(err)
 			}
+			return nil, err
+		}
+
+		if err != nil {
+			sleepBackoff(cp.backoff, attempt)
 			continue
 		}
 
-		channel, err := connHost.Connection.Channel()
+		if !admitted {
+			cp.waitForCircuit()
+		}
+
+		var channel *amqp.Channel
+		err = cp.channelFault(0)
+		if err == nil {
+			channel, err = connHost.Connection.Channel()
+		}
+
+		if err == nil && ackable {
+			if err = channel.Confirm(false); err != nil {
+				closeTransientChannel(channel)
+			}
+		}
+
+		if !admitted || err != nil {
+			cp.recordCircuit(err)
+		}
+
+		if err != nil && !IsRetryable(err) {
+			err = newTerminalError("create channel", fmt.Errorf("unable to create transient channel: %w", err))
+			cp.logger.Error("transient channel refused, not retrying: %s", err)
+			cp.errors.send(NewErrorEvent(SubsystemChannel, "create", attempt, err))
+			cp.ReturnConnection(connHost, true)
+			return nil, err
+		}
 		if err != nil {
-			if cp.sleepOnErrorInterval > 0 {
-				time.Sleep(cp.sleepOnErrorInterval)
+			cp.errors.send(NewErrorEvent(SubsystemChannel, "create", attempt, fmt.Errorf("unable to create transient channel: %w", err)))
+			if admitted {
+				cp.logger.Warn("unable to create transient channel: %s", err)
+				cp.ReturnConnection(connHost, true)
+				return nil, err
 			}
+
+			cp.logger.Warn("unable to create transient channel, retrying: %s", err)
+			sleepBackoff(cp.backoff, attempt)
 			cp.ReturnConnection(connHost, true)
 			continue
 		}
 
 		cp.ReturnConnection(connHost, false)
+		atomic.AddUint64(&cp.transientChannels, 1)
 
-		if ackable {
-			err := channel.Confirm(false)
-			if err != nil {
-				if cp.sleepOnErrorInterval > 0 {
-					time.Sleep(cp.sleepOnErrorInterval)
-				}
-				continue
-			}
+		return channel, nil
+	}
+}
+
+// closeTransientChannel closes a transient channel that may already be closed.
+func closeTransientChannel(channel *amqp.Channel) {
+
+	defer func() { _ = recover() }()
+
+	channel.Close()
+}
+
+// CircuitState is the state of the circuit breaker, always CircuitClosed when one isn't configured.
+func (cp *ConnectionPool) CircuitState() CircuitState {
+
+	if cp.breaker == nil {
+		return CircuitClosed
+	}
+
+	return cp.breaker.State()
+}
+
+// allowCircuit returns ErrCircuitOpen when operations should fail fast.
+func (cp *ConnectionPool) allowCircuit() error {
+
+	if cp.breaker == nil {
+		return nil
+	}
+
+	return cp.breaker.Allow()
+}
+
+// waitForCircuit sleeps, rather than spinning, until the circuit breaker allows an operation.
+func (cp *ConnectionPool) waitForCircuit() {
+
+	if cp.breaker == nil {
+		return
+	}
+
+	for cp.breaker.Allow() != nil {
+		time.Sleep(cp.breaker.retryAfter())
+	}
+}
+
+// recordCircuit records the outcome of an allowed operation.
+func (cp *ConnectionPool) recordCircuit(err error) {
+
+	if cp.breaker != nil {
+		cp.breaker.Record(err)
+	}
+}
+
+// ActiveURI is the broker URI connections currently dial, the first of URIs unless failed over.
+func (cp *ConnectionPool) ActiveURI() string {
+
+	_, uri := cp.hosts.active()
+	return uri
+}
+
+// watchPreferredHost probes the preferred host every FailbackInterval until stopped.
+func (cp *ConnectionPool) watchPreferredHost(stop chan struct{}) {
+
+	ticker := time.NewTicker(cp.failbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			cp.failback()
 		}
-		return channel
 	}
 }
 
+// failback makes the preferred host active again once it accepts a connection, then closes connections
+// still on a fallback host. Closed connections are recovered onto the preferred host by the usual
+// health checks, so cached channels on them are rebuilt the next time they are returned in error.
+func (cp *ConnectionPool) failback() {
+
+	if index, _ := cp.hosts.active(); index == 0 {
+		return
+	}
+
+	preferred := cp.hosts.uris[0]
+	probe, err := dial(preferred, clientProperties(cp.Config.ConnectionName+"-failback", cp.Config.ClientProperties), cp.heartbeatInterval, cp.connectionTimeout, cp.Config.TLSConfig)
+	if err != nil {
+		cp.logger.Debug("connectionpool %s preferred host still unreachable: %s", cp.Config.ConnectionName, err)
+		return
+	}
+	_ = probe.Close()
+
+	if !cp.hosts.prefer() {
+		return
+	}
+
+	cp.logger.Info("connectionpool %s preferred host reachable, moving connections back", cp.Config.ConnectionName)
+	cp.notify(EventHostFailback, 0, "preferred host reachable, moving connections back")
+
+	cp.poolRWLock.RLock()
+	connectionHosts := cp.connectionHosts
+	cp.poolRWLock.RUnlock()
+
+	for _, connHost := range connectionHosts {
+		connHost.disconnectFrom(func(uri string) bool { return uri != preferred })
+	}
+}
+
+// ChannelExceptions yields broker initiated closures of cached channels, correlated with the operation in flight.
+// Oldest exceptions are dropped when nobody is reading.
+func (cp *ConnectionPool) ChannelExceptions() <-chan *ChannelException {
+	return cp.channelExceptions
+}
+
+// Errors yields the ErrorEvents of failed connection and channel recovery attempts. Oldest errors are dropped
+// when nobody is reading.
+func (cp *ConnectionPool) Errors() <-chan error {
+	return cp.errors.errors
+}
+
+// DroppedErrors is the count of errors discarded because the Errors() channel was full.
+func (cp *ConnectionPool) DroppedErrors() uint64 {
+	return cp.errors.droppedCount()
+}
+
+// reportChannelException logs the exception and queues it without blocking.
+func (cp *ConnectionPool) reportChannelException(exception *ChannelException) {
+
+	cp.logger.Warn("connectionpool %s %s", cp.Config.ConnectionName, exception.Error())
+
+	for {
+		select {
+		case cp.channelExceptions <- exception:
+			return
+		default:
+		}
+
+		select {
+		case <-cp.channelExceptions:
+		default:
+		}
+	}
+}
+
+// notify sends a PoolEvent to the Notifier when webhook notifications are enabled.
+func (cp *ConnectionPool) notify(eventType string, connectionID uint64, message string) {
+
+	if cp.notifier == nil {
+		return
+	}
+
+	cp.notifier.Notify(&PoolEvent{
+		Type:           eventType,
+		ConnectionName: cp.Config.ConnectionName,
+		ConnectionID:   connectionID,
+		Message:        message,
+		UTCDateTime:    time.Now().UTC(),
+	})
+}
+
 // UnflagConnection flags that connection as usable in the future.
 func (cp *ConnectionPool) unflagConnection(connectionID uint64) {
 	cp.poolRWLock.Lock()
@@ -311,9 +965,46 @@ func (cp *ConnectionPool) isConnectionFlagged(connectionID uint64) bool {
 	return false
 }
 
-// Shutdown closes all connections in the ConnectionPool and resets the Pool to pre-initialized state.
+// Shutdown closes all connections in the ConnectionPool. Only the first call has any effect and the
+// ConnectionPool can't be used afterwards.
 func (cp *ConnectionPool) Shutdown() {
 
+	if !cp.transition(PoolReady, PoolShuttingDown) {
+		return
+	}
+
+	close(cp.closing)
+	cp.logger.Info("connectionpool %s shutting down", cp.Config.ConnectionName)
+	cp.emitLifecycle(LifecycleShuttingDown, "")
+	cp.runShutdownHooks(ShutdownPreDrain)
+
+	cp.poolRWLock.Lock()
+	if cp.failbackStop != nil {
+		close(cp.failbackStop)
+		cp.failbackStop = nil
+	}
+
+	if cp.reapStop != nil {
+		close(cp.reapStop)
+		cp.reapStop = nil
+	}
+
+	if cp.faultStop != nil {
+		close(cp.faultStop)
+		cp.faultStop = nil
+	}
+
+	if cp.recycleStop != nil {
+		close(cp.recycleStop)
+		cp.recycleStop = nil
+	}
+
+	if cp.slowStop != nil {
+		close(cp.slowStop)
+		cp.slowStop = nil
+	}
+	cp.poolRWLock.Unlock()
+
 	wg := &sync.WaitGroup{}
 
 ChannelFlushLoop:
@@ -335,31 +1026,53 @@ ChannelFlushLoop:
 	}
 
 	wg.Wait()
+	cp.runShutdownHooks(ShutdownPostDrain)
 
-	for !cp.connections.Empty() {
-		items, _ := cp.connections.Get(cp.connections.Len())
-
-		for _, item := range items {
-			wg.Add(1)
+	// Disposing wakes anyone waiting on a connection; connections checked out right now are closed on return.
+	for _, item := range cp.connections.Dispose() {
+		wg.Add(1)
 
-			connectionHost := item.(*ConnectionHost)
+		connectionHost := item.(*ConnectionHost)
 
-			// Started receiving panics on Connection.Close()
-			go func(*ConnectionHost) {
-				defer wg.Done()
-				defer func() { _ = recover() }()
-
-				if !connectionHost.Connection.IsClosed() {
-					connectionHost.Connection.Close()
-				}
-			}(connectionHost)
+		// Started receiving panics on Connection.Close()
+		go func(*ConnectionHost) {
+			defer wg.Done()
+			defer func() { _ = recover() }()
 
-		}
+			if !connectionHost.Connection.IsClosed() {
+				connectionHost.Connection.Close()
+			}
+		}(connectionHost)
 	}
 
 	wg.Wait()
 
-	cp.connections = queue.New(int64(cp.Config.MaxConnectionCount))
+	cp.poolRWLock.Lock()
 	cp.flaggedConnections = make(map[uint64]bool)
-	cp.connectionID = 0
+	cp.cachedChannels = make(map[uint64]*ChannelHost)
+	cp.connectionHosts = nil
+	cp.poolRWLock.Unlock()
+
+	cp.transition(PoolShuttingDown, PoolShutdown)
+	cp.runShutdownHooks(ShutdownPostClose)
+	cp.logger.Info("connectionpool %s shutdown complete", cp.Config.ConnectionName)
+	cp.emitLifecycle(LifecycleShutdown, "")
+}
+
+// OnShutdown registers a hook to run at a stage of Shutdown. Hooks of a stage run in registration order.
+// Pre-drain runs before cached channels close, post-drain before connections close, and post-close last.
+func (cp *ConnectionPool) OnShutdown(stage ShutdownStage, name string, hook func() error) {
+	cp.shutdownHooks.add(stage, name, hook)
+}
+
+func (cp *ConnectionPool) runShutdownHooks(stage ShutdownStage) {
+
+	for _, err := range cp.shutdownHooks.run(stage) {
+		cp.logger.Error("connectionpool %s %s", cp.Config.ConnectionName, err)
+	}
+}
+
+// Logger returns the Logger used by the ConnectionPool and everything built on top of it.
+func (cp *ConnectionPool) Logger() Logger {
+	return cp.logger
 }
@@ -4,9 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 )
 
 // Consumer receives messages from a RabbitMQ location.
@@ -16,32 +17,54 @@ type Consumer struct {
 	Enabled              bool
 	QueueName            string
 	ConsumerName         string
-	errors               chan error
+	queueNames           []string          // every queue consumed, QueueName first
+	consumerTags         map[string]string // the queue of each consumer tag, when consuming more than one
+	errors               *errorBuffer
 	sleepOnErrorInterval time.Duration
 	sleepOnIdleInterval  time.Duration
 	messageGroup         *sync.WaitGroup
 	receivedMessages     chan *ReceivedMessage
 	consumeStop          chan bool
 	stopImmediate        bool
+	paused               int32
 	Started              bool
 	autoAck              bool
 	exclusive            bool
 	noWait               bool
 	args                 amqp.Table
 	qosCountOverride     int
+	qosChange            chan int // QosCountOverride changes for the running consume loop
+	prefetch             *ByteBudgetPrefetch
+	deduper              Deduper
+	dedupHeader          string
+	duplicates           uint64
+	retry                *retryPolicy
+	quarantine           *quarantinePolicy
+	stream               *streamPosition
+	onPanic              string
+	handlerTimeout       time.Duration
+	onHandlerTimeout     string
+	acks                 *ackBatcher
+	chunks               *chunkAssembler
+	messageAges          *Histogram
+	metrics              *consumerMetrics
+	inflight             *inflightTracker
+	drainDone            chan *ChannelHost // set while draining, receives the channel kept open for settlement
+	drainHost            *ChannelHost
 	conLock              *sync.Mutex
 }
 
 // NewConsumerFromConfig creates a new Consumer to receive messages from a specific queuename.
 func NewConsumerFromConfig(config *ConsumerConfig, cp *ConnectionPool) *Consumer {
 
-	return &Consumer{
+	con := &Consumer{
 		Config:               config,
 		ConnectionPool:       cp,
 		Enabled:              config.Enabled,
 		QueueName:            config.QueueName,
 		ConsumerName:         config.ConsumerName,
-		errors:               make(chan error, 1000),
+		queueNames:           consumeQueues(config.QueueName, config.QueueNames),
+		errors:               newErrorBuffer(config.ErrorBuffer, SubsystemConsumer),
 		sleepOnErrorInterval: time.Duration(config.SleepOnErrorInterval) * time.Millisecond,
 		sleepOnIdleInterval:  time.Duration(config.SleepOnIdleInterval) * time.Millisecond,
 		messageGroup:         &sync.WaitGroup{},
@@ -50,10 +73,28 @@ func NewConsumerFromConfig(config *ConsumerConfig, cp *ConnectionPool) *Consumer
 		autoAck:              config.AutoAck,
 		exclusive:            config.Exclusive,
 		noWait:               config.NoWait,
-		args:                 amqp.Table(config.Args),
+		args:                 consumerArgs(config),
 		qosCountOverride:     config.QosCountOverride,
+		qosChange:            make(chan int, 1),
+		prefetch:             newPrefetch(config.PrefetchByteBudget),
+		deduper:              config.Deduper,
+		dedupHeader:          config.DedupHeader,
+		retry:                newRetryPolicy(config.QueueName, config.RetryConfig),
+		quarantine:           newQuarantinePolicy(config.QueueName, config.QuarantineConfig),
+		stream:               newStreamPosition(config.ConsumerName, config.StreamConfig, cp),
+		onPanic:              onPanicAction(config.ConsumerName, config.OnPanic, cp),
+		handlerTimeout:       time.Duration(config.HandlerTimeout) * time.Millisecond,
+		onHandlerTimeout:     onHandlerTimeoutAction(config.ConsumerName, config.OnHandlerTimeout, cp),
+		chunks:               newChunkAssembler(config.ChunkTimeout),
+		messageAges:          NewHistogram(nil),
+		metrics:              newConsumerMetrics(),
+		inflight:             &inflightTracker{},
 		conLock:              &sync.Mutex{},
 	}
+
+	con.acks = newAckBatcher(config.AckBatchConfig, con.errors)
+
+	return con
 }
 
 // NewConsumer creates a new Consumer to receive messages from a specific queuename.
@@ -76,13 +117,14 @@ func NewConsumer(
 		return nil, fmt.Errorf("consumer %q was not found in config", consumerName)
 	}
 
-	return &Consumer{
+	con := &Consumer{
 		Config:               config,
 		ConnectionPool:       cp,
 		Enabled:              true,
 		QueueName:            queuename,
 		ConsumerName:         consumerName,
-		errors:               make(chan error, 1000),
+		queueNames:           consumeQueues(queuename, config.QueueNames),
+		errors:               newErrorBuffer(config.ErrorBuffer, SubsystemConsumer),
 		sleepOnErrorInterval: time.Duration(sleepOnErrorInterval) * time.Millisecond,
 		sleepOnIdleInterval:  time.Duration(sleepOnIdleInterval) * time.Millisecond,
 		messageGroup:         &sync.WaitGroup{},
@@ -95,15 +137,36 @@ func NewConsumer(
 		noWait:               noWait,
 		args:                 args,
 		qosCountOverride:     qosCountOverride,
+		qosChange:            make(chan int, 1),
+		prefetch:             newPrefetch(config.PrefetchByteBudget),
+		deduper:              config.Deduper,
+		dedupHeader:          config.DedupHeader,
+		retry:                newRetryPolicy(queuename, config.RetryConfig),
+		quarantine:           newQuarantinePolicy(queuename, config.QuarantineConfig),
+		stream:               newStreamPosition(consumerName, config.StreamConfig, cp),
+		onPanic:              onPanicAction(consumerName, config.OnPanic, cp),
+		handlerTimeout:       time.Duration(config.HandlerTimeout) * time.Millisecond,
+		onHandlerTimeout:     onHandlerTimeoutAction(consumerName, config.OnHandlerTimeout, cp),
+		chunks:               newChunkAssembler(config.ChunkTimeout),
+		messageAges:          NewHistogram(nil),
+		metrics:              newConsumerMetrics(),
+		inflight:             &inflightTracker{},
 		conLock:              &sync.Mutex{},
-	}, nil
+	}
+
+	con.acks = newAckBatcher(config.AckBatchConfig, con.errors)
+
+	return con, nil
 }
 
 // Get gets a single message from any queue. Auto-Acknowledges.
 func (con *Consumer) Get(queueName string) (*amqp.Delivery, error) {
 
 	// Get Channel
-	channel := con.ConnectionPool.GetTransientChannel(false)
+	channel, err := con.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return nil, err
+	}
 	defer channel.Close()
 
 	// Get Single Message
@@ -127,7 +190,10 @@ func (con *Consumer) GetBatch(queueName string, batchSize int) ([]*amqp.Delivery
 	}
 
 	// Get Channel
-	channel := con.ConnectionPool.GetTransientChannel(false)
+	channel, err := con.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return nil, err
+	}
 	defer channel.Close()
 
 	messages := make([]*amqp.Delivery, 0)
@@ -155,6 +221,15 @@ GetBatchLoop:
 	return messages, nil
 }
 
+// logStart logs the Consumer starting, and that it waits on standby when its queue has a single active consumer.
+func (con *Consumer) logStart() {
+
+	con.ConnectionPool.logger.Info("consumer %s starting on queue %s", con.ConsumerName, con.QueueName)
+	if con.Config != nil && con.Config.SingleActiveConsumer {
+		con.ConnectionPool.logger.Info("consumer %s is on standby until the broker makes it the single active consumer of queue %s", con.ConsumerName, con.QueueName)
+	}
+}
+
 // StartConsuming starts the Consumer.
 func (con *Consumer) StartConsuming() {
 	con.conLock.Lock()
@@ -165,6 +240,8 @@ func (con *Consumer) StartConsuming() {
 		con.FlushErrors()
 		con.FlushStop()
 
+		con.logStart()
+		con.ConnectionPool.trackConsumer(con)
 		go con.startConsumeLoop(nil)
 		con.Started = true
 	}
@@ -180,13 +257,88 @@ func (con *Consumer) StartConsumingWithAction(action func(*ReceivedMessage)) {
 		con.FlushErrors()
 		con.FlushStop()
 
+		con.logStart()
+		con.ConnectionPool.trackConsumer(con)
 		go con.startConsumeLoop(action)
 		con.Started = true
 	}
 }
 
+// StartConsumingWithHandler starts the Consumer, acknowledging each message whose handler returns nil.
+// With a RetryConfig, failed messages are republished to a delayed retry queue (declared here) and then
+// parked after MaxAttempts retries. Without one, failed messages are nacked without requeueing.
+func (con *Consumer) StartConsumingWithHandler(handler func(*ReceivedMessage) error) error {
+
+	if con.retry != nil && len(con.queueNames) > 1 {
+		return errors.New("consumer retries only support a single queue, not QueueNames")
+	}
+
+	if con.retry != nil {
+		if err := NewTopologer(con.ConnectionPool).BuildToplogy(con.retry.topology(), false); err != nil {
+			return fmt.Errorf("consumer unable to declare retry queues: %w", err)
+		}
+	}
+
+	con.StartConsumingWithAction(func(msg *ReceivedMessage) {
+		con.settle(msg, handler(msg))
+	})
+
+	return nil
+}
+
+// settle acknowledges a handled message or hands a failed one to the retry policy.
+func (con *Consumer) settle(msg *ReceivedMessage, handlerErr error) {
+
+	if msg.timedOut() { // nacked when the HandlerTimeout passed
+		return
+	}
+
+	// A handler failing past its deadline, ex. returning ctx.Err(), is settled per OnHandlerTimeout.
+	if handlerErr != nil && msg.Context().Err() != nil && con.expireMessage(msg) {
+		return
+	}
+
+	if handlerErr != nil {
+		con.errors.report("handle", int(GetRetryCount(msg.Headers))+1, handlerErr)
+
+		if msg.isSettled() { // by the handler itself
+			return
+		}
+
+		if con.retry == nil {
+			if msg.IsAckable {
+				if err := msg.Nack(false); err != nil {
+					con.errors.report("nack", 0, fmt.Errorf("consumer unable to nack failed message: %w", err))
+				}
+			}
+			return
+		}
+
+		if err := con.retry.republish(con.ConnectionPool, msg, handlerErr); err != nil {
+			con.errors.report("retry", int(GetRetryCount(msg.Headers))+1, fmt.Errorf("consumer unable to republish message for retry: %w", err))
+
+			if msg.IsAckable { // leave it with the broker rather than lose it
+				if err := msg.Nack(true); err != nil {
+					con.errors.report("nack", 0, fmt.Errorf("consumer unable to nack failed message: %w", err))
+				}
+			}
+			return
+		}
+	}
+
+	if msg.IsAckable && !msg.isSettled() {
+		if err := msg.Acknowledge(); err != nil {
+			con.errors.report("ack", 0, fmt.Errorf("consumer unable to acknowledge message: %w", err))
+		}
+	}
+}
+
 func (con *Consumer) startConsumeLoop(action func(*ReceivedMessage)) {
 
+	if con.acks != nil && !con.autoAck {
+		con.acks.start()
+	}
+
 ConsumeLoop:
 	for {
 		// Detect if we should stop consuming.
@@ -199,23 +351,47 @@ ConsumeLoop:
 			break
 		}
 
-		// Get ChannelHost
-		chanHost := con.ConnectionPool.GetChannelFromPool()
+		// Hold off consuming while paused, returns true when we are to stop all consuming.
+		if con.waitWhilePaused() {
+			break ConsumeLoop
+		}
+
+		// Get ChannelHost, the pool shutting down stops all consuming.
+		chanHost, err := con.ConnectionPool.getChannel()
+		if err != nil {
+			con.errors.report("consume", 0, fmt.Errorf("consumer unable to get a channel: %w", err))
+			break ConsumeLoop
+		}
 
 		// Configure RabbitMQ channel QoS for Consumer
-		if con.qosCountOverride > 0 {
-			chanHost.Channel.Qos(con.qosCountOverride, 0, false)
+		chanHost.setOperation("basic.qos", con.QueueName)
+		if con.prefetch != nil {
+			// Channel wide (global) so the limit can be adjusted for the running consumer.
+			chanHost.Channel.Qos(con.prefetch.Prefetch(), 0, true)
+		} else if qosCount := con.qosCount(); qosCount > 0 {
+			chanHost.Channel.Qos(qosCount, 0, false)
+		} else if con.stream != nil {
+			chanHost.Channel.Qos(defaultStreamPrefetch, 0, false)
+		}
+
+		// Streams are read from an offset, resuming after the last delivered message when re-consuming.
+		args := con.args
+		if con.stream != nil {
+			args = con.stream.consumeArgs(con.args)
 		}
 
 		// Initiate consuming process.
-		deliveryChan, err := chanHost.Channel.Consume(con.QueueName, con.ConsumerName, con.autoAck, con.exclusive, false, con.noWait, nil)
+		deliveryChan, stopMerging, err := con.consume(chanHost, args)
 		if err != nil {
-			con.ConnectionPool.ReturnChannel(chanHost, true)
+			con.ConnectionPool.logger.Error("consumer %s unable to consume, retrying: %s", con.ConsumerName, err)
+			con.returnChannel(chanHost, true)
 			continue
 		}
 
 		// Process delivered messages by the consumer, returns true when we are to stop all consuming.
-		if con.processDeliveries(deliveryChan, chanHost, action) {
+		stop := con.processDeliveries(deliveryChan, chanHost, action)
+		stopMerging()
+		if stop {
 			break ConsumeLoop
 		}
 	}
@@ -228,10 +404,24 @@ ConsumeLoop:
 		con.messageGroup.Wait() // wait for every message to be received to the internal queue
 	}
 
+	if con.acks != nil && !con.autoAck {
+		con.acks.stopAndFlush()
+	}
+
 	con.conLock.Lock()
 	con.Started = false
 	con.stopImmediate = false
+	atomic.StoreInt32(&con.paused, 0)
+	drainDone, drainHost := con.drainDone, con.drainHost
+	con.drainDone, con.drainHost = nil, nil
 	con.conLock.Unlock()
+
+	if drainDone != nil {
+		drainDone <- drainHost
+	}
+
+	con.ConnectionPool.untrackConsumer(con)
+	con.ConnectionPool.logger.Info("consumer %s stopped consuming from queue %s", con.ConsumerName, con.QueueName)
 }
 
 // ProcessDeliveries is the inner loop for processing the deliveries and returns true to break outer loop.
@@ -243,8 +433,9 @@ func (con *Consumer) processDeliveries(deliveryChan <-chan amqp.Delivery, chanHo
 		select {
 		case errorMessage := <-chanHost.Errors:
 			if errorMessage != nil {
-				con.ConnectionPool.ReturnChannel(chanHost, true)
-				con.errors <- fmt.Errorf("consumer's current channel closed\r\n[reason: %s]\r\n[code: %d]", errorMessage.Reason, errorMessage.Code)
+				con.ConnectionPool.logger.Warn("consumer %s channel closed [code: %d] %s, reconnecting", con.ConsumerName, errorMessage.Code, errorMessage.Reason)
+				con.returnChannel(chanHost, true)
+				con.errors.send(NewErrorEvent(SubsystemChannel, "consume", 0, NewChannelException(chanHost, errorMessage)))
 				return false
 			}
 		default:
@@ -255,20 +446,24 @@ func (con *Consumer) processDeliveries(deliveryChan <-chan amqp.Delivery, chanHo
 		select {
 		case delivery := <-deliveryChan: // all buffered deliveries are wiped on a channel close error
 
-			msg := NewMessage(
-				!con.autoAck,
-				delivery.Body,
-				delivery.Headers,
-				delivery.DeliveryTag,
-				chanHost.Channel)
+			if age, ok := GetMessageAge(&delivery); ok {
+				con.messageAges.Observe(age)
+			}
 
-			if action != nil {
-				action(msg)
-			} else {
-				con.receivedMessages <- msg
+			if con.prefetch != nil {
+				if prefetch, changed := con.prefetch.Observe(len(delivery.Body)); changed {
+					con.ConnectionPool.logger.Debug("consumer %s prefetch adjusted to %d", con.ConsumerName, prefetch)
+					if err := chanHost.Channel.Qos(prefetch, 0, true); err != nil {
+						con.errors.report("qos", 0, fmt.Errorf("consumer unable to adjust prefetch to %d: %w", prefetch, err))
+					}
+				}
 			}
 
+			con.handleDelivery(&delivery, con.acknowledger(chanHost, delivery.DeliveryTag), action)
+
 		default:
+			con.expireChunks() // a message missing chunks stops further chunks arriving once it fills the prefetch
+
 			if con.sleepOnIdleInterval > 0 {
 				time.Sleep(con.sleepOnIdleInterval)
 			}
@@ -279,13 +474,105 @@ func (con *Consumer) processDeliveries(deliveryChan <-chan amqp.Delivery, chanHo
 		select {
 		case stop := <-con.consumeStop:
 			if stop {
-				con.ConnectionPool.ReturnChannel(chanHost, false)
+				if con.draining() {
+					drainHost := con.drainDeliveries(deliveryChan, chanHost, action)
+					con.conLock.Lock()
+					con.drainHost = drainHost
+					con.conLock.Unlock()
+					return true
+				}
+
+				con.returnChannel(chanHost, false)
 				return true
 			}
+		case qosCount := <-con.qosChange:
+			if con.prefetch == nil && qosCount > 0 {
+				if err := chanHost.Channel.Qos(qosCount, 0, false); err != nil {
+					con.errors.report("qos", 0, fmt.Errorf("consumer unable to adjust prefetch to %d: %w", qosCount, err))
+				}
+			}
 		default:
 			break
 		}
+
+		if con.Paused() {
+			con.cancelDeliveries(deliveryChan, chanHost, action)
+			return false
+		}
+	}
+}
+
+// cancelDeliveries sends basic.cancel and handles deliveries already in flight before returning the channel.
+func (con *Consumer) cancelDeliveries(deliveryChan <-chan amqp.Delivery, chanHost *ChannelHost, action func(*ReceivedMessage)) {
+
+	if err := con.cancel(chanHost); err != nil {
+		con.returnChannel(chanHost, true)
+		con.errors.report("pause", 0, fmt.Errorf("consumer unable to cancel while pausing: %w", err))
+		return // a closed channel takes its unacked deliveries with it
+	}
+
+	for delivery := range deliveryChan { // closed by streadway/amqp once the cancel completes
+		con.handleDelivery(&delivery, con.acknowledger(chanHost, delivery.DeliveryTag), action)
 	}
+
+	con.returnChannel(chanHost, false)
+	con.ConnectionPool.logger.Info("consumer %s paused on queue %s", con.ConsumerName, con.QueueName)
+}
+
+// waitWhilePaused blocks until the consumer is resumed, returning true if it was stopped instead.
+func (con *Consumer) waitWhilePaused() bool {
+
+	for con.Paused() {
+		select {
+		case stop := <-con.consumeStop:
+			if stop {
+				return true
+			}
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	return false
+}
+
+// PauseConsuming cancels the consumer on the broker, so no new messages are delivered, without stopping it.
+// Messages already delivered are still processed and the cached channel goes back to the ConnectionPool.
+func (con *Consumer) PauseConsuming() error {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	if !con.Started {
+		return errors.New("can't pause a stopped consumer")
+	}
+
+	atomic.StoreInt32(&con.paused, 1)
+	return nil
+}
+
+// ResumeConsuming consumes from the queue again after PauseConsuming.
+func (con *Consumer) ResumeConsuming() error {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	if !con.Started {
+		return errors.New("can't resume a stopped consumer")
+	}
+
+	atomic.StoreInt32(&con.paused, 0)
+	return nil
+}
+
+// Paused reports whether PauseConsuming is in effect.
+func (con *Consumer) Paused() bool {
+	return atomic.LoadInt32(&con.paused) == 1
+}
+
+// consuming reads Started under the Consumer's lock.
+func (con *Consumer) consuming() bool {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	return con.Started
 }
 
 // StopConsuming allows you to signal stop to the consumer.
@@ -311,18 +598,250 @@ func (con *Consumer) StopConsuming(immediate bool, flushMessages bool) error {
 	return nil
 }
 
+// Prefetch is the consumer's current prefetch count when using a PrefetchByteBudget, otherwise the QosCountOverride.
+func (con *Consumer) Prefetch() int {
+
+	if con.prefetch != nil {
+		return con.prefetch.Prefetch()
+	}
+
+	return con.qosCount()
+}
+
+// qosCount is the QosCountOverride, which ReloadConfig can change while consuming.
+func (con *Consumer) qosCount() int {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	return con.qosCountOverride
+}
+
 // ReceivedMessages yields all the internal messages ready for consuming.
 func (con *Consumer) ReceivedMessages() <-chan *ReceivedMessage {
 	return con.receivedMessages
 }
 
-// Errors yields all the internal errs for consuming messages.
+// MessageAges yields the histogram of message ages (now minus published time) observed by this consumer.
+// Messages without a Timestamp property or HeaderPublishedAt header are not recorded.
+func (con *Consumer) MessageAges() *HistogramSnapshot {
+	return con.messageAges.Snapshot()
+}
+
+// GetMessageAge calculates how long ago a delivery was published.
+// Prefers the HeaderPublishedAt header (time, unix milliseconds, or RFC3339 string) for its
+// precision and falls back to the AMQP Timestamp property (seconds).
+func GetMessageAge(delivery *amqp.Delivery) (time.Duration, bool) {
+
+	if publishedAt, ok := Headers(delivery.Headers).GetTime(HeaderPublishedAt); ok {
+		return time.Since(publishedAt), true
+	}
+
+	if !delivery.Timestamp.IsZero() {
+		return time.Since(delivery.Timestamp), true
+	}
+
+	return 0, false
+}
+
+// skipDuplicate acks the delivery, and any earlier chunks of it, and returns true when the Deduper has already
+// processed its key. Dedup failures are sent to Errors and the delivery is handled normally.
+func (con *Consumer) skipDuplicate(delivery *amqp.Delivery, chunkTags []uint64, acknowledger amqp.Acknowledger, dedupKey string) bool {
+
+	duplicate, err := con.deduper.IsDuplicate(dedupKey)
+	if err != nil {
+		con.errors.report("dedup", 0, fmt.Errorf("consumer unable to check message %q for duplication: %w", dedupKey, err))
+		return false
+	}
+
+	if !duplicate {
+		return false
+	}
+
+	atomic.AddUint64(&con.duplicates, 1)
+
+	if !con.autoAck && acknowledger != nil {
+		for _, deliveryTag := range append(chunkTags, delivery.DeliveryTag) {
+			if err := acknowledger.Ack(deliveryTag, false); err != nil {
+				con.errors.report("ack", 0, fmt.Errorf("consumer unable to ack duplicate message %q: %w", dedupKey, err))
+			}
+		}
+	}
+
+	return true
+}
+
+// Duplicates is the count of deliveries skipped (and acked) because the Deduper had already processed them.
+func (con *Consumer) Duplicates() uint64 {
+	return atomic.LoadUint64(&con.duplicates)
+}
+
+// Errors yields all the internal errs for consuming messages, each an ErrorEvent.
 func (con *Consumer) Errors() <-chan error {
-	return con.errors
+	return con.errors.errors
+}
+
+// DroppedErrors is the count of errors discarded because the Errors() channel was full.
+func (con *Consumer) DroppedErrors() uint64 {
+	return con.errors.droppedCount()
+}
+
+// acknowledger is what a delivery on the channel settles through, the ackBatcher when acks are batched.
+func (con *Consumer) acknowledger(chanHost *ChannelHost, deliveryTag uint64) amqp.Acknowledger {
+
+	if con.acks != nil && !con.autoAck {
+		return con.acks.deliver(chanHost.Channel, deliveryTag)
+	}
+
+	return chanHost.Channel
 }
 
-func (con *Consumer) convertDelivery(amqpChan *amqp.Channel, delivery *amqp.Delivery, isAckable bool) {
+// returnChannel hands the channel back to the ConnectionPool, which may rebuild or replace it, retiring its ack
+// window first.
+func (con *Consumer) returnChannel(chanHost *ChannelHost, erred bool) {
 
+	if con.acks != nil {
+		con.acks.retire(chanHost.Channel)
+	}
+
+	con.ConnectionPool.ReturnChannel(chanHost, erred)
+}
+
+// handleDelivery converts the delivery and hands it to the action or the ReceivedMessages channel.
+func (con *Consumer) handleDelivery(delivery *amqp.Delivery, acknowledger amqp.Acknowledger, action func(*ReceivedMessage)) {
+
+	con.metrics.delivered(delivery)
+
+	if con.stream != nil {
+		con.stream.observe(delivery)
+	}
+
+	var chunkTags []uint64
+	if isChunk(delivery) {
+		var complete bool
+		if delivery, chunkTags, complete = con.assembleChunk(delivery, acknowledger); !complete {
+			return
+		}
+	}
+
+	if con.quarantine != nil && !con.autoAck && con.quarantineDelivery(delivery, chunkTags, acknowledger) {
+		return
+	}
+
+	dedupKey := ""
+	if con.deduper != nil {
+		dedupKey = GetDedupKey(delivery, con.dedupHeader)
+		if dedupKey != "" && con.skipDuplicate(delivery, chunkTags, acknowledger, dedupKey) {
+			return
+		}
+	}
+
+	msg := con.convertDelivery(acknowledger, delivery, !con.autoAck)
+	msg.chunkTags = chunkTags
+
+	if dedupKey != "" {
+		if con.autoAck { // already acknowledged by the server
+			if err := con.deduper.MarkProcessed(dedupKey); err != nil {
+				con.errors.report("dedup", 0, fmt.Errorf("consumer unable to mark message %q processed: %w", dedupKey, err))
+			}
+		} else {
+			msg.deduper = con.deduper
+			msg.dedupKey = dedupKey
+		}
+	}
+
+	if action != nil {
+		con.invokeAction(action, msg)
+	} else {
+		con.receivedMessages <- msg
+	}
+}
+
+// assembleChunk holds a chunk until the rest of its message arrives, returning the reassembled delivery and the
+// delivery tags of its earlier chunks once complete. Malformed chunks are rejected without requeueing.
+func (con *Consumer) assembleChunk(delivery *amqp.Delivery, acknowledger amqp.Acknowledger) (*amqp.Delivery, []uint64, bool) {
+
+	con.expireChunks()
+
+	chunkID, _ := delivery.Headers[HeaderChunkID].(string)
+	count, _ := headerInt(delivery.Headers[HeaderChunkCount])
+	if qosCount := con.qosCount(); con.prefetch == nil && qosCount > 0 && count > qosCount && !con.chunks.pending(chunkID) {
+		con.errors.report("reassemble", 0, fmt.Errorf("consumer prefetch %d is below the %d chunks of message %s, it can't be reassembled", qosCount, count, chunkID))
+	}
+
+	assembled, chunkTags, err := con.chunks.add(delivery, acknowledger)
+	if err != nil {
+		con.errors.report("reassemble", 0, fmt.Errorf("consumer unable to reassemble message: %w", err))
+
+		if !con.autoAck && acknowledger != nil {
+			_ = acknowledger.Reject(delivery.DeliveryTag, false)
+		}
+		return nil, nil, false
+	}
+
+	return assembled, chunkTags, assembled != nil
+}
+
+// expireChunks settles the chunks of messages that didn't all arrive within the ChunkTimeout. They are requeued
+// the first time, for the rest may be held by a competing consumer or behind the prefetch limit, and rejected
+// once they time out again, dead lettered when the queue has a dead letter exchange.
+func (con *Consumer) expireChunks() {
+
+	for chunkID, set := range con.chunks.expire() {
+		if con.autoAck || set.acknowledger == nil {
+			con.errors.report("reassemble", 0, fmt.Errorf("consumer dropped chunked message %s, only %d of %d chunks arrived in time", chunkID, set.received, len(set.parts)))
+			continue
+		}
+
+		requeue := !set.redelivered
+		for _, deliveryTag := range set.deliveryTags {
+			if requeue {
+				_ = set.acknowledger.Nack(deliveryTag, false, true)
+			} else {
+				_ = set.acknowledger.Reject(deliveryTag, false)
+			}
+		}
+
+		if requeue {
+			con.errors.report("reassemble", 0, fmt.Errorf("consumer requeued chunked message %s, only %d of %d chunks arrived in time", chunkID, set.received, len(set.parts)))
+		} else {
+			con.errors.report("reassemble", 0, fmt.Errorf("consumer rejected chunked message %s, only %d of %d chunks arrived in time after a requeue", chunkID, set.received, len(set.parts)))
+		}
+	}
+}
+
+func (con *Consumer) convertDelivery(acknowledger amqp.Acknowledger, delivery *amqp.Delivery, isAckable bool) *ReceivedMessage {
+
+	msg := &ReceivedMessage{
+		IsAckable:       isAckable,
+		Body:            delivery.Body,
+		Headers:         delivery.Headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		MessageID:       delivery.MessageId,
+		CorrelationID:   delivery.CorrelationId,
+		ReplyTo:         delivery.ReplyTo,
+		Type:            delivery.Type,
+		AppID:           delivery.AppId,
+		Priority:        delivery.Priority,
+		Timestamp:       delivery.Timestamp,
+		Exchange:        delivery.Exchange,
+		RoutingKey:      delivery.RoutingKey,
+		Queue:           con.QueueName,
+		deliveryTag:     delivery.DeliveryTag,
+		acknowledger:    acknowledger,
+	}
+
+	if queueName, ok := con.consumerTags[delivery.ConsumerTag]; ok {
+		msg.Queue = queueName
+	}
+
+	if isAckable {
+		msg.inflight = con.inflight
+		msg.metrics = con.metrics
+		con.inflight.deliver()
+	}
+
+	return msg
 }
 
 // FlushStop allows you to flush out all previous Stop signals.
@@ -340,15 +859,7 @@ FlushLoop:
 
 // FlushErrors allows you to flush out all previous Errors.
 func (con *Consumer) FlushErrors() {
-
-FlushLoop:
-	for {
-		select {
-		case <-con.errors:
-		default:
-			break FlushLoop
-		}
-	}
+	con.errors.flush()
 }
 
 // FlushMessages allows you to flush out all previous Messages.
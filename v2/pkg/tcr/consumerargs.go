@@ -0,0 +1,35 @@
+package tcr
+
+import "github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+
+const (
+	// ConsumerArgPriority is the basic.consume argument for a consumer's priority.
+	ConsumerArgPriority = "x-priority"
+
+	// ConsumerArgTimeout is the basic.consume argument for how long, in ms, a delivery may go unacknowledged.
+	ConsumerArgTimeout = "x-consumer-timeout"
+)
+
+// consumerArgs copies the config's Args, adding the arguments of its Priority and ConsumerTimeout. Args set
+// explicitly win.
+func consumerArgs(config *ConsumerConfig) amqp.Table {
+
+	if config.Priority == 0 && config.ConsumerTimeout == 0 {
+		return amqp.Table(config.Args)
+	}
+
+	args := make(amqp.Table, len(config.Args)+2)
+	if config.Priority != 0 {
+		args[ConsumerArgPriority] = config.Priority
+	}
+
+	if config.ConsumerTimeout > 0 {
+		args[ConsumerArgTimeout] = int64(config.ConsumerTimeout)
+	}
+
+	for key, value := range config.Args {
+		args[key] = value
+	}
+
+	return args
+}
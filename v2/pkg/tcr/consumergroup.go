@@ -0,0 +1,344 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConsumerGroup runs several Consumers against the same queue as one unit. Each member consumes on its own
+// channel from the ConnectionPool, so the broker round-robins the queue's messages across the members and
+// their connections. Messages and errors from every member are merged into the group's channels.
+// With an AutoScaleConfig the group adds and removes members while started, following the queue's depth.
+type ConsumerGroup struct {
+	Consumers        []*Consumer
+	config           *ConsumerConfig
+	connectionPool   *ConnectionPool
+	autoScale        *autoScalePolicy
+	memberCount      int             // members ever created, so a member added by scaling gets a fresh name
+	memberStops      []chan struct{} // stops the forwarder of the member at the same index
+	startMember      func(*Consumer) error
+	forwardMessages  bool
+	receivedMessages chan *ReceivedMessage
+	errors           *errorBuffer
+	forwardStop      chan struct{}
+	forwardGroup     *sync.WaitGroup
+	scaleStop        chan struct{}
+	scaleDone        chan struct{}
+	started          bool
+	groupLock        *sync.Mutex
+}
+
+// NewConsumerGroup creates size Consumers from the config, named ConsumerName-0 through ConsumerName-(size-1).
+// With an AutoScaleConfig size is the starting count, kept between MinConsumers and MaxConsumers.
+func NewConsumerGroup(config *ConsumerConfig, cp *ConnectionPool, size int) (*ConsumerGroup, error) {
+
+	if size < 1 {
+		return nil, errors.New("consumer group needs at least one consumer")
+	}
+
+	group := &ConsumerGroup{
+		config:           config,
+		connectionPool:   cp,
+		autoScale:        newAutoScalePolicy(config.AutoScaleConfig, cp),
+		receivedMessages: make(chan *ReceivedMessage, 1000),
+		errors:           newErrorBuffer(config.ErrorBuffer, SubsystemConsumer),
+		forwardGroup:     &sync.WaitGroup{},
+		groupLock:        &sync.Mutex{},
+	}
+
+	if group.autoScale != nil && config.SingleActiveConsumer {
+		// Only one member receives messages however deep the queue gets.
+		cp.logger.Warn("consumer group %s won't autoscale, queue %s has a single active consumer", config.ConsumerName, config.QueueName)
+		group.autoScale = nil
+	}
+
+	if group.autoScale != nil {
+		size = group.autoScale.clamp(size)
+	}
+
+	group.Consumers = make([]*Consumer, size)
+	for i := range group.Consumers {
+		group.Consumers[i] = group.newMember()
+	}
+
+	return group, nil
+}
+
+// newMember creates the group's next Consumer.
+func (group *ConsumerGroup) newMember() *Consumer {
+
+	memberConfig := *group.config
+	memberConfig.ConsumerName = fmt.Sprintf("%s-%d", group.config.ConsumerName, group.memberCount)
+	group.memberCount++
+
+	return NewConsumerFromConfig(&memberConfig, group.connectionPool)
+}
+
+// StartConsuming starts every member, merging their messages into ReceivedMessages.
+func (group *ConsumerGroup) StartConsuming() error {
+
+	return group.start(func(con *Consumer) error {
+		con.StartConsuming()
+		return nil
+	}, true)
+}
+
+// StartConsumingWithAction starts every member invoking the action on each message. The action is called
+// concurrently from every member.
+func (group *ConsumerGroup) StartConsumingWithAction(action func(*ReceivedMessage)) error {
+
+	return group.start(func(con *Consumer) error {
+		con.StartConsumingWithAction(action)
+		return nil
+	}, false)
+}
+
+// StartConsumingWithHandler starts every member with Consumer.StartConsumingWithHandler. The handler is called
+// concurrently from every member.
+func (group *ConsumerGroup) StartConsumingWithHandler(handler func(*ReceivedMessage) error) error {
+
+	return group.start(func(con *Consumer) error {
+		return con.StartConsumingWithHandler(handler)
+	}, false)
+}
+
+func (group *ConsumerGroup) start(startMember func(*Consumer) error, forwardMessages bool) error {
+	group.groupLock.Lock()
+	defer group.groupLock.Unlock()
+
+	if group.started {
+		return errors.New("consumer group is already started")
+	}
+
+	group.startMember, group.forwardMessages = startMember, forwardMessages
+	group.forwardStop = make(chan struct{})
+	group.memberStops = make([]chan struct{}, 0, len(group.Consumers))
+	for i, con := range group.Consumers {
+		if err := startMember(con); err != nil {
+			_ = group.stopMembers(group.Consumers[:i], true, false)
+			return err
+		}
+
+		group.forwardMember(con)
+	}
+
+	if group.autoScale != nil {
+		group.scaleStop, group.scaleDone = make(chan struct{}), make(chan struct{})
+		go group.scale(group.scaleStop, group.scaleDone)
+	}
+
+	group.started = true
+	return nil
+}
+
+// forwardMember starts merging a started member into the group.
+func (group *ConsumerGroup) forwardMember(con *Consumer) {
+
+	memberStop := make(chan struct{})
+	group.memberStops = append(group.memberStops, memberStop)
+
+	group.forwardGroup.Add(1)
+	go group.forward(con, group.forwardMessages, memberStop)
+}
+
+// forward merges a member's errors, and messages when asked, into the group until the group, or the member, stops.
+func (group *ConsumerGroup) forward(con *Consumer, forwardMessages bool, memberStop chan struct{}) {
+	defer group.forwardGroup.Done()
+
+	var messages <-chan *ReceivedMessage // nil never receives when messages aren't forwarded
+	if forwardMessages {
+		messages = con.ReceivedMessages()
+	}
+
+	for {
+		select {
+		case <-group.forwardStop:
+			return
+
+		case <-memberStop:
+			return
+
+		case err := <-con.Errors():
+			group.errors.send(err)
+
+		case msg := <-messages:
+			select {
+			case group.receivedMessages <- msg:
+			case <-group.forwardStop:
+				return
+			}
+		}
+	}
+}
+
+// StopConsuming stops every member and the merging of their messages and errors.
+func (group *ConsumerGroup) StopConsuming(immediate bool, flushMessages bool) error {
+
+	group.stopScaling()
+
+	group.groupLock.Lock()
+	defer group.groupLock.Unlock()
+
+	if !group.started {
+		return errors.New("can't stop a stopped consumer group")
+	}
+
+	err := group.stopMembers(group.Consumers, immediate, flushMessages)
+
+	if flushMessages {
+		group.FlushMessages()
+	}
+
+	group.started = false
+	return err
+}
+
+// stopMembers stops the members and their forwarders, returning the first error.
+func (group *ConsumerGroup) stopMembers(members []*Consumer, immediate bool, flushMessages bool) error {
+
+	var firstErr error
+	for _, con := range members {
+		if err := con.StopConsuming(immediate, flushMessages); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	close(group.forwardStop)
+	group.forwardGroup.Wait()
+
+	return firstErr
+}
+
+// scale polls the queue depth and resizes the group until stopped.
+func (group *ConsumerGroup) scale(scaleStop chan struct{}, scaleDone chan struct{}) {
+	defer close(scaleDone)
+
+	ticker := time.NewTicker(group.autoScale.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-scaleStop:
+			return
+		case <-ticker.C:
+			group.resize()
+		}
+	}
+}
+
+// resize adds or removes members for the current queue depth.
+func (group *ConsumerGroup) resize() {
+
+	ctx, cancel := context.WithTimeout(context.Background(), group.autoScale.pollInterval)
+	depth, err := group.autoScale.queueDepth(ctx, group.config.QueueName)
+	cancel()
+	if err != nil {
+		group.errors.report("autoscale", 0, fmt.Errorf("consumer group unable to read the depth of queue %s: %w", group.config.QueueName, err))
+		return
+	}
+
+	group.groupLock.Lock()
+	defer group.groupLock.Unlock()
+
+	if !group.started {
+		return
+	}
+
+	current := len(group.Consumers)
+	desired := group.autoScale.desired(depth, current)
+
+	for len(group.Consumers) < desired {
+		con := group.newMember()
+		if err := group.startMember(con); err != nil {
+			group.errors.report("autoscale", 0, fmt.Errorf("consumer group unable to add consumer %s: %w", con.ConsumerName, err))
+			break
+		}
+
+		group.Consumers = append(group.Consumers, con)
+		group.forwardMember(con)
+	}
+
+	for len(group.Consumers) > desired {
+		group.removeLastMember()
+	}
+
+	if len(group.Consumers) != current {
+		group.connectionPool.logger.Info(
+			"consumer group %s scaled from %d to %d consumers for %d messages in queue %s",
+			group.config.ConsumerName, current, len(group.Consumers), depth, group.config.QueueName)
+	}
+}
+
+// removeLastMember drains the newest member so its messages are settled, then stops forwarding it.
+func (group *ConsumerGroup) removeLastMember() {
+
+	last := len(group.Consumers) - 1
+	con, memberStop := group.Consumers[last], group.memberStops[last]
+
+	ctx, cancel := context.WithTimeout(context.Background(), autoScaleDrainTimeout)
+	if _, err := con.Drain(ctx); err != nil {
+		group.errors.report("drain", 0, fmt.Errorf("consumer group unable to drain consumer %s: %w", con.ConsumerName, err))
+	}
+	cancel()
+
+	close(memberStop)
+	group.Consumers, group.memberStops = group.Consumers[:last], group.memberStops[:last]
+}
+
+// stopScaling stops resizing the group, waiting for a resize in progress.
+func (group *ConsumerGroup) stopScaling() {
+
+	group.groupLock.Lock()
+	scaleStop, scaleDone := group.scaleStop, group.scaleDone
+	group.scaleStop, group.scaleDone = nil, nil
+	group.groupLock.Unlock()
+
+	if scaleStop == nil {
+		return
+	}
+
+	close(scaleStop)
+	<-scaleDone
+}
+
+// Size is the current member count, which changes while auto scaling.
+func (group *ConsumerGroup) Size() int {
+	group.groupLock.Lock()
+	defer group.groupLock.Unlock()
+
+	return len(group.Consumers)
+}
+
+// Started is true between StartConsuming (or its variants) and StopConsuming.
+func (group *ConsumerGroup) Started() bool {
+	group.groupLock.Lock()
+	defer group.groupLock.Unlock()
+
+	return group.started
+}
+
+// ReceivedMessages yields the messages of every member when started with StartConsuming.
+func (group *ConsumerGroup) ReceivedMessages() <-chan *ReceivedMessage {
+	return group.receivedMessages
+}
+
+// Errors yields the errors of every member.
+func (group *ConsumerGroup) Errors() <-chan error {
+	return group.errors.errors
+}
+
+// FlushMessages discards messages merged into ReceivedMessages that haven't been read.
+func (group *ConsumerGroup) FlushMessages() {
+
+FlushLoop:
+	for {
+		select {
+		case <-group.receivedMessages:
+		default:
+			break FlushLoop
+		}
+	}
+}
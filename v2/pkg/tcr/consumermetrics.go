@@ -0,0 +1,142 @@
+package tcr
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// ConsumerCounters are the counters of a Consumer. Those of a started Consumer are also in its ConnectionPool's
+// Counters, so they're published via expvar along with the pool's.
+type ConsumerCounters struct {
+	ConsumerName   string             `json:"ConsumerName"`
+	QueueName      string             `json:"QueueName"`
+	Received       uint64             `json:"Received"`       // deliveries from the broker, each chunk of a chunked message counted
+	Redelivered    uint64             `json:"Redelivered"`    // of those, flagged by the broker as delivered before
+	RedeliveryRate float64            `json:"RedeliveryRate"` // Redelivered over Received
+	Processed      uint64             `json:"Processed"`      // messages an action or handler returned from, panicking included
+	Acked          uint64             `json:"Acked"`
+	Nacked         uint64             `json:"Nacked"`       // nacked or rejected
+	Requeued       uint64             `json:"Requeued"`     // of those nacked, requeued
+	SettleErrors   uint64             `json:"SettleErrors"` // failed acks, nacks, and rejects, the broker redelivers those messages
+	Duplicates     uint64             `json:"Duplicates"`   // skipped (and acked) by the Deduper
+	HandlerLatency *HistogramSnapshot `json:"HandlerLatency"`
+	MessageAges    *HistogramSnapshot `json:"MessageAges"`
+}
+
+// consumerMetrics counts a Consumer's deliveries and their settlements, and times its action or handler.
+type consumerMetrics struct {
+	received       uint64
+	redelivered    uint64
+	processed      uint64
+	acked          uint64
+	nacked         uint64
+	requeued       uint64
+	settleErrors   uint64
+	handlerLatency *Histogram
+}
+
+func newConsumerMetrics() *consumerMetrics {
+
+	return &consumerMetrics{
+		handlerLatency: NewHistogram(nil),
+	}
+}
+
+func (cm *consumerMetrics) delivered(delivery *amqp.Delivery) {
+
+	atomic.AddUint64(&cm.received, 1)
+	if delivery.Redelivered {
+		atomic.AddUint64(&cm.redelivered, 1)
+	}
+}
+
+// handled records an action or handler started at start returning.
+func (cm *consumerMetrics) handled(start time.Time) {
+
+	atomic.AddUint64(&cm.processed, 1)
+	cm.handlerLatency.Observe(time.Since(start))
+}
+
+// settled records a message's settlement, like inflightTracker.settle.
+func (cm *consumerMetrics) settled(err error, ack bool, requeue bool) {
+
+	switch {
+	case err != nil:
+		atomic.AddUint64(&cm.settleErrors, 1)
+	case ack:
+		atomic.AddUint64(&cm.acked, 1)
+	case requeue:
+		atomic.AddUint64(&cm.nacked, 1)
+		atomic.AddUint64(&cm.requeued, 1)
+	default:
+		atomic.AddUint64(&cm.nacked, 1)
+	}
+}
+
+// Counters reads the Consumer's counters. Like the ConnectionPool's, it only reads state, so it is safe to call
+// at any time.
+func (con *Consumer) Counters() *ConsumerCounters {
+
+	counters := &ConsumerCounters{
+		ConsumerName:   con.ConsumerName,
+		QueueName:      con.QueueName,
+		Received:       atomic.LoadUint64(&con.metrics.received),
+		Redelivered:    atomic.LoadUint64(&con.metrics.redelivered),
+		Processed:      atomic.LoadUint64(&con.metrics.processed),
+		Acked:          atomic.LoadUint64(&con.metrics.acked),
+		Nacked:         atomic.LoadUint64(&con.metrics.nacked),
+		Requeued:       atomic.LoadUint64(&con.metrics.requeued),
+		SettleErrors:   atomic.LoadUint64(&con.metrics.settleErrors),
+		Duplicates:     con.Duplicates(),
+		HandlerLatency: con.metrics.handlerLatency.Snapshot(),
+		MessageAges:    con.MessageAges(),
+	}
+
+	if counters.Received > 0 {
+		counters.RedeliveryRate = float64(counters.Redelivered) / float64(counters.Received)
+	}
+
+	return counters
+}
+
+// trackConsumer adds a started Consumer's counters to the pool's, a Consumer of the same ConsumerName replaces it.
+func (cp *ConnectionPool) trackConsumer(con *Consumer) {
+	cp.poolRWLock.Lock()
+	defer cp.poolRWLock.Unlock()
+
+	cp.consumers[con.ConsumerName] = con
+}
+
+// untrackConsumer removes a stopped Consumer's counters from the pool's.
+func (cp *ConnectionPool) untrackConsumer(con *Consumer) {
+	cp.poolRWLock.Lock()
+	defer cp.poolRWLock.Unlock()
+
+	if cp.consumers[con.ConsumerName] == con {
+		delete(cp.consumers, con.ConsumerName)
+	}
+}
+
+// consumerCounters reads the counters of the pool's started Consumers, by ConsumerName.
+func (cp *ConnectionPool) consumerCounters() map[string]*ConsumerCounters {
+
+	cp.poolRWLock.RLock()
+	consumers := make([]*Consumer, 0, len(cp.consumers))
+	for _, con := range cp.consumers {
+		consumers = append(consumers, con)
+	}
+	cp.poolRWLock.RUnlock()
+
+	if len(consumers) == 0 {
+		return nil
+	}
+
+	counters := make(map[string]*ConsumerCounters, len(consumers))
+	for _, con := range consumers {
+		counters[con.ConsumerName] = con.Counters()
+	}
+
+	return counters
+}
@@ -0,0 +1,151 @@
+package tcr
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// Deduper tracks processed message keys so a Consumer can skip (and ack) redelivered duplicates.
+// Keys are marked processed only once the message is acknowledged, so a nacked message is not lost.
+type Deduper interface {
+	IsDuplicate(key string) (bool, error)
+	MarkProcessed(key string) error
+}
+
+// GetDedupKey is the MessageId of the delivery, or the value of header when set. Empty when neither is present.
+func GetDedupKey(delivery *amqp.Delivery, header string) string {
+
+	if header == "" {
+		return delivery.MessageId
+	}
+
+	if value, ok := delivery.Headers[header]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+
+	return ""
+}
+
+// MemoryDeduper is an in-memory, least recently used Deduper. Keys expire after the TTL (if set).
+type MemoryDeduper struct {
+	capacity  int
+	ttl       time.Duration
+	entries   map[string]*list.Element
+	order     *list.List
+	dedupLock *sync.Mutex
+}
+
+type dedupEntry struct {
+	key       string
+	processed time.Time
+}
+
+// NewMemoryDeduper creates a MemoryDeduper that remembers up to capacity keys.
+func NewMemoryDeduper(capacity int, ttl time.Duration) (*MemoryDeduper, error) {
+
+	if capacity < 1 {
+		return nil, errors.New("memory deduper capacity must be at least 1")
+	}
+
+	return &MemoryDeduper{
+		capacity:  capacity,
+		ttl:       ttl,
+		entries:   make(map[string]*list.Element, capacity),
+		order:     list.New(),
+		dedupLock: &sync.Mutex{},
+	}, nil
+}
+
+// IsDuplicate reports whether the key was already processed (and has not expired).
+func (md *MemoryDeduper) IsDuplicate(key string) (bool, error) {
+	md.dedupLock.Lock()
+	defer md.dedupLock.Unlock()
+
+	element, ok := md.entries[key]
+	if !ok {
+		return false, nil
+	}
+
+	if md.ttl > 0 && time.Since(element.Value.(*dedupEntry).processed) > md.ttl {
+		md.order.Remove(element)
+		delete(md.entries, key)
+		return false, nil
+	}
+
+	md.order.MoveToFront(element)
+	return true, nil
+}
+
+// MarkProcessed remembers the key, evicting the least recently used key when at capacity.
+func (md *MemoryDeduper) MarkProcessed(key string) error {
+	md.dedupLock.Lock()
+	defer md.dedupLock.Unlock()
+
+	if element, ok := md.entries[key]; ok {
+		element.Value.(*dedupEntry).processed = time.Now()
+		md.order.MoveToFront(element)
+		return nil
+	}
+
+	if md.order.Len() >= md.capacity {
+		oldest := md.order.Back()
+		md.order.Remove(oldest)
+		delete(md.entries, oldest.Value.(*dedupEntry).key)
+	}
+
+	md.entries[key] = md.order.PushFront(&dedupEntry{key: key, processed: time.Now()})
+	return nil
+}
+
+// RedisDeduper is a Deduper shared between consumers (and services) through Redis.
+type RedisDeduper struct {
+	client  redis.UniversalClient
+	prefix  string
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+// NewRedisDeduper creates a RedisDeduper storing keys as prefix+key that expire after the TTL (0 never expires).
+func NewRedisDeduper(client redis.UniversalClient, prefix string, ttl time.Duration) (*RedisDeduper, error) {
+
+	if client == nil {
+		return nil, errors.New("can't create a redis deduper without a client")
+	}
+
+	return &RedisDeduper{
+		client:  client,
+		prefix:  prefix,
+		ttl:     ttl,
+		timeout: 5 * time.Second,
+	}, nil
+}
+
+// IsDuplicate reports whether the key exists in Redis.
+func (rd *RedisDeduper) IsDuplicate(key string) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), rd.timeout)
+	defer cancel()
+
+	count, err := rd.client.Exists(ctx, rd.prefix+key).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// MarkProcessed stores the key in Redis.
+func (rd *RedisDeduper) MarkProcessed(key string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), rd.timeout)
+	defer cancel()
+
+	return rd.client.Set(ctx, rd.prefix+key, 1, rd.ttl).Err()
+}
@@ -0,0 +1,94 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultDialMaxAttempts = 5
+	defaultDialInitial     = time.Second
+	defaultDialMax         = 30 * time.Second
+)
+
+// ErrBrokerUnreachable is matched by the DialError a ConnectionPool's initialization returns once every dial failed.
+var ErrBrokerUnreachable = errors.New("broker unreachable")
+
+// DialError is returned by NewConnectionPool (and ChannelPool.Initialize) when a connection couldn't be dialed
+// in DialConfig.MaxAttempts. It matches ErrBrokerUnreachable and unwraps to the last dial's error.
+type DialError struct {
+	ConnectionID uint64
+	Attempts     int
+	Err          error
+}
+
+// Error allows you to quickly log the DialError struct as a string.
+func (de *DialError) Error() string {
+	return fmt.Sprintf("connection %d unable to dial after %d attempts: %s", de.ConnectionID, de.Attempts, de.Err)
+}
+
+// Unwrap returns the last dial's error.
+func (de *DialError) Unwrap() error {
+	return de.Err
+}
+
+// Is reports whether target is ErrBrokerUnreachable.
+func (de *DialError) Is(target error) bool {
+	return target == ErrBrokerUnreachable
+}
+
+// dialer retries the dials of a ConnectionPool's initialization.
+type dialer struct {
+	maxAttempts int
+	backoff     BackoffPolicy
+}
+
+// newDialer creates a dialer from config. A nil config dials once.
+func newDialer(config *DialConfig) (*dialer, error) {
+
+	if config == nil {
+		return &dialer{maxAttempts: 1, backoff: &ConstantBackoff{}}, nil
+	}
+
+	d := &dialer{maxAttempts: int(config.MaxAttempts)}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = defaultDialMaxAttempts
+	}
+
+	backoff, err := NewBackoffPolicy(config.BackoffConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	d.backoff = backoff
+	if d.backoff == nil {
+		d.backoff = &ExponentialBackoff{Initial: defaultDialInitial, Max: defaultDialMax}
+	}
+
+	return d, nil
+}
+
+// dialConnection calls dial until it succeeds, the broker refuses it with a terminal error, or the dialer's
+// attempts run out, sleeping the dialer's backoff between them.
+func (cp *ConnectionPool) dialConnection(connectionID uint64, dial func() (*ConnectionHost, error)) (*ConnectionHost, error) {
+
+	for attempt := 1; ; attempt++ {
+		connHost, err := dial()
+		if err == nil {
+			return connHost, nil
+		}
+
+		if !IsRetryable(err) {
+			return nil, newTerminalError("connect", err)
+		}
+
+		if attempt >= cp.dialer.maxAttempts {
+			return nil, &DialError{ConnectionID: connectionID, Attempts: attempt, Err: err}
+		}
+
+		cp.logger.Warn("connectionpool unable to dial connection %d (attempt %d of %d), retrying: %s", connectionID, attempt, cp.dialer.maxAttempts, err)
+		cp.errors.report("connect", attempt, err)
+		sleepBackoff(cp.dialer.backoff, attempt)
+	}
+}
@@ -0,0 +1,94 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoHandler is the error of a message no Dispatcher route matched, when it has no fallback handler.
+var ErrNoHandler = errors.New("no handler registered for message")
+
+type dispatchRoute struct {
+	routingKey string // topic style pattern, empty when matching a header
+	header     string
+	value      string
+	handler    func(*ReceivedMessage) error
+}
+
+// matches reports whether the route takes the message.
+func (route *dispatchRoute) matches(msg *ReceivedMessage) bool {
+
+	if route.header != "" {
+		value, ok := msg.Headers[route.header]
+		if !ok {
+			return false
+		}
+
+		if bytes, ok := value.([]byte); ok {
+			return string(bytes) == route.value
+		}
+
+		return fmt.Sprint(value) == route.value
+	}
+
+	return matchTopic(route.routingKey, msg.RoutingKey)
+}
+
+// Dispatcher hands each message to the handler registered for its routing key or a header value, instead of one
+// handler switching on them. Routes are tried in the order registered and the first match handles the message.
+// Register routes before consuming.
+type Dispatcher struct {
+	routes   []*dispatchRoute
+	fallback func(*ReceivedMessage) error
+}
+
+// NewDispatcher creates a Dispatcher without routes.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Register routes messages whose routing key matches the topic style pattern, where * matches one word and # zero
+// or more, to the handler. Returns the Dispatcher to chain.
+func (d *Dispatcher) Register(routingKeyPattern string, handler func(*ReceivedMessage) error) *Dispatcher {
+
+	d.routes = append(d.routes, &dispatchRoute{routingKey: routingKeyPattern, handler: handler})
+	return d
+}
+
+// RegisterHeader routes messages whose header has the value (compared as a string) to the handler. Returns the
+// Dispatcher to chain.
+func (d *Dispatcher) RegisterHeader(header string, value string, handler func(*ReceivedMessage) error) *Dispatcher {
+
+	d.routes = append(d.routes, &dispatchRoute{header: header, value: value, handler: handler})
+	return d
+}
+
+// Fallback handles the messages no route matched. Returns the Dispatcher to chain.
+func (d *Dispatcher) Fallback(handler func(*ReceivedMessage) error) *Dispatcher {
+
+	d.fallback = handler
+	return d
+}
+
+// Handle calls the handler of the first matching route, or the fallback, returning its error. Without either it
+// returns ErrNoHandler. Handle is a handler itself, for Consumer.StartConsumingWithHandler and the like.
+func (d *Dispatcher) Handle(msg *ReceivedMessage) error {
+
+	for _, route := range d.routes {
+		if route.matches(msg) {
+			return route.handler(msg)
+		}
+	}
+
+	if d.fallback != nil {
+		return d.fallback(msg)
+	}
+
+	return fmt.Errorf("%w: routing key %s", ErrNoHandler, msg.RoutingKey)
+}
+
+// StartConsumingWithDispatcher starts the Consumer like StartConsumingWithHandler, handling each message with
+// the Dispatcher. Messages no route matches, without a fallback, fail with ErrNoHandler.
+func (con *Consumer) StartConsumingWithDispatcher(dispatcher *Dispatcher) error {
+	return con.StartConsumingWithHandler(dispatcher.Handle)
+}
@@ -0,0 +1,195 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// DrainResult counts how the messages settled while a Consumer drained.
+type DrainResult struct {
+	Completed uint64 // acknowledged
+	Requeued  uint64 // nacked or rejected with requeue, including those left unsettled when the context ended
+	Rejected  uint64 // nacked or rejected without requeue
+}
+
+// inflightTracker counts a Consumer's ackable messages from delivery until they are settled.
+type inflightTracker struct {
+	inflight  int64
+	completed uint64
+	requeued  uint64
+	rejected  uint64
+}
+
+func (it *inflightTracker) deliver() {
+	atomic.AddInt64(&it.inflight, 1)
+}
+
+// settle records a settlement. A failed one left the message with the broker, which redelivers it.
+func (it *inflightTracker) settle(err error, ack bool, requeue bool) {
+
+	switch {
+	case err == nil && ack:
+		atomic.AddUint64(&it.completed, 1)
+	case err == nil && !requeue:
+		atomic.AddUint64(&it.rejected, 1)
+	default:
+		atomic.AddUint64(&it.requeued, 1)
+	}
+
+	atomic.AddInt64(&it.inflight, -1)
+}
+
+func (it *inflightTracker) snapshot() DrainResult {
+
+	return DrainResult{
+		Completed: atomic.LoadUint64(&it.completed),
+		Requeued:  atomic.LoadUint64(&it.requeued),
+		Rejected:  atomic.LoadUint64(&it.rejected),
+	}
+}
+
+// Drain stops the Consumer without losing messages, for rolling deployments. It cancels the subscription
+// (basic.cancel) so no new messages are delivered, hands on the deliveries already sent, and waits for every
+// ackable message to be settled before returning the channel to the ConnectionPool.
+//
+// When ctx ends first, buffered messages nobody has read are requeued and the channel is closed, so the broker
+// requeues those still held by handlers, and ctx's error is returned. Settling those late fails.
+func (con *Consumer) Drain(ctx context.Context) (*DrainResult, error) {
+	con.conLock.Lock()
+
+	if !con.Started || con.drainDone != nil {
+		con.conLock.Unlock()
+		return nil, errors.New("can't drain a stopped consumer")
+	}
+
+	start := con.inflight.snapshot()
+	drainDone := make(chan *ChannelHost, 1)
+	con.drainDone = drainDone
+	con.consumeStop <- true
+	con.conLock.Unlock()
+
+	var chanHost *ChannelHost
+	var err error
+
+	select {
+	case chanHost = <-drainDone:
+		err = con.waitForInflight(ctx)
+	case <-ctx.Done():
+		err = ctx.Err()
+		chanHost = con.awaitDrainLoop(drainDone)
+	}
+
+	if err != nil {
+		con.requeueBuffered()
+	}
+
+	if chanHost != nil {
+		if err != nil && atomic.LoadInt64(&con.inflight.inflight) > 0 {
+			chanHost.Close() // the broker requeues what the handlers still hold
+			con.returnChannel(chanHost, true)
+		} else {
+			con.returnChannel(chanHost, false)
+		}
+	}
+
+	end := con.inflight.snapshot()
+	result := &DrainResult{
+		Completed: end.Completed - start.Completed,
+		Requeued:  end.Requeued - start.Requeued,
+		Rejected:  end.Rejected - start.Rejected,
+	}
+
+	if unsettled := atomic.LoadInt64(&con.inflight.inflight); err != nil && unsettled > 0 {
+		result.Requeued += uint64(unsettled)
+	}
+
+	con.ConnectionPool.logger.Info("consumer %s drained queue %s, %d completed, %d requeued, %d rejected",
+		con.ConsumerName, con.QueueName, result.Completed, result.Requeued, result.Rejected)
+
+	if err != nil {
+		return result, fmt.Errorf("consumer %s drain incomplete: %w", con.ConsumerName, err)
+	}
+
+	return result, nil
+}
+
+// awaitDrainLoop waits for the consume loop to hand over the channel after the drain context ended. It keeps
+// requeueing buffered messages meanwhile, so the loop isn't stuck on a full ReceivedMessages buffer. A handler
+// still running holds the loop up until it returns.
+func (con *Consumer) awaitDrainLoop(drainDone chan *ChannelHost) *ChannelHost {
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case chanHost := <-drainDone:
+			return chanHost
+		case <-ticker.C:
+			con.requeueBuffered()
+		}
+	}
+}
+
+// waitForInflight waits for every delivered ackable message to be settled.
+func (con *Consumer) waitForInflight(ctx context.Context) error {
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&con.inflight.inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// draining reports whether Drain is waiting on the consume loop.
+func (con *Consumer) draining() bool {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	return con.drainDone != nil
+}
+
+// requeueBuffered nacks, with requeue, the messages waiting in ReceivedMessages.
+func (con *Consumer) requeueBuffered() {
+
+FlushLoop:
+	for {
+		select {
+		case msg := <-con.receivedMessages:
+			if msg.IsAckable {
+				_ = msg.Nack(true)
+			}
+		default:
+			break FlushLoop
+		}
+	}
+}
+
+// drainDeliveries sends basic.cancel and hands on the deliveries already in flight, keeping the channel open
+// for their settlement. Returns nil when the channel failed, taking its unacked deliveries with it.
+func (con *Consumer) drainDeliveries(deliveryChan <-chan amqp.Delivery, chanHost *ChannelHost, action func(*ReceivedMessage)) *ChannelHost {
+
+	if err := con.cancel(chanHost); err != nil {
+		con.returnChannel(chanHost, true)
+		con.errors.report("drain", 0, fmt.Errorf("consumer unable to cancel while draining: %w", err))
+		return nil
+	}
+
+	for delivery := range deliveryChan { // closed by streadway/amqp once the cancel completes
+		con.handleDelivery(&delivery, con.acknowledger(chanHost, delivery.DeliveryTag), action)
+	}
+
+	return chanHost
+}
@@ -0,0 +1,60 @@
+package tcr
+
+import (
+	"fmt"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// envelopeDefaults fills in the properties a Publisher's letters are published without.
+type envelopeDefaults struct {
+	contentType     string
+	contentEncoding string
+	deliveryMode    uint8
+	appID           string
+}
+
+// newEnvelopeDefaults creates envelopeDefaults from the config. Returns nil when it has no defaults.
+func newEnvelopeDefaults(config *EnvelopeDefaults) (*envelopeDefaults, error) {
+
+	if config == nil || *config == (EnvelopeDefaults{}) {
+		return nil, nil
+	}
+
+	switch config.DeliveryMode {
+	case 0, amqp.Transient, amqp.Persistent:
+	default:
+		return nil, fmt.Errorf("invalid default delivery mode %d, must be %d (transient) or %d (persistent)", config.DeliveryMode, amqp.Transient, amqp.Persistent)
+	}
+
+	return &envelopeDefaults{
+		contentType:     config.ContentType,
+		contentEncoding: config.ContentEncoding,
+		deliveryMode:    config.DeliveryMode,
+		appID:           config.AppID,
+	}, nil
+}
+
+// apply sets each default on the letter unless the letter has its own.
+func (ed *envelopeDefaults) apply(letter *Letter) {
+
+	if ed == nil || letter.Envelope == nil {
+		return
+	}
+
+	if letter.Envelope.ContentType == "" {
+		letter.Envelope.ContentType = ed.contentType
+	}
+
+	if letter.Envelope.ContentEncoding == "" {
+		letter.Envelope.ContentEncoding = ed.contentEncoding
+	}
+
+	if letter.Envelope.DeliveryMode == 0 {
+		letter.Envelope.DeliveryMode = ed.deliveryMode
+	}
+
+	if letter.Envelope.AppID == "" {
+		letter.Envelope.AppID = ed.appID
+	}
+}
@@ -0,0 +1,79 @@
+package tcr
+
+import "sync/atomic"
+
+const defaultErrorBuffer = 1000
+
+// errorBuffer is a bounded, non-blocking error channel that drops the oldest error when full.
+// Writers never block (or spawn goroutines) when nobody is reading. Every error queued is an ErrorEvent.
+type errorBuffer struct {
+	errors    chan error
+	subsystem string
+	reported  uint64
+	dropped   uint64
+}
+
+func newErrorBuffer(capacity uint32, subsystem string) *errorBuffer {
+
+	if capacity == 0 {
+		capacity = defaultErrorBuffer
+	}
+
+	return &errorBuffer{
+		errors:    make(chan error, capacity),
+		subsystem: subsystem,
+	}
+}
+
+// report queues the error as an ErrorEvent of the buffer's subsystem.
+func (eb *errorBuffer) report(operation string, attempt int, err error) {
+	eb.send(NewErrorEvent(eb.subsystem, operation, attempt, err))
+}
+
+// send queues the error, evicting the oldest queued error when at capacity. ErrorEvents, such as those
+// forwarded from another buffer, are queued as is and other errors are wrapped in one of the buffer's subsystem.
+func (eb *errorBuffer) send(err error) {
+
+	if _, ok := err.(*ErrorEvent); !ok {
+		err = NewErrorEvent(eb.subsystem, "", 0, err)
+	}
+	atomic.AddUint64(&eb.reported, 1)
+
+	for {
+		select {
+		case eb.errors <- err:
+			return
+		default:
+		}
+
+		// Full, drop the oldest to make room.
+		select {
+		case <-eb.errors:
+			atomic.AddUint64(&eb.dropped, 1)
+		default:
+		}
+	}
+}
+
+// flush discards all queued errors.
+func (eb *errorBuffer) flush() {
+
+FlushLoop:
+	for {
+		select {
+		case <-eb.errors:
+		default:
+			break FlushLoop
+		}
+	}
+}
+
+// reportedCount is the number of errors queued, including those since dropped.
+func (eb *errorBuffer) reportedCount() uint64 {
+	return atomic.LoadUint64(&eb.reported)
+}
+
+// droppedCount is the number of errors evicted because nobody was reading.
+func (eb *errorBuffer) droppedCount() uint64 {
+	return atomic.LoadUint64(&eb.dropped)
+}
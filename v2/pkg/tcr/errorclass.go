@@ -0,0 +1,87 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// terminalCodes are the AMQP reply codes a retry can't fix, the broker's or the client's config has to change first.
+var terminalCodes = map[int]bool{
+	amqp.ContentTooLarge:    true,
+	amqp.InvalidPath:        true, // vhost doesn't exist
+	amqp.AccessRefused:      true, // bad credentials, or no permission on the vhost or resource
+	amqp.NotFound:           true,
+	amqp.PreconditionFailed: true,
+	amqp.NotAllowed:         true,
+	amqp.NotImplemented:     true,
+}
+
+// TerminalError is an error the pool gave up on instead of retrying, such as the broker refusing its credentials.
+// Retrying is pointless until the broker's permissions or the pool's config are changed.
+type TerminalError struct {
+	Operation string // what the pool was doing, ex. create channel
+	Code      int    // the AMQP reply code, 0 when the error didn't come from the broker
+	Name      string // ex. ACCESS_REFUSED
+	Reason    string
+	Err       error
+}
+
+// newTerminalError wraps err, which IsRetryable reported false for, as a TerminalError of the operation.
+func newTerminalError(operation string, err error) error {
+
+	var terminal *TerminalError
+	if errors.As(err, &terminal) {
+		return err
+	}
+
+	terminal = &TerminalError{Operation: operation, Reason: err.Error(), Err: err}
+
+	var amqpError *amqp.Error
+	if errors.As(err, &amqpError) {
+		terminal.Code = amqpError.Code
+		terminal.Name = ExceptionName(amqpError.Code)
+		terminal.Reason = amqpError.Reason
+	}
+
+	return terminal
+}
+
+// Error allows you to quickly log the TerminalError struct as a string.
+func (te *TerminalError) Error() string {
+
+	if te.Code == 0 {
+		return fmt.Sprintf("%s failed, not retrying: %s", te.Operation, te.Err)
+	}
+
+	return fmt.Sprintf("%s failed, not retrying [%d %s]: %s", te.Operation, te.Code, te.Name, te.Err)
+}
+
+// Unwrap returns the error the pool gave up on.
+func (te *TerminalError) Unwrap() error {
+	return te.Err
+}
+
+// IsRetryable reports whether retrying what returned err might succeed. Broker errors are classified by reply
+// code: ACCESS_REFUSED, NOT_FOUND, NOT_ALLOWED, and the like are terminal, while CONNECTION_FORCED, RESOURCE_ERROR,
+// INTERNAL_ERROR, and closed channels or connections are retryable, as are network errors. A TerminalError,
+// ErrPoolClosed, or nil error is not retryable.
+func IsRetryable(err error) bool {
+
+	if err == nil || errors.Is(err, ErrPoolClosed) {
+		return false
+	}
+
+	var terminal *TerminalError
+	if errors.As(err, &terminal) {
+		return false
+	}
+
+	var amqpError *amqp.Error
+	if errors.As(err, &amqpError) {
+		return !terminalCodes[amqpError.Code]
+	}
+
+	return true
+}
@@ -0,0 +1,99 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// SubsystemConnection marks errors of connections to the broker.
+	SubsystemConnection = "connection"
+
+	// SubsystemChannel marks errors of channels, broker channel exceptions included.
+	SubsystemChannel = "channel"
+
+	// SubsystemPublisher marks errors publishing letters.
+	SubsystemPublisher = "publisher"
+
+	// SubsystemConsumer marks errors consuming and settling messages.
+	SubsystemConsumer = "consumer"
+
+	// SubsystemService marks errors of the RabbitService itself, such as shutdown hooks.
+	SubsystemService = "service"
+)
+
+// ErrorEvent is what the Errors() channels (and RabbitService.CentralErr) carry: the error along with when and
+// where it happened. It wraps the error, so errors.Is and errors.As see through it, and marshals to JSON for
+// structured logging and alerting.
+type ErrorEvent struct {
+	Timestamp time.Time `json:"Timestamp"`
+	Subsystem string    `json:"Subsystem"` // one of the Subsystem constants
+	Operation string    `json:"Operation"` // what was being done, e.g. "ack" or "reconnect"
+	Attempt   int       `json:"Attempt"`   // 1 for the first try of a retried operation, 0 when it isn't retried
+	Err       error     `json:"-"`
+}
+
+// NewErrorEvent creates an ErrorEvent stamped with the current time.
+func NewErrorEvent(subsystem string, operation string, attempt int, err error) *ErrorEvent {
+
+	return &ErrorEvent{
+		Timestamp: time.Now().UTC(),
+		Subsystem: subsystem,
+		Operation: operation,
+		Attempt:   attempt,
+		Err:       err,
+	}
+}
+
+// AsErrorEvent finds the ErrorEvent in an error read from an Errors() channel.
+func AsErrorEvent(err error) (*ErrorEvent, bool) {
+
+	var event *ErrorEvent
+	if errors.As(err, &event) {
+		return event, true
+	}
+
+	return nil, false
+}
+
+// Error allows you to quickly log the ErrorEvent as a string.
+func (ee *ErrorEvent) Error() string {
+
+	if ee.Operation == "" {
+		return fmt.Sprintf("[%s] %s", ee.Subsystem, ee.Err)
+	}
+
+	if ee.Attempt > 0 {
+		return fmt.Sprintf("[%s] %s (attempt %d): %s", ee.Subsystem, ee.Operation, ee.Attempt, ee.Err)
+	}
+
+	return fmt.Sprintf("[%s] %s: %s", ee.Subsystem, ee.Operation, ee.Err)
+}
+
+// Unwrap returns the wrapped error.
+func (ee *ErrorEvent) Unwrap() error {
+	return ee.Err
+}
+
+// MarshalJSON adds the wrapped error's message as Error.
+func (ee *ErrorEvent) MarshalJSON() ([]byte, error) {
+
+	type errorEvent ErrorEvent // drops the methods, MarshalJSON included
+
+	var message string
+	if ee.Err != nil {
+		message = ee.Err.Error()
+	}
+
+	var json = jsoniter.ConfigFastest
+	return json.Marshal(&struct {
+		*errorEvent
+		Error string `json:"Error"`
+	}{
+		errorEvent: (*errorEvent)(ee),
+		Error:      message,
+	})
+}
@@ -0,0 +1,108 @@
+package tcr
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// expvarPools are the pools published under each expvar namespace, by ConnectionName. expvar can't remove a
+// variable, so a namespace is published once and reads whichever pools are in it at the time.
+var expvarPools = map[string]map[string]*ConnectionPool{}
+var expvarLock = &sync.Mutex{}
+
+// PoolCounters are the counters of a ConnectionPool published via expvar.
+type PoolCounters struct {
+	State             string `json:"State"`
+	ChannelsCreated   uint64 `json:"ChannelsCreated"`   // cached channels made, including remade after errors
+	ChannelGets       uint64 `json:"ChannelGets"`       // cached channels handed out
+	ChannelReturns    uint64 `json:"ChannelReturns"`    // channels returned
+	ChannelErrors     uint64 `json:"ChannelErrors"`     // channels returned in error and rebuilt
+	TransientChannels uint64 `json:"TransientChannels"` // transient channels created
+	SlowChannels      uint64 `json:"SlowChannels"`      // cached channels replaced for being slow
+	Flags             uint64 `json:"Flags"`             // connections returned flagged as unhealthy
+	Reconnects        uint64 `json:"Reconnects"`
+	Errors            uint64 `json:"Errors"`        // ErrorEvents reported to Errors
+	ErrorsDropped     uint64 `json:"ErrorsDropped"` // of those, evicted because nobody was reading
+
+	// Consumers are the counters of the pool's started Consumers, by ConsumerName.
+	Consumers map[string]*ConsumerCounters `json:"Consumers,omitempty"`
+}
+
+// Counters reads the pool's counters. Like GetPoolStats, it only reads state, so it is safe to call at any time.
+func (cp *ConnectionPool) Counters() *PoolCounters {
+
+	counters := &PoolCounters{
+		State:             cp.State().String(),
+		ChannelsCreated:   atomic.LoadUint64(&cp.channelsCreated),
+		ChannelGets:       atomic.LoadUint64(&cp.channelGets),
+		ChannelReturns:    atomic.LoadUint64(&cp.channelReturns),
+		ChannelErrors:     atomic.LoadUint64(&cp.channelErrors),
+		TransientChannels: atomic.LoadUint64(&cp.transientChannels),
+		SlowChannels:      cp.slowChannels.replacedCount(),
+		Errors:            cp.errors.reportedCount(),
+		ErrorsDropped:     cp.errors.droppedCount(),
+		Consumers:         cp.consumerCounters(),
+	}
+
+	cp.poolRWLock.RLock()
+	connectionHosts := cp.connectionHosts
+	cp.poolRWLock.RUnlock()
+
+	for _, connHost := range connectionHosts {
+		counters.Flags += atomic.LoadUint64(&connHost.flags)
+		counters.Reconnects += connHost.Reconnects()
+	}
+
+	return counters
+}
+
+// publishExpvar adds the pool to its expvar namespace, publishing the namespace on first use. The pool is removed
+// once it has shut down, a pool of the same ConnectionName replaces it.
+func (cp *ConnectionPool) publishExpvar(namespace string) {
+	expvarLock.Lock()
+	defer expvarLock.Unlock()
+
+	pools, ok := expvarPools[namespace]
+	if !ok {
+		pools = map[string]*ConnectionPool{}
+		expvarPools[namespace] = pools
+
+		if expvar.Get(namespace) == nil {
+			expvar.Publish(namespace, expvar.Func(func() interface{} { return expvarCounters(namespace) }))
+		} else {
+			cp.logger.Warn("connectionpool %s expvar namespace %s is taken, not publishing", cp.Config.ConnectionName, namespace)
+		}
+	}
+
+	pools[cp.Config.ConnectionName] = cp
+
+	cp.OnShutdown(ShutdownPostClose, "expvar", func() error {
+		expvarLock.Lock()
+		defer expvarLock.Unlock()
+
+		if expvarPools[namespace][cp.Config.ConnectionName] == cp {
+			delete(expvarPools[namespace], cp.Config.ConnectionName)
+		}
+
+		return nil
+	})
+}
+
+// expvarCounters reads the counters of the pools in the namespace, by ConnectionName.
+func expvarCounters(namespace string) interface{} {
+
+	expvarLock.Lock()
+	pools := make([]*ConnectionPool, 0, len(expvarPools[namespace]))
+	for _, cp := range expvarPools[namespace] {
+		pools = append(pools, cp)
+	}
+	expvarLock.Unlock()
+
+	counters := make(map[string]*PoolCounters, len(pools))
+	for _, cp := range pools {
+		counters[cp.Config.ConnectionName] = cp.Counters()
+	}
+
+	return counters
+}
@@ -0,0 +1,257 @@
+package tcr
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInjectedFault is the error Faults fails channel and connection attempts with.
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultInjector lets tests make a ConnectionPool fail on purpose, to exercise an application's behavior under
+// broker flapping. Set PoolConfig.FaultInjector, never in production. Faults is a ready made implementation.
+type FaultInjector interface {
+	// ChannelFault is consulted before each channel the pool creates or recovers, transient channels have ID 0.
+	// An error fails the attempt as if the broker had refused it.
+	ChannelFault(channelID uint64) error
+
+	// ConnectionFault is consulted before each reconnection attempt. An error fails the attempt.
+	ConnectionFault(connectionID uint64) error
+
+	// FaultInterval is how often the pool asks which channels and connections to force close, 0 never asks.
+	FaultInterval() time.Duration
+
+	// ChannelsToClose picks the cached channels to force close from those open.
+	ChannelsToClose(channelIDs []uint64) []uint64
+
+	// ConnectionsToClose picks the connections to force close from those open.
+	ConnectionsToClose(connectionIDs []uint64) []uint64
+}
+
+// Faults is a FaultInjector driven by counters and a seeded random source, so a CI run is repeatable.
+type Faults struct {
+	failChannels     int
+	failConnections  int
+	interval         time.Duration
+	closeChannels    int
+	closeConnections int
+	random           *rand.Rand
+	injected         uint64
+	faultLock        *sync.Mutex
+}
+
+// NewFaults creates Faults that inject nothing until told to, picking what to close with the seed.
+func NewFaults(seed int64) *Faults {
+
+	return &Faults{
+		random:    rand.New(rand.NewSource(seed)),
+		faultLock: &sync.Mutex{},
+	}
+}
+
+// FailNextChannels fails the next n channel creations or recoveries.
+func (f *Faults) FailNextChannels(n int) {
+	f.faultLock.Lock()
+	defer f.faultLock.Unlock()
+
+	f.failChannels = n
+}
+
+// FailNextConnections fails the next n reconnection attempts.
+func (f *Faults) FailNextConnections(n int) {
+	f.faultLock.Lock()
+	defer f.faultLock.Unlock()
+
+	f.failConnections = n
+}
+
+// CloseEvery force closes the given number of random cached channels and connections every interval.
+// Takes effect for pools created afterwards, a zero interval stops it.
+func (f *Faults) CloseEvery(interval time.Duration, channels, connections int) {
+	f.faultLock.Lock()
+	defer f.faultLock.Unlock()
+
+	f.interval = interval
+	f.closeChannels = channels
+	f.closeConnections = connections
+}
+
+// Injected is the number of faults injected, failed attempts plus forced closures.
+func (f *Faults) Injected() uint64 {
+	return atomic.LoadUint64(&f.injected)
+}
+
+// ChannelFault implements FaultInjector.
+func (f *Faults) ChannelFault(channelID uint64) error {
+	f.faultLock.Lock()
+	defer f.faultLock.Unlock()
+
+	return f.fail(&f.failChannels)
+}
+
+// ConnectionFault implements FaultInjector.
+func (f *Faults) ConnectionFault(connectionID uint64) error {
+	f.faultLock.Lock()
+	defer f.faultLock.Unlock()
+
+	return f.fail(&f.failConnections)
+}
+
+func (f *Faults) fail(remaining *int) error {
+
+	if *remaining <= 0 {
+		return nil
+	}
+
+	*remaining--
+	atomic.AddUint64(&f.injected, 1)
+	return ErrInjectedFault
+}
+
+// FaultInterval implements FaultInjector.
+func (f *Faults) FaultInterval() time.Duration {
+	f.faultLock.Lock()
+	defer f.faultLock.Unlock()
+
+	return f.interval
+}
+
+// ChannelsToClose implements FaultInjector.
+func (f *Faults) ChannelsToClose(channelIDs []uint64) []uint64 {
+	f.faultLock.Lock()
+	defer f.faultLock.Unlock()
+
+	return f.pick(channelIDs, f.closeChannels)
+}
+
+// ConnectionsToClose implements FaultInjector.
+func (f *Faults) ConnectionsToClose(connectionIDs []uint64) []uint64 {
+	f.faultLock.Lock()
+	defer f.faultLock.Unlock()
+
+	return f.pick(connectionIDs, f.closeConnections)
+}
+
+func (f *Faults) pick(ids []uint64, count int) []uint64 {
+
+	if count <= 0 || len(ids) == 0 {
+		return nil
+	}
+
+	if count > len(ids) {
+		count = len(ids)
+	}
+
+	picked := make([]uint64, 0, count)
+	for _, i := range f.random.Perm(len(ids))[:count] {
+		picked = append(picked, ids[i])
+	}
+
+	atomic.AddUint64(&f.injected, uint64(count))
+	return picked
+}
+
+// injectFaults force closes the channels and connections the FaultInjector picks every FaultInterval until stopped.
+func (cp *ConnectionPool) injectFaults(interval time.Duration, stop chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			cp.closeFaultyChannels()
+			cp.closeFaultyConnections()
+		}
+	}
+}
+
+func (cp *ConnectionPool) closeFaultyChannels() {
+
+	cp.poolRWLock.RLock()
+	channelIDs := make([]uint64, 0, len(cp.cachedChannels))
+	for id := range cp.cachedChannels {
+		channelIDs = append(channelIDs, id)
+	}
+	sort.Slice(channelIDs, func(i, j int) bool { return channelIDs[i] < channelIDs[j] }) // repeatable picks
+	cp.poolRWLock.RUnlock()
+
+	for _, id := range cp.Config.FaultInjector.ChannelsToClose(channelIDs) {
+		cp.poolRWLock.RLock()
+		chanHost, ok := cp.cachedChannels[id]
+		cp.poolRWLock.RUnlock()
+		if !ok {
+			continue
+		}
+
+		cp.logger.Warn("connectionpool %s injecting fault, closing channel %d", cp.Config.ConnectionName, id)
+
+		go func(chanHost *ChannelHost) {
+			defer func() { _ = recover() }()
+
+			chanHost.chanLock.Lock()
+			channel := chanHost.Channel
+			chanHost.chanLock.Unlock()
+
+			_ = channel.Close()
+		}(chanHost)
+	}
+}
+
+func (cp *ConnectionPool) closeFaultyConnections() {
+
+	cp.poolRWLock.RLock()
+	connectionHosts := cp.connectionHosts
+	cp.poolRWLock.RUnlock()
+
+	connectionIDs := make([]uint64, 0, len(connectionHosts))
+	for _, connHost := range connectionHosts {
+		connectionIDs = append(connectionIDs, connHost.ConnectionID)
+	}
+
+	for _, id := range cp.Config.FaultInjector.ConnectionsToClose(connectionIDs) {
+		for _, connHost := range connectionHosts {
+			if connHost.ConnectionID != id {
+				continue
+			}
+
+			cp.logger.Warn("connectionpool %s injecting fault, closing connection %d", cp.Config.ConnectionName, id)
+
+			go func(connHost *ConnectionHost) {
+				defer func() { _ = recover() }()
+
+				connHost.connLock.Lock()
+				connection := connHost.Connection
+				connHost.connLock.Unlock()
+
+				_ = connection.Close()
+			}(connHost)
+		}
+	}
+}
+
+// channelFault consults the FaultInjector, when there is one, before a channel is made.
+func (cp *ConnectionPool) channelFault(channelID uint64) error {
+
+	if cp.Config.FaultInjector == nil {
+		return nil
+	}
+
+	return cp.Config.FaultInjector.ChannelFault(channelID)
+}
+
+// connectionFault consults the FaultInjector, when there is one, before a reconnection attempt.
+func (cp *ConnectionPool) connectionFault(connectionID uint64) error {
+
+	if cp.Config.FaultInjector == nil {
+		return nil
+	}
+
+	return cp.Config.FaultInjector.ConnectionFault(connectionID)
+}
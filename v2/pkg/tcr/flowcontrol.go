@@ -0,0 +1,72 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// ErrConnectionBlocked is returned (or sent in a PublishReceipt) by a Publisher with OnBlocked set to
+// BlockedActionFail while the broker blocks publishing.
+var ErrConnectionBlocked = errors.New("connection blocked by the broker")
+
+const (
+	// BlockedActionNone publishes regardless, the broker stops reading from the socket until the alarm clears.
+	BlockedActionNone = ""
+
+	// BlockedActionWait holds publishes until the broker unblocks the connection (or ctx is done).
+	BlockedActionWait = "wait"
+
+	// BlockedActionFail fails publishes with ErrConnectionBlocked while the broker blocks the connection.
+	BlockedActionFail = "fail"
+)
+
+// connectionBlocked logs and notifies a change in the broker's flow control of a connection.
+func (cp *ConnectionPool) connectionBlocked(connHost *ConnectionHost, blocking amqp.Blocking) {
+
+	if blocking.Active {
+		cp.logger.Warn("connection %d blocked by the broker: %s", connHost.ConnectionID, blocking.Reason)
+		cp.notify(EventConnectionBlocked, connHost.ConnectionID, "connection blocked by the broker: "+blocking.Reason)
+		return
+	}
+
+	cp.logger.Info("connection %d unblocked by the broker", connHost.ConnectionID)
+	cp.notify(EventConnectionUnblocked, connHost.ConnectionID, "connection unblocked by the broker")
+}
+
+// Blocked reports whether the broker is blocking publishes on any of the pool's connections, usually for a
+// memory or disk alarm. Brokers alarm cluster wide, but only tell connections that publish.
+func (cp *ConnectionPool) Blocked() bool {
+
+	cp.poolRWLock.RLock()
+	connectionHosts := cp.connectionHosts
+	cp.poolRWLock.RUnlock()
+
+	for _, connHost := range connectionHosts {
+		if connHost.Blocked() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitWhileBlocked blocks until no connection is blocked, returning the error when ctx is done or the pool closes.
+func (cp *ConnectionPool) waitWhileBlocked(ctx context.Context) error {
+
+	for cp.Blocked() {
+		if cp.closed() {
+			return ErrPoolClosed
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// EventHandlerTimeout indicates a Consumer's handler ran past HandlerTimeout and its message was nacked.
+const EventHandlerTimeout = "handler-timeout"
+
+// ErrHandlerTimeout is the error of settling a message after it was nacked because its handler ran past the
+// Consumer's HandlerTimeout. The ctx of the message is cancelled with it.
+var ErrHandlerTimeout = errors.New("handler timed out")
+
+// Who settles a message whose Consumer has a HandlerTimeout: whoever claims it first.
+const (
+	messageUnclaimed int32 = iota
+	messageClaimedByHandler
+	messageClaimedByTimeout
+)
+
+// onHandlerTimeoutAction validates ConsumerConfig.OnHandlerTimeout, defaulting to OnPanicRequeue.
+func onHandlerTimeoutAction(consumerName string, onTimeout string, cp *ConnectionPool) string {
+
+	switch onTimeout {
+	case OnPanicRequeue, OnPanicDeadLetter:
+		return onTimeout
+	case "":
+		return OnPanicRequeue
+	default:
+		if cp != nil {
+			cp.logger.Warn("consumer %s has an invalid OnHandlerTimeout %q, using %q", consumerName, onTimeout, OnPanicRequeue)
+		}
+		return OnPanicRequeue
+	}
+}
+
+// withHandlerTimeout gives the message a ctx with the HandlerTimeout as its deadline, when the message is nacked
+// unless already settled. Call the returned func once the handler returns, it waits on a nack in progress.
+func (con *Consumer) withHandlerTimeout(msg *ReceivedMessage) func() {
+
+	ctx, cancel := context.WithTimeout(context.Background(), con.handlerTimeout)
+	msg.ctx = ctx
+
+	expired := make(chan struct{})
+	timer := time.AfterFunc(con.handlerTimeout, func() {
+		defer close(expired)
+		_ = con.expireMessage(msg)
+	})
+
+	return func() {
+		if !timer.Stop() {
+			<-expired
+		}
+		cancel()
+	}
+}
+
+// expireMessage nacks, per OnHandlerTimeout, the message of a handler that ran past the HandlerTimeout, unless the
+// handler already settled it or is settling it. It reports whether it claimed the message.
+func (con *Consumer) expireMessage(msg *ReceivedMessage) bool {
+
+	if !msg.IsAckable || msg.acknowledger == nil || msg.isSettled() ||
+		!atomic.CompareAndSwapInt32(&msg.claim, messageUnclaimed, messageClaimedByTimeout) {
+		return false
+	}
+
+	timeoutErr := fmt.Errorf("consumer %s %w after %s on message %q from %s, nacking (%s)",
+		con.ConsumerName, ErrHandlerTimeout, con.handlerTimeout, msg.MessageID, msg.Queue, con.onHandlerTimeout)
+
+	con.ConnectionPool.logger.Warn("%s", timeoutErr)
+	con.ConnectionPool.notify(EventHandlerTimeout, 0, timeoutErr.Error())
+	con.errors.report("handle", 0, timeoutErr)
+
+	if err := msg.nack(con.onHandlerTimeout == OnPanicRequeue); err != nil {
+		con.errors.report("nack", 0, fmt.Errorf("consumer unable to nack timed out message: %w", err))
+	}
+
+	return true
+}
+
+// claimForHandler reports whether the handler may settle the message, false once it was nacked for timing out.
+func (msg *ReceivedMessage) claimForHandler() bool {
+
+	return atomic.CompareAndSwapInt32(&msg.claim, messageUnclaimed, messageClaimedByHandler) ||
+		atomic.LoadInt32(&msg.claim) == messageClaimedByHandler
+}
+
+// timedOut reports whether the message was nacked because its handler ran past the HandlerTimeout.
+func (msg *ReceivedMessage) timedOut() bool {
+	return atomic.LoadInt32(&msg.claim) == messageClaimedByTimeout
+}
@@ -0,0 +1,288 @@
+package tcr
+
+import (
+	"math"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// Headers is an amqp.Table with typed accessors, so reading a header doesn't need a type assertion per integer
+// width the broker or another client may have sent. Getters report false when the header is missing or holds
+// an incompatible type, and never panic. Convert freely, ex. tcr.Headers(msg.Headers) or amqp.Table(headers).
+type Headers amqp.Table
+
+// NewHeaders creates empty Headers.
+func NewHeaders() Headers {
+	return Headers{}
+}
+
+// HeadersFromTable wraps the table, making one when it is nil so the Headers can be set. Setting a header on
+// the Headers sets it on the table.
+func HeadersFromTable(table amqp.Table) Headers {
+
+	if table == nil {
+		return Headers{}
+	}
+
+	return Headers(table)
+}
+
+// Table is the Headers as an amqp.Table, for a Letter's Envelope or any other AMQP call.
+func (h Headers) Table() amqp.Table {
+	return amqp.Table(h)
+}
+
+// Validate returns an error when a header holds a type AMQP can't encode.
+func (h Headers) Validate() error {
+	return amqp.Table(h).Validate()
+}
+
+// Get returns the header's raw value.
+func (h Headers) Get(key string) (interface{}, bool) {
+
+	value, ok := h[key]
+	return value, ok
+}
+
+// GetString reads a string header, or a byte array one as a string.
+func (h Headers) GetString(key string) (string, bool) {
+
+	switch value := h[key].(type) {
+	case string:
+		return value, true
+	case []byte:
+		return string(value), true
+	}
+
+	return "", false
+}
+
+// GetInt64 reads an integer header of any width. An unsigned value too large for an int64 reports false.
+func (h Headers) GetInt64(key string) (int64, bool) {
+
+	switch value := h[key].(type) {
+	case int:
+		return int64(value), true
+	case int8:
+		return int64(value), true
+	case int16:
+		return int64(value), true
+	case int32:
+		return int64(value), true
+	case int64:
+		return value, true
+	case uint8:
+		return int64(value), true
+	case uint16:
+		return int64(value), true
+	case uint32:
+		return int64(value), true
+	case uint:
+		if uint64(value) <= math.MaxInt64 {
+			return int64(value), true
+		}
+	case uint64:
+		if value <= math.MaxInt64 {
+			return int64(value), true
+		}
+	}
+
+	return 0, false
+}
+
+// GetFloat64 reads a floating point header, or an integer one as a float.
+func (h Headers) GetFloat64(key string) (float64, bool) {
+
+	switch value := h[key].(type) {
+	case float32:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+
+	if value, ok := h.GetInt64(key); ok {
+		return float64(value), true
+	}
+
+	return 0, false
+}
+
+// GetBool reads a boolean header.
+func (h Headers) GetBool(key string) (bool, bool) {
+
+	value, ok := h[key].(bool)
+	return value, ok
+}
+
+// GetTime reads a timestamp header, an RFC3339 string one, or an integer one as unix milliseconds, like
+// HeaderPublishedAt.
+func (h Headers) GetTime(key string) (time.Time, bool) {
+
+	switch value := h[key].(type) {
+	case time.Time:
+		return value, true
+	case string:
+		if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return parsed, true
+		}
+		return time.Time{}, false
+	}
+
+	if millis, ok := h.GetInt64(key); ok {
+		return time.UnixMilli(millis), true
+	}
+
+	return time.Time{}, false
+}
+
+// GetTable reads a nested table header.
+func (h Headers) GetTable(key string) (Headers, bool) {
+	return asHeaders(h[key])
+}
+
+// GetTables reads an array of tables header, ex. the x-death header of a dead lettered message. An array holding
+// anything but tables reports false.
+func (h Headers) GetTables(key string) ([]Headers, bool) {
+
+	values, ok := h[key].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	tables := make([]Headers, 0, len(values))
+	for _, value := range values {
+		table, ok := asHeaders(value)
+		if !ok {
+			return nil, false
+		}
+
+		tables = append(tables, table)
+	}
+
+	return tables, true
+}
+
+// GetStrings reads an array of strings header. An array holding anything but strings reports false.
+func (h Headers) GetStrings(key string) ([]string, bool) {
+
+	values, ok := h[key].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	strings := make([]string, 0, len(values))
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			strings = append(strings, value)
+		case []byte:
+			strings = append(strings, string(value))
+		default:
+			return nil, false
+		}
+	}
+
+	return strings, true
+}
+
+// Set sets the header, converting values AMQP can't encode as is to ones it can: nested Headers and maps to
+// amqp.Tables, and slices of strings or tables to arrays. Other values are set as given, see Validate.
+func (h Headers) Set(key string, value interface{}) {
+	h[key] = amqpValue(value)
+}
+
+// SetString sets a string header.
+func (h Headers) SetString(key string, value string) {
+	h[key] = value
+}
+
+// SetInt64 sets an integer header, a long long int on the wire.
+func (h Headers) SetInt64(key string, value int64) {
+	h[key] = value
+}
+
+// SetFloat64 sets a floating point header.
+func (h Headers) SetFloat64(key string, value float64) {
+	h[key] = value
+}
+
+// SetBool sets a boolean header.
+func (h Headers) SetBool(key string, value bool) {
+	h[key] = value
+}
+
+// SetTime sets a timestamp header. AMQP timestamps are in seconds, use SetInt64 with unix milliseconds when the
+// precision matters, GetTime reads either.
+func (h Headers) SetTime(key string, value time.Time) {
+	h[key] = value
+}
+
+// SetTable sets a nested table header.
+func (h Headers) SetTable(key string, value Headers) {
+	h[key] = amqpValue(value)
+}
+
+// Delete removes the header.
+func (h Headers) Delete(key string) {
+	delete(h, key)
+}
+
+// asHeaders reads a nested table, whichever map type it was set or decoded as.
+func asHeaders(value interface{}) (Headers, bool) {
+
+	switch table := value.(type) {
+	case amqp.Table:
+		return Headers(table), true
+	case Headers:
+		return table, true
+	case map[string]interface{}:
+		return Headers(table), true
+	}
+
+	return nil, false
+}
+
+// amqpValue converts the maps and slices AMQP can't encode to tables and arrays.
+func amqpValue(value interface{}) interface{} {
+
+	switch value := value.(type) {
+	case Headers:
+		return amqpTable(value)
+	case amqp.Table:
+		return amqpTable(value)
+	case map[string]interface{}:
+		return amqpTable(value)
+	case []Headers:
+		array := make([]interface{}, 0, len(value))
+		for _, table := range value {
+			array = append(array, amqpTable(table))
+		}
+		return array
+	case []string:
+		array := make([]interface{}, 0, len(value))
+		for _, s := range value {
+			array = append(array, s)
+		}
+		return array
+	case []interface{}:
+		array := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			array = append(array, amqpValue(item))
+		}
+		return array
+	}
+
+	return value
+}
+
+// amqpTable copies the map as an amqp.Table, converting its values.
+func amqpTable(values map[string]interface{}) amqp.Table {
+
+	table := make(amqp.Table, len(values))
+	for key, value := range values {
+		table[key] = amqpValue(value)
+	}
+
+	return table
+}
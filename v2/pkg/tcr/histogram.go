@@ -0,0 +1,156 @@
+package tcr
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds used when a Histogram is created without buckets.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	time.Hour,
+}
+
+// Histogram is a lock-free, fixed bucket histogram of durations.
+type Histogram struct {
+	buckets []time.Duration
+	counts  []uint64 // len(buckets)+1, last is the overflow (+Inf) bucket
+	count   uint64
+	sum     uint64 // nanoseconds
+	max     uint64 // nanoseconds
+}
+
+// HistogramSnapshot is a point in time copy of a Histogram.
+type HistogramSnapshot struct {
+	Buckets []time.Duration `json:"Buckets"`
+	Counts  []uint64        `json:"Counts"` // non-cumulative, len(Buckets)+1 with the last being overflow
+	Count   uint64          `json:"Count"`
+	Sum     time.Duration   `json:"Sum"`
+	Max     time.Duration   `json:"Max"`
+}
+
+// NewHistogram creates a Histogram with the provided bucket upper bounds (DefaultLatencyBuckets if empty).
+func NewHistogram(buckets []time.Duration) *Histogram {
+
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	sorted := make([]time.Duration, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return &Histogram{
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe records a single duration. Negative durations (clock skew) are recorded as zero.
+func (h *Histogram) Observe(value time.Duration) {
+
+	if value < 0 {
+		value = 0
+	}
+
+	index := sort.Search(len(h.buckets), func(i int) bool { return value <= h.buckets[i] })
+	atomic.AddUint64(&h.counts[index], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, uint64(value))
+
+	for {
+		max := atomic.LoadUint64(&h.max)
+		if uint64(value) <= max || atomic.CompareAndSwapUint64(&h.max, max, uint64(value)) {
+			return
+		}
+	}
+}
+
+// Snapshot copies the current state of the Histogram.
+func (h *Histogram) Snapshot() *HistogramSnapshot {
+
+	snapshot := &HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  make([]uint64, len(h.counts)),
+		Count:   atomic.LoadUint64(&h.count),
+		Sum:     time.Duration(atomic.LoadUint64(&h.sum)),
+		Max:     time.Duration(atomic.LoadUint64(&h.max)),
+	}
+
+	for i := range h.counts {
+		snapshot.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+
+	return snapshot
+}
+
+// Mean returns the average observed duration.
+func (hs *HistogramSnapshot) Mean() time.Duration {
+
+	if hs.Count == 0 {
+		return 0
+	}
+
+	return hs.Sum / time.Duration(hs.Count)
+}
+
+// Percentile estimates the duration at percentile p (0.0 - 1.0) using the bucket upper bounds.
+// Values landing in the overflow bucket report the observed Max.
+func (hs *HistogramSnapshot) Percentile(p float64) time.Duration {
+
+	var total uint64
+	for _, count := range hs.Counts {
+		total += count
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	target := uint64(p * float64(total))
+	if target == 0 {
+		target = 1
+	}
+
+	var cumulative uint64
+	for i, count := range hs.Counts {
+		cumulative += count
+		if cumulative >= target {
+			if i < len(hs.Buckets) {
+				return hs.Buckets[i]
+			}
+			break
+		}
+	}
+
+	return hs.Max
+}
+
+// merge adds the observations of another snapshot with identical buckets into this snapshot.
+func (hs *HistogramSnapshot) merge(other *HistogramSnapshot) {
+
+	if len(hs.Counts) != len(other.Counts) {
+		return
+	}
+
+	for i := range other.Counts {
+		hs.Counts[i] += other.Counts[i]
+	}
+
+	hs.Count += other.Count
+	hs.Sum += other.Sum
+	if other.Max > hs.Max {
+		hs.Max = other.Max
+	}
+}
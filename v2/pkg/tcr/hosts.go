@@ -0,0 +1,59 @@
+package tcr
+
+import (
+	"sync"
+)
+
+// hostList rotates through broker URIs, shared by every connection of a ConnectionPool.
+// The first URI is the preferred host.
+type hostList struct {
+	uris     []string
+	current  int
+	hostLock *sync.Mutex
+}
+
+func newHostList(uris []string) *hostList {
+
+	return &hostList{
+		uris:     uris,
+		hostLock: &sync.Mutex{},
+	}
+}
+
+// active returns the index and URI connections should dial.
+func (hl *hostList) active() (int, string) {
+	hl.hostLock.Lock()
+	defer hl.hostLock.Unlock()
+
+	return hl.current, hl.uris[hl.current]
+}
+
+// failed rotates to the next URI when index is still the active host. Returns the new active URI.
+// Checking the index stops several connections failing on the same host from skipping past healthy ones.
+func (hl *hostList) failed(index int) string {
+	hl.hostLock.Lock()
+	defer hl.hostLock.Unlock()
+
+	if index == hl.current {
+		hl.current = (hl.current + 1) % len(hl.uris)
+	}
+
+	return hl.uris[hl.current]
+}
+
+// prefer makes the preferred host active. Returns false when it already was.
+func (hl *hostList) prefer() bool {
+	hl.hostLock.Lock()
+	defer hl.hostLock.Unlock()
+
+	if hl.current == 0 {
+		return false
+	}
+
+	hl.current = 0
+	return true
+}
+
+func (hl *hostList) len() int {
+	return len(hl.uris)
+}
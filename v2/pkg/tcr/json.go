@@ -19,19 +19,10 @@ const (
 	AesSymmetricType = "aes"
 )
 
-// ConvertJSONFileToConfig opens a file.json and converts to RabbitSeasoning.
+// ConvertJSONFileToConfig opens a file.json and converts to RabbitSeasoning, applying the profile named by the
+// TCR_PROFILE environment variable or the file's Profile, see ConvertJSONFileToConfigProfile.
 func ConvertJSONFileToConfig(fileNamePath string) (*RabbitSeasoning, error) {
-
-	byteValue, err := ioutil.ReadFile(fileNamePath)
-	if err != nil {
-		return nil, err
-	}
-
-	config := &RabbitSeasoning{}
-	var json = jsoniter.ConfigFastest
-	err = json.Unmarshal(byteValue, config)
-
-	return config, err
+	return ConvertJSONFileToConfigProfile(fileNamePath, "")
 }
 
 // ConvertJSONFileToTopologyConfig opens a file.json and converts to Topology.
@@ -78,22 +69,36 @@ func ReadJSONFileToInterface(fileNamePath string) (interface{}, error) {
 }
 
 // CreatePayload creates a JSON marshal and optionally compresses and encrypts the bytes.
+// Payloads smaller than the compression MinCompressSize are left uncompressed.
 func CreatePayload(
 	input interface{},
 	compression *CompressionConfig,
 	encryption *EncryptionConfig) ([]byte, error) {
 
+	data, _, err := createPayload(input, "", compression, encryption)
+	return data, err
+}
+
+// createPayload is CreatePayload compressing with the first supported type in acceptEncoding, also returning
+// the compression type used, empty when uncompressed.
+func createPayload(
+	input interface{},
+	acceptEncoding string,
+	compression *CompressionConfig,
+	encryption *EncryptionConfig) ([]byte, string, error) {
+
 	var json = jsoniter.ConfigFastest
 	data, err := json.Marshal(&input)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	buffer := &bytes.Buffer{}
-	if compression.Enabled {
-		err := handleCompression(compression, data, buffer)
+	compressionType := SelectCompression(compression, len(data), acceptEncoding)
+	if compressionType != "" {
+		err := handleCompression(compressionType, data, buffer)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		// Update data - data is now compressed
@@ -103,14 +108,14 @@ func CreatePayload(
 	if encryption.Enabled {
 		err := handleEncryption(encryption, data, buffer)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		// Update data - data is now encrypted
 		data = buffer.Bytes()
 	}
 
-	return data, nil
+	return data, compressionType, nil
 }
 
 // CreateWrappedPayload wraps your data in a plaintext wrapper called ModdedLetter and performs the selected modifications to data.
@@ -121,6 +126,18 @@ func CreateWrappedPayload(
 	compression *CompressionConfig,
 	encryption *EncryptionConfig) ([]byte, error) {
 
+	return createWrappedPayload(input, letterID, metadata, "", compression, encryption)
+}
+
+// createWrappedPayload is CreateWrappedPayload compressing with the first supported type in acceptEncoding.
+func createWrappedPayload(
+	input interface{},
+	letterID uint64,
+	metadata string,
+	acceptEncoding string,
+	compression *CompressionConfig,
+	encryption *EncryptionConfig) ([]byte, error) {
+
 	wrappedBody := &WrappedBody{
 		LetterID:       letterID,
 		LetterMetadata: metadata,
@@ -136,15 +153,15 @@ func CreateWrappedPayload(
 	}
 
 	buffer := &bytes.Buffer{}
-	if compression.Enabled {
-		err := handleCompression(compression, innerData, buffer)
+	if compressionType := SelectCompression(compression, len(innerData), acceptEncoding); compressionType != "" {
+		err := handleCompression(compressionType, innerData, buffer)
 		if err != nil {
 			return nil, err
 		}
 
 		// Data is now compressed
 		wrappedBody.Body.Compressed = true
-		wrappedBody.Body.CType = compression.Type
+		wrappedBody.Body.CType = compressionType
 		innerData = buffer.Bytes()
 	}
 
@@ -171,16 +188,21 @@ func CreateWrappedPayload(
 	return data, nil
 }
 
-func handleCompression(compression *CompressionConfig, data []byte, buffer *bytes.Buffer) error {
+func handleCompression(compressionType string, data []byte, buffer *bytes.Buffer) error {
 
-	switch compression.Type {
-	case ZstdCompressionType:
-		return CompressWithZstd(data, buffer)
-	case GzipCompressionType:
-		fallthrough
-	default:
-		return CompressWithGzip(data, buffer)
+	compressor, err := GetCompressor(compressionType)
+	if err != nil {
+		return err
+	}
+
+	compressed, err := compressor.Compress(data)
+	if err != nil {
+		return err
 	}
+
+	*buffer = *bytes.NewBuffer(compressed)
+
+	return nil
 }
 
 func handleEncryption(encryption *EncryptionConfig, data []byte, buffer *bytes.Buffer) error {
@@ -201,8 +223,15 @@ func handleEncryption(encryption *EncryptionConfig, data []byte, buffer *bytes.B
 	}
 }
 
-// ReadPayload unencrypts and uncompresses payloads
+// ReadPayload unencrypts and uncompresses payloads. The compression type is detected from the payload, so
+// payloads left uncompressed or compressed with another supported type are read too.
 func ReadPayload(buffer *bytes.Buffer, compression *CompressionConfig, encryption *EncryptionConfig) error {
+	return ReadEncodedPayload(buffer, "", compression, encryption)
+}
+
+// ReadEncodedPayload is ReadPayload decompressing with the Compressor registered as contentEncoding, the
+// message's ContentEncoding. Without one, gzip and zstd are detected from the payload when compression is enabled.
+func ReadEncodedPayload(buffer *bytes.Buffer, contentEncoding string, compression *CompressionConfig, encryption *EncryptionConfig) error {
 
 	if encryption != nil && encryption.Enabled {
 		if err := handleDecryption(encryption, buffer); err != nil {
@@ -210,25 +239,32 @@ func ReadPayload(buffer *bytes.Buffer, compression *CompressionConfig, encryptio
 		}
 	}
 
-	if compression != nil && compression.Enabled {
-		if err := handleDecompression(compression, buffer); err != nil {
-			return err
-		}
+	if contentEncoding == "" && compression != nil && compression.Enabled {
+		contentEncoding = DetectCompression(buffer.Bytes())
 	}
 
-	return nil
+	return handleDecompression(contentEncoding, buffer)
 }
 
-func handleDecompression(compression *CompressionConfig, buffer *bytes.Buffer) error {
+func handleDecompression(compressionType string, buffer *bytes.Buffer) error {
 
-	switch compression.Type {
-	case ZstdCompressionType:
-		return DecompressWithZstd(buffer)
-	case GzipCompressionType:
-		fallthrough
-	default:
-		return DecompressWithGzip(buffer)
+	if compressionType == "" || compressionType == IdentityEncoding {
+		return nil // not compressed
+	}
+
+	compressor, err := GetCompressor(compressionType)
+	if err != nil {
+		return err
 	}
+
+	data, err := compressor.Decompress(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+
+	*buffer = *bytes.NewBuffer(data)
+
+	return nil
 }
 
 func handleDecryption(encryption *EncryptionConfig, buffer *bytes.Buffer) error {
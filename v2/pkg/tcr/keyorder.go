@@ -0,0 +1,72 @@
+package tcr
+
+import (
+	"context"
+	"sync"
+)
+
+// keyOrder lets one publish per exchange and routing key be in flight at a time, the rest wait their turn in
+// the order they arrived.
+type keyOrder struct {
+	turns     map[string]*keyTurn
+	orderLock *sync.Mutex
+}
+
+// keyTurn is handed between the publishes to one key, token holds a value while no publish has the turn.
+type keyTurn struct {
+	token   chan struct{}
+	holders int // publishes with or waiting for the turn
+}
+
+// newKeyOrder creates a keyOrder. Returns nil when not enabled.
+func newKeyOrder(enabled bool) *keyOrder {
+
+	if !enabled {
+		return nil
+	}
+
+	return &keyOrder{
+		turns:     make(map[string]*keyTurn),
+		orderLock: &sync.Mutex{},
+	}
+}
+
+// wait blocks until it is the key's turn and returns the func that ends it. Returns ctx.Err() when ctx is done
+// first. A nil keyOrder never waits.
+func (ko *keyOrder) wait(ctx context.Context, key string) (func(), error) {
+
+	if ko == nil {
+		return func() {}, nil
+	}
+
+	ko.orderLock.Lock()
+	turn, ok := ko.turns[key]
+	if !ok {
+		turn = &keyTurn{token: make(chan struct{}, 1)}
+		turn.token <- struct{}{}
+		ko.turns[key] = turn
+	}
+	turn.holders++
+	ko.orderLock.Unlock()
+
+	select {
+	case <-turn.token:
+		return func() {
+			turn.token <- struct{}{}
+			ko.leave(key, turn)
+		}, nil
+	case <-ctx.Done():
+		ko.leave(key, turn)
+		return nil, ctx.Err()
+	}
+}
+
+// leave forgets the key once no publish has or waits for its turn.
+func (ko *keyOrder) leave(key string, turn *keyTurn) {
+	ko.orderLock.Lock()
+	defer ko.orderLock.Unlock()
+
+	if turn.holders--; turn.holders == 0 {
+		delete(ko.turns, key)
+	}
+}
@@ -1,6 +1,11 @@
 package tcr
 
-import "github.com/streadway/amqp"
+import (
+	"strconv"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
 
 // Letter contains the message body and address of where things are going.
 type Letter struct {
@@ -8,17 +13,60 @@ type Letter struct {
 	RetryCount uint32
 	Body       []byte
 	Envelope   *Envelope
+
+	// OnReceipt, when set, is called once with the letter's final PublishReceipt in addition to PublishReceipts, on
+	// the publishing goroutine, so keep it quick. When a RabbitService retries failures, it's called with the failure
+	// only after the last retry.
+	OnReceipt func(*PublishReceipt) `json:"-"`
+
+	requeues uint32 // by the RabbitService after failed publishes, the letter goes to its Outbox after RetryAttempts
 }
 
-// Envelope contains all the address details of where a letter is going.
+// Envelope contains all the address details of where a letter is going and the properties it is sent with.
 type Envelope struct {
-	Exchange     string
-	RoutingKey   string
-	ContentType  string
-	Mandatory    bool
-	Immediate    bool
-	Headers      amqp.Table
-	DeliveryMode uint8
+	Exchange        string
+	RoutingKey      string
+	ContentType     string
+	ContentEncoding string
+	Mandatory       bool
+	Immediate       bool
+	Headers         amqp.Table
+	DeliveryMode    uint8         // amqp.Transient or amqp.Persistent
+	Priority        uint8         // 0 to 9, only honored by priority queues
+	Expiration      time.Duration // per-message TTL, zero never expires, rounded down to milliseconds
+	CorrelationID   string
+	ReplyTo         string
+	MessageID       string
+	Timestamp       time.Time
+	Type            string
+	UserID          string // must match the connection's user when set
+	AppID           string
+}
+
+// publishing converts the letter into the amqp.Publishing sent to the broker.
+func (letter *Letter) publishing() amqp.Publishing {
+
+	publishing := amqp.Publishing{
+		ContentType:     letter.Envelope.ContentType,
+		ContentEncoding: letter.Envelope.ContentEncoding,
+		Body:            letter.Body,
+		Headers:         letter.Envelope.Headers,
+		DeliveryMode:    letter.Envelope.DeliveryMode,
+		Priority:        letter.Envelope.Priority,
+		CorrelationId:   letter.Envelope.CorrelationID,
+		ReplyTo:         letter.Envelope.ReplyTo,
+		MessageId:       letter.Envelope.MessageID,
+		Timestamp:       letter.Envelope.Timestamp,
+		Type:            letter.Envelope.Type,
+		UserId:          letter.Envelope.UserID,
+		AppId:           letter.Envelope.AppID,
+	}
+
+	if letter.Envelope.Expiration > 0 {
+		publishing.Expiration = strconv.FormatInt(int64(letter.Envelope.Expiration/time.Millisecond), 10)
+	}
+
+	return publishing
 }
 
 // WrappedBody is to go inside a Letter struct with indications of the body of data being modified (ex., compressed).
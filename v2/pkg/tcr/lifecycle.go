@@ -0,0 +1,128 @@
+package tcr
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// LifecycleInitializing is emitted when a ConnectionPool starts creating its connections and channels.
+	LifecycleInitializing = "initializing"
+
+	// LifecycleInitialized is emitted when a ConnectionPool is ready for use.
+	LifecycleInitialized = "initialized"
+
+	// LifecycleDegraded is emitted when a healthy ConnectionPool loses a connection or fails to create or recover
+	// a channel.
+	LifecycleDegraded = "degraded"
+
+	// LifecycleRecovered is emitted when a degraded ConnectionPool has reconnected or recovered its channel.
+	LifecycleRecovered = "recovered"
+
+	// LifecycleShuttingDown is emitted when Shutdown begins, before any shutdown hook runs.
+	LifecycleShuttingDown = "shutting-down"
+
+	// LifecycleShutdown is emitted when Shutdown has closed everything, after the post-close hooks.
+	LifecycleShutdown = "shutdown"
+)
+
+// LifecycleEvent is a change in a ConnectionPool's lifecycle.
+type LifecycleEvent struct {
+	Type           string    `json:"Type"`
+	ConnectionName string    `json:"ConnectionName"`
+	Message        string    `json:"Message,omitempty"`
+	UTCDateTime    time.Time `json:"UTCDateTime"`
+}
+
+// lifecycle calls the listeners with each LifecycleEvent, in the order they were added.
+type lifecycle struct {
+	listeners     []func(*LifecycleEvent)
+	degraded      bool
+	lifecycleLock *sync.Mutex
+}
+
+func newLifecycle(listener func(*LifecycleEvent)) *lifecycle {
+
+	lc := &lifecycle{lifecycleLock: &sync.Mutex{}}
+	if listener != nil {
+		lc.listeners = append(lc.listeners, listener)
+	}
+
+	return lc
+}
+
+// OnLifecycle adds a listener that is called, synchronously and in the order added, with every LifecycleEvent of
+// the ConnectionPool from now on. Listeners run on the goroutine making the change, so Shutdown waits for them and
+// they must not block. Use PoolConfig.OnLifecycle to hear about initializing too.
+func (cp *ConnectionPool) OnLifecycle(listener func(*LifecycleEvent)) {
+	cp.lifecycle.lifecycleLock.Lock()
+	defer cp.lifecycle.lifecycleLock.Unlock()
+
+	cp.lifecycle.listeners = append(cp.lifecycle.listeners, listener)
+}
+
+// RegisterShutdownHook registers a hook to run when Shutdown begins, before cached channels close. Hooks run in
+// registration order, use OnShutdown for the later stages or hooks that can fail.
+func (cp *ConnectionPool) RegisterShutdownHook(hook func()) {
+
+	cp.OnShutdown(ShutdownPreDrain, "registered", func() error {
+		hook()
+		return nil
+	})
+}
+
+// emitLifecycle calls the lifecycle listeners with the event.
+func (cp *ConnectionPool) emitLifecycle(eventType string, message string) {
+
+	cp.lifecycle.lifecycleLock.Lock()
+	listeners := cp.lifecycle.listeners
+	cp.lifecycle.lifecycleLock.Unlock()
+
+	if len(listeners) == 0 {
+		return
+	}
+
+	event := &LifecycleEvent{
+		Type:           eventType,
+		ConnectionName: cp.Config.ConnectionName,
+		Message:        message,
+		UTCDateTime:    time.Now().UTC(),
+	}
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// degrade emits LifecycleDegraded, unless the pool is already degraded or shutting down.
+func (cp *ConnectionPool) degrade(message string) {
+
+	if cp.closed() || !cp.lifecycle.setDegraded(true) {
+		return
+	}
+
+	cp.emitLifecycle(LifecycleDegraded, message)
+}
+
+// restore emits LifecycleRecovered when the pool was degraded.
+func (cp *ConnectionPool) restore(message string) {
+
+	if cp.closed() || !cp.lifecycle.setDegraded(false) {
+		return
+	}
+
+	cp.emitLifecycle(LifecycleRecovered, message)
+}
+
+// setDegraded reports whether degraded changed.
+func (lc *lifecycle) setDegraded(degraded bool) bool {
+	lc.lifecycleLock.Lock()
+	defer lc.lifecycleLock.Unlock()
+
+	if lc.degraded == degraded {
+		return false
+	}
+
+	lc.degraded = degraded
+	return true
+}
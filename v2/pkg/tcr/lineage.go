@@ -0,0 +1,88 @@
+package tcr
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// crockford is the ULID alphabet, Crockford's base32 without I, L, O and U.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// correlationKey is the context key for the correlation ID carried between consumed and published messages.
+type correlationKey struct{}
+
+// NewMessageID creates a ULID, a 26 character ID that sorts by the millisecond it was created.
+// Publishers stamp it on letters without a MessageID.
+func NewMessageID() string {
+
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(id[6:])
+
+	// 128 bits as 26 base32 characters, the first holding the top 3 bits.
+	var encoded [26]byte
+	high := binary.BigEndian.Uint64(id[:8])
+	low := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		encoded[i] = crockford[low&31]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+
+	return string(encoded[:])
+}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID. Letters published with it,
+// through PublishWithConfirmationContext or PublishAndWait, get it as their CorrelationID when they have none.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, correlationID)
+}
+
+// CorrelationIDFromContext gets the correlation ID carried by ctx, empty when it has none.
+func CorrelationIDFromContext(ctx context.Context) string {
+
+	if ctx == nil {
+		return ""
+	}
+
+	correlationID, _ := ctx.Value(correlationKey{}).(string)
+	return correlationID
+}
+
+// WithCorrelation returns a copy of ctx carrying the message's CorrelationID, or its MessageID when the message
+// starts a lineage, so whatever is published while handling it is correlated back to it.
+func (msg *ReceivedMessage) WithCorrelation(ctx context.Context) context.Context {
+
+	correlationID := msg.CorrelationID
+	if correlationID == "" {
+		correlationID = msg.MessageID
+	}
+
+	if correlationID == "" {
+		return ctx
+	}
+
+	return WithCorrelationID(ctx, correlationID)
+}
+
+// stamp fills in the letter's MessageID and Timestamp, and its CorrelationID from ctx, when they aren't set.
+func (letter *Letter) stamp(ctx context.Context) {
+
+	if letter.Envelope == nil {
+		return
+	}
+
+	if letter.Envelope.MessageID == "" {
+		letter.Envelope.MessageID = NewMessageID()
+	}
+
+	if letter.Envelope.Timestamp.IsZero() {
+		letter.Envelope.Timestamp = time.Now()
+	}
+
+	if letter.Envelope.CorrelationID == "" {
+		letter.Envelope.CorrelationID = CorrelationIDFromContext(ctx)
+	}
+}
@@ -0,0 +1,92 @@
+package tcr
+
+import (
+	"fmt"
+	"log"
+)
+
+const (
+	// LogLevelDebug logs everything.
+	LogLevelDebug = iota
+
+	// LogLevelInfo logs info, warnings, and errors.
+	LogLevelInfo
+
+	// LogLevelWarn logs warnings and errors.
+	LogLevelWarn
+
+	// LogLevelError logs only errors.
+	LogLevelError
+)
+
+// Logger allows you to receive the internal logging of pools, publishers, and consumers.
+// Messages follow fmt.Printf formatting.
+type Logger interface {
+	Debug(format string, args ...interface{})
+	Info(format string, args ...interface{})
+	Warn(format string, args ...interface{})
+	Error(format string, args ...interface{})
+}
+
+// NoOpLogger discards everything and is the default Logger.
+type NoOpLogger struct{}
+
+// Debug does nothing.
+func (NoOpLogger) Debug(format string, args ...interface{}) {}
+
+// Info does nothing.
+func (NoOpLogger) Info(format string, args ...interface{}) {}
+
+// Warn does nothing.
+func (NoOpLogger) Warn(format string, args ...interface{}) {}
+
+// Error does nothing.
+func (NoOpLogger) Error(format string, args ...interface{}) {}
+
+// StdLogger writes to a standard library *log.Logger at or above a minimum level.
+type StdLogger struct {
+	logger *log.Logger
+	level  int
+}
+
+// NewStdLogger creates a Logger backed by the standard library log package.
+func NewStdLogger(logger *log.Logger, level int) *StdLogger {
+
+	if logger == nil {
+		logger = log.New(log.Writer(), "[tcr] ", log.LstdFlags)
+	}
+
+	return &StdLogger{
+		logger: logger,
+		level:  level,
+	}
+}
+
+// Debug logs debug messages.
+func (sl *StdLogger) Debug(format string, args ...interface{}) {
+	sl.write(LogLevelDebug, "DEBUG", format, args...)
+}
+
+// Info logs informational messages.
+func (sl *StdLogger) Info(format string, args ...interface{}) {
+	sl.write(LogLevelInfo, "INFO", format, args...)
+}
+
+// Warn logs warnings.
+func (sl *StdLogger) Warn(format string, args ...interface{}) {
+	sl.write(LogLevelWarn, "WARN", format, args...)
+}
+
+// Error logs errors.
+func (sl *StdLogger) Error(format string, args ...interface{}) {
+	sl.write(LogLevelError, "ERROR", format, args...)
+}
+
+func (sl *StdLogger) write(level int, prefix string, format string, args ...interface{}) {
+
+	if level < sl.level {
+		return
+	}
+
+	sl.logger.Output(3, prefix+": "+fmt.Sprintf(format, args...))
+}
@@ -1,11 +1,18 @@
 package tcr
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const (
+	// HeaderPublishedAt is the header consumers check for the time a message was published.
+	HeaderPublishedAt = "x-published-at"
 )
 
 // PublishReceipt is a way to monitor publishing success and to initiate a retry when using async publishing.
@@ -27,11 +34,31 @@ func (not *PublishReceipt) ToString() string {
 
 // ReceivedMessage allow for you to acknowledge, after processing the received payload, by its RabbitMQ tag and Channel pointer.
 type ReceivedMessage struct {
-	IsAckable   bool
-	Body        []byte
-	Headers     amqp.Table
-	deliveryTag uint64
-	amqpChan    *amqp.Channel
+	IsAckable       bool
+	Body            []byte
+	Headers         amqp.Table
+	ContentType     string
+	ContentEncoding string // the compression type of the Body, for ReadEncodedPayload
+	MessageID       string
+	CorrelationID   string
+	ReplyTo         string
+	Type            string
+	AppID           string
+	Priority        uint8
+	Timestamp       time.Time
+	Exchange        string // the exchange it was published to, empty for the default exchange
+	RoutingKey      string // the routing key it was published with
+	Queue           string // the queue it was consumed from
+	deliveryTag     uint64
+	chunkTags       []uint64 // earlier chunks of a reassembled message, settled along with it
+	acknowledger    amqp.Acknowledger
+	deduper         Deduper
+	dedupKey        string
+	inflight        *inflightTracker // counts the message until it is settled, for Consumer.Drain
+	metrics         *consumerMetrics // counts how the message was settled, for Consumer.Counters
+	settled         int32
+	claim           int32           // settled by the handler or, past the HandlerTimeout, by the Consumer
+	ctx             context.Context // cancelled when the HandlerTimeout passes
 }
 
 // NewMessage creates a new Message.
@@ -42,12 +69,35 @@ func NewMessage(
 	deliveryTag uint64,
 	amqpChan *amqp.Channel) *ReceivedMessage {
 
-	return &ReceivedMessage{
+	msg := &ReceivedMessage{
 		IsAckable:   isAckable,
 		Body:        body,
 		Headers:     headers,
 		deliveryTag: deliveryTag,
-		amqpChan:    amqpChan,
+	}
+
+	if amqpChan != nil {
+		msg.acknowledger = amqpChan
+	}
+
+	return msg
+}
+
+// NewMessageWithAcknowledger creates a new Message settled through the given Acknowledger instead of a channel,
+// for test doubles.
+func NewMessageWithAcknowledger(
+	isAckable bool,
+	body []byte,
+	headers amqp.Table,
+	deliveryTag uint64,
+	acknowledger amqp.Acknowledger) *ReceivedMessage {
+
+	return &ReceivedMessage{
+		IsAckable:    isAckable,
+		Body:         body,
+		Headers:      headers,
+		deliveryTag:  deliveryTag,
+		acknowledger: acknowledger,
 	}
 }
 
@@ -59,11 +109,34 @@ func (msg *ReceivedMessage) Acknowledge() error {
 		return errors.New("can't acknowledge, not an ackable message")
 	}
 
-	if msg.amqpChan == nil {
+	if msg.acknowledger == nil {
 		return errors.New("can't acknowledge, internal channel is nil")
 	}
 
-	return msg.amqpChan.Ack(msg.deliveryTag, false)
+	if !msg.claimForHandler() {
+		return ErrHandlerTimeout
+	}
+
+	for _, chunkTag := range msg.chunkTags {
+		if err := msg.acknowledger.Ack(chunkTag, false); err != nil {
+			msg.track(err, true, false)
+			return err
+		}
+	}
+
+	err := msg.acknowledger.Ack(msg.deliveryTag, false)
+	msg.track(err, true, false)
+	if err != nil {
+		return err
+	}
+
+	if msg.deduper != nil {
+		if err := msg.deduper.MarkProcessed(msg.dedupKey); err != nil {
+			return fmt.Errorf("message acknowledged but not marked processed: %w", err)
+		}
+	}
+
+	return nil
 }
 
 // Nack allows for you to negative acknowledge message on the original channel it was received.
@@ -73,11 +146,30 @@ func (msg *ReceivedMessage) Nack(requeue bool) error {
 		return errors.New("can't nack, not an ackable message")
 	}
 
-	if msg.amqpChan == nil {
+	if msg.acknowledger == nil {
 		return errors.New("can't nack, internal channel is nil")
 	}
 
-	return msg.amqpChan.Nack(msg.deliveryTag, false, requeue)
+	if !msg.claimForHandler() {
+		return ErrHandlerTimeout
+	}
+
+	return msg.nack(requeue)
+}
+
+// nack nacks the message and its chunks.
+func (msg *ReceivedMessage) nack(requeue bool) error {
+
+	for _, chunkTag := range msg.chunkTags {
+		if err := msg.acknowledger.Nack(chunkTag, false, requeue); err != nil {
+			msg.track(err, false, requeue)
+			return err
+		}
+	}
+
+	err := msg.acknowledger.Nack(msg.deliveryTag, false, requeue)
+	msg.track(err, false, requeue)
+	return err
 }
 
 // Reject allows for you to reject on the original channel it was received.
@@ -87,11 +179,68 @@ func (msg *ReceivedMessage) Reject(requeue bool) error {
 		return errors.New("can't reject, not an ackable message")
 	}
 
-	if msg.amqpChan == nil {
+	if msg.acknowledger == nil {
 		return errors.New("can't reject, internal channel is nil")
 	}
 
-	return msg.amqpChan.Reject(msg.deliveryTag, requeue)
+	if !msg.claimForHandler() {
+		return ErrHandlerTimeout
+	}
+
+	for _, chunkTag := range msg.chunkTags {
+		if err := msg.acknowledger.Reject(chunkTag, requeue); err != nil {
+			msg.track(err, false, requeue)
+			return err
+		}
+	}
+
+	err := msg.acknowledger.Reject(msg.deliveryTag, requeue)
+	msg.track(err, false, requeue)
+	return err
+}
+
+// track records the message's first settlement, reporting it to its Consumer's inflightTracker and metrics.
+func (msg *ReceivedMessage) track(err error, ack bool, requeue bool) {
+
+	if !atomic.CompareAndSwapInt32(&msg.settled, 0, 1) {
+		return
+	}
+
+	if msg.metrics != nil {
+		msg.metrics.settled(err, ack, requeue)
+	}
+
+	if msg.inflight != nil {
+		msg.inflight.settle(err, ack, requeue)
+	}
+}
+
+// Context is the message's context for its handler, carrying the HandlerTimeout of its Consumer as a deadline
+// that cancels it when the message is nacked for timing out. It has no deadline otherwise.
+func (msg *ReceivedMessage) Context() context.Context {
+
+	if msg.ctx == nil {
+		return context.Background()
+	}
+
+	return msg.ctx
+}
+
+// isSettled reports whether the message was already acknowledged, nacked, or rejected.
+func (msg *ReceivedMessage) isSettled() bool {
+	return atomic.LoadInt32(&msg.settled) == 1
+}
+
+// Decode deserializes the Body into output with the Codec matching the message ContentType.
+// Messages without a ContentType are decoded as JSON.
+func (msg *ReceivedMessage) Decode(output interface{}) error {
+
+	codec, err := GetCodec(msg.ContentType)
+	if err != nil {
+		return err
+	}
+
+	return codec.Unmarshal(msg.Body, output)
 }
 
 // ErrorMessage allow for you to replay a message that was returned.
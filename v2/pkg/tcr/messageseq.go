@@ -0,0 +1,119 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+)
+
+// MessageResult is a message, or an error, from MessagesChan.
+type MessageResult struct {
+	Message *ReceivedMessage
+	Err     error
+}
+
+// Messages returns an iterator that starts the Consumer, yields its messages until ctx is done or the loop ranging
+// over it exits, then drains the Consumer. It is an iter.Seq2[*ReceivedMessage, error], so with Go 1.23 or later:
+//
+//	for msg, err := range consumer.Messages(ctx) {
+//		if err != nil {
+//			continue // or break, which stops the Consumer
+//		}
+//		...
+//		_ = msg.Acknowledge()
+//	}
+//
+// Consumer errors are yielded with a nil message and don't end the iteration, while ctx's error is yielded last
+// when it does. Once the iteration ends, the messages buffered and those yielded but not yet settled are requeued,
+// settling them later fails. A Consumer already started, or disabled, yields a single error. Before Go 1.23, call
+// the iterator with a yield func or use MessagesChan.
+func (con *Consumer) Messages(ctx context.Context) func(yield func(*ReceivedMessage, error) bool) {
+
+	return func(yield func(*ReceivedMessage, error) bool) {
+
+		if err := con.startMessages(); err != nil {
+			yield(nil, err)
+			return
+		}
+		defer con.stopMessages()
+
+		yieldMessages(ctx, con.receivedMessages, con.errors.errors, yield)
+	}
+}
+
+// MessagesChan is Messages over a channel, which closes once ctx is done and the Consumer has stopped. Cancel ctx
+// when done reading.
+func (con *Consumer) MessagesChan(ctx context.Context) <-chan *MessageResult {
+
+	results := make(chan *MessageResult)
+
+	go func() {
+		defer close(results)
+
+		con.Messages(ctx)(func(msg *ReceivedMessage, err error) bool {
+			select {
+			case results <- &MessageResult{Message: msg, Err: err}:
+				return true
+			case <-ctx.Done():
+				if msg != nil && msg.IsAckable {
+					_ = msg.Nack(true) // never read, so back on the queue
+				}
+				return false
+			}
+		})
+	}()
+
+	return results
+}
+
+// startMessages starts the Consumer for Messages, which stops it when done, so it must not be started already.
+func (con *Consumer) startMessages() error {
+
+	con.conLock.Lock()
+	started, enabled := con.Started, con.Enabled
+	con.conLock.Unlock()
+
+	if !enabled {
+		return errors.New("can't iterate the messages of a disabled consumer")
+	}
+
+	if started {
+		return errors.New("can't iterate the messages of a started consumer")
+	}
+
+	con.StartConsuming()
+	return nil
+}
+
+// stopMessages drains the Consumer without waiting on the messages the iteration left unsettled, so it stops by the
+// time Messages returns.
+func (con *Consumer) stopMessages() {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _ = con.Drain(ctx)
+}
+
+// yieldMessages yields the messages and errors until ctx is done, yielding its error, or yield returns false.
+func yieldMessages(
+	ctx context.Context,
+	messages <-chan *ReceivedMessage,
+	errs <-chan error,
+	yield func(*ReceivedMessage, error) bool) {
+
+	for {
+		select {
+		case <-ctx.Done():
+			yield(nil, ctx.Err())
+			return
+		case msg := <-messages:
+			if !yield(msg, nil) {
+				return
+			}
+		case err := <-errs:
+			if !yield(nil, err) {
+				return
+			}
+		}
+	}
+}
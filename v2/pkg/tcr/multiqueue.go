@@ -0,0 +1,135 @@
+package tcr
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// consumeQueues lists the queues a Consumer consumes, queueName first and without repeats.
+func consumeQueues(queueName string, queueNames []string) []string {
+
+	queues := []string{queueName}
+	for _, name := range queueNames {
+		repeated := false
+		for _, queue := range queues {
+			repeated = repeated || queue == name
+		}
+
+		if !repeated && name != "" {
+			queues = append(queues, name)
+		}
+	}
+
+	return queues
+}
+
+// Queues are the queues the Consumer consumes, QueueName first followed by the QueueNames.
+func (con *Consumer) Queues() []string {
+	return append([]string{}, con.queueNames...)
+}
+
+// consumerTag is the tag of the Consumer's basic.consume on the queue. A single queue uses the ConsumerName.
+func (con *Consumer) consumerTag(queueName string) string {
+
+	if len(con.queueNames) == 1 {
+		return con.ConsumerName
+	}
+
+	return con.ConsumerName + "." + queueName
+}
+
+// consume issues a basic.consume on the channel for each of the Consumer's queues, merging their deliveries into
+// one channel. Stream args only apply to QueueName. The returned func stops the merge once the deliveries are no
+// longer read, any still unread are left unacknowledged on the channel.
+func (con *Consumer) consume(chanHost *ChannelHost, args amqp.Table) (<-chan amqp.Delivery, func(), error) {
+
+	if len(con.queueNames) == 1 {
+		chanHost.setOperation("basic.consume", con.QueueName)
+		deliveries, err := chanHost.Channel.Consume(con.QueueName, con.ConsumerName, con.autoAck, con.exclusive, false, con.noWait, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to consume from queue %s: %w", con.QueueName, err)
+		}
+
+		return deliveries, func() {}, nil
+	}
+
+	consumerTags := make(map[string]string, len(con.queueNames))
+	sources := make([]<-chan amqp.Delivery, 0, len(con.queueNames))
+	for i, queueName := range con.queueNames {
+		queueArgs := con.args
+		if i == 0 {
+			queueArgs = args
+		}
+
+		tag := con.consumerTag(queueName)
+		chanHost.setOperation("basic.consume", queueName)
+		deliveries, err := chanHost.Channel.Consume(queueName, tag, con.autoAck, con.exclusive, false, con.noWait, queueArgs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to consume from queue %s: %w", queueName, err)
+		}
+
+		consumerTags[tag] = queueName
+		sources = append(sources, deliveries)
+	}
+
+	con.consumerTags = consumerTags
+
+	merged, stop := mergeDeliveries(sources)
+	return merged, stop, nil
+}
+
+// cancel sends a basic.cancel for each of the Consumer's queues. Their deliveries close once the cancels complete.
+func (con *Consumer) cancel(chanHost *ChannelHost) error {
+
+	for _, queueName := range con.queueNames {
+		chanHost.setOperation("basic.cancel", queueName)
+		if err := chanHost.Channel.Cancel(con.consumerTag(queueName), false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeDeliveries forwards the deliveries of every source to one channel, which closes after they all have.
+// Calling the returned func stops forwarding.
+func mergeDeliveries(sources []<-chan amqp.Delivery) (<-chan amqp.Delivery, func()) {
+
+	merged := make(chan amqp.Delivery)
+	done := make(chan struct{})
+	forwarders := &sync.WaitGroup{}
+
+	for _, source := range sources {
+		forwarders.Add(1)
+		go func(source <-chan amqp.Delivery) {
+			defer forwarders.Done()
+
+			for {
+				select {
+				case delivery, ok := <-source:
+					if !ok {
+						return
+					}
+
+					select {
+					case merged <- delivery:
+					case <-done:
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}(source)
+	}
+
+	go func() {
+		forwarders.Wait()
+		close(merged)
+	}()
+
+	once := &sync.Once{}
+	return merged, func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,207 @@
+package tcr
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// NameKindExchange identifies exchange names.
+	NameKindExchange = "exchange"
+
+	// NameKindQueue identifies queue names.
+	NameKindQueue = "queue"
+
+	// NameKindRoutingKey identifies routing keys.
+	NameKindRoutingKey = "routing key"
+)
+
+var templatePlaceholder = regexp.MustCompile(`\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// NamingViolation is a name that does not match the configured convention.
+type NamingViolation struct {
+	Kind    string
+	Name    string
+	Pattern string
+}
+
+// Error allows you to quickly log the NamingViolation struct as a string.
+func (nv *NamingViolation) Error() string {
+	return fmt.Sprintf("%s %q does not match the naming convention %q", nv.Kind, nv.Name, nv.Pattern)
+}
+
+// NamingConvention validates exchange, queue, and routing key names, and decorates exchange and queue names
+// with a prefix and suffix.
+type NamingConvention struct {
+	Strict   bool
+	patterns map[string]*regexp.Regexp
+	sources  map[string]string
+	prefix   string
+	suffix   string
+}
+
+// NewNamingConvention compiles the NamingConfig patterns. Returns nil when config is nil.
+// A pattern is a regular expression, or a template when it contains {placeholder} tokens,
+// ex. "{domain}.{entity}.events" where each placeholder matches [A-Za-z0-9_-]+.
+func NewNamingConvention(config *NamingConfig) (*NamingConvention, error) {
+
+	if config == nil {
+		return nil, nil
+	}
+
+	nc := &NamingConvention{
+		Strict:   config.Strict,
+		patterns: make(map[string]*regexp.Regexp),
+		sources:  make(map[string]string),
+	}
+
+	for kind, pattern := range map[string]string{
+		NameKindExchange:   config.ExchangePattern,
+		NameKindQueue:      config.QueuePattern,
+		NameKindRoutingKey: config.RoutingKeyPattern,
+	} {
+		if pattern == "" {
+			continue
+		}
+
+		compiled, err := regexp.Compile(namingExpression(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s naming pattern %q: %w", kind, pattern, err)
+		}
+
+		nc.patterns[kind] = compiled
+		nc.sources[kind] = pattern
+	}
+
+	var err error
+	if nc.prefix, err = renderTemplate(config.Prefix, config.Variables); err != nil {
+		return nil, fmt.Errorf("invalid naming prefix %q: %w", config.Prefix, err)
+	}
+
+	if nc.suffix, err = renderTemplate(config.Suffix, config.Variables); err != nil {
+		return nil, fmt.Errorf("invalid naming suffix %q: %w", config.Suffix, err)
+	}
+
+	return nc, nil
+}
+
+// renderTemplate fills in the template's placeholders from variables, or else the environment.
+func renderTemplate(template string, variables map[string]string) (string, error) {
+
+	var missing string
+	rendered := templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if value, ok := variables[name]; ok {
+			return value
+		}
+
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+
+		if missing == "" {
+			missing = name
+		}
+		return placeholder
+	})
+
+	if missing != "" {
+		return "", fmt.Errorf("no value for {%s}", missing)
+	}
+
+	return rendered, nil
+}
+
+// namingExpression converts a template into an anchored regular expression, anchoring plain regexes too.
+func namingExpression(pattern string) string {
+
+	if templatePlaceholder.MatchString(pattern) {
+		literals := templatePlaceholder.Split(pattern, -1)
+		for i := range literals {
+			literals[i] = regexp.QuoteMeta(literals[i])
+		}
+
+		pattern = strings.Join(literals, "[A-Za-z0-9_-]+")
+	}
+
+	return "^(?:" + strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$") + ")$"
+}
+
+// Validate returns a NamingViolation when the name doesn't match the pattern for its kind.
+// Kinds without a pattern always pass.
+func (nc *NamingConvention) Validate(kind, name string) error {
+
+	pattern, ok := nc.patterns[kind]
+	if !ok || pattern.MatchString(name) {
+		return nil
+	}
+
+	return &NamingViolation{Kind: kind, Name: name, Pattern: nc.sources[kind]}
+}
+
+// Exchange decorates the exchange name with the prefix and suffix. The default exchange, the broker's amq.*
+// exchanges, and names already decorated are returned as is.
+func (nc *NamingConvention) Exchange(name string) string {
+	return nc.decorate(name)
+}
+
+// Queue decorates the queue name with the prefix and suffix. Server-named queues (""), the broker's amq.*
+// queues, and names already decorated are returned as is.
+func (nc *NamingConvention) Queue(name string) string {
+	return nc.decorate(name)
+}
+
+func (nc *NamingConvention) decorate(name string) string {
+
+	if nc == nil || (nc.prefix == "" && nc.suffix == "") {
+		return name
+	}
+
+	if name == "" || strings.HasPrefix(name, "amq.") {
+		return name
+	}
+
+	if nc.decorated(name) {
+		return name
+	}
+
+	return nc.prefix + name + nc.suffix
+}
+
+// undecorate removes the prefix and suffix from a decorated name.
+func (nc *NamingConvention) undecorate(name string) string {
+
+	if nc == nil || (nc.prefix == "" && nc.suffix == "") || !nc.decorated(name) {
+		return name
+	}
+
+	return name[len(nc.prefix) : len(name)-len(nc.suffix)]
+}
+
+func (nc *NamingConvention) decorated(name string) bool {
+
+	return strings.HasPrefix(name, nc.prefix) && strings.HasSuffix(name, nc.suffix) &&
+		len(name) > len(nc.prefix)+len(nc.suffix)
+}
+
+// enforce validates the names, logging violations as warnings or, in strict mode, returning the first one.
+func (nc *NamingConvention) enforce(logger Logger, kindNames ...string) error {
+
+	if nc == nil {
+		return nil
+	}
+
+	for i := 0; i+1 < len(kindNames); i += 2 {
+		if err := nc.Validate(kindNames[i], kindNames[i+1]); err != nil {
+			if nc.Strict {
+				return err
+			}
+
+			logger.Warn("%s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package tcr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// EventConnectionLost indicates a connection was found closed/unhealthy and recovery has begun.
+	EventConnectionLost = "connection-lost"
+
+	// EventConnectionRestored indicates a connection has been successfully reconnected.
+	EventConnectionRestored = "connection-restored"
+
+	// EventPoolDegraded indicates the pool was unable to create or recover a cached channel.
+	EventPoolDegraded = "pool-degraded"
+
+	// EventConnectionBlocked indicates the broker is blocking publishes on a connection, usually for a memory or disk alarm.
+	EventConnectionBlocked = "connection-blocked"
+
+	// EventConnectionUnblocked indicates the broker is accepting publishes on a blocked connection again.
+	EventConnectionUnblocked = "connection-unblocked"
+
+	// EventConnectionRecycled indicates a connection reached MaxConnectionLifetime and was replaced.
+	EventConnectionRecycled = "connection-recycled"
+
+	// EventMessageQuarantined indicates a Consumer moved a poison message to its quarantine queue.
+	EventMessageQuarantined = "message-quarantined"
+
+	// EventHostFailback indicates the preferred host is reachable again and connections are moving back to it.
+	EventHostFailback = "host-failback"
+
+	// EventSlowChannel indicates a cached channel's publishes were far slower, or failed far more, than the rest of the
+	// pool's, so it is being replaced.
+	EventSlowChannel = "slow-channel"
+
+	// WebhookTemplateSlack sends a Slack (incoming webhook) compatible payload.
+	WebhookTemplateSlack = "slack"
+
+	// WebhookTemplatePagerDuty sends a PagerDuty Events API v2 compatible payload.
+	WebhookTemplatePagerDuty = "pagerduty"
+
+	// WebhookTemplateGeneric sends the PoolEvent as plain JSON.
+	WebhookTemplateGeneric = "generic"
+)
+
+// PoolEvent describes something noteworthy that happened inside the ConnectionPool.
+type PoolEvent struct {
+	Type           string    `json:"Type"`
+	ConnectionName string    `json:"ConnectionName"`
+	ConnectionID   uint64    `json:"ConnectionID"`
+	Message        string    `json:"Message"`
+	UTCDateTime    time.Time `json:"UTCDateTime"`
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+type pagerDutyPayload struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyDetails `json:"payload"`
+}
+
+type pagerDutyDetails struct {
+	Summary   string `json:"summary"`
+	Source    string `json:"source"`
+	Severity  string `json:"severity"`
+	Timestamp string `json:"timestamp"`
+	Component string `json:"component"`
+}
+
+// Notifier POSTs PoolEvents to a configured webhook.
+type Notifier struct {
+	Config           WebhookConfig
+	client           *http.Client
+	customTemplate   *template.Template
+	cooldownInterval time.Duration
+	lastSent         map[string]time.Time
+	notifyLock       *sync.Mutex
+}
+
+// NewNotifier creates a Notifier from the WebhookConfig.
+func NewNotifier(config *WebhookConfig) (*Notifier, error) {
+
+	if config.URL == "" {
+		return nil, errors.New("webhook url can't be empty")
+	}
+
+	notifier := &Notifier{
+		Config:           *config,
+		client:           &http.Client{Timeout: time.Duration(config.TimeoutInterval) * time.Millisecond},
+		cooldownInterval: time.Duration(config.CooldownInterval) * time.Millisecond,
+		lastSent:         make(map[string]time.Time),
+		notifyLock:       &sync.Mutex{},
+	}
+
+	if notifier.client.Timeout == 0 {
+		notifier.client.Timeout = 5 * time.Second
+	}
+
+	if config.CustomTemplate != "" {
+		tmpl, err := template.New("webhook").Parse(config.CustomTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		notifier.customTemplate = tmpl
+	}
+
+	return notifier, nil
+}
+
+// Notify sends the event to the webhook in the background.
+// Events of the same type (and connection) are suppressed until the CooldownInterval has passed.
+func (n *Notifier) Notify(event *PoolEvent) {
+
+	if !n.shouldSend(event) {
+		return
+	}
+
+	go func(*PoolEvent) {
+		_ = n.Send(event)
+	}(event)
+}
+
+// Send builds the payload for the event and POSTs it to the webhook, ignoring the cooldown.
+func (n *Notifier) Send(event *PoolEvent) error {
+
+	payload, err := n.BuildPayload(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.Config.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// BuildPayload renders the event with the configured template.
+func (n *Notifier) BuildPayload(event *PoolEvent) ([]byte, error) {
+
+	if n.customTemplate != nil {
+		buffer := &bytes.Buffer{}
+		if err := n.customTemplate.Execute(buffer, event); err != nil {
+			return nil, err
+		}
+
+		return buffer.Bytes(), nil
+	}
+
+	var json = jsoniter.ConfigFastest
+	summary := fmt.Sprintf("[%s] %s (connection: %s-%d)", event.Type, event.Message, event.ConnectionName, event.ConnectionID)
+
+	switch n.Config.Template {
+	case WebhookTemplateSlack:
+		return json.Marshal(&slackPayload{Text: summary})
+	case WebhookTemplatePagerDuty:
+		payload := &pagerDutyPayload{
+			RoutingKey:  n.Config.RoutingKey,
+			EventAction: "trigger",
+			DedupKey:    fmt.Sprintf("%s-%d", event.ConnectionName, event.ConnectionID),
+			Payload: pagerDutyDetails{
+				Summary:   summary,
+				Source:    event.ConnectionName,
+				Severity:  "error",
+				Timestamp: event.UTCDateTime.Format(time.RFC3339),
+				Component: "turbocookedrabbit",
+			},
+		}
+
+		if event.Type == EventConnectionRestored || event.Type == EventConnectionUnblocked {
+			payload.EventAction = "resolve"
+			payload.Payload.Severity = "info"
+		}
+
+		if event.Type == EventConnectionRecycled {
+			payload.Payload.Severity = "info" // routine, nothing is wrong
+		}
+
+		return json.Marshal(payload)
+	case WebhookTemplateGeneric:
+		fallthrough
+	default:
+		return json.Marshal(event)
+	}
+}
+
+func (n *Notifier) shouldSend(event *PoolEvent) bool {
+	n.notifyLock.Lock()
+	defer n.notifyLock.Unlock()
+
+	key := fmt.Sprintf("%s-%d", event.Type, event.ConnectionID)
+	if last, ok := n.lastSent[key]; ok && time.Since(last) < n.cooldownInterval {
+		return false
+	}
+
+	n.lastSent[key] = time.Now()
+	return true
+}
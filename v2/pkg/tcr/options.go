@@ -0,0 +1,192 @@
+package tcr
+
+import (
+	"context"
+	"time"
+)
+
+// PoolOption sets a field of the PoolConfig built by NewConnectionPoolWithOptions. Any func(*PoolConfig) works,
+// for the fields without an option of their own.
+type PoolOption func(*PoolConfig)
+
+// WithConnectionName names the pool's connections, shown in the management UI.
+func WithConnectionName(name string) PoolOption {
+	return func(config *PoolConfig) { config.ConnectionName = name }
+}
+
+// WithFailoverURIs adds cluster URIs, tried in order after the first.
+func WithFailoverURIs(uris ...string) PoolOption {
+	return func(config *PoolConfig) { config.URIs = append([]string{config.URI}, uris...) }
+}
+
+// WithConnections sets MaxConnectionCount.
+func WithConnections(count uint64) PoolOption {
+	return func(config *PoolConfig) { config.MaxConnectionCount = count }
+}
+
+// WithChannels sets MaxCacheChannelCount.
+func WithChannels(count uint64) PoolOption {
+	return func(config *PoolConfig) { config.MaxCacheChannelCount = count }
+}
+
+// WithHeartbeat sets the connection heartbeat, rounded down to seconds.
+func WithHeartbeat(heartbeat time.Duration) PoolOption {
+	return func(config *PoolConfig) { config.Heartbeat = uint32(heartbeat / time.Second) }
+}
+
+// WithTLS connects with AMQPS using the TLSConfig.
+func WithTLS(tlsConfig *TLSConfig) PoolOption {
+	return func(config *PoolConfig) { config.TLSConfig = tlsConfig }
+}
+
+// WithLogger sets the pool's Logger, used by everything built on the pool.
+func WithLogger(logger Logger) PoolOption {
+	return func(config *PoolConfig) { config.Logger = logger }
+}
+
+// NewConnectionPoolWithOptions creates a ConnectionPool for the uri, with 2 connections, 10 cached channels, and a
+// 6 second heartbeat unless an option says otherwise. It returns ctx's error when ctx ends before the pool has
+// connected, and the pool is shut down once its dials finish.
+func NewConnectionPoolWithOptions(ctx context.Context, uri string, opts ...PoolOption) (*ConnectionPool, error) {
+
+	config := &PoolConfig{
+		URI:                  uri,
+		ConnectionName:       "tcr",
+		Heartbeat:            6,
+		ConnectionTimeout:    10,
+		SleepOnErrorInterval: 1000,
+		MaxConnectionCount:   2,
+		MaxCacheChannelCount: 10,
+	}
+
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		cp  *ConnectionPool
+		err error
+	}
+
+	created := make(chan result, 1)
+	go func() {
+		cp, err := NewConnectionPool(config)
+		created <- result{cp: cp, err: err}
+	}()
+
+	select {
+	case result := <-created:
+		return result.cp, result.err
+	case <-ctx.Done():
+		go func() {
+			if result := <-created; result.cp != nil {
+				result.cp.Shutdown()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// PublisherOption sets a field of the PublisherConfig built by NewPublisherWithOptions. Any func(*PublisherConfig)
+// works, for the fields without an option of their own.
+type PublisherOption func(*PublisherConfig)
+
+// WithConfirmTimeout sets how long publishes wait for a confirmation, PublishTimeOutInterval.
+func WithConfirmTimeout(timeout time.Duration) PublisherOption {
+	return func(config *PublisherConfig) { config.PublishTimeOutInterval = uint32(timeout / time.Millisecond) }
+}
+
+// WithPublishBackoff sets the delays between publish retries.
+func WithPublishBackoff(backoff BackoffPolicy) PublisherOption {
+	return func(config *PublisherConfig) { config.Backoff = backoff }
+}
+
+// WithEnvelopeDefaults sets the properties of letters published without their own.
+func WithEnvelopeDefaults(defaults *EnvelopeDefaults) PublisherOption {
+	return func(config *PublisherConfig) { config.EnvelopeDefaults = defaults }
+}
+
+// WithReceiptSink sets the ReceiptSink called with the outcome of every publish.
+func WithReceiptSink(sink ReceiptSink) PublisherOption {
+	return func(config *PublisherConfig) { config.ReceiptSink = sink }
+}
+
+// NewPublisherWithOptions creates a Publisher on the ConnectionPool, waiting 5 seconds for confirmations unless an
+// option says otherwise. Publish with the context-first PublishAndWait or PublishWithConfirmationContext.
+func NewPublisherWithOptions(cp *ConnectionPool, opts ...PublisherOption) *Publisher {
+
+	config := &PublisherConfig{
+		SleepOnIdleInterval:    0,
+		SleepOnErrorInterval:   1000,
+		PublishTimeOutInterval: 5000,
+	}
+
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	poolConfig := cp.Config
+	return NewPublisherFromConfig(&RabbitSeasoning{PoolConfig: &poolConfig, PublisherConfig: config}, cp)
+}
+
+// ConsumerOption sets a field of the ConsumerConfig built by NewConsumerWithOptions. Any func(*ConsumerConfig)
+// works, for the fields without an option of their own.
+type ConsumerOption func(*ConsumerConfig)
+
+// WithConsumerName sets the ConsumerName, the queue name by default.
+func WithConsumerName(name string) ConsumerOption {
+	return func(config *ConsumerConfig) { config.ConsumerName = name }
+}
+
+// WithPrefetch sets QosCountOverride.
+func WithPrefetch(count int) ConsumerOption {
+	return func(config *ConsumerConfig) { config.QosCountOverride = count }
+}
+
+// WithRetry sends failed messages through delayed retry queues, then a parking lot.
+func WithRetry(retryConfig *RetryConfig) ConsumerOption {
+	return func(config *ConsumerConfig) { config.RetryConfig = retryConfig }
+}
+
+// WithHandlerTimeout cancels a handler's ctx, and nacks its message, after the timeout.
+func WithHandlerTimeout(timeout time.Duration) ConsumerOption {
+	return func(config *ConsumerConfig) { config.HandlerTimeout = uint32(timeout / time.Millisecond) }
+}
+
+// NewConsumerWithOptions creates an enabled Consumer of the queue on the ConnectionPool, with a prefetch of 10 unless
+// an option says otherwise. Consume with the context-first Consume or Messages.
+func NewConsumerWithOptions(cp *ConnectionPool, queueName string, opts ...ConsumerOption) *Consumer {
+
+	config := &ConsumerConfig{
+		Enabled:              true,
+		QueueName:            queueName,
+		ConsumerName:         queueName,
+		QosCountOverride:     10,
+		SleepOnErrorInterval: 1000,
+	}
+
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	return NewConsumerFromConfig(config, cp)
+}
+
+// Consume starts the Consumer with the handler, see StartConsumingWithHandler, and blocks until ctx is done. It
+// then drains the Consumer, waiting for the messages in hand to be settled, and returns Drain's error, nil when
+// it drained cleanly.
+func (con *Consumer) Consume(ctx context.Context, handler func(*ReceivedMessage) error) error {
+
+	if err := con.StartConsumingWithHandler(handler); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+
+	_, err := con.Drain(context.Background())
+	return err
+}
@@ -0,0 +1,280 @@
+package tcr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	bolt "go.etcd.io/bbolt"
+)
+
+var outboxBucket = []byte("outbox")
+
+// OutboxEntry is a letter persisted in an OutboxStore.
+type OutboxEntry struct {
+	ID     uint64
+	Letter *Letter
+}
+
+// OutboxStore durably persists letters that could not be published.
+type OutboxStore interface {
+	Save(letter *Letter) error
+	Load(max int) ([]*OutboxEntry, error)
+	Delete(id uint64) error
+	Count() (int, error)
+	Close() error
+}
+
+// BoltOutboxStore is an OutboxStore backed by a local BoltDB file.
+type BoltOutboxStore struct {
+	db *bolt.DB
+}
+
+// NewBoltOutboxStore opens (or creates) a BoltDB file for storing letters.
+func NewBoltOutboxStore(fileNamePath string) (*BoltOutboxStore, error) {
+
+	db, err := bolt.Open(fileNamePath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open outbox store %q: %w", fileNamePath, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(outboxBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltOutboxStore{db: db}, nil
+}
+
+// Save persists the letter, in order, after any previously saved letters.
+func (bos *BoltOutboxStore) Save(letter *Letter) error {
+
+	var json = jsoniter.ConfigFastest
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	return bos.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(outboxBucket)
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(outboxKey(id), data)
+	})
+}
+
+// Load reads up to max of the oldest letters without removing them.
+func (bos *BoltOutboxStore) Load(max int) ([]*OutboxEntry, error) {
+
+	entries := make([]*OutboxEntry, 0)
+	err := bos.db.View(func(tx *bolt.Tx) error {
+
+		var json = jsoniter.ConfigFastest
+		cursor := tx.Bucket(outboxBucket).Cursor()
+		for key, value := cursor.First(); key != nil && len(entries) < max; key, value = cursor.Next() {
+
+			letter := &Letter{}
+			if err := json.Unmarshal(value, letter); err != nil {
+				return err
+			}
+
+			entries = append(entries, &OutboxEntry{ID: binary.BigEndian.Uint64(key), Letter: letter})
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// Delete removes a letter once it has been published.
+func (bos *BoltOutboxStore) Delete(id uint64) error {
+
+	return bos.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).Delete(outboxKey(id))
+	})
+}
+
+// Count is the number of letters waiting in the store.
+func (bos *BoltOutboxStore) Count() (int, error) {
+
+	count := 0
+	err := bos.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(outboxBucket).Stats().KeyN
+		return nil
+	})
+
+	return count, err
+}
+
+// Close closes the BoltDB file.
+func (bos *BoltOutboxStore) Close() error {
+	return bos.db.Close()
+}
+
+// outboxKey is big endian so keys iterate in insertion order.
+func outboxKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// Outbox republishes letters from an OutboxStore, with confirmations, in the background.
+// Entries are only deleted once the broker has confirmed them (at least once delivery).
+type Outbox struct {
+	Store                  OutboxStore
+	ConnectionPool         *ConnectionPool
+	batchSize              int
+	retryAttempts          uint32
+	republishInterval      time.Duration
+	publishTimeOutDuration time.Duration
+	stop                   chan struct{}
+	started                bool
+	outboxGroup            *sync.WaitGroup
+	outboxLock             *sync.Mutex
+}
+
+// NewOutbox creates an Outbox that drains the store through the ConnectionPool.
+func NewOutbox(store OutboxStore, cp *ConnectionPool, config *OutboxConfig) (*Outbox, error) {
+
+	if store == nil {
+		return nil, errors.New("can't create an outbox without a store")
+	}
+
+	if config == nil {
+		config = &OutboxConfig{}
+	}
+
+	outbox := &Outbox{
+		Store:                  store,
+		ConnectionPool:         cp,
+		batchSize:              int(config.BatchSize),
+		retryAttempts:          config.RetryAttempts,
+		republishInterval:      time.Duration(config.RepublishInterval) * time.Millisecond,
+		publishTimeOutDuration: time.Duration(config.PublishTimeOutInterval) * time.Millisecond,
+		outboxGroup:            &sync.WaitGroup{},
+		outboxLock:             &sync.Mutex{},
+	}
+
+	if outbox.batchSize == 0 {
+		outbox.batchSize = 100
+	}
+
+	if outbox.retryAttempts == 0 {
+		outbox.retryAttempts = 3
+	}
+
+	if outbox.republishInterval == 0 {
+		outbox.republishInterval = 5 * time.Second
+	}
+
+	if outbox.publishTimeOutDuration == 0 {
+		outbox.publishTimeOutDuration = 5 * time.Second
+	}
+
+	return outbox, nil
+}
+
+// Save persists a letter for republishing.
+func (ob *Outbox) Save(letter *Letter) error {
+
+	err := ob.Store.Save(letter)
+	if err == nil {
+		ob.ConnectionPool.logger.Warn("letter %d persisted to the outbox for republishing", letter.LetterID)
+	}
+
+	return err
+}
+
+// StartRepublishing begins draining the store in the background every RepublishInterval.
+func (ob *Outbox) StartRepublishing() {
+	ob.outboxLock.Lock()
+	defer ob.outboxLock.Unlock()
+
+	if ob.started {
+		return
+	}
+
+	ob.started = true
+	ob.stop = make(chan struct{})
+	ob.outboxGroup.Add(1)
+	go ob.republishLoop(ob.stop)
+}
+
+// StopRepublishing stops the background republisher and waits for it to exit.
+func (ob *Outbox) StopRepublishing() {
+	ob.outboxLock.Lock()
+	if !ob.started {
+		ob.outboxLock.Unlock()
+		return
+	}
+
+	ob.started = false
+	close(ob.stop)
+	ob.outboxLock.Unlock()
+
+	ob.outboxGroup.Wait()
+}
+
+func (ob *Outbox) republishLoop(stop chan struct{}) {
+	defer ob.outboxGroup.Done()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(ob.republishInterval):
+		}
+
+		if _, err := ob.Drain(); err != nil {
+			ob.ConnectionPool.logger.Debug("outbox drain stopped early, will retry: %s", err)
+		}
+	}
+}
+
+// Drain republishes stored letters, oldest first, until the store is empty or a publish fails.
+// Returns the number of letters republished.
+func (ob *Outbox) Drain() (int, error) {
+
+	published := 0
+	for {
+		entries, err := ob.Store.Load(ob.batchSize)
+		if err != nil {
+			return published, err
+		}
+
+		if len(entries) == 0 {
+			return published, nil
+		}
+
+		for _, entry := range entries {
+			if err := ob.republish(entry.Letter); err != nil {
+				return published, err
+			}
+
+			if err := ob.Store.Delete(entry.ID); err != nil {
+				return published, err
+			}
+
+			published++
+		}
+
+		ob.ConnectionPool.logger.Info("outbox republished %d letters", published)
+	}
+}
+
+// republish publishes a single letter and waits for its confirmation.
+func (ob *Outbox) republish(letter *Letter) error {
+	return publishConfirmed(ob.ConnectionPool, letter, ob.publishTimeOutDuration)
+}
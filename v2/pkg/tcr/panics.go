@@ -0,0 +1,102 @@
+package tcr
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	// OnPanicRequeue nacks, with requeue, the message whose handler panicked.
+	OnPanicRequeue = "requeue"
+
+	// OnPanicDeadLetter nacks, without requeue, the message whose handler panicked, so it goes to the queue's
+	// dead letter exchange when it has one (and is dropped otherwise).
+	OnPanicDeadLetter = "dead-letter"
+
+	// OnPanicAck acknowledges the message whose handler panicked.
+	OnPanicAck = "ack"
+
+	// EventHandlerPanic indicates a Consumer's handler panicked and the Consumer recovered.
+	EventHandlerPanic = "handler-panic"
+)
+
+// PanicError is sent on the Consumer's Errors() whenever its handler (or action) panics on a message.
+type PanicError struct {
+	ConsumerName string
+	QueueName    string
+	MessageID    string
+	Value        interface{} // what the handler panicked with
+	Stack        []byte      // the handler's goroutine stack when it panicked
+}
+
+// Error allows you to quickly log the PanicError struct as a string.
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("consumer %s handler panicked on message %q from %s: %v", pe.ConsumerName, pe.MessageID, pe.QueueName, pe.Value)
+}
+
+// onPanicAction validates ConsumerConfig.OnPanic, defaulting to OnPanicRequeue.
+func onPanicAction(consumerName string, onPanic string, cp *ConnectionPool) string {
+
+	switch onPanic {
+	case OnPanicRequeue, OnPanicDeadLetter, OnPanicAck:
+		return onPanic
+	case "":
+		return OnPanicRequeue
+	default:
+		if cp != nil {
+			cp.logger.Warn("consumer %s has an invalid OnPanic %q, using %q", consumerName, onPanic, OnPanicRequeue)
+		}
+		return OnPanicRequeue
+	}
+}
+
+// invokeAction calls the action, recovering when it panics so the consume loop keeps going. The message is
+// settled per OnPanic unless the action settled it before panicking.
+func (con *Consumer) invokeAction(action func(*ReceivedMessage), msg *ReceivedMessage) {
+
+	defer con.metrics.handled(time.Now())
+
+	if con.handlerTimeout > 0 && msg.IsAckable {
+		defer con.withHandlerTimeout(msg)()
+	}
+
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+
+		panicErr := &PanicError{
+			ConsumerName: con.ConsumerName,
+			QueueName:    con.QueueName,
+			MessageID:    msg.MessageID,
+			Value:        value,
+			Stack:        debug.Stack(),
+		}
+
+		con.ConnectionPool.logger.Error("%s\n%s", panicErr, panicErr.Stack)
+		con.ConnectionPool.notify(EventHandlerPanic, 0, panicErr.Error())
+		con.errors.report("handle", 0, panicErr)
+
+		if !msg.IsAckable || msg.isSettled() || msg.timedOut() {
+			return
+		}
+
+		var err error
+		switch con.onPanic {
+		case OnPanicAck:
+			err = msg.Acknowledge()
+		case OnPanicDeadLetter:
+			err = msg.Nack(false)
+		default:
+			err = msg.Nack(true)
+		}
+
+		if err != nil {
+			con.errors.report("settle", 0, fmt.Errorf("consumer unable to settle message after handler panic: %w", err))
+		}
+	}()
+
+	action(msg)
+}
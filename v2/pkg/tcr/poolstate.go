@@ -0,0 +1,62 @@
+package tcr
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrPoolClosed is returned by ConnectionPool methods once Shutdown has begun.
+var ErrPoolClosed = errors.New("connectionpool has been shutdown")
+
+// ErrNoCachedChannels is returned for cached channels by a transient-only ConnectionPool, one created with a
+// MaxCacheChannelCount of 0.
+var ErrNoCachedChannels = errors.New("connectionpool caches no channels")
+
+// PoolState is the lifecycle state of a ConnectionPool.
+type PoolState int32
+
+const (
+	// PoolUninitialized is a ConnectionPool still creating its connections and channels.
+	PoolUninitialized PoolState = iota
+
+	// PoolReady is a ConnectionPool in service.
+	PoolReady
+
+	// PoolShuttingDown is a ConnectionPool closing its channels and connections.
+	PoolShuttingDown
+
+	// PoolShutdown is a ConnectionPool that has released everything. It can't be used again.
+	PoolShutdown
+)
+
+// String allows you to quickly log the PoolState.
+func (ps PoolState) String() string {
+
+	switch ps {
+	case PoolUninitialized:
+		return "uninitialized"
+	case PoolReady:
+		return "ready"
+	case PoolShuttingDown:
+		return "shutting-down"
+	case PoolShutdown:
+		return "shutdown"
+	}
+
+	return "unknown"
+}
+
+// State is the current PoolState of the ConnectionPool.
+func (cp *ConnectionPool) State() PoolState {
+	return PoolState(atomic.LoadInt32(&cp.state))
+}
+
+// transition moves the pool from one state to another, returning false if it wasn't in the from state.
+func (cp *ConnectionPool) transition(from, to PoolState) bool {
+	return atomic.CompareAndSwapInt32(&cp.state, int32(from), int32(to))
+}
+
+// closed reports whether Shutdown has begun.
+func (cp *ConnectionPool) closed() bool {
+	return cp.State() >= PoolShuttingDown
+}
@@ -0,0 +1,222 @@
+package tcr
+
+import (
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// PoolStats is a point in time snapshot of a ConnectionPool, meant to be dumped on a debug endpoint.
+type PoolStats struct {
+	ConnectionName       string             `json:"ConnectionName"`
+	State                string             `json:"State"`
+	ActiveURI            string             `json:"ActiveURI"`
+	CircuitState         string             `json:"CircuitState"`
+	Blocked              bool               `json:"Blocked"`
+	MaxCacheChannelCount uint64             `json:"MaxCacheChannelCount"`
+	CachedChannels       uint64             `json:"CachedChannels"`    // open cached channels
+	IdleChannels         int                `json:"IdleChannels"`      // cached channels not checked out right now
+	ChannelsCreated      uint64             `json:"ChannelsCreated"`   // cached channels made, including remade after errors
+	ChannelGets          uint64             `json:"ChannelGets"`       // cached channels handed out
+	ChannelReturns       uint64             `json:"ChannelReturns"`    // channels returned
+	ChannelErrors        uint64             `json:"ChannelErrors"`     // channels returned in error and rebuilt
+	TransientChannels    uint64             `json:"TransientChannels"` // transient channels created
+	SlowChannels         uint64             `json:"SlowChannels"`      // cached channels replaced for being slow, see SlowChannelConfig
+	Connections          []*ConnectionStats `json:"Connections"`
+	Channels             []*ChannelStats    `json:"Channels"`
+	UTCDateTime          time.Time          `json:"UTCDateTime"`
+}
+
+// ConnectionStats describes one of the pool's connections.
+type ConnectionStats struct {
+	ConnectionID    uint64            `json:"ConnectionID"`
+	Name            string            `json:"Name"`
+	URI             string            `json:"URI"`
+	Open            bool              `json:"Open"`
+	Flagged         bool              `json:"Flagged"`
+	Blocked         bool              `json:"Blocked"`
+	BlockedReason   string            `json:"BlockedReason,omitempty"`
+	Age             time.Duration     `json:"Age"` // since the current connection was established
+	Reconnects      uint64            `json:"Reconnects"`
+	LastReconnectAt time.Time         `json:"LastReconnectAt,omitempty"`
+	Flags           uint64            `json:"Flags"` // times returned to the pool flagged as unhealthy
+	LastError       string            `json:"LastError,omitempty"`
+	LastErrorAt     time.Time         `json:"LastErrorAt,omitempty"`
+	RecentErrors    []ConnectionError `json:"RecentErrors,omitempty"` // oldest first, LastError is the newest
+	CachedChannels  uint64            `json:"CachedChannels"`
+}
+
+// ChannelStats describes one of the pool's cached channels.
+type ChannelStats struct {
+	ChannelID     uint64        `json:"ChannelID"`
+	ConnectionID  uint64        `json:"ConnectionID"`
+	Age           time.Duration `json:"Age"` // since the channel was last (re)made
+	LastUsed      time.Time     `json:"LastUsed,omitempty"`
+	Published     uint64        `json:"Published"` // since the channel was last (re)made
+	LastOperation string        `json:"LastOperation,omitempty"`
+	LastTarget    string        `json:"LastTarget,omitempty"`
+}
+
+// GetPoolStats takes a snapshot of the pool's connections, cached channels, and counters. It only reads
+// state, so it is safe to call at any time, including during an outage.
+func (cp *ConnectionPool) GetPoolStats() *PoolStats {
+
+	stats := &PoolStats{
+		ConnectionName:       cp.Config.ConnectionName,
+		State:                cp.State().String(),
+		ActiveURI:            cp.ActiveURI(),
+		CircuitState:         cp.CircuitState().String(),
+		Blocked:              cp.Blocked(),
+		MaxCacheChannelCount: atomic.LoadUint64(&cp.channelLimit),
+		CachedChannels:       atomic.LoadUint64(&cp.channelCount),
+		IdleChannels:         len(cp.channels),
+		ChannelsCreated:      atomic.LoadUint64(&cp.channelsCreated),
+		ChannelGets:          atomic.LoadUint64(&cp.channelGets),
+		ChannelReturns:       atomic.LoadUint64(&cp.channelReturns),
+		ChannelErrors:        atomic.LoadUint64(&cp.channelErrors),
+		TransientChannels:    atomic.LoadUint64(&cp.transientChannels),
+		SlowChannels:         cp.slowChannels.replacedCount(),
+		UTCDateTime:          time.Now().UTC(),
+	}
+
+	cp.poolRWLock.RLock()
+	connectionHosts := cp.connectionHosts
+	chanHosts := make([]*ChannelHost, 0, len(cp.cachedChannels))
+	for _, chanHost := range cp.cachedChannels {
+		chanHosts = append(chanHosts, chanHost)
+	}
+	cp.poolRWLock.RUnlock()
+
+	for _, connHost := range connectionHosts {
+		stats.Connections = append(stats.Connections, cp.connectionStats(connHost))
+	}
+
+	sort.Slice(chanHosts, func(i, j int) bool { return chanHosts[i].ID < chanHosts[j].ID })
+	for _, chanHost := range chanHosts {
+		stats.Channels = append(stats.Channels, chanHost.stats())
+	}
+
+	return stats
+}
+
+// PoolDump is a ConnectionPool's PoolStats along with the config in effect, for support tickets and debug
+// handlers. Credentials are redacted so it can be shared as is.
+type PoolDump struct {
+	Stats    *PoolStats `json:"Stats"`
+	Config   PoolConfig `json:"Config"`   // in effect, MaxCacheChannelCount included after a reload
+	Degraded bool       `json:"Degraded"` // since the last LifecycleDegraded
+}
+
+// DumpState takes a JSON serializable snapshot of the pool. Like GetPoolStats, it only reads state under the
+// pool's own locks, so it is safe to call at any time.
+func (cp *ConnectionPool) DumpState() *PoolDump {
+
+	dump := &PoolDump{
+		Stats:  cp.GetPoolStats(),
+		Config: cp.Config,
+	}
+
+	dump.Config.MaxCacheChannelCount = atomic.LoadUint64(&cp.channelLimit)
+	dump.Config.URI = redactURI(dump.Config.URI)
+	if len(dump.Config.URIs) > 0 {
+		dump.Config.URIs = make([]string, len(cp.Config.URIs))
+		for i, uri := range cp.Config.URIs {
+			dump.Config.URIs[i] = redactURI(uri)
+		}
+	}
+
+	if dump.Config.WebhookConfig != nil {
+		webhook := *dump.Config.WebhookConfig
+		webhook.URL = redactURI(webhook.URL)
+		if webhook.RoutingKey != "" {
+			webhook.RoutingKey = "xxxxx"
+		}
+		dump.Config.WebhookConfig = &webhook
+	}
+
+	dump.Stats.ActiveURI = redactURI(dump.Stats.ActiveURI)
+	for _, connStats := range dump.Stats.Connections {
+		connStats.URI = redactURI(connStats.URI)
+	}
+
+	cp.lifecycle.lifecycleLock.Lock()
+	dump.Degraded = cp.lifecycle.degraded
+	cp.lifecycle.lifecycleLock.Unlock()
+
+	return dump
+}
+
+// redactURI replaces the password of a URI, and the path and query of a webhook URL that may hold a token.
+func redactURI(uri string) string {
+
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" {
+		if uri == "" {
+			return ""
+		}
+		return "xxxxx" // not a URI we can pick apart, leave nothing out by accident
+	}
+
+	if parsed.Scheme == "http" || parsed.Scheme == "https" {
+		if parsed.Path != "" && parsed.Path != "/" {
+			parsed.Path = "/xxxxx"
+		}
+		if parsed.RawQuery != "" {
+			parsed.RawQuery = "xxxxx"
+		}
+	}
+
+	return parsed.Redacted()
+}
+
+func (cp *ConnectionPool) connectionStats(connHost *ConnectionHost) *ConnectionStats {
+
+	stats := &ConnectionStats{
+		ConnectionID:   connHost.ConnectionID,
+		Name:           connHost.connectionName,
+		URI:            connHost.URI(),
+		Open:           connHost.Connection != nil && !connHost.Connection.IsClosed(),
+		Flagged:        cp.isConnectionFlagged(connHost.ConnectionID),
+		Flags:          atomic.LoadUint64(&connHost.flags),
+		CachedChannels: atomic.LoadUint64(&connHost.CachedChannelCount),
+	}
+
+	connHost.stateLock.Lock()
+	stats.Blocked = connHost.blocking.Active
+	if stats.Blocked {
+		stats.BlockedReason = connHost.blocking.Reason
+	}
+	stats.Age = time.Since(connHost.connectedAt)
+	stats.Reconnects = connHost.reconnects
+	stats.LastReconnectAt = connHost.lastReconnectAt
+	stats.RecentErrors = connHost.recentErrorsLocked()
+	connHost.stateLock.Unlock()
+
+	if len(stats.RecentErrors) > 0 {
+		lastError := stats.RecentErrors[len(stats.RecentErrors)-1]
+		stats.LastError, stats.LastErrorAt = lastError.Reason, lastError.At
+	}
+
+	return stats
+}
+
+func (ch *ChannelHost) stats() *ChannelStats {
+	ch.chanLock.Lock()
+	defer ch.chanLock.Unlock()
+
+	target := ch.target
+	if ch.operation == "basic.publish" {
+		target += "/" + ch.routingKey
+	}
+
+	return &ChannelStats{
+		ChannelID:     ch.ID,
+		ConnectionID:  ch.ConnectionID,
+		Age:           time.Since(ch.madeAt),
+		LastUsed:      ch.lastUsed,
+		Published:     ch.published,
+		LastOperation: ch.operation,
+		LastTarget:    target,
+	}
+}
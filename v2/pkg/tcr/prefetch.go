@@ -0,0 +1,86 @@
+package tcr
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	maxPrefetchCount = math.MaxUint16 // AMQP prefetch-count is a short
+
+	prefetchSizeWeight     = 0.1  // weight of each new message size in the running average
+	prefetchDriftThreshold = 0.25 // relative change in prefetch required before re-issuing Qos
+)
+
+// ByteBudgetPrefetch sizes a consumer's prefetch so that, on average, no more than Budget bytes of
+// unacknowledged payloads are held in memory. Message sizes are tracked with a moving average.
+type ByteBudgetPrefetch struct {
+	Budget       uint64
+	averageSize  float64
+	prefetch     int
+	prefetchLock *sync.Mutex
+}
+
+// NewByteBudgetPrefetch creates a ByteBudgetPrefetch with a budget in bytes.
+// Prefetch starts at 1 until the first message size is observed.
+func NewByteBudgetPrefetch(budget uint64) *ByteBudgetPrefetch {
+
+	return &ByteBudgetPrefetch{
+		Budget:       budget,
+		prefetch:     1,
+		prefetchLock: &sync.Mutex{},
+	}
+}
+
+// Prefetch is the current prefetch count.
+func (bbp *ByteBudgetPrefetch) Prefetch() int {
+	bbp.prefetchLock.Lock()
+	defer bbp.prefetchLock.Unlock()
+
+	return bbp.prefetch
+}
+
+// Observe records a message size and returns the new prefetch count and true when it has drifted
+// far enough from the current prefetch that Qos should be re-issued.
+func (bbp *ByteBudgetPrefetch) Observe(size int) (int, bool) {
+	bbp.prefetchLock.Lock()
+	defer bbp.prefetchLock.Unlock()
+
+	if size < 1 {
+		size = 1
+	}
+
+	if bbp.averageSize == 0 {
+		bbp.averageSize = float64(size)
+	} else {
+		bbp.averageSize += prefetchSizeWeight * (float64(size) - bbp.averageSize)
+	}
+
+	prefetch := int(float64(bbp.Budget) / bbp.averageSize)
+	if prefetch < 1 {
+		prefetch = 1
+	} else if prefetch > maxPrefetchCount {
+		prefetch = maxPrefetchCount
+	}
+
+	if prefetch == bbp.prefetch {
+		return prefetch, false
+	}
+
+	drift := math.Abs(float64(prefetch-bbp.prefetch)) / float64(bbp.prefetch)
+	if drift < prefetchDriftThreshold {
+		return bbp.prefetch, false
+	}
+
+	bbp.prefetch = prefetch
+	return prefetch, true
+}
+
+func newPrefetch(budget uint64) *ByteBudgetPrefetch {
+
+	if budget == 0 {
+		return nil
+	}
+
+	return NewByteBudgetPrefetch(budget)
+}
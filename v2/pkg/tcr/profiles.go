@@ -0,0 +1,121 @@
+package tcr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ProfileEnvVar names the profile ConvertJSONFileToConfig applies when the caller doesn't pick one.
+const ProfileEnvVar = "TCR_PROFILE"
+
+// profilesKey is the object of a seasoning file holding its profiles, by name.
+const profilesKey = "Profiles"
+
+// ErrProfileNotFound is returned when loading a seasoning with a profile the file doesn't have.
+var ErrProfileNotFound = errors.New("seasoning profile not found")
+
+// ConvertJSONFileToConfigProfile opens a file.json and converts it to a RabbitSeasoning with the named profile
+// applied. The file's top level settings are the base every profile shares, and its "Profiles" object holds the
+// overrides of each profile, by name. Overrides merge into the base object by object, so a profile only lists the
+// settings it changes, while values and arrays replace the base's outright.
+//
+// An empty profile falls back to the TCR_PROFILE environment variable, then to the file's own "Profile" setting.
+// Without any, the base is used as is. The profile applied is set on the RabbitSeasoning's Profile.
+func ConvertJSONFileToConfigProfile(fileNamePath string, profile string) (*RabbitSeasoning, error) {
+
+	byteValue, err := ioutil.ReadFile(fileNamePath)
+	if err != nil {
+		return nil, err
+	}
+
+	byteValue, err = applyProfile(byteValue, profile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileNamePath, err)
+	}
+
+	config := &RabbitSeasoning{}
+	var json = jsoniter.ConfigFastest
+	err = json.Unmarshal(byteValue, config)
+
+	return config, err
+}
+
+// applyProfile merges the selected profile of the seasoning into its base, returning the seasoning without its
+// profiles.
+func applyProfile(data []byte, profile string) ([]byte, error) {
+
+	seasoning := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keeps large integers exact through the merge
+	if err := decoder.Decode(&seasoning); err != nil {
+		return nil, err
+	}
+
+	profiles, _ := seasoning[profilesKey].(map[string]interface{})
+	delete(seasoning, profilesKey)
+
+	if profile == "" {
+		profile = os.Getenv(ProfileEnvVar)
+	}
+
+	if profile == "" {
+		profile, _ = seasoning["Profile"].(string)
+	}
+
+	if profile == "" {
+		return json.Marshal(seasoning)
+	}
+
+	overrides, ok := profiles[profile].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, the profiles are %s", ErrProfileNotFound, profile, profileNames(profiles))
+	}
+
+	seasoning = mergeSettings(seasoning, overrides)
+	seasoning["Profile"] = profile
+
+	return json.Marshal(seasoning)
+}
+
+// mergeSettings merges the overrides into base, recursing into objects both of them have.
+func mergeSettings(base map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+
+	for key, override := range overrides {
+		baseObject, baseIsObject := base[key].(map[string]interface{})
+		overrideObject, overrideIsObject := override.(map[string]interface{})
+
+		if baseIsObject && overrideIsObject {
+			base[key] = mergeSettings(baseObject, overrideObject)
+			continue
+		}
+
+		base[key] = override
+	}
+
+	return base
+}
+
+// profileNames lists the profiles for an error message.
+func profileNames(profiles map[string]interface{}) string {
+
+	if len(profiles) == 0 {
+		return "none"
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
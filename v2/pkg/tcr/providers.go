@@ -0,0 +1,93 @@
+package tcr
+
+import (
+	"context"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// ConnectionProvider hands out connections. ConnectionPool implements it.
+type ConnectionProvider interface {
+	GetConnection() (*ConnectionHost, error)
+	ReturnConnection(connHost *ConnectionHost, flag bool)
+	Shutdown()
+}
+
+// ChannelProvider hands out channels. ConnectionPool implements it.
+type ChannelProvider interface {
+	GetChannelFromPool() *ChannelHost
+	GetChannelFromPoolContext(ctx context.Context) (*ChannelHost, error)
+	ReturnChannel(chanHost *ChannelHost, erred bool)
+	GetTransientChannel(ackable bool) *amqp.Channel
+}
+
+// LetterPublisher is the part of a Publisher applications publish through. Depend on it instead of *Publisher
+// to unit test publishing logic with a double, such as the one in the tcrtest package.
+type LetterPublisher interface {
+	Publish(letter *Letter, skipReceipt bool)
+	PublishWithConfirmationContext(ctx context.Context, letter *Letter)
+	PublishAndWait(ctx context.Context, letter *Letter) error
+	PublishAsync(ctx context.Context, letter *Letter) *PublishFuture
+	PublishToQueue(ctx context.Context, queueName string, letter *Letter, verifyQueue bool) error
+	QueueLetter(letter *Letter) bool
+	PublishReceipts() <-chan *PublishReceipt
+}
+
+// MessageConsumer is the part of a Consumer applications consume through. Depend on it instead of *Consumer
+// to unit test consuming logic with a double, such as the one in the tcrtest package.
+type MessageConsumer interface {
+	StartConsuming()
+	StartConsumingWithAction(action func(*ReceivedMessage))
+	StartConsumingWithHandler(handler func(*ReceivedMessage) error) error
+	StopConsuming(immediate bool, flushMessages bool) error
+	ReceivedMessages() <-chan *ReceivedMessage
+	ConsumeBatch(maxCount int, maxWait time.Duration) MessageBatch
+	Errors() <-chan error
+}
+
+// ChannelPooler is a pool of channels, for dependency injection containers to bind a ConnectionPool, or a
+// decorator of one, as. ConnectionPool implements it.
+type ChannelPooler interface {
+	ChannelProvider
+	ChannelCount() uint64
+}
+
+// ConnectionPooler is a ConnectionPool as the rest of an application sees it: connections, channels, readiness,
+// and stats. Bind it in a dependency injection container to swap in an instrumented decorator. ConnectionPool
+// implements it.
+type ConnectionPooler interface {
+	ConnectionProvider
+	ChannelPooler
+	Ready() bool
+	WaitForReady(ctx context.Context) error
+	GetPoolStats() *PoolStats
+	Counters() *PoolCounters
+	Errors() <-chan error
+}
+
+// Publisherer is a LetterPublisher along with the lifecycle a dependency injection container starts and stops.
+// Publisher and the tcrtest double implement it.
+type Publisherer interface {
+	LetterPublisher
+	StartAutoPublishing()
+	Shutdown(shutdownPools bool)
+}
+
+// Consumerer is a MessageConsumer along with its counters, for decorators instrumenting a Consumer. Consumer and
+// the tcrtest double implement it.
+type Consumerer interface {
+	MessageConsumer
+	Counters() *ConsumerCounters
+}
+
+var (
+	_ ConnectionProvider = (*ConnectionPool)(nil)
+	_ ChannelProvider    = (*ConnectionPool)(nil)
+	_ ChannelPooler      = (*ConnectionPool)(nil)
+	_ ConnectionPooler   = (*ConnectionPool)(nil)
+	_ LetterPublisher    = (*Publisher)(nil)
+	_ Publisherer        = (*Publisher)(nil)
+	_ MessageConsumer    = (*Consumer)(nil)
+	_ Consumerer         = (*Consumer)(nil)
+)
@@ -0,0 +1,209 @@
+package tcr
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// OverflowBlock makes Publish wait for room in a full publish buffer.
+	OverflowBlock = "block"
+
+	// OverflowDropNew drops the letter being published when the publish buffer is full.
+	OverflowDropNew = "drop-new"
+
+	// OverflowDropOld drops the oldest buffered letter to make room when the publish buffer is full.
+	OverflowDropOld = "drop-old"
+)
+
+var (
+	// ErrPublishBufferFull is the receipt error of a letter dropped from, or never let into, a full publish buffer.
+	ErrPublishBufferFull = errors.New("publish buffer full, letter dropped")
+
+	// ErrPublishBufferClosed is the receipt error of a letter published after the Publisher shut down its buffer.
+	ErrPublishBufferClosed = errors.New("publish buffer closed")
+)
+
+// PublishBufferStats is a snapshot of the publish buffer.
+type PublishBufferStats struct {
+	Depth    int    `json:"Depth"`    // letters waiting to be published
+	MaxDepth int    `json:"MaxDepth"` // deepest the buffer has been
+	Capacity int    `json:"Capacity"`
+	Dropped  uint64 `json:"Dropped"` // letters dropped by the overflow policy
+}
+
+type bufferedLetter struct {
+	letter      *Letter
+	skipReceipt bool
+}
+
+// publishBuffer holds letters given to Publish while its workers get channels and publish them, so a brief
+// broker slowdown queues letters in memory instead of blocking the callers.
+type publishBuffer struct {
+	letters      chan bufferedLetter
+	overflow     string
+	maxDepth     int64
+	dropped      uint64
+	closed       bool
+	workerStop   chan struct{}
+	workerGroup  *sync.WaitGroup
+	bufferRWLock *sync.RWMutex
+}
+
+// newPublishBuffer creates a publishBuffer from config, nil when not enabled.
+func newPublishBuffer(config *PublishBufferConfig) *publishBuffer {
+
+	if config == nil || config.Size == 0 {
+		return nil
+	}
+
+	pb := &publishBuffer{
+		letters:      make(chan bufferedLetter, config.Size),
+		overflow:     config.OverflowPolicy,
+		workerStop:   make(chan struct{}),
+		workerGroup:  &sync.WaitGroup{},
+		bufferRWLock: &sync.RWMutex{},
+	}
+
+	if pb.overflow == "" {
+		pb.overflow = OverflowBlock
+	}
+
+	return pb
+}
+
+// startBufferWorkers starts the workers publishing buffered letters.
+func (pub *Publisher) startBufferWorkers(workers uint32) {
+
+	if workers == 0 {
+		workers = 1
+	}
+
+	for i := uint32(0); i < workers; i++ {
+		pub.buffer.workerGroup.Add(1)
+		go pub.publishBuffered()
+	}
+}
+
+// publishBuffered publishes buffered letters until stopped, then publishes what is left in the buffer.
+func (pub *Publisher) publishBuffered() {
+	defer pub.buffer.workerGroup.Done()
+
+	for {
+		select {
+		case buffered := <-pub.buffer.letters:
+			pub.publish(buffered.letter, buffered.skipReceipt)
+		case <-pub.buffer.workerStop:
+			for {
+				select {
+				case buffered := <-pub.buffer.letters:
+					pub.publish(buffered.letter, buffered.skipReceipt)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// bufferLetter adds the letter to the publish buffer, applying the overflow policy when it is full.
+func (pub *Publisher) bufferLetter(letter *Letter, skipReceipt bool) {
+
+	pb := pub.buffer
+	buffered := bufferedLetter{letter: letter, skipReceipt: skipReceipt}
+
+	pb.bufferRWLock.RLock()
+	defer pb.bufferRWLock.RUnlock()
+
+	if pb.closed {
+		pub.dropLetter(buffered, ErrPublishBufferClosed)
+		return
+	}
+
+	switch pb.overflow {
+	case OverflowDropNew:
+		select {
+		case pb.letters <- buffered:
+		default:
+			atomic.AddUint64(&pb.dropped, 1)
+			pub.dropLetter(buffered, ErrPublishBufferFull)
+			return
+		}
+	case OverflowDropOld:
+	SendLoop:
+		for {
+			select {
+			case pb.letters <- buffered:
+				break SendLoop
+			default:
+			}
+
+			select {
+			case oldest := <-pb.letters:
+				atomic.AddUint64(&pb.dropped, 1)
+				pub.dropLetter(oldest, ErrPublishBufferFull)
+			default:
+			}
+		}
+	default:
+		pb.letters <- buffered // workers run until the buffer is closed, which waits for us
+	}
+
+	pb.observeDepth()
+}
+
+// dropLetter reports a letter the buffer didn't publish.
+func (pub *Publisher) dropLetter(buffered bufferedLetter, err error) {
+
+	if buffered.skipReceipt {
+		pub.emitResult(buffered.letter, err)
+		return
+	}
+
+	pub.publishReceipt(buffered.letter, err)
+}
+
+// observeDepth records the deepest the buffer has been.
+func (pb *publishBuffer) observeDepth() {
+
+	depth := int64(len(pb.letters))
+	for {
+		maxDepth := atomic.LoadInt64(&pb.maxDepth)
+		if depth <= maxDepth || atomic.CompareAndSwapInt64(&pb.maxDepth, maxDepth, depth) {
+			return
+		}
+	}
+}
+
+// close stops new letters being buffered and waits for the workers to publish the rest.
+func (pb *publishBuffer) close() {
+
+	pb.bufferRWLock.Lock()
+	if pb.closed {
+		pb.bufferRWLock.Unlock()
+		return
+	}
+
+	pb.closed = true
+	close(pb.workerStop)
+	pb.bufferRWLock.Unlock()
+
+	pb.workerGroup.Wait()
+}
+
+// PublishBufferStats is a snapshot of the publish buffer when PublisherConfig.PublishBufferConfig is set,
+// otherwise the zero value.
+func (pub *Publisher) PublishBufferStats() PublishBufferStats {
+
+	if pub.buffer == nil {
+		return PublishBufferStats{}
+	}
+
+	return PublishBufferStats{
+		Depth:    len(pub.buffer.letters),
+		MaxDepth: int(atomic.LoadInt64(&pub.buffer.maxDepth)),
+		Capacity: cap(pub.buffer.letters),
+		Dropped:  atomic.LoadUint64(&pub.buffer.dropped),
+	}
+}
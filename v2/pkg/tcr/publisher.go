@@ -2,13 +2,22 @@ package tcr
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 )
 
+// ErrPublishNacked is returned by PublishAndWait when the broker nacks the delivery.
+var ErrPublishNacked = errors.New("publish was nacked")
+
+// ErrQueueNotFound is returned by PublishToQueue when verifying a queue that doesn't exist.
+var ErrQueueNotFound = errors.New("queue not found")
+
 // Publisher contains everything you need to publish a message.
 type Publisher struct {
 	Config                 *RabbitSeasoning
@@ -16,11 +25,28 @@ type Publisher struct {
 	letters                chan *Letter
 	autoStop               chan bool
 	publishReceipts        chan *PublishReceipt
+	droppedReceipts        uint64
 	autoStarted            bool
 	autoPublishGroup       *sync.WaitGroup
 	sleepOnIdleInterval    time.Duration
-	sleepOnErrorInterval   time.Duration
 	publishTimeOutDuration time.Duration
+	backoff                BackoffPolicy
+	rateLimiter            *RateLimiter
+	naming                 *NamingConvention
+	validators             *Validators
+	ttl                    *ttlPolicies
+	defaults               *envelopeDefaults
+	trace                  *tracer
+	strictOrdering         bool
+	orderingShards         int
+	order                  *keyOrder
+	chunkSize              int
+	onBlocked              string
+	stamping               bool
+	events                 *publisherEvents
+	buffer                 *publishBuffer
+	receiptSink            ReceiptSink
+	deferOnReceipt         bool // a RabbitService retries failed letters and calls their OnReceipt once they're done
 	pubLock                *sync.Mutex
 	pubRWLock              *sync.RWMutex
 }
@@ -30,7 +56,18 @@ func NewPublisherFromConfig(
 	config *RabbitSeasoning,
 	cp *ConnectionPool) *Publisher {
 
-	return &Publisher{
+	backoff, err := backoffPolicy(
+		config.PublisherConfig.Backoff,
+		config.PublisherConfig.BackoffConfig,
+		time.Duration(config.PublisherConfig.SleepOnErrorInterval)*time.Millisecond)
+	if err != nil {
+		if cp != nil {
+			cp.logger.Warn("publisher backoffconfig is invalid, using SleepOnErrorInterval: %s", err)
+		}
+		backoff = &ConstantBackoff{Interval: time.Duration(config.PublisherConfig.SleepOnErrorInterval) * time.Millisecond}
+	}
+
+	pub := &Publisher{
 		Config:                 config,
 		ConnectionPool:         cp,
 		letters:                make(chan *Letter, 1000),
@@ -38,12 +75,42 @@ func NewPublisherFromConfig(
 		autoPublishGroup:       &sync.WaitGroup{},
 		publishReceipts:        make(chan *PublishReceipt, 1000),
 		sleepOnIdleInterval:    time.Duration(config.PublisherConfig.SleepOnIdleInterval) * time.Millisecond,
-		sleepOnErrorInterval:   time.Duration(config.PublisherConfig.SleepOnErrorInterval) * time.Millisecond,
 		publishTimeOutDuration: time.Duration(config.PublisherConfig.PublishTimeOutInterval) * time.Millisecond,
+		backoff:                backoff,
+		rateLimiter:            NewRateLimiter(config.PublisherConfig.RateLimitConfig),
+		strictOrdering:         config.PublisherConfig.StrictOrdering,
+		orderingShards:         int(config.PublisherConfig.OrderingShards),
+		order:                  newKeyOrder(config.PublisherConfig.OrderByKey),
+		chunkSize:              int(config.PublisherConfig.ChunkSize),
+		onBlocked:              config.PublisherConfig.OnBlocked,
+		stamping:               !config.PublisherConfig.DisableStamping,
+		events:                 newPublisherEvents(config.PublisherConfig.EventBuffer),
+		buffer:                 newPublishBuffer(config.PublisherConfig.PublishBufferConfig),
+		receiptSink:            config.PublisherConfig.ReceiptSink,
 		pubLock:                &sync.Mutex{},
 		pubRWLock:              &sync.RWMutex{},
 		autoStarted:            false,
 	}
+
+	if pub.ttl, err = newTTLPolicies(config.PublisherConfig.TTLPolicies); err != nil && cp != nil {
+		cp.logger.Warn("publisher ttlpolicies are invalid, not applying them: %s", err)
+	}
+
+	if pub.defaults, err = newEnvelopeDefaults(config.PublisherConfig.EnvelopeDefaults); err != nil && cp != nil {
+		cp.logger.Warn("publisher envelopedefaults are invalid, not applying them: %s", err)
+	}
+
+	if config.PoolConfig != nil {
+		pub.trace = newTracer(config.PublisherConfig.TraceConfig, config.PoolConfig.ConnectionName)
+	} else {
+		pub.trace = newTracer(config.PublisherConfig.TraceConfig, "")
+	}
+
+	if pub.buffer != nil {
+		pub.startBufferWorkers(config.PublisherConfig.PublishBufferConfig.Workers)
+	}
+
+	return pub
 }
 
 // NewPublisher creates and configures a new Publisher.
@@ -60,8 +127,9 @@ func NewPublisher(
 		autoPublishGroup:       &sync.WaitGroup{},
 		publishReceipts:        make(chan *PublishReceipt, 1000),
 		sleepOnIdleInterval:    sleepOnIdleInterval,
-		sleepOnErrorInterval:   sleepOnErrorInterval,
 		publishTimeOutDuration: publishTimeOutDuration,
+		backoff:                &ConstantBackoff{Interval: sleepOnErrorInterval},
+		stamping:               true,
 		pubLock:                &sync.Mutex{},
 		pubRWLock:              &sync.RWMutex{},
 		autoStarted:            false,
@@ -71,55 +139,111 @@ func NewPublisher(
 // Publish sends a single message to the address on the letter using a cached ChannelHost.
 // Subscribe to PublishReceipts to see success and errors.
 // For proper resilience (at least once delivery guarantee over shaky network) use PublishWithConfirmation
+// With a PublishBufferConfig the letter is buffered and published in the background, Publish only waits
+// when the buffer is full and its OverflowPolicy is block.
 func (pub *Publisher) Publish(letter *Letter, skipReceipt bool) {
 
-	chanHost := pub.ConnectionPool.GetChannelFromPool()
-
-	err := chanHost.Channel.Publish(
-		letter.Envelope.Exchange,
-		letter.Envelope.RoutingKey,
-		letter.Envelope.Mandatory,
-		letter.Envelope.Immediate,
-		amqp.Publishing{
-			ContentType:  letter.Envelope.ContentType,
-			Body:         letter.Body,
-			Headers:      letter.Envelope.Headers,
-			DeliveryMode: letter.Envelope.DeliveryMode,
-		},
-	)
+	if pub.buffer != nil {
+		pub.bufferLetter(letter, skipReceipt)
+		return
+	}
+
+	pub.publish(letter, skipReceipt)
+}
+
+// publish sends the letter on a cached ChannelHost, and with OrderByKey waits for its confirmation.
+func (pub *Publisher) publish(letter *Letter, skipReceipt bool) {
+
+	if pub.settings().order != nil {
+		ctx, cancel := pub.confirmContext()
+		err := pub.publishAndWait(ctx, letter)
+		cancel()
+
+		if !skipReceipt {
+			pub.publishReceipt(letter, err)
+		} else {
+			pub.emitResult(letter, err)
+		}
+		return
+	}
+
+	if err := pub.preflight(context.Background(), letter); err != nil {
+		if !skipReceipt {
+			pub.publishReceipt(letter, err)
+		} else {
+			pub.emitResult(letter, err)
+		}
+		return
+	}
+
+	chanHost, err := pub.ConnectionPool.getChannel()
+	if err == nil {
+		_, _, err = pub.publishLetter(chanHost, letter)
+		pub.ConnectionPool.ReturnChannel(chanHost, err != nil)
+	}
+	pub.ConnectionPool.recordCircuit(err)
 
 	if !skipReceipt {
 		pub.publishReceipt(letter, err)
+	} else {
+		pub.emitResult(letter, err)
 	}
-
-	pub.ConnectionPool.ReturnChannel(chanHost, err != nil)
 }
 
 // PublishWithTransient sends a single message to the address on the letter using a transient (new) RabbitMQ channel.
 // Subscribe to PublishReceipts to see success and errors.
 // For proper resilience (at least once delivery guarantee over shaky network) use PublishWithConfirmation
-func (pub *Publisher) PublishWithTransient(letter *Letter) error {
+// With OrderByKey the channel is put in confirm mode and the publish waits for its confirmation.
+func (pub *Publisher) PublishWithTransient(letter *Letter) (err error) {
+	defer func() { pub.emitResult(letter, err) }()
 
-	channel := pub.ConnectionPool.GetTransientChannel(false)
-	defer func() {
-		defer func() {
-			_ = recover()
-		}()
-		channel.Close()
-	}()
+	if err := pub.admit(context.Background(), letter); err != nil {
+		return err
+	}
+
+	endTurn, err := pub.awaitTurn(context.Background(), letter)
+	if err != nil {
+		return err
+	}
+	defer endTurn()
 
-	return channel.Publish(
-		letter.Envelope.Exchange,
-		letter.Envelope.RoutingKey,
-		letter.Envelope.Mandatory,
-		letter.Envelope.Immediate,
-		amqp.Publishing{
-			ContentType:  letter.Envelope.ContentType,
-			Body:         letter.Body,
-			Headers:      letter.Envelope.Headers,
-			DeliveryMode: letter.Envelope.DeliveryMode,
-		},
-	)
+	if err := pub.ConnectionPool.allowCircuit(); err != nil {
+		return err
+	}
+
+	settings := pub.settings()
+	channel, err := pub.ConnectionPool.createTransientChannel(settings.order != nil, true)
+	if err != nil {
+		return err
+	}
+	defer closeTransientChannel(channel)
+
+	chunks := splitLetter(letter, settings.chunkSize)
+
+	var confirmations chan amqp.Confirmation
+	if settings.order != nil {
+		confirmations = channel.NotifyPublish(make(chan amqp.Confirmation, len(chunks)))
+	}
+
+	for _, chunk := range chunks {
+		err = channel.Publish(
+			chunk.Envelope.Exchange,
+			chunk.Envelope.RoutingKey,
+			chunk.Envelope.Mandatory,
+			chunk.Envelope.Immediate,
+			chunk.publishing(),
+		)
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil && confirmations != nil {
+		err = pub.awaitTransientConfirmations(confirmations, len(chunks), letter)
+	}
+	pub.ConnectionPool.recordCircuit(err)
+
+	return err
 }
 
 // PublishWithConfirmation sends a single message to the address on the letter with confirmation capabilities.
@@ -132,34 +256,53 @@ func (pub *Publisher) PublishWithConfirmation(letter *Letter, timeout time.Durat
 		timeout = pub.publishTimeOutDuration
 	}
 
-	for {
+	if err := pub.admit(context.Background(), letter); err != nil {
+		pub.publishReceipt(letter, err)
+		return
+	}
+
+	endTurn, err := pub.awaitTurn(context.Background(), letter)
+	if err != nil {
+		pub.publishReceipt(letter, err)
+		return
+	}
+	defer endTurn()
+
+PublishLoop:
+	for attempt := 1; ; attempt++ {
+		// Fail fast instead of retrying while the broker is down.
+		if err := pub.ConnectionPool.allowCircuit(); err != nil {
+			pub.publishReceipt(letter, err)
+			return
+		}
+
 		// Has to use an Ackable channel for Publish Confirmations.
-		chanHost := pub.ConnectionPool.GetChannelFromPool()
+		chanHost, err := pub.ConnectionPool.getChannel()
+		if err != nil {
+			pub.ConnectionPool.recordCircuit(err)
+			pub.publishReceipt(letter, err)
+			return
+		}
 		chanHost.FlushConfirms() // Flush all previous publish confirmations
 
-	Publish:
 		timeoutAfter := time.After(timeout) // timeoutAfter resets everytime we try to publish.
-		err := chanHost.Channel.Publish(
-			letter.Envelope.Exchange,
-			letter.Envelope.RoutingKey,
-			letter.Envelope.Mandatory,
-			letter.Envelope.Immediate,
-			amqp.Publishing{
-				ContentType:  letter.Envelope.ContentType,
-				Body:         letter.Body,
-				Headers:      letter.Envelope.Headers,
-				DeliveryMode: letter.Envelope.DeliveryMode,
-			},
-		)
+		first, last, err := pub.publishLetter(chanHost, letter)
 		if err != nil {
+			pub.ConnectionPool.logger.Warn("publish of LetterID %d failed, retrying: %s", letter.LetterID, err)
+			pub.ConnectionPool.recordCircuit(err)
 			pub.ConnectionPool.ReturnChannel(chanHost, true)
+			pub.emit(PublisherEventRetried, letter, attempt, err)
+			sleepBackoff(pub.settings().backoff, attempt)
 			continue // Take it again! From the top!
 		}
 
-		// Wait for very next confirmation on this channel, which should be our confirmation.
+		// Wait for the very next confirmations on this channel, which should be ours (one per chunk).
+		pending := last - first + 1
 		for {
 			select {
 			case <-timeoutAfter:
+				pub.ConnectionPool.logger.Warn("publish confirmation for LetterID %d timed out", letter.LetterID)
+				pub.ConnectionPool.recordCircuit(errConfirmationTimeout)
 				pub.publishReceipt(letter, fmt.Errorf("publish confirmation for LetterId: %d wasn't received in a timely manner - recommend retry/requeue", letter.LetterID))
 				pub.ConnectionPool.ReturnChannel(chanHost, false) // not a channel error
 				return
@@ -167,10 +310,19 @@ func (pub *Publisher) PublishWithConfirmation(letter *Letter, timeout time.Durat
 			case confirmation := <-chanHost.Confirmations:
 
 				if !confirmation.Ack {
-					goto Publish //nack has occurred, republish
+					pub.ConnectionPool.logger.Debug("publish of LetterID %d was nacked, republishing", letter.LetterID)
+					pub.ConnectionPool.recordCircuit(nil) // the broker answered
+					pub.ConnectionPool.ReturnChannel(chanHost, false)
+					pub.emit(PublisherEventRetried, letter, attempt, ErrPublishNacked)
+					continue PublishLoop //nack has occurred, republish
+				}
+
+				if pending--; pending > 0 {
+					continue // more chunks to confirm
 				}
 
 				// Happy Path, publish was received by server and we didn't timeout client side.
+				pub.ConnectionPool.recordCircuit(nil)
 				pub.publishReceipt(letter, nil)
 				pub.ConnectionPool.ReturnChannel(chanHost, false)
 				return
@@ -189,33 +341,52 @@ func (pub *Publisher) PublishWithConfirmation(letter *Letter, timeout time.Durat
 // A confirmation failure keeps trying to publish (at least until timeout failure occurs.)
 func (pub *Publisher) PublishWithConfirmationContext(ctx context.Context, letter *Letter) {
 
-	for {
+	if err := pub.admit(ctx, letter); err != nil {
+		pub.publishReceipt(letter, err)
+		return
+	}
+
+	endTurn, err := pub.awaitTurn(ctx, letter)
+	if err != nil {
+		pub.publishReceipt(letter, err)
+		return
+	}
+	defer endTurn()
+
+PublishLoop:
+	for attempt := 1; ; attempt++ {
+		// Fail fast instead of retrying while the broker is down.
+		if err := pub.ConnectionPool.allowCircuit(); err != nil {
+			pub.publishReceipt(letter, err)
+			return
+		}
+
 		// Has to use an Ackable channel for Publish Confirmations.
-		chanHost := pub.ConnectionPool.GetChannelFromPool()
+		chanHost, err := pub.ConnectionPool.GetChannelFromPoolContext(ctx)
+		if err != nil {
+			pub.ConnectionPool.recordCircuit(err)
+			pub.publishReceipt(letter, err)
+			return
+		}
 		chanHost.FlushConfirms() // Flush all previous publish confirmations
 
-	Publish:
-		err := chanHost.Channel.Publish(
-			letter.Envelope.Exchange,
-			letter.Envelope.RoutingKey,
-			letter.Envelope.Mandatory,
-			letter.Envelope.Immediate,
-			amqp.Publishing{
-				ContentType:  letter.Envelope.ContentType,
-				Body:         letter.Body,
-				Headers:      letter.Envelope.Headers,
-				DeliveryMode: letter.Envelope.DeliveryMode,
-			},
-		)
+		first, last, err := pub.publishLetter(chanHost, letter)
 		if err != nil {
+			pub.ConnectionPool.logger.Warn("publish of LetterID %d failed, retrying: %s", letter.LetterID, err)
+			pub.ConnectionPool.recordCircuit(err)
 			pub.ConnectionPool.ReturnChannel(chanHost, true)
+			pub.emit(PublisherEventRetried, letter, attempt, err)
+			sleepBackoff(pub.settings().backoff, attempt)
 			continue // Take it again! From the top!
 		}
 
-		// Wait for very next confirmation on this channel, which should be our confirmation.
+		// Wait for the very next confirmations on this channel, which should be ours (one per chunk).
+		pending := last - first + 1
 		for {
 			select {
 			case <-ctx.Done():
+				pub.ConnectionPool.logger.Warn("publish confirmation for LetterID %d not received before context expired", letter.LetterID)
+				pub.ConnectionPool.recordCircuit(errConfirmationTimeout)
 				pub.publishReceipt(letter, fmt.Errorf("publish confirmation for LetterID: %d wasn't received before context expired - recommend retry/requeue", letter.LetterID))
 				pub.ConnectionPool.ReturnChannel(chanHost, false) // not a channel error
 				return
@@ -223,10 +394,19 @@ func (pub *Publisher) PublishWithConfirmationContext(ctx context.Context, letter
 			case confirmation := <-chanHost.Confirmations:
 
 				if !confirmation.Ack {
-					goto Publish //nack has occurred, republish
+					pub.ConnectionPool.logger.Debug("publish of LetterID %d was nacked, republishing", letter.LetterID)
+					pub.ConnectionPool.recordCircuit(nil) // the broker answered
+					pub.ConnectionPool.ReturnChannel(chanHost, false)
+					pub.emit(PublisherEventRetried, letter, attempt, ErrPublishNacked)
+					continue PublishLoop //nack has occurred, republish
+				}
+
+				if pending--; pending > 0 {
+					continue // more chunks to confirm
 				}
 
 				// Happy Path, publish was received by server and we didn't timeout client side.
+				pub.ConnectionPool.recordCircuit(nil)
 				pub.publishReceipt(letter, nil)
 				pub.ConnectionPool.ReturnChannel(chanHost, false)
 				return
@@ -239,6 +419,122 @@ func (pub *Publisher) PublishWithConfirmationContext(ctx context.Context, letter
 	}
 }
 
+// PublishAndWait publishes the letter and blocks until the broker confirms or nacks that specific delivery
+// (every chunk of it when chunked), or ctx is done. Confirmations are matched by delivery tag, so stale confirmations left on the channel by
+// earlier publishes are skipped. Nothing is retried and no PublishReceipt is sent, the returned error is the result.
+func (pub *Publisher) PublishAndWait(ctx context.Context, letter *Letter) (err error) {
+	defer func() { pub.emitResult(letter, err) }()
+
+	return pub.publishAndWait(ctx, letter)
+}
+
+// publishAndWait is PublishAndWait without the publisher event.
+func (pub *Publisher) publishAndWait(ctx context.Context, letter *Letter) error {
+
+	if err := pub.admit(ctx, letter); err != nil {
+		return err
+	}
+
+	endTurn, err := pub.awaitTurn(ctx, letter)
+	if err != nil {
+		return err
+	}
+	defer endTurn()
+
+	if err := pub.ConnectionPool.allowCircuit(); err != nil {
+		return err
+	}
+
+	// Has to use an Ackable channel for Publish Confirmations.
+	chanHost, err := pub.ConnectionPool.GetChannelFromPoolContext(ctx)
+	if err != nil {
+		pub.ConnectionPool.recordCircuit(err)
+		return err
+	}
+
+	first, last, err := pub.publishLetter(chanHost, letter)
+	if err != nil {
+		pub.ConnectionPool.recordCircuit(err)
+		pub.ConnectionPool.ReturnChannel(chanHost, true)
+		return err
+	}
+
+	nacked := false // any chunk of the letter
+	for {
+		select {
+		case <-ctx.Done():
+			pub.ConnectionPool.recordCircuit(errConfirmationTimeout)
+			pub.ConnectionPool.ReturnChannel(chanHost, false) // not a channel error
+			return fmt.Errorf("publish confirmation for LetterID %d wasn't received: %w", letter.LetterID, ctx.Err())
+
+		case confirmation, ok := <-chanHost.Confirmations:
+			if !ok {
+				err := errors.New("channel closed while awaiting publish confirmation")
+				pub.ConnectionPool.recordCircuit(err)
+				pub.ConnectionPool.ReturnChannel(chanHost, true)
+				return err
+			}
+
+			if confirmation.DeliveryTag < first {
+				continue // confirms an earlier publish on this channel
+			}
+
+			if confirmation.DeliveryTag > last {
+				// Someone else consumed our confirmation, the channel can no longer be trusted to correlate.
+				pub.ConnectionPool.recordCircuit(nil) // the broker answered
+				pub.ConnectionPool.ReturnChannel(chanHost, true)
+				return fmt.Errorf("publish confirmation for LetterID %d was missed", letter.LetterID)
+			}
+
+			nacked = nacked || !confirmation.Ack
+			if confirmation.DeliveryTag < last {
+				continue // awaiting the rest of the chunks
+			}
+
+			pub.ConnectionPool.recordCircuit(nil)
+			pub.ConnectionPool.ReturnChannel(chanHost, false)
+
+			if nacked {
+				return fmt.Errorf("%w: LetterID %d", ErrPublishNacked, letter.LetterID)
+			}
+
+			return nil
+		}
+	}
+}
+
+// PublishToQueue publishes the letter directly to the queue, through the default exchange with the queue name as
+// the routing key, and waits for the confirmation like PublishAndWait. The broker confirms, and drops, a message
+// for a queue that doesn't exist, so verifyQueue passively declares the queue first (one more round trip) and
+// returns ErrQueueNotFound instead.
+func (pub *Publisher) PublishToQueue(ctx context.Context, queueName string, letter *Letter, verifyQueue bool) error {
+
+	if queueName == "" {
+		return errors.New("can't publish to a queue without a name")
+	}
+
+	if letter.Envelope == nil {
+		letter.Envelope = &Envelope{DeliveryMode: amqp.Persistent}
+	}
+
+	letter.Envelope.Exchange = ""
+	letter.Envelope.RoutingKey = queueName
+
+	if verifyQueue {
+		exists, err := NewTopologer(pub.ConnectionPool).queueExists(queueName)
+		if err == nil && !exists {
+			err = fmt.Errorf("%w: %s", ErrQueueNotFound, queueName)
+		}
+
+		if err != nil {
+			pub.emitResult(letter, err)
+			return err
+		}
+	}
+
+	return pub.PublishAndWait(ctx, letter)
+}
+
 // PublishWithConfirmationTransient sends a single message to the address on the letter with confirmation capabilities on transient Channels.
 // This is an expensive and slow call - use this when delivery confirmation on publish is your highest priority.
 // A timeout failure drops the letter back in the PublishReceipts. When combined with QueueLetter, it automatically
@@ -250,31 +546,56 @@ func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout t
 		timeout = pub.publishTimeOutDuration
 	}
 
-	for {
+	if err := pub.admit(context.Background(), letter); err != nil {
+		pub.publishReceipt(letter, err)
+		return
+	}
+
+	endTurn, err := pub.awaitTurn(context.Background(), letter)
+	if err != nil {
+		pub.publishReceipt(letter, err)
+		return
+	}
+	defer endTurn()
+
+PublishLoop:
+	for attempt := 1; ; attempt++ {
+		// Fail fast instead of retrying while the broker is down.
+		if err := pub.ConnectionPool.allowCircuit(); err != nil {
+			pub.publishReceipt(letter, err)
+			return
+		}
+
 		// Has to use an Ackable channel for Publish Confirmations.
-		channel := pub.ConnectionPool.GetTransientChannel(true)
+		channel, err := pub.ConnectionPool.createTransientChannel(true, true)
+		if err != nil && !IsRetryable(err) {
+			pub.publishReceipt(letter, err)
+			return
+		}
+
+		if err != nil {
+			pub.emit(PublisherEventRetried, letter, attempt, err)
+			sleepBackoff(pub.settings().backoff, attempt)
+			continue
+		}
+
 		confirms := make(chan amqp.Confirmation, 1)
 		channel.NotifyPublish(confirms)
 
-	Publish:
 		timeoutAfter := time.After(timeout)
-		err := channel.Publish(
+		err = channel.Publish(
 			letter.Envelope.Exchange,
 			letter.Envelope.RoutingKey,
 			letter.Envelope.Mandatory,
 			letter.Envelope.Immediate,
-			amqp.Publishing{
-				ContentType:  letter.Envelope.ContentType,
-				Body:         letter.Body,
-				Headers:      letter.Envelope.Headers,
-				DeliveryMode: letter.Envelope.DeliveryMode,
-			},
+			letter.publishing(),
 		)
 		if err != nil {
+			pub.ConnectionPool.logger.Warn("transient publish of LetterID %d failed, retrying: %s", letter.LetterID, err)
+			pub.ConnectionPool.recordCircuit(err)
 			channel.Close()
-			if pub.sleepOnErrorInterval < 0 {
-				time.Sleep(pub.sleepOnErrorInterval)
-			}
+			pub.emit(PublisherEventRetried, letter, attempt, err)
+			sleepBackoff(pub.settings().backoff, attempt)
 			continue // Take it again! From the top!
 		}
 
@@ -282,6 +603,7 @@ func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout t
 		for {
 			select {
 			case <-timeoutAfter:
+				pub.ConnectionPool.recordCircuit(errConfirmationTimeout)
 				pub.publishReceipt(letter, fmt.Errorf("publish confirmation for LetterId: %d wasn't received in a timely manner (%dms) - recommend retry/requeue", letter.LetterID, timeout))
 				channel.Close()
 				return
@@ -289,10 +611,15 @@ func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout t
 			case confirmation := <-confirms:
 
 				if !confirmation.Ack {
-					goto Publish //nack has occurred, republish
+					pub.ConnectionPool.logger.Debug("publish of LetterID %d was nacked, republishing", letter.LetterID)
+					pub.ConnectionPool.recordCircuit(nil) // the broker answered
+					channel.Close()
+					pub.emit(PublisherEventRetried, letter, attempt, ErrPublishNacked)
+					continue PublishLoop //nack has occurred, republish
 				}
 
 				// Happy Path, publish was received by server and we didn't timeout client side.
+				pub.ConnectionPool.recordCircuit(nil)
 				pub.publishReceipt(letter, nil)
 				channel.Close()
 				return
@@ -305,18 +632,472 @@ func (pub *Publisher) PublishWithConfirmationTransient(letter *Letter, timeout t
 	}
 }
 
+// PublishInTransaction publishes all letters atomically using an AMQP transaction on a dedicated transient channel.
+// Either every letter is committed or the transaction is rolled back and an error returned for the batch.
+// Transactions are much slower than confirmations, use this only when the batch must be all or nothing.
+func (pub *Publisher) PublishInTransaction(letters []*Letter) (err error) {
+
+	if len(letters) == 0 {
+		return errors.New("can't publish an empty batch of letters in a transaction")
+	}
+
+	defer func() {
+		for _, letter := range letters {
+			pub.emitResult(letter, err)
+		}
+	}()
+
+	for _, letter := range letters {
+		if err := pub.admit(context.Background(), letter); err != nil {
+			return err
+		}
+	}
+
+	if err := pub.ConnectionPool.allowCircuit(); err != nil {
+		return err
+	}
+
+	// Transactions and confirmations can't be mixed on a channel.
+	channel, err := pub.ConnectionPool.createTransientChannel(false, true)
+	if err != nil {
+		return err
+	}
+	defer closeTransientChannel(channel)
+
+	if err := channel.Tx(); err != nil {
+		pub.ConnectionPool.recordCircuit(err)
+		return fmt.Errorf("unable to select transaction mode: %w", err)
+	}
+
+	for _, letter := range letters {
+		err := channel.Publish(
+			letter.Envelope.Exchange,
+			letter.Envelope.RoutingKey,
+			letter.Envelope.Mandatory,
+			letter.Envelope.Immediate,
+			letter.publishing(),
+		)
+		if err != nil {
+			pub.ConnectionPool.recordCircuit(err)
+			pub.ConnectionPool.logger.Warn("transactional publish of LetterID %d failed, rolling back: %s", letter.LetterID, err)
+			if rollbackErr := channel.TxRollback(); rollbackErr != nil {
+				return fmt.Errorf("publish of LetterID %d failed (%s) and rollback failed: %w", letter.LetterID, err, rollbackErr)
+			}
+
+			return fmt.Errorf("publish of LetterID %d failed, transaction rolled back: %w", letter.LetterID, err)
+		}
+	}
+
+	err = channel.TxCommit()
+	pub.ConnectionPool.recordCircuit(err)
+	if err != nil {
+		return fmt.Errorf("unable to commit transaction of %d letters: %w", len(letters), err)
+	}
+
+	return nil
+}
+
+// SetRateLimiter limits all publishing through this Publisher. Set before publishing, nil removes the limit.
+func (pub *Publisher) SetRateLimiter(rateLimiter *RateLimiter) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.rateLimiter = rateLimiter
+}
+
+// SetNamingConvention lints the exchange and routing key of every published letter, then decorates the exchange
+// with the convention's prefix and suffix. Nil removes the convention.
+// Letters for the default exchange have their routing key checked and decorated as a queue name.
+func (pub *Publisher) SetNamingConvention(naming *NamingConvention) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.naming = naming
+}
+
+// SetValidators runs the Validators on every published letter, rejecting invalid ones with a ValidationError
+// before they are sent. Set before publishing, nil removes validation.
+func (pub *Publisher) SetValidators(validators *Validators) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.validators = validators
+}
+
+// SetBackoffPolicy sets the delay between retries of a failing publish. Set before publishing.
+func (pub *Publisher) SetBackoffPolicy(backoff BackoffPolicy) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.backoff = backoff
+}
+
+// SetTTLPolicies gives letters published without an Expiration the one of the first matching TTLPolicy.
+// Set before publishing, nil removes the policies.
+func (pub *Publisher) SetTTLPolicies(policies []*TTLPolicy) error {
+
+	ttl, err := newTTLPolicies(policies)
+	if err != nil {
+		return err
+	}
+
+	pub.pubRWLock.Lock()
+	pub.ttl = ttl
+	pub.pubRWLock.Unlock()
+
+	return nil
+}
+
+// SetEnvelopeDefaults gives letters published without a ContentType, ContentEncoding, DeliveryMode, or AppID
+// those of the defaults. Set before publishing, nil removes the defaults.
+func (pub *Publisher) SetEnvelopeDefaults(defaults *EnvelopeDefaults) error {
+
+	envelopeDefaults, err := newEnvelopeDefaults(defaults)
+	if err != nil {
+		return err
+	}
+
+	pub.pubRWLock.Lock()
+	pub.defaults = envelopeDefaults
+	pub.pubRWLock.Unlock()
+
+	return nil
+}
+
+// SetTraceConfig appends a hop, recording the config's Service, to the x-trace header of every letter published
+// from now on. Nil or a disabled config stops tracing.
+func (pub *Publisher) SetTraceConfig(config *TraceConfig) {
+
+	trace := newTracer(config, pub.ConnectionPool.Config.ConnectionName)
+
+	pub.pubRWLock.Lock()
+	pub.trace = trace
+	pub.pubRWLock.Unlock()
+}
+
+// SetStamping enables or disables filling in a MessageID, Timestamp, and the context's correlation ID
+// on letters that don't have them.
+func (pub *Publisher) SetStamping(stamping bool) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.stamping = stamping
+}
+
+// SetStrictOrdering makes auto-publishing send queued letters in order, one confirmed letter at a time,
+// through a single channel. Set before StartAutoPublishing. Direct Publish calls are not ordered with queued letters.
+func (pub *Publisher) SetStrictOrdering(strictOrdering bool) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.strictOrdering = strictOrdering
+}
+
+// SetOrderingShards spreads strictly ordered auto-publishing over shards channels. A letter's routing key is
+// hashed to pick its shard, so letters sharing a routing key stay in order while different keys publish in
+// parallel. Set before StartAutoPublishing. Capped at half the pool's MaxCacheChannelCount, since each shard holds
+// its channel until stopped, 0 or 1 is a single channel.
+func (pub *Publisher) SetOrderingShards(shards int) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.orderingShards = shards
+}
+
+// SetOrderByKey makes direct publishes to the same exchange and routing key wait for the one before to be
+// confirmed, so only one is ever in flight and retries can't reorder them. Publish and PublishWithTransient wait
+// for a confirmation too. Trades throughput for order, different keys still publish in parallel. Letters queued
+// for auto-publishing are ordered with StrictOrdering instead, and not with direct publishes.
+func (pub *Publisher) SetOrderByKey(orderByKey bool) {
+
+	order := newKeyOrder(orderByKey)
+
+	pub.pubRWLock.Lock()
+	pub.order = order
+	pub.pubRWLock.Unlock()
+}
+
+// SetOnBlocked chooses what publishing does while the broker blocks the connection for a memory or disk alarm:
+// BlockedActionWait holds publishes until it unblocks, BlockedActionFail returns ErrConnectionBlocked, and
+// BlockedActionNone publishes into the stalled connection as before.
+func (pub *Publisher) SetOnBlocked(action string) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.onBlocked = action
+}
+
+// SetChunkSize publishes letters whose body is larger than chunkSize bytes as numbered chunks, which Consumers
+// reassemble before handing over the message. 0 disables chunking. PublishWithConfirmationTransient and
+// PublishInTransaction always publish bodies whole.
+func (pub *Publisher) SetChunkSize(chunkSize int) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.chunkSize = chunkSize
+}
+
+// publisherSettings are the Publisher's fields its Set methods change, copied by settings.
+type publisherSettings struct {
+	backoff        BackoffPolicy
+	rateLimiter    *RateLimiter
+	naming         *NamingConvention
+	validators     *Validators
+	ttl            *ttlPolicies
+	defaults       *envelopeDefaults
+	trace          *tracer
+	strictOrdering bool
+	orderingShards int
+	order          *keyOrder
+	chunkSize      int
+	onBlocked      string
+	stamping       bool
+}
+
+// settings copies the fields the Set methods change under pubRWLock, since they may be called while publishing.
+func (pub *Publisher) settings() publisherSettings {
+	pub.pubRWLock.RLock()
+	defer pub.pubRWLock.RUnlock()
+
+	return publisherSettings{
+		backoff:        pub.backoff,
+		rateLimiter:    pub.rateLimiter,
+		naming:         pub.naming,
+		validators:     pub.validators,
+		ttl:            pub.ttl,
+		defaults:       pub.defaults,
+		trace:          pub.trace,
+		strictOrdering: pub.strictOrdering,
+		orderingShards: pub.orderingShards,
+		order:          pub.order,
+		chunkSize:      pub.chunkSize,
+		onBlocked:      pub.onBlocked,
+		stamping:       pub.stamping,
+	}
+}
+
+// publishLetter publishes the letter, or each of its chunks in order, on the channel and returns the
+// delivery tags of the first and last publish.
+func (pub *Publisher) publishLetter(chanHost *ChannelHost, letter *Letter) (uint64, uint64, error) {
+
+	var first, last uint64
+	for i, chunk := range splitLetter(letter, pub.settings().chunkSize) {
+		deliveryTag, err := chanHost.publish(chunk)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if i == 0 {
+			first = deliveryTag
+		}
+		last = deliveryTag
+	}
+
+	return first, last, nil
+}
+
+// preflight admits the letter and then fails fast when the circuit breaker is open.
+func (pub *Publisher) preflight(ctx context.Context, letter *Letter) error {
+
+	if err := pub.admit(ctx, letter); err != nil {
+		return err
+	}
+
+	return pub.ConnectionPool.allowCircuit()
+}
+
+// admit fills in the envelope defaults, stamps the letter, applies the TTL policies, checks its naming, body, and the broker's flow
+// control, applies the rate limit, then appends the Publisher's hop to its trace.
+func (pub *Publisher) admit(ctx context.Context, letter *Letter) error {
+
+	settings := pub.settings()
+	settings.defaults.apply(letter)
+
+	if settings.stamping {
+		letter.stamp(ctx)
+	}
+
+	settings.ttl.apply(letter)
+
+	if err := pub.checkNaming(settings.naming, letter); err != nil {
+		return err
+	}
+
+	if err := settings.validators.Validate(letter); err != nil {
+		return err
+	}
+
+	if err := pub.checkBlocked(ctx, settings.onBlocked); err != nil {
+		return err
+	}
+
+	if err := pub.limit(ctx, settings.rateLimiter, letter); err != nil {
+		return err
+	}
+
+	settings.trace.apply(ctx, letter)
+	return nil
+}
+
+// awaitTurn waits, with OrderByKey, until no other publish to the letter's exchange and routing key is in flight.
+// Returns the func ending the letter's turn, or ctx.Err() when ctx is done first.
+func (pub *Publisher) awaitTurn(ctx context.Context, letter *Letter) (func(), error) {
+
+	order := pub.settings().order
+	if order == nil || letter.Envelope == nil {
+		return func() {}, nil
+	}
+
+	return order.wait(ctx, letter.Envelope.Exchange+"\x00"+letter.Envelope.RoutingKey)
+}
+
+// confirmContext bounds waiting for a confirmation by the PublishTimeOutInterval, when there is one.
+func (pub *Publisher) confirmContext() (context.Context, context.CancelFunc) {
+
+	if pub.publishTimeOutDuration > 0 {
+		return context.WithTimeout(context.Background(), pub.publishTimeOutDuration)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+// awaitTransientConfirmations waits for the confirmations of a letter's pending publishes on a transient channel.
+func (pub *Publisher) awaitTransientConfirmations(confirmations <-chan amqp.Confirmation, pending int, letter *Letter) error {
+
+	ctx, cancel := pub.confirmContext()
+	defer cancel()
+
+	nacked := false
+	for ; pending > 0; pending-- {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("publish confirmation for LetterID %d wasn't received: %w", letter.LetterID, ctx.Err())
+		case confirmation, ok := <-confirmations:
+			if !ok {
+				return errors.New("channel closed while awaiting publish confirmation")
+			}
+
+			nacked = nacked || !confirmation.Ack
+		}
+	}
+
+	if nacked {
+		return fmt.Errorf("%w: LetterID %d", ErrPublishNacked, letter.LetterID)
+	}
+
+	return nil
+}
+
+// checkBlocked applies the Publisher's OnBlocked action while the broker blocks the pool's connections.
+func (pub *Publisher) checkBlocked(ctx context.Context, onBlocked string) error {
+
+	switch onBlocked {
+	case BlockedActionWait:
+		return pub.ConnectionPool.waitWhileBlocked(ctx)
+	case BlockedActionFail:
+		if pub.ConnectionPool.Blocked() {
+			return ErrConnectionBlocked
+		}
+	}
+
+	return nil
+}
+
+// checkNaming applies the Publisher's NamingConvention, if any, to the letter's address and decorates it.
+func (pub *Publisher) checkNaming(naming *NamingConvention, letter *Letter) error {
+
+	if naming == nil {
+		return nil
+	}
+
+	if letter.Envelope.Exchange == "" {
+		queueName := naming.undecorate(letter.Envelope.RoutingKey) // a retried letter is already decorated
+		if err := naming.enforce(pub.ConnectionPool.logger, NameKindQueue, queueName); err != nil {
+			return err
+		}
+
+		letter.Envelope.RoutingKey = naming.Queue(letter.Envelope.RoutingKey)
+		return nil
+	}
+
+	err := naming.enforce(
+		pub.ConnectionPool.logger,
+		NameKindExchange, naming.undecorate(letter.Envelope.Exchange),
+		NameKindRoutingKey, letter.Envelope.RoutingKey)
+	if err != nil {
+		return err
+	}
+
+	letter.Envelope.Exchange = naming.Exchange(letter.Envelope.Exchange)
+	return nil
+}
+
+// limit applies the Publisher's RateLimiter, if any, to the letter.
+func (pub *Publisher) limit(ctx context.Context, rateLimiter *RateLimiter, letter *Letter) error {
+
+	if rateLimiter == nil {
+		return nil
+	}
+
+	return rateLimiter.Take(ctx, len(letter.Body))
+}
+
+// publishConfirmed publishes a single letter on a cached channel and waits for its confirmation.
+func publishConfirmed(cp *ConnectionPool, letter *Letter, timeout time.Duration) error {
+
+	chanHost, err := cp.getChannel()
+	if err != nil {
+		return err
+	}
+	chanHost.FlushConfirms()
+
+	_, err = chanHost.publish(letter)
+	if err != nil {
+		cp.ReturnChannel(chanHost, true)
+		return err
+	}
+
+	select {
+	case confirmation := <-chanHost.Confirmations:
+		cp.ReturnChannel(chanHost, false)
+		if !confirmation.Ack {
+			return fmt.Errorf("publish of LetterID %d was nacked", letter.LetterID)
+		}
+
+		return nil
+
+	case <-time.After(timeout):
+		cp.ReturnChannel(chanHost, false)
+		return fmt.Errorf("publish confirmation for LetterID %d wasn't received in a timely manner", letter.LetterID)
+	}
+}
+
+// publishTarget describes where a letter is addressed for ChannelException correlation.
+func publishTarget(envelope *Envelope) string {
+	return envelope.Exchange + "/" + envelope.RoutingKey
+}
+
 // PublishReceipts yields all the success and failures during all publish events. Highly recommend susbscribing to this.
+// It holds the last 1000 receipts, the oldest successful ones are dropped when nobody is reading. Failed receipts,
+// which carry the letter to retry, are never dropped and wait for a reader.
 func (pub *Publisher) PublishReceipts() <-chan *PublishReceipt {
 	return pub.publishReceipts
 }
 
+// DroppedReceipts is the number of successful receipts dropped because nobody was reading PublishReceipts().
+func (pub *Publisher) DroppedReceipts() uint64 {
+	return atomic.LoadUint64(&pub.droppedReceipts)
+}
+
 // StartAutoPublishing starts the Publisher's auto-publishing capabilities.
 func (pub *Publisher) StartAutoPublishing() {
 	pub.pubLock.Lock()
 	defer pub.pubLock.Unlock()
 
 	if !pub.autoStarted {
+		pub.ConnectionPool.logger.Info("publisher starting auto-publishing")
 		pub.autoStarted = true
+		pub.emit(PublisherEventStarted, nil, 0, nil)
 		go pub.startAutoPublishingLoop()
 	}
 }
@@ -337,7 +1118,16 @@ AutoPublishLoop:
 		}
 
 		// Deliver letters queued in the publisher, returns true when we are to stop publishing.
-		if pub.deliverLetters() {
+		settings := pub.settings()
+		if settings.strictOrdering && settings.orderingShards > 1 {
+			if pub.deliverLettersSharded(settings.orderingShards) {
+				break AutoPublishLoop
+			}
+		} else if settings.strictOrdering {
+			if pub.deliverLettersInOrder() {
+				break AutoPublishLoop
+			}
+		} else if pub.deliverLetters() {
 			break AutoPublishLoop
 		}
 	}
@@ -345,6 +1135,8 @@ AutoPublishLoop:
 	pub.pubLock.Lock()
 	pub.autoStarted = false
 	pub.pubLock.Unlock()
+
+	pub.ConnectionPool.logger.Info("publisher stopped auto-publishing")
 }
 
 func (pub *Publisher) deliverLetters() bool {
@@ -389,6 +1181,169 @@ func (pub *Publisher) deliverLetters() bool {
 	}
 }
 
+// deliverLettersInOrder publishes queued letters from this goroutine alone, on a single cached channel
+// it holds until stopped. Returns true when we are to stop publishing.
+func (pub *Publisher) deliverLettersInOrder() bool {
+
+	chanHost, err := pub.ConnectionPool.getChannel()
+	if err == nil {
+		defer pub.ConnectionPool.ReturnChannel(chanHost, false)
+	}
+
+	for {
+		select {
+		case stop := <-pub.autoStop:
+			if stop {
+				close(pub.letters)
+				return true
+			}
+
+		case letter := <-pub.letters:
+			pub.publishInOrder(chanHost, err, letter)
+		}
+	}
+}
+
+// deliverLettersSharded hands queued letters to count shard goroutines by routing key, each publishing in order on
+// its own cached channel held until stopped. Returns true when we are to stop publishing.
+func (pub *Publisher) deliverLettersSharded(count int) bool {
+
+	if limit := maxOrderingShards(pub.ConnectionPool.Config.MaxCacheChannelCount); count > limit {
+		count = limit // shards hold their channels until stopped, leave the rest of the pool to everyone else
+	}
+
+	shards := make([]chan *Letter, count)
+	shardGroup := &sync.WaitGroup{}
+	for i := range shards {
+		shards[i] = make(chan *Letter, 100)
+
+		shardGroup.Add(1)
+		go pub.deliverShard(shards[i], shardGroup)
+	}
+
+	for {
+		select {
+		case stop := <-pub.autoStop:
+			if stop {
+				for _, shard := range shards {
+					close(shard) // shards finish the letters already handed to them
+				}
+				shardGroup.Wait()
+
+				close(pub.letters)
+				return true
+			}
+
+		case letter := <-pub.letters:
+			shards[shardIndex(letter.Envelope.RoutingKey, count)] <- letter
+		}
+	}
+}
+
+// deliverShard publishes a shard's letters in order on a single cached channel.
+func (pub *Publisher) deliverShard(letters <-chan *Letter, shardGroup *sync.WaitGroup) {
+	defer shardGroup.Done()
+
+	chanHost, err := pub.ConnectionPool.getChannel()
+	if err == nil {
+		defer pub.ConnectionPool.ReturnChannel(chanHost, false)
+	}
+
+	for letter := range letters {
+		pub.publishInOrder(chanHost, err, letter)
+	}
+}
+
+// maxOrderingShards is half the cached channels, and at least one, so shards never take the whole pool.
+func maxOrderingShards(maxCacheChannelCount uint64) int {
+
+	if limit := int(maxCacheChannelCount / 2); limit > 1 {
+		return limit
+	}
+
+	return 1
+}
+
+// shardIndex is the stable shard of a routing key.
+func shardIndex(routingKey string, shards int) int {
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(routingKey))
+
+	return int(hash.Sum32() % uint32(shards))
+}
+
+// publishInOrder publishes the letter and waits for its confirmation, republishing until the broker acks.
+// Nothing else is published in the meantime so broker-side order matches queue order (retries may duplicate).
+// Failed or timed out publishes rebuild the channel through the pool, which also discards stale confirmations.
+// Without a channel the letter fails with channelErr, why the pool couldn't provide one: ErrPoolClosed once it has
+// shut down, ErrNoCachedChannels, or the TerminalError of a refused channel.
+func (pub *Publisher) publishInOrder(chanHost *ChannelHost, channelErr error, letter *Letter) {
+
+	if channelErr != nil {
+		pub.publishReceipt(letter, channelErr)
+		return
+	}
+
+	if err := pub.admit(context.Background(), letter); err != nil {
+		pub.publishReceipt(letter, err)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		pub.ConnectionPool.waitForCircuit()
+
+		chanHost.FlushConfirms()
+		first, last, err := pub.publishLetter(chanHost, letter)
+
+		acked := err == nil
+		for pending := last - first + 1; acked && pending > 0; pending-- {
+			acked, err = pub.awaitConfirmation(chanHost)
+		}
+		pub.ConnectionPool.recordCircuit(err)
+
+		if acked {
+			pub.publishReceipt(letter, nil)
+			return
+		}
+
+		if err != nil {
+			pub.ConnectionPool.logger.Warn("ordered publish of LetterID %d failed, retrying: %s", letter.LetterID, err)
+			if err := pub.ConnectionPool.reconnectChannel(chanHost); err != nil {
+				pub.publishReceipt(letter, err)
+				return
+			}
+		} else {
+			pub.ConnectionPool.logger.Debug("ordered publish of LetterID %d was nacked, republishing", letter.LetterID)
+			err = ErrPublishNacked
+		}
+		pub.emit(PublisherEventRetried, letter, attempt, err)
+
+		sleepBackoff(pub.settings().backoff, attempt)
+	}
+}
+
+// awaitConfirmation waits for the next confirmation on the channel, returning an error on timeout or channel closure.
+func (pub *Publisher) awaitConfirmation(chanHost *ChannelHost) (bool, error) {
+
+	var timeoutAfter <-chan time.Time // waits indefinitely without a PublishTimeOutInterval
+	if pub.publishTimeOutDuration > 0 {
+		timeoutAfter = time.After(pub.publishTimeOutDuration)
+	}
+
+	select {
+	case <-timeoutAfter:
+		return false, errConfirmationTimeout
+
+	case confirmation, ok := <-chanHost.Confirmations:
+		if !ok {
+			return false, errors.New("channel closed while awaiting publish confirmation")
+		}
+
+		return confirmation.Ack, nil
+	}
+}
+
 // stopAutoPublish stops publishing letters queued up.
 func (pub *Publisher) stopAutoPublish() {
 	pub.pubLock.Lock()
@@ -435,20 +1390,54 @@ func (pub *Publisher) safeSend(letter *Letter) (closed bool) {
 // publishReceipt sends the status to the receipt channel.
 func (pub *Publisher) publishReceipt(letter *Letter, err error) {
 
-	go func(*Letter, error) {
-		publishReceipt := &PublishReceipt{
-			LetterID: letter.LetterID,
-			Error:    err,
+	// Built before handing off so a successfully published letter isn't touched after the publish returns,
+	// it may already have been released back to the letter pool.
+	publishReceipt := &PublishReceipt{
+		LetterID: letter.LetterID,
+		Error:    err,
+	}
+
+	if err == nil {
+		publishReceipt.Success = true
+	} else {
+		publishReceipt.FailedLetter = letter
+	}
+
+	pub.emitResult(letter, err)
+
+	if letter.OnReceipt != nil && (err == nil || !pub.deferOnReceipt) {
+		letter.OnReceipt(publishReceipt)
+	}
+
+	for {
+		select {
+		case pub.publishReceipts <- publishReceipt:
+			return
+		default:
 		}
 
-		if err == nil {
-			publishReceipt.Success = true
-		} else {
-			publishReceipt.FailedLetter = letter
+		// Full, a failed receipt carries its letter for retrying so it waits for a reader instead of being dropped.
+		if !publishReceipt.Success {
+			go pub.spillReceipt(publishReceipt)
+			return
 		}
 
-		pub.publishReceipts <- publishReceipt
-	}(letter, err)
+		// Drop the oldest successful receipt to make room.
+		select {
+		case oldest := <-pub.publishReceipts:
+			if oldest.Success {
+				atomic.AddUint64(&pub.droppedReceipts, 1)
+			} else {
+				go pub.spillReceipt(oldest)
+			}
+		default:
+		}
+	}
+}
+
+// spillReceipt waits for a reader of PublishReceipts to take the failed receipt.
+func (pub *Publisher) spillReceipt(publishReceipt *PublishReceipt) {
+	pub.publishReceipts <- publishReceipt
 }
 
 // Shutdown cleanly shutdown the publisher and resets it's internal state.
@@ -456,6 +1445,12 @@ func (pub *Publisher) Shutdown(shutdownPools bool) {
 
 	pub.stopAutoPublish()
 
+	if pub.buffer != nil {
+		pub.buffer.close() // publishes what is left in the buffer
+	}
+
+	pub.emit(PublisherEventShutdown, nil, 0, nil)
+
 	if shutdownPools { // in case the ChannelPool is shared between structs, you can prevent it from shutting down
 		pub.ConnectionPool.Shutdown()
 	}
@@ -0,0 +1,125 @@
+package tcr
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// PublisherEventStarted is emitted when auto-publishing starts.
+	PublisherEventStarted = "started"
+
+	// PublisherEventPublished is emitted when a letter is published (and confirmed, when confirming).
+	PublisherEventPublished = "published"
+
+	// PublisherEventRetried is emitted each time a failed or nacked publish of a letter is tried again.
+	PublisherEventRetried = "retried"
+
+	// PublisherEventFailed is emitted when a publish of a letter gives up.
+	PublisherEventFailed = "failed"
+
+	// PublisherEventShutdown is emitted when the Publisher shuts down.
+	PublisherEventShutdown = "shutdown"
+)
+
+// PublisherEvent describes something the Publisher did, for dashboards and alerts on retry storms and failure spikes.
+type PublisherEvent struct {
+	Type        string    `json:"Type"`
+	LetterID    uint64    `json:"LetterID,omitempty"`
+	Exchange    string    `json:"Exchange,omitempty"`
+	RoutingKey  string    `json:"RoutingKey,omitempty"`
+	Attempt     int       `json:"Attempt,omitempty"` // of a retry, 1 for the first
+	Error       error     `json:"-"`
+	UTCDateTime time.Time `json:"UTCDateTime"`
+}
+
+// publisherEvents is a bounded, non-blocking event channel that drops the oldest event when full.
+type publisherEvents struct {
+	events  chan *PublisherEvent
+	dropped uint64
+}
+
+// newPublisherEvents creates the event channel, nil when capacity is zero.
+func newPublisherEvents(capacity uint32) *publisherEvents {
+
+	if capacity == 0 {
+		return nil
+	}
+
+	return &publisherEvents{
+		events: make(chan *PublisherEvent, capacity),
+	}
+}
+
+// Events yields the Publisher's events when PublisherConfig.EventBuffer is set, otherwise nil.
+// Oldest events are dropped when nobody is reading.
+func (pub *Publisher) Events() <-chan *PublisherEvent {
+
+	if pub.events == nil {
+		return nil
+	}
+
+	return pub.events.events
+}
+
+// DroppedEvents is the number of events dropped because nobody was reading Events().
+func (pub *Publisher) DroppedEvents() uint64 {
+
+	if pub.events == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&pub.events.dropped)
+}
+
+// emit queues an event about the letter, nil for the Publisher itself, when events are enabled.
+// Letter fields are copied now since a published letter may be released right after.
+func (pub *Publisher) emit(eventType string, letter *Letter, attempt int, err error) {
+
+	if pub.events == nil {
+		return
+	}
+
+	event := &PublisherEvent{
+		Type:        eventType,
+		Attempt:     attempt,
+		Error:       err,
+		UTCDateTime: time.Now().UTC(),
+	}
+
+	if letter != nil {
+		event.LetterID = letter.LetterID
+		if letter.Envelope != nil {
+			event.Exchange = letter.Envelope.Exchange
+			event.RoutingKey = letter.Envelope.RoutingKey
+		}
+	}
+
+	for {
+		select {
+		case pub.events.events <- event:
+			return
+		default:
+		}
+
+		// Full, drop the oldest to make room.
+		select {
+		case <-pub.events.events:
+			atomic.AddUint64(&pub.events.dropped, 1)
+		default:
+		}
+	}
+}
+
+// emitResult records the letter's outcome with the ReceiptSink and emits published or failed for it.
+func (pub *Publisher) emitResult(letter *Letter, err error) {
+
+	pub.recordReceipt(letter, err)
+
+	if err != nil {
+		pub.emit(PublisherEventFailed, letter, 0, err)
+		return
+	}
+
+	pub.emit(PublisherEventPublished, letter, 0, nil)
+}
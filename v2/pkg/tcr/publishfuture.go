@@ -0,0 +1,90 @@
+package tcr
+
+import (
+	"context"
+)
+
+// PublishFuture is the pending outcome of a PublishAsync, completed once the broker confirms the letter or the
+// publish fails. Select on Done() to wait on many publishes at once.
+type PublishFuture struct {
+	LetterID uint64
+	done     chan struct{}
+	err      error
+}
+
+// NewCompletedPublishFuture creates a PublishFuture that is already done with err, for test doubles.
+func NewCompletedPublishFuture(letterID uint64, err error) *PublishFuture {
+
+	pf := &PublishFuture{
+		LetterID: letterID,
+		done:     make(chan struct{}),
+	}
+
+	pf.complete(err)
+
+	return pf
+}
+
+// complete records the outcome and closes Done(). Only called once.
+func (pf *PublishFuture) complete(err error) {
+
+	pf.err = err
+	close(pf.done)
+}
+
+// Done is closed when the publish has been confirmed or has failed.
+func (pf *PublishFuture) Done() <-chan struct{} {
+	return pf.done
+}
+
+// Err is why the publish failed, like ErrPublishNacked, once Done() is closed. It is nil while pending and
+// after a confirmation.
+func (pf *PublishFuture) Err() error {
+
+	select {
+	case <-pf.done:
+		return pf.err
+	default:
+		return nil
+	}
+}
+
+// Confirmed reports whether the broker has acked the letter. False while pending.
+func (pf *PublishFuture) Confirmed() bool {
+
+	select {
+	case <-pf.done:
+		return pf.err == nil
+	default:
+		return false
+	}
+}
+
+// Wait blocks until the publish is done, returning its Err(), or until ctx is done, returning ctx.Err().
+// The publish itself carries on when ctx is done first.
+func (pf *PublishFuture) Wait(ctx context.Context) error {
+
+	select {
+	case <-pf.done:
+		return pf.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PublishAsync publishes the letter like PublishAndWait without blocking, the returned PublishFuture completes
+// with the outcome. ctx bounds the whole publish, waiting for a channel and the confirmation included. Each
+// pending publish holds a cached channel, so at most MaxCacheChannelCount are in flight while the rest wait.
+func (pub *Publisher) PublishAsync(ctx context.Context, letter *Letter) *PublishFuture {
+
+	pf := &PublishFuture{
+		LetterID: letter.LetterID,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		pf.complete(pub.PublishAndWait(ctx, letter))
+	}()
+
+	return pf
+}
@@ -0,0 +1,220 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const (
+	// HeaderQuarantineReason is why a message was quarantined.
+	HeaderQuarantineReason = "x-quarantine-reason"
+
+	// HeaderQuarantineAttempts is the number of times the message had been delivered when it was quarantined.
+	HeaderQuarantineAttempts = "x-quarantine-attempts"
+
+	// HeaderQuarantineSourceQueue is the queue the message was quarantined from.
+	HeaderQuarantineSourceQueue = "x-quarantine-source-queue"
+
+	// HeaderQuarantinedAt is when the message was quarantined, unix milliseconds.
+	HeaderQuarantinedAt = "x-quarantined-at"
+
+	// maxTrackedRedeliveries bounds the redelivery counts kept for messages without broker side counts.
+	maxTrackedRedeliveries = 10000
+)
+
+// ErrMessageQuarantined is sent on the Consumer's Errors() for every message moved to the quarantine queue.
+var ErrMessageQuarantined = errors.New("poison message quarantined")
+
+// quarantinePolicy moves messages delivered more than maxAttempts times to a quarantine queue, so a message
+// that keeps failing (or crashing its consumer) can't requeue loop forever. It is only used by the consume loop.
+type quarantinePolicy struct {
+	queueName      string
+	quarantine     string
+	maxAttempts    uint32
+	publishTimeout time.Duration
+	declared       bool
+	redeliveries   map[string]uint32
+	quarantined    uint64
+}
+
+// newQuarantinePolicy creates a quarantinePolicy for the queue from config. Returns nil when not enabled.
+func newQuarantinePolicy(queueName string, config *QuarantineConfig) *quarantinePolicy {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	qp := &quarantinePolicy{
+		queueName:      queueName,
+		quarantine:     config.QueueName,
+		maxAttempts:    config.MaxProcessAttempts,
+		publishTimeout: time.Duration(config.PublishTimeOutInterval) * time.Millisecond,
+		redeliveries:   make(map[string]uint32),
+	}
+
+	if qp.quarantine == "" {
+		qp.quarantine = queueName + ".quarantine"
+	}
+
+	if qp.maxAttempts == 0 {
+		qp.maxAttempts = 5
+	}
+
+	if qp.publishTimeout == 0 {
+		qp.publishTimeout = 5 * time.Second
+	}
+
+	return qp
+}
+
+// attempts is the delivery's attempt number, the highest of the broker's x-delivery-count (quorum queues),
+// its x-death count for this queue (dead letter cycles), and the redeliveries this consumer has seen.
+func (qp *quarantinePolicy) attempts(delivery *amqp.Delivery) uint32 {
+
+	attempts := uint32(1)
+
+	if count, ok := headerInt(delivery.Headers["x-delivery-count"]); ok && uint32(count)+1 > attempts {
+		attempts = uint32(count) + 1
+	}
+
+	if deaths := deathCount(delivery.Headers, qp.queueName); deaths+1 > attempts {
+		attempts = deaths + 1
+	}
+
+	if delivery.Redelivered {
+		if len(qp.redeliveries) >= maxTrackedRedeliveries {
+			qp.redeliveries = make(map[string]uint32)
+		}
+
+		key := redeliveryKey(delivery)
+		qp.redeliveries[key]++
+		if qp.redeliveries[key]+1 > attempts {
+			attempts = qp.redeliveries[key] + 1
+		}
+	}
+
+	return attempts
+}
+
+// deathCount sums the x-death counts recorded for the queue.
+func deathCount(headers amqp.Table, queueName string) uint32 {
+
+	deaths, ok := headers["x-death"].([]interface{})
+	if !ok {
+		return 0
+	}
+
+	var total uint32
+	for _, death := range deaths {
+		table, ok := death.(amqp.Table)
+		if !ok || table["queue"] != queueName {
+			continue
+		}
+
+		if count, ok := headerInt(table["count"]); ok {
+			total += uint32(count)
+		}
+	}
+
+	return total
+}
+
+// redeliveryKey identifies a message across redeliveries, by MessageId or else by body.
+func redeliveryKey(delivery *amqp.Delivery) string {
+
+	if delivery.MessageId != "" {
+		return delivery.MessageId
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write(delivery.Body)
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// quarantineDelivery moves the delivery to the quarantine queue, with its failure metadata in the headers,
+// and acks it along with its chunks. Returns false, leaving the delivery untouched, when it is within
+// MaxProcessAttempts. A failed move nacks it with requeue, so it is tried again on its next delivery.
+func (con *Consumer) quarantineDelivery(delivery *amqp.Delivery, chunkTags []uint64, acknowledger amqp.Acknowledger) bool {
+
+	qp := con.quarantine
+	attempts := qp.attempts(delivery)
+	maxAttempts := atomic.LoadUint32(&qp.maxAttempts)
+	if attempts <= maxAttempts {
+		return false
+	}
+
+	reason := fmt.Sprintf("delivered %d times, more than the %d processing attempts allowed", attempts, maxAttempts)
+	if err := qp.publish(con.ConnectionPool, delivery, attempts, reason); err != nil {
+		con.errors.report("quarantine", int(attempts), fmt.Errorf("consumer unable to quarantine poison message: %w", err))
+
+		for _, chunkTag := range chunkTags {
+			_ = acknowledger.Nack(chunkTag, false, true)
+		}
+		_ = acknowledger.Nack(delivery.DeliveryTag, false, true)
+		return true
+	}
+
+	for _, chunkTag := range chunkTags {
+		_ = acknowledger.Ack(chunkTag, false)
+	}
+	_ = acknowledger.Ack(delivery.DeliveryTag, false)
+
+	delete(qp.redeliveries, redeliveryKey(delivery))
+	atomic.AddUint64(&qp.quarantined, 1)
+
+	con.ConnectionPool.logger.Warn("consumer %s quarantined a message from %s to %s: %s", con.ConsumerName, qp.queueName, qp.quarantine, reason)
+	con.ConnectionPool.notify(EventMessageQuarantined, 0, fmt.Sprintf("message from %s quarantined to %s: %s", qp.queueName, qp.quarantine, reason))
+	con.errors.report("quarantine", int(attempts), fmt.Errorf("%w: message %q from %s, %s", ErrMessageQuarantined, delivery.MessageId, qp.queueName, reason))
+
+	return true
+}
+
+// publish declares the quarantine queue, once, and publishes the delivery to it with the failure metadata.
+func (qp *quarantinePolicy) publish(cp *ConnectionPool, delivery *amqp.Delivery, attempts uint32, reason string) error {
+
+	if !qp.declared {
+		if err := NewTopologer(cp).CreateQueueFromConfig(&Queue{Name: qp.quarantine, Durable: true}); err != nil {
+			return err
+		}
+		qp.declared = true
+	}
+
+	headers := make(amqp.Table, len(delivery.Headers)+4)
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+
+	headers[HeaderQuarantineReason] = reason
+	headers[HeaderQuarantineAttempts] = int64(attempts)
+	headers[HeaderQuarantineSourceQueue] = qp.queueName
+	headers[HeaderQuarantinedAt] = time.Now().UnixMilli()
+
+	return publishConfirmed(cp, &Letter{
+		Body: delivery.Body,
+		Envelope: &Envelope{
+			RoutingKey:    qp.quarantine,
+			ContentType:   delivery.ContentType,
+			Headers:       headers,
+			DeliveryMode:  amqp.Persistent,
+			CorrelationID: delivery.CorrelationId,
+			MessageID:     delivery.MessageId,
+			Type:          delivery.Type,
+		},
+	}, qp.publishTimeout)
+}
+
+// Quarantined is the number of poison messages this Consumer moved to its quarantine queue.
+func (con *Consumer) Quarantined() uint64 {
+
+	if con.quarantine == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&con.quarantine.quarantined)
+}
@@ -0,0 +1,263 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// QueueEventBacklog is emitted when a queue's messages rise above its MaxMessages.
+	QueueEventBacklog = "backlog"
+
+	// QueueEventBacklogCleared is emitted when a queue with a backlog is back to MaxMessages or fewer.
+	QueueEventBacklogCleared = "backlog-cleared"
+
+	// QueueEventConsumersLow is emitted when a queue's consumers drop below its MinConsumers.
+	QueueEventConsumersLow = "consumers-low"
+
+	// QueueEventConsumersRestored is emitted when a queue with too few consumers is back to MinConsumers or more.
+	QueueEventConsumersRestored = "consumers-restored"
+
+	// QueueEventCheckFailed is emitted when a queue's counts can't be read, once until a check succeeds again.
+	QueueEventCheckFailed = "check-failed"
+)
+
+const defaultQueueMonitorInterval = 10 * time.Second
+
+// QueueCountsFunc reads how many messages are in a queue and how many consumers it has.
+type QueueCountsFunc func(ctx context.Context, queueName string) (messages int, consumers int, err error)
+
+// QueueEvent is a queue crossing one of its thresholds, or failing to be checked.
+type QueueEvent struct {
+	Type        string    `json:"Type"`
+	QueueName   string    `json:"QueueName"`
+	Messages    int       `json:"Messages"`
+	Consumers   int       `json:"Consumers"`
+	Threshold   int       `json:"Threshold,omitempty"` // the MaxMessages or MinConsumers crossed
+	Error       error     `json:"-"`
+	UTCDateTime time.Time `json:"UTCDateTime"`
+}
+
+// queueState is what a QueueMonitor last saw of a queue, so only crossings are emitted.
+type queueState struct {
+	backlog      bool
+	consumersLow bool
+	failing      bool
+}
+
+// QueueMonitor checks the message and consumer counts of queues every PollInterval and tells its listeners when a
+// queue crosses a threshold, for scaling workers or alerting from inside the application. Each crossing is
+// emitted once, followed by its cleared or restored event when the queue is back within its threshold.
+type QueueMonitor struct {
+	ConnectionPool *ConnectionPool
+	thresholds     []*QueueThreshold
+	pollInterval   time.Duration
+	queueCounts    QueueCountsFunc
+	states         map[string]*queueState
+	listeners      []func(*QueueEvent)
+	started        bool
+	stop           chan struct{}
+	monitorGroup   *sync.WaitGroup
+	monitorLock    *sync.Mutex
+}
+
+// NewQueueMonitor creates a QueueMonitor for the queues of the config. Call Start to begin checking them.
+func NewQueueMonitor(cp *ConnectionPool, config *QueueMonitorConfig) (*QueueMonitor, error) {
+
+	if config == nil || len(config.Queues) == 0 {
+		return nil, errors.New("queue monitor requires at least one queue")
+	}
+
+	qm := &QueueMonitor{
+		ConnectionPool: cp,
+		thresholds:     config.Queues,
+		pollInterval:   time.Duration(config.PollInterval) * time.Second,
+		queueCounts:    config.QueueCounts,
+		states:         make(map[string]*queueState),
+		monitorGroup:   &sync.WaitGroup{},
+		monitorLock:    &sync.Mutex{},
+	}
+
+	for _, threshold := range config.Queues {
+		if threshold.QueueName == "" {
+			return nil, errors.New("queue monitor requires a QueueName for every queue")
+		}
+
+		qm.states[threshold.QueueName] = &queueState{}
+	}
+
+	if qm.pollInterval <= 0 {
+		qm.pollInterval = defaultQueueMonitorInterval
+	}
+
+	if qm.queueCounts == nil {
+		topologer := NewTopologer(cp)
+		qm.queueCounts = func(ctx context.Context, queueName string) (int, int, error) {
+			return topologer.QueueCounts(queueName)
+		}
+	}
+
+	return qm, nil
+}
+
+// OnEvent adds a listener that is called with every QueueEvent from now on. Listeners run on the monitor's
+// goroutine in the order added, so they must not block.
+func (qm *QueueMonitor) OnEvent(listener func(*QueueEvent)) {
+	qm.monitorLock.Lock()
+	defer qm.monitorLock.Unlock()
+
+	qm.listeners = append(qm.listeners, listener)
+}
+
+// Start begins checking the queues in the background, right away and then every PollInterval.
+func (qm *QueueMonitor) Start() {
+	qm.monitorLock.Lock()
+	defer qm.monitorLock.Unlock()
+
+	if qm.started {
+		return
+	}
+
+	qm.started = true
+	qm.stop = make(chan struct{})
+	qm.monitorGroup.Add(1)
+	go qm.monitorLoop(qm.stop)
+}
+
+// Stop stops checking the queues and waits for a check in progress to finish.
+func (qm *QueueMonitor) Stop() {
+	qm.monitorLock.Lock()
+	if !qm.started {
+		qm.monitorLock.Unlock()
+		return
+	}
+
+	qm.started = false
+	close(qm.stop)
+	qm.monitorLock.Unlock()
+
+	qm.monitorGroup.Wait()
+}
+
+func (qm *QueueMonitor) monitorLoop(stop chan struct{}) {
+	defer qm.monitorGroup.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		_ = qm.Check(ctx)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(qm.pollInterval):
+		}
+	}
+}
+
+// Check reads the counts of every queue once, emitting the events of the thresholds crossed since the last check,
+// and returns the errors of the queues it couldn't read. Start calls it every PollInterval.
+func (qm *QueueMonitor) Check(ctx context.Context) error {
+
+	var errs []error
+	for _, threshold := range qm.thresholds {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		messages, consumers, err := qm.queueCounts(ctx, threshold.QueueName)
+		if err != nil {
+			err = fmt.Errorf("queue monitor unable to read queue %s: %w", threshold.QueueName, err)
+			errs = append(errs, err)
+		}
+
+		for _, event := range qm.crossings(threshold, messages, consumers, err) {
+			qm.emit(event)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// crossings updates the queue's state with a check, returning the events of the thresholds it crossed.
+func (qm *QueueMonitor) crossings(threshold *QueueThreshold, messages int, consumers int, err error) []*QueueEvent {
+	qm.monitorLock.Lock()
+	defer qm.monitorLock.Unlock()
+
+	state := qm.states[threshold.QueueName]
+	newEvent := func(eventType string, limit uint32) *QueueEvent {
+		return &QueueEvent{
+			Type:        eventType,
+			QueueName:   threshold.QueueName,
+			Messages:    messages,
+			Consumers:   consumers,
+			Threshold:   int(limit),
+			Error:       err,
+			UTCDateTime: time.Now().UTC(),
+		}
+	}
+
+	if err != nil {
+		if state.failing {
+			return nil
+		}
+
+		state.failing = true
+		qm.ConnectionPool.logger.Warn("%s", err)
+		qm.ConnectionPool.errors.report("monitor", 0, err)
+		return []*QueueEvent{newEvent(QueueEventCheckFailed, 0)}
+	}
+
+	state.failing = false
+
+	var events []*QueueEvent
+	if threshold.MaxMessages > 0 {
+		backlog := messages > int(threshold.MaxMessages)
+		if backlog != state.backlog {
+			state.backlog = backlog
+			if backlog {
+				events = append(events, newEvent(QueueEventBacklog, threshold.MaxMessages))
+			} else {
+				events = append(events, newEvent(QueueEventBacklogCleared, threshold.MaxMessages))
+			}
+		}
+	}
+
+	if threshold.MinConsumers > 0 {
+		consumersLow := consumers < int(threshold.MinConsumers)
+		if consumersLow != state.consumersLow {
+			state.consumersLow = consumersLow
+			if consumersLow {
+				events = append(events, newEvent(QueueEventConsumersLow, threshold.MinConsumers))
+			} else {
+				events = append(events, newEvent(QueueEventConsumersRestored, threshold.MinConsumers))
+			}
+		}
+	}
+
+	return events
+}
+
+// emit calls the listeners with the event.
+func (qm *QueueMonitor) emit(event *QueueEvent) {
+
+	qm.monitorLock.Lock()
+	listeners := qm.listeners
+	qm.monitorLock.Unlock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
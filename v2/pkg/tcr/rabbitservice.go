@@ -8,7 +8,7 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 )
 
 // RabbitService is the struct for containing all you need for RabbitMQ access.
@@ -17,12 +17,16 @@ type RabbitService struct {
 	ConnectionPool       *ConnectionPool
 	Topologer            *Topologer
 	Publisher            *Publisher
+	Outbox               *Outbox
+	Brokers              *BrokerRegistry // the BrokerTargets, nil when none are configured
 	encryptionConfigured bool
-	centralErr           chan error
+	naming               *NamingConvention
+	centralErr           *errorBuffer
 	consumers            map[string]*Consumer
 	shutdownSignal       chan bool
 	shutdown             bool
 	letterCount          uint64
+	shutdownHooks        *shutdownHooks
 	monitorSleepInterval time.Duration
 	serviceLock          *sync.Mutex
 }
@@ -48,17 +52,57 @@ func NewRabbitService(
 		Config:               config,
 		Publisher:            publisher,
 		Topologer:            topologer,
-		centralErr:           make(chan error, 1000),
+		centralErr:           newErrorBuffer(errorBufferSize(config.ServiceConfig), SubsystemService),
 		shutdownSignal:       make(chan bool, 1),
 		consumers:            make(map[string]*Consumer),
+		shutdownHooks:        newShutdownHooks(),
 		monitorSleepInterval: time.Duration(200) * time.Millisecond,
 		serviceLock:          &sync.Mutex{},
 	}
 
+	naming, err := NewNamingConvention(config.NamingConfig)
+	if err != nil {
+		return rs.abort(err)
+	}
+
+	rs.naming = naming
+	rs.Topologer.SetNamingConvention(naming)
+	rs.Publisher.SetNamingConvention(naming)
+
+	// Declare the configured topology before any Consumer needs it.
+	if config.TopologyConfig != nil {
+		if err = rs.Topologer.BuildToplogy(config.TopologyConfig, false); err != nil {
+			return rs.abort(fmt.Errorf("unable to build topology: %w", err))
+		}
+	}
+
 	// Build a Map for Consumer retrieval.
 	err = rs.createConsumers(config.ConsumerConfigs)
 	if err != nil {
-		return nil, err
+		return rs.abort(err)
+	}
+
+	// Persist letters that exhaust their retries when an outbox is configured.
+	if config.OutboxConfig != nil && config.OutboxConfig.Enabled {
+		store, err := NewBoltOutboxStore(config.OutboxConfig.FilePath)
+		if err != nil {
+			return rs.abort(err)
+		}
+
+		rs.Outbox, err = NewOutbox(store, connectionPool, config.OutboxConfig)
+		if err != nil {
+			_ = store.Close()
+			return rs.abort(err)
+		}
+
+		rs.Outbox.StartRepublishing()
+	}
+
+	if len(config.BrokerTargets) > 0 {
+		rs.Brokers, err = NewBrokerRegistry(config)
+		if err != nil {
+			return rs.abort(err)
+		}
 	}
 
 	// Create a HashKey for Encryption
@@ -75,13 +119,14 @@ func NewRabbitService(
 	}
 
 	// Start the background monitors and logging.
-	go rs.collectConsumerErrors()
+	go rs.collectErrors()
 	go rs.monitorForShutdown()
 
 	// Monitors all publish events
 	if processPublishReceipts != nil {
 		go rs.invokeProcessPublishReceipts(processPublishReceipts)
 	} else { // Default action is to retry publishing all failures.
+		rs.Publisher.deferOnReceipt = true
 		go rs.processPublishReceipts()
 	}
 
@@ -98,11 +143,33 @@ func NewRabbitService(
 	return rs, nil
 }
 
+// abort releases what NewRabbitService created before failing with err, the outbox and the ConnectionPool.
+func (rs *RabbitService) abort(err error) (*RabbitService, error) {
+
+	if rs.Outbox != nil {
+		rs.Outbox.StopRepublishing()
+		_ = rs.Outbox.Store.Close()
+	}
+
+	rs.ConnectionPool.Shutdown()
+	return nil, err
+}
+
 // CreateConsumers takes a config from the Config and builds all the consumers (errors if config is missing).
 func (rs *RabbitService) createConsumers(consumerConfigs map[string]*ConsumerConfig) error {
 
 	for consumerName, consumerConfig := range consumerConfigs {
 
+		if rs.naming != nil {
+			copied := *consumerConfig // the configured names stay as they are
+			copied.QueueName = rs.naming.Queue(consumerConfig.QueueName)
+			copied.QueueNames = make([]string, 0, len(consumerConfig.QueueNames))
+			for _, queueName := range consumerConfig.QueueNames {
+				copied.QueueNames = append(copied.QueueNames, rs.naming.Queue(queueName))
+			}
+			consumerConfig = &copied
+		}
+
 		consumer := NewConsumerFromConfig(consumerConfig, rs.ConnectionPool)
 		hostName, err := os.Hostname()
 
@@ -110,12 +177,27 @@ func (rs *RabbitService) createConsumers(consumerConfigs map[string]*ConsumerCon
 			consumer.ConsumerName = hostName + "-" + consumer.ConsumerName
 		}
 
+		rs.serviceLock.Lock()
 		rs.consumers[consumerName] = consumer
+		rs.serviceLock.Unlock()
 	}
 
 	return nil
 }
 
+// consumerList is a snapshot of the consumers, safe to range over while Start adds registered consumers.
+func (rs *RabbitService) consumerList() []*Consumer {
+	rs.serviceLock.Lock()
+	defer rs.serviceLock.Unlock()
+
+	consumers := make([]*Consumer, 0, len(rs.consumers))
+	for _, consumer := range rs.consumers {
+		consumers = append(consumers, consumer)
+	}
+
+	return consumers
+}
+
 // PublishWithConfirmation tries to publish and wait for a confirmation.
 func (rs *RabbitService) PublishWithConfirmation(
 	input interface{},
@@ -134,15 +216,19 @@ func (rs *RabbitService) PublishWithConfirmation(
 	currentCount := atomic.LoadUint64(&rs.letterCount)
 	atomic.AddUint64(&rs.letterCount, 1)
 
+	// Honor the encodings advertised by the consumer, when passed along.
+	acceptEncoding, _ := headers[HeaderAcceptEncoding].(string)
+
 	var data []byte
+	var contentEncoding string
 	var err error
 	if wrapPayload {
-		data, err = CreateWrappedPayload(input, currentCount, metadata, rs.Config.CompressionConfig, rs.Config.EncryptionConfig)
+		data, err = createWrappedPayload(input, currentCount, metadata, acceptEncoding, rs.Config.CompressionConfig, rs.Config.EncryptionConfig)
 		if err != nil {
 			return err
 		}
 	} else {
-		data, err = CreatePayload(input, rs.Config.CompressionConfig, rs.Config.EncryptionConfig)
+		data, contentEncoding, err = createPayload(input, acceptEncoding, rs.Config.CompressionConfig, rs.Config.EncryptionConfig)
 		if err != nil {
 			return err
 		}
@@ -155,13 +241,14 @@ func (rs *RabbitService) PublishWithConfirmation(
 			LetterID: currentCount,
 			Body:     data,
 			Envelope: &Envelope{
-				Exchange:     exchangeName,
-				RoutingKey:   routingKey,
-				ContentType:  "application/json",
-				Mandatory:    false,
-				Immediate:    false,
-				DeliveryMode: 2,
-				Headers:      headers,
+				Exchange:        exchangeName,
+				RoutingKey:      routingKey,
+				ContentType:     "application/json",
+				ContentEncoding: contentEncoding,
+				Mandatory:       false,
+				Immediate:       false,
+				DeliveryMode:    2,
+				Headers:         headers,
 			},
 		},
 		time.Duration(time.Millisecond*300))
@@ -187,15 +274,19 @@ func (rs *RabbitService) Publish(
 	currentCount := atomic.LoadUint64(&rs.letterCount)
 	atomic.AddUint64(&rs.letterCount, 1)
 
+	// Honor the encodings advertised by the consumer, when passed along.
+	acceptEncoding, _ := headers[HeaderAcceptEncoding].(string)
+
 	var data []byte
+	var contentEncoding string
 	var err error
 	if wrapPayload {
-		data, err = CreateWrappedPayload(input, currentCount, metadata, rs.Config.CompressionConfig, rs.Config.EncryptionConfig)
+		data, err = createWrappedPayload(input, currentCount, metadata, acceptEncoding, rs.Config.CompressionConfig, rs.Config.EncryptionConfig)
 		if err != nil {
 			return err
 		}
 	} else {
-		data, err = CreatePayload(input, rs.Config.CompressionConfig, rs.Config.EncryptionConfig)
+		data, contentEncoding, err = createPayload(input, acceptEncoding, rs.Config.CompressionConfig, rs.Config.EncryptionConfig)
 		if err != nil {
 			return err
 		}
@@ -206,12 +297,13 @@ func (rs *RabbitService) Publish(
 			LetterID: currentCount,
 			Body:     data,
 			Envelope: &Envelope{
-				Exchange:     exchangeName,
-				RoutingKey:   routingKey,
-				ContentType:  "application/json",
-				Mandatory:    false,
-				Immediate:    false,
-				DeliveryMode: 2,
+				Exchange:        exchangeName,
+				RoutingKey:      routingKey,
+				ContentType:     "application/json",
+				ContentEncoding: contentEncoding,
+				Mandatory:       false,
+				Immediate:       false,
+				DeliveryMode:    2,
 			},
 		},
 		false)
@@ -294,6 +386,8 @@ func (rs *RabbitService) QueueLetter(letter *Letter) error {
 
 // GetConsumer allows you to get the individual consumers stored in memory.
 func (rs *RabbitService) GetConsumer(consumerName string) (*Consumer, error) {
+	rs.serviceLock.Lock()
+	defer rs.serviceLock.Unlock()
 
 	if consumer, ok := rs.consumers[consumerName]; ok {
 		return consumer, nil
@@ -302,24 +396,107 @@ func (rs *RabbitService) GetConsumer(consumerName string) (*Consumer, error) {
 	return nil, fmt.Errorf("consumer %q was not found", consumerName)
 }
 
+// StartConsumer starts the named Consumer, from the ConsumerConfigs, with the handler. A nil error from the
+// handler acks the message, see Consumer.StartConsumingWithHandler. Stopped by Shutdown(true).
+func (rs *RabbitService) StartConsumer(consumerName string, handler func(*ReceivedMessage) error) error {
+
+	consumer, err := rs.GetConsumer(consumerName)
+	if err != nil {
+		return err
+	}
+
+	return consumer.StartConsumingWithHandler(handler)
+}
+
 // GetConsumerConfig allows you to get the individual consumers' config stored in memory.
 func (rs *RabbitService) GetConsumerConfig(consumerName string) (*ConsumerConfig, error) {
 
-	if consumer, ok := rs.consumers[consumerName]; ok {
-		return consumer.Config, nil
+	consumer, err := rs.GetConsumer(consumerName)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("consumer %q was not found", consumerName)
+	return consumer.Config, nil
 }
 
-// CentralErr yields all the internal errs for sub-processes.
+// MessageAges yields the message age histograms of all consumers keyed by queue name.
+func (rs *RabbitService) MessageAges() map[string]*HistogramSnapshot {
+
+	ages := make(map[string]*HistogramSnapshot)
+	for _, consumer := range rs.consumerList() {
+		if snapshot, ok := ages[consumer.QueueName]; ok {
+			snapshot.merge(consumer.MessageAges())
+			continue
+		}
+
+		ages[consumer.QueueName] = consumer.MessageAges()
+	}
+
+	return ages
+}
+
+// ConsumerCounters yields the counters of all consumers keyed by consumer name, started or not.
+func (rs *RabbitService) ConsumerCounters() map[string]*ConsumerCounters {
+
+	rs.serviceLock.Lock()
+	defer rs.serviceLock.Unlock()
+
+	counters := make(map[string]*ConsumerCounters, len(rs.consumers))
+	for consumerName, consumer := range rs.consumers {
+		counters[consumerName] = consumer.Counters()
+	}
+
+	return counters
+}
+
+// ServiceDump is the PoolDump of the RabbitService's ConnectionPool and of each of its broker targets.
+type ServiceDump struct {
+	ConnectionPool *PoolDump            `json:"ConnectionPool"`
+	BrokerTargets  map[string]*PoolDump `json:"BrokerTargets,omitempty"`
+}
+
+// DumpState takes a JSON serializable snapshot of every pool of the RabbitService, see ConnectionPool.DumpState.
+func (rs *RabbitService) DumpState() *ServiceDump {
+
+	dump := &ServiceDump{ConnectionPool: rs.ConnectionPool.DumpState()}
+
+	if rs.Brokers != nil {
+		dump.BrokerTargets = make(map[string]*PoolDump)
+		for _, name := range rs.Brokers.Names() {
+			if cp, err := rs.Brokers.ConnectionPool(name); err == nil {
+				dump.BrokerTargets[name] = cp.DumpState()
+			}
+		}
+	}
+
+	return dump
+}
+
+// CentralErr yields all the internal errs for sub-processes, each an ErrorEvent. The errors of the ConnectionPool
+// and the consumers are forwarded here.
 func (rs *RabbitService) CentralErr() <-chan error {
-	return rs.centralErr
+	return rs.centralErr.errors
+}
+
+// DroppedErrors is the count of errors discarded because the CentralErr() channel was full.
+func (rs *RabbitService) DroppedErrors() uint64 {
+	return rs.centralErr.droppedCount()
+}
+
+func errorBufferSize(config *ServiceConfig) uint32 {
+
+	if config == nil {
+		return 0
+	}
+
+	return config.ErrorBuffer
 }
 
 // Shutdown stops the service and shuts down the ChannelPool.
 func (rs *RabbitService) Shutdown(stopConsumers bool) {
 
+	rs.runShutdownHooks(ShutdownPreDrain)
+
 	rs.Publisher.Shutdown(false)
 
 	time.Sleep(time.Second)
@@ -327,15 +504,45 @@ func (rs *RabbitService) Shutdown(stopConsumers bool) {
 	time.Sleep(time.Second)
 
 	if stopConsumers {
-		for _, consumer := range rs.consumers {
+		for _, consumer := range rs.consumerList() {
 			err := consumer.StopConsuming(true, true)
 			if err != nil {
-				rs.centralErr <- err
+				rs.centralErr.send(NewErrorEvent(SubsystemConsumer, "stop", 0, err))
 			}
 		}
 	}
 
+	if rs.Outbox != nil {
+		rs.Outbox.StopRepublishing()
+		if err := rs.Outbox.Store.Close(); err != nil {
+			rs.centralErr.report("shutdown", 0, err)
+		}
+	}
+
+	rs.runShutdownHooks(ShutdownPostDrain)
+
+	if rs.Brokers != nil {
+		rs.Brokers.Shutdown()
+	}
+
 	rs.ConnectionPool.Shutdown()
+
+	rs.runShutdownHooks(ShutdownPostClose)
+}
+
+// OnShutdown registers a hook to run at a stage of Shutdown. Hooks of a stage run in registration order.
+// Pre-drain runs before publishing and consuming stop, post-drain before the ConnectionPool closes, and
+// post-close after. Hook errors are sent to CentralErr.
+func (rs *RabbitService) OnShutdown(stage ShutdownStage, name string, hook func() error) {
+	rs.shutdownHooks.add(stage, name, hook)
+}
+
+func (rs *RabbitService) runShutdownHooks(stage ShutdownStage) {
+
+	for _, err := range rs.shutdownHooks.run(stage) {
+		rs.ConnectionPool.logger.Error("%s", err)
+		rs.centralErr.report("shutdown", 0, err)
+	}
 }
 
 func (rs *RabbitService) monitorForShutdown() {
@@ -353,12 +560,27 @@ MonitorLoop:
 	}
 }
 
-func (rs *RabbitService) collectConsumerErrors() {
+// collectErrors forwards the errors of the ConnectionPool and the consumers to CentralErr.
+func (rs *RabbitService) collectErrors() {
 
 MonitorLoop:
 	for {
 
-		for _, consumer := range rs.consumers {
+	PoolLoop:
+		for {
+			if rs.shutdown {
+				break MonitorLoop // Prevent leaking goroutine
+			}
+
+			select {
+			case err := <-rs.ConnectionPool.Errors():
+				rs.centralErr.send(err)
+			default:
+				break PoolLoop
+			}
+		}
+
+		for _, consumer := range rs.consumerList() {
 		IndividualConsumerLoop:
 			for {
 				if rs.shutdown {
@@ -367,7 +589,7 @@ MonitorLoop:
 
 				select {
 				case err := <-consumer.Errors():
-					rs.centralErr <- err
+					rs.centralErr.send(err)
 				default:
 					break IndividualConsumerLoop
 				}
@@ -396,6 +618,24 @@ ProcessLoop:
 	}
 }
 
+// saveToOutbox persists the receipt's failed letter for the Outbox to republish, which ends its retries here.
+func (rs *RabbitService) saveToOutbox(receipt *PublishReceipt) {
+
+	if err := rs.Outbox.Save(receipt.FailedLetter); err != nil {
+		rs.centralErr.send(NewErrorEvent(SubsystemPublisher, "publish", 0, fmt.Errorf("failed to publish letter %d and unable to persist it to the outbox: %w", receipt.LetterID, err)))
+	}
+
+	finalReceipt(receipt)
+}
+
+// finalReceipt calls the failed letter's OnReceipt, deferred by the Publisher while the service still retried it.
+func finalReceipt(receipt *PublishReceipt) {
+
+	if receipt.FailedLetter.OnReceipt != nil {
+		receipt.FailedLetter.OnReceipt(receipt)
+	}
+}
+
 func (rs *RabbitService) processPublishReceipts() {
 
 ProcessLoop:
@@ -407,13 +647,23 @@ ProcessLoop:
 		select {
 		case receipt := <-rs.Publisher.PublishReceipts():
 			if !receipt.Success {
-				if receipt.FailedLetter != nil {
-					rs.centralErr <- fmt.Errorf("failed to publish letter %d... retrying", receipt.LetterID)
+				if receipt.FailedLetter != nil && rs.Outbox != nil && receipt.FailedLetter.requeues >= rs.Outbox.retryAttempts {
+					rs.saveToOutbox(receipt) // retried enough, the broker is likely down
+				} else if receipt.FailedLetter != nil {
+					receipt.FailedLetter.requeues++
+
+					rs.ConnectionPool.logger.Warn("failed to publish letter %d, requeueing for retry", receipt.LetterID)
+					rs.centralErr.send(NewErrorEvent(SubsystemPublisher, "publish", 0, fmt.Errorf("failed to publish letter %d... retrying", receipt.LetterID)))
 					if ok := rs.Publisher.QueueLetter(receipt.FailedLetter); !ok {
-						rs.centralErr <- fmt.Errorf("failed to publish a letter %d and autopublisher has been shutdown", receipt.LetterID)
+						if rs.Outbox != nil {
+							rs.saveToOutbox(receipt)
+						} else {
+							rs.centralErr.send(NewErrorEvent(SubsystemPublisher, "publish", 0, fmt.Errorf("failed to publish a letter %d and autopublisher has been shutdown", receipt.LetterID)))
+							finalReceipt(receipt)
+						}
 					}
 				} else {
-					rs.centralErr <- fmt.Errorf("failed to publish a letter %d and unable to retry as a copy of the letter was not received", receipt.LetterID)
+					rs.centralErr.send(NewErrorEvent(SubsystemPublisher, "publish", 0, fmt.Errorf("failed to publish a letter %d and unable to retry as a copy of the letter was not received", receipt.LetterID)))
 				}
 
 			}
@@ -433,7 +683,7 @@ ProcessLoop:
 		}
 
 		select {
-		case err := <-rs.centralErr:
+		case err := <-rs.centralErr.errors:
 			processError(err)
 		default:
 			time.Sleep(rs.monitorSleepInterval)
@@ -450,7 +700,7 @@ ProcessLoop:
 			break ProcessLoop // Prevent leaking goroutine
 		}
 		select {
-		case err := <-rs.centralErr:
+		case err := <-rs.centralErr.errors:
 			fmt.Printf("TCR Central Err: %s\r\n", err)
 		default:
 			time.Sleep(rs.monitorSleepInterval)
@@ -0,0 +1,152 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned (or sent in a PublishReceipt) when a non-blocking Publisher is over its rate limit.
+var ErrRateLimited = errors.New("publish rate limited")
+
+// RateLimiter is a token bucket limiting messages per second and/or bytes per second.
+type RateLimiter struct {
+	messageRate   float64
+	messageBurst  float64
+	messageTokens float64
+	byteRate      float64
+	byteBurst     float64
+	byteTokens    float64
+	nonBlocking   bool
+	last          time.Time
+	limitLock     *sync.Mutex
+}
+
+// NewRateLimiter creates a RateLimiter from config. Returns nil when no limit is configured.
+func NewRateLimiter(config *RateLimitConfig) *RateLimiter {
+
+	if config == nil || (config.MessagesPerSecond == 0 && config.BytesPerSecond == 0) {
+		return nil
+	}
+
+	rl := &RateLimiter{
+		messageRate:  config.MessagesPerSecond,
+		messageBurst: float64(config.MessageBurst),
+		byteRate:     float64(config.BytesPerSecond),
+		byteBurst:    float64(config.ByteBurst),
+		nonBlocking:  config.NonBlocking,
+		last:         time.Now(),
+		limitLock:    &sync.Mutex{},
+	}
+
+	if rl.messageBurst == 0 {
+		rl.messageBurst = rl.messageRate
+	}
+
+	if rl.messageBurst < 1 {
+		rl.messageBurst = 1
+	}
+
+	if rl.byteBurst == 0 {
+		rl.byteBurst = rl.byteRate
+	}
+
+	rl.messageTokens = rl.messageBurst
+	rl.byteTokens = rl.byteBurst
+
+	return rl
+}
+
+// Allow takes tokens for a message of size bytes and reports whether it was within the limit.
+func (rl *RateLimiter) Allow(size int) bool {
+	return rl.reserve(size) == 0
+}
+
+// Wait blocks until a message of size bytes is within the limit or the context is done.
+func (rl *RateLimiter) Wait(ctx context.Context, size int) error {
+
+	for {
+		delay := rl.reserve(size)
+		if delay == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Take applies the configured behavior: Wait when blocking, otherwise Allow or ErrRateLimited.
+func (rl *RateLimiter) Take(ctx context.Context, size int) error {
+
+	if rl.nonBlocking {
+		if !rl.Allow(size) {
+			return ErrRateLimited
+		}
+
+		return nil
+	}
+
+	return rl.Wait(ctx, size)
+}
+
+// reserve consumes tokens and returns 0, or returns how long until enough tokens are available.
+// A message larger than the byte burst waits for a full bucket instead of waiting forever.
+func (rl *RateLimiter) reserve(size int) time.Duration {
+	rl.limitLock.Lock()
+	defer rl.limitLock.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(rl.last).Seconds()
+	rl.last = now
+
+	var delay float64
+	if rl.messageRate > 0 {
+		rl.messageTokens = refill(rl.messageTokens, rl.messageBurst, rl.messageRate, elapsed)
+		if rl.messageTokens < 1 {
+			delay = (1 - rl.messageTokens) / rl.messageRate
+		}
+	}
+
+	needed := float64(size)
+	if rl.byteRate > 0 {
+		if needed > rl.byteBurst {
+			needed = rl.byteBurst
+		}
+
+		rl.byteTokens = refill(rl.byteTokens, rl.byteBurst, rl.byteRate, elapsed)
+		if rl.byteTokens < needed {
+			if byteDelay := (needed - rl.byteTokens) / rl.byteRate; byteDelay > delay {
+				delay = byteDelay
+			}
+		}
+	}
+
+	if delay > 0 {
+		return time.Duration(delay*float64(time.Second)) + time.Millisecond
+	}
+
+	if rl.messageRate > 0 {
+		rl.messageTokens--
+	}
+
+	if rl.byteRate > 0 {
+		rl.byteTokens -= needed
+	}
+
+	return 0
+}
+
+func refill(tokens, burst, rate, elapsed float64) float64 {
+
+	tokens += rate * elapsed
+	if tokens > burst {
+		return burst
+	}
+
+	return tokens
+}
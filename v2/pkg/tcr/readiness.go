@@ -0,0 +1,98 @@
+package tcr
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Ready reports whether the pool is in service with every connection open and at least MinReady cached
+// channels. Missing channels, with LazyChannels, MaxChannelIdleTime, or after terminal errors, are created here,
+// but only while the connections are open so Ready never waits out an outage.
+func (cp *ConnectionPool) Ready() bool {
+
+	if cp.State() != PoolReady || !cp.connectionsOpen() {
+		return false
+	}
+
+	minReady := cp.minReady()
+	for atomic.LoadUint64(&cp.channelCount) < minReady {
+		chanHost, _ := cp.createLazyChannel()
+		if chanHost == nil {
+			break
+		}
+
+		cp.cacheChannel(chanHost)
+	}
+
+	return atomic.LoadUint64(&cp.channelCount) >= minReady
+}
+
+// WaitForReady blocks until Ready, so services can hold off accepting traffic until the broker is reachable.
+// Returns ErrPoolClosed once Shutdown has begun, or an error wrapping ctx.Err() when ctx is done first.
+func (cp *ConnectionPool) WaitForReady(ctx context.Context) error {
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if cp.closed() {
+			return ErrPoolClosed
+		}
+
+		if cp.Ready() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf(
+				"connectionpool %s not ready, %d of %d channels: %w",
+				cp.Config.ConnectionName,
+				atomic.LoadUint64(&cp.channelCount),
+				cp.minReady(),
+				ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// minReady is MinReady, falling back to MinChannelCount then 1, capped at MaxCacheChannelCount.
+func (cp *ConnectionPool) minReady() uint64 {
+
+	minReady := cp.Config.MinReady
+	if minReady == 0 {
+		minReady = cp.Config.MinChannelCount
+	}
+
+	if minReady == 0 {
+		minReady = 1
+	}
+
+	if limit := atomic.LoadUint64(&cp.channelLimit); minReady > limit {
+		minReady = limit
+	}
+
+	return minReady
+}
+
+// connectionsOpen reports whether every connection, and so every cached channel's connection, is open.
+func (cp *ConnectionPool) connectionsOpen() bool {
+
+	cp.poolRWLock.RLock()
+	connectionHosts := cp.connectionHosts
+	cp.poolRWLock.RUnlock()
+
+	if len(connectionHosts) == 0 {
+		return false
+	}
+
+	for _, connHost := range connectionHosts {
+		if connHost.closed() || cp.isConnectionFlagged(connHost.ConnectionID) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,46 @@
+package tcr
+
+import "time"
+
+// ReceiptSink records the outcome of every publish, for reconciliation jobs that need to know which letters
+// made it. Sinks are called synchronously on the publishing goroutine, before PublishAndWait returns or the
+// PublishReceipt is sent, so a slow sink slows publishing. Hand the outcome off when persisting it takes a while.
+type ReceiptSink interface {
+	RecordReceipt(letterID uint64, success bool, err error, confirmedAt time.Time)
+}
+
+// ReceiptSinkFunc lets an ordinary func be a ReceiptSink.
+type ReceiptSinkFunc func(letterID uint64, success bool, err error, confirmedAt time.Time)
+
+// RecordReceipt implements ReceiptSink.
+func (sink ReceiptSinkFunc) RecordReceipt(letterID uint64, success bool, err error, confirmedAt time.Time) {
+	sink(letterID, success, err, confirmedAt)
+}
+
+// SetReceiptSink sets the ReceiptSink called with every publish outcome, nil stops calling one.
+func (pub *Publisher) SetReceiptSink(sink ReceiptSink) {
+	pub.pubRWLock.Lock()
+	defer pub.pubRWLock.Unlock()
+
+	pub.receiptSink = sink
+}
+
+// recordReceipt calls the ReceiptSink, when set, with the letter's outcome. confirmedAt is when the broker
+// confirmed it, or when it was sent without confirmation, and zero when the publish failed.
+func (pub *Publisher) recordReceipt(letter *Letter, err error) {
+
+	pub.pubRWLock.RLock()
+	sink := pub.receiptSink
+	pub.pubRWLock.RUnlock()
+
+	if sink == nil {
+		return
+	}
+
+	if err != nil {
+		sink.RecordReceipt(letter.LetterID, false, err, time.Time{})
+		return
+	}
+
+	sink.RecordReceipt(letter.LetterID, true, nil, time.Now().UTC())
+}
@@ -0,0 +1,145 @@
+package tcr
+
+import (
+	"fmt"
+	"time"
+)
+
+// recycleConnections replaces connections older than MaxConnectionLifetime until stopped. At most one is
+// recycled per tick, so connections created together are spread out instead of all moving at once.
+func (cp *ConnectionPool) recycleConnections(stop chan struct{}) {
+
+	interval := cp.connectionLifetime / time.Duration(2*cp.Config.MaxConnectionCount)
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if connHost := cp.expiredConnection(); connHost != nil {
+				cp.recycleConnection(connHost, fmt.Sprintf("after %s", cp.connectionLifetime), stop)
+			}
+		}
+	}
+}
+
+// expiredConnection is the oldest open connection past MaxConnectionLifetime, nil when there is none.
+func (cp *ConnectionPool) expiredConnection() *ConnectionHost {
+
+	cp.poolRWLock.RLock()
+	connectionHosts := cp.connectionHosts
+	cp.poolRWLock.RUnlock()
+
+	var oldest *ConnectionHost
+	var oldestAt time.Time
+	for _, connHost := range connectionHosts {
+		connHost.stateLock.Lock()
+		connectedAt := connHost.connectedAt
+		connHost.stateLock.Unlock()
+
+		if time.Since(connectedAt) < cp.connectionLifetime || connHost.Connection.IsClosed() {
+			continue
+		}
+
+		if oldest == nil || connectedAt.Before(oldestAt) {
+			oldest, oldestAt = connHost, connectedAt
+		}
+	}
+
+	return oldest
+}
+
+// recycleConnection opens the connection's replacement, moves the cached channels over, and closes the old
+// connection once none of its channels are left or RecycleGracePeriod has passed. The reason is logged and sent
+// with the EventConnectionRecycled. Channels in use move when
+// they are returned, those still out at the deadline (a Consumer's) are rebuilt like any other channel failure.
+func (cp *ConnectionPool) recycleConnection(connHost *ConnectionHost, reason string, stop chan struct{}) {
+
+	old, err := connHost.replace()
+	if err != nil {
+		cp.logger.Warn("connectionpool %s unable to recycle connection %d, retrying later: %s", cp.Config.ConnectionName, connHost.ConnectionID, err)
+		return
+	}
+
+	cp.logger.Info("connectionpool %s recycling connection %d %s", cp.Config.ConnectionName, connHost.ConnectionID, reason)
+	cp.notify(EventConnectionRecycled, connHost.ConnectionID, fmt.Sprintf("connection recycled %s", reason))
+
+	cp.migrateCachedChannels()
+
+	deadline := time.NewTimer(cp.recycleGracePeriod)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+WaitLoop:
+	for cp.staleChannels(connHost) > 0 {
+		select {
+		case <-stop:
+			break WaitLoop
+		case <-deadline.C:
+			cp.logger.Warn("connectionpool %s closing recycled connection %d with channels still in use", cp.Config.ConnectionName, connHost.ConnectionID)
+			break WaitLoop
+		case <-ticker.C:
+			cp.migrateCachedChannels()
+		}
+	}
+
+	defer func() { _ = recover() }()
+	_ = old.Close()
+}
+
+// migrateCachedChannels rebuilds the stale channels sitting in the cache on their connection's replacement.
+func (cp *ConnectionPool) migrateCachedChannels() {
+
+	for i := len(cp.channels); i > 0 && !cp.closed(); i-- {
+		var chanHost *ChannelHost
+		select {
+		case chanHost = <-cp.channels:
+		default:
+			return
+		}
+
+		if chanHost.stale() && cp.migrateChannel(chanHost) != nil {
+			cp.dropChannel(chanHost)
+			continue
+		}
+
+		cp.channels <- chanHost // keeps its cachedAt
+	}
+}
+
+// migrateChannel closes the channel and makes it again on its ConnectionHost's current connection.
+func (cp *ConnectionPool) migrateChannel(chanHost *ChannelHost) error {
+
+	cp.logger.Debug("connectionpool %s moving channel %d to connection %d's replacement", cp.Config.ConnectionName, chanHost.ID, chanHost.ConnectionID)
+
+	func() {
+		defer func() { _ = recover() }()
+		chanHost.Close()
+	}()
+
+	return cp.reconnectChannel(chanHost)
+}
+
+// staleChannels counts the connection's cached channels still made on a connection it has replaced.
+func (cp *ConnectionPool) staleChannels(connHost *ConnectionHost) int {
+
+	cp.poolRWLock.RLock()
+	defer cp.poolRWLock.RUnlock()
+
+	count := 0
+	for _, chanHost := range cp.cachedChannels {
+		if chanHost.connHost == connHost && chanHost.stale() {
+			count++
+		}
+	}
+
+	return count
+}
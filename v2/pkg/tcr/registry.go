@@ -0,0 +1,160 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RegisterOptions configures the topology and Consumer of a registered handler. All fields are optional.
+type RegisterOptions struct {
+	ConsumerName     string             // defaults to the queue name, a ConsumerConfigs entry of this name is used (and honors Enabled) when present
+	Queue            *Queue             // defaults to a durable classic queue, Name defaults to the queue name
+	Exchanges        []*Exchange        // declared before any queue
+	QueueBindings    []*QueueBinding    // QueueName defaults to the queue name
+	ExchangeBindings []*ExchangeBinding // bound after queues
+	ConsumerConfig   *ConsumerConfig    // used when no ConsumerConfigs entry matches, QueueName and ConsumerName are set for you
+}
+
+type registration struct {
+	queueName string
+	handler   func(*ReceivedMessage)
+	options   RegisterOptions
+}
+
+var registrations []*registration
+var registrationErrs []error
+var registryLock = &sync.Mutex{}
+
+// Register adds a handler for a queue to be provisioned and consumed by Start. Intended to be called from init.
+// A nil handler or a queue already registered is skipped, and the error is returned by the next Start.
+func Register(queueName string, handler func(*ReceivedMessage), options *RegisterOptions) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if handler == nil {
+		registrationErrs = append(registrationErrs, fmt.Errorf("register handler is nil for queue %q", queueName))
+		return
+	}
+
+	for _, existing := range registrations {
+		if existing.queueName == queueName {
+			registrationErrs = append(registrationErrs, fmt.Errorf("register called twice for queue %q", queueName))
+			return
+		}
+	}
+
+	reg := &registration{queueName: queueName, handler: handler}
+	if options != nil {
+		reg.options = *options
+	}
+
+	registrations = append(registrations, reg)
+}
+
+// Start creates a RabbitService from the seasoning, builds the topology of every registered handler, and starts
+// a Consumer per handler. The service, including its consumers, is shut down when ctx is done. The errors of
+// Register calls since the last Start are returned, and cleared, before anything is created.
+func Start(ctx context.Context, seasoning *RabbitSeasoning) (*RabbitService, error) {
+
+	registryLock.Lock()
+	regs := append([]*registration{}, registrations...)
+	errs := registrationErrs
+	registrationErrs = nil
+	registryLock.Unlock()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	rs, err := NewRabbitService(seasoning, "", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = rs.Topologer.BuildToplogy(registeredTopology(regs), false); err != nil {
+		rs.Shutdown(true)
+		return nil, fmt.Errorf("unable to build registered topology: %w", err)
+	}
+
+	for _, reg := range regs {
+		rs.registeredConsumer(reg).StartConsumingWithAction(reg.handler)
+	}
+
+	go func() {
+		<-ctx.Done()
+		rs.Shutdown(true)
+	}()
+
+	return rs, nil
+}
+
+// registeredTopology merges the registrations into one TopologyConfig so exchanges exist before any binding.
+func registeredTopology(regs []*registration) *TopologyConfig {
+
+	topology := &TopologyConfig{}
+	for _, reg := range regs {
+
+		queue := &Queue{Durable: true}
+		if reg.options.Queue != nil {
+			copied := *reg.options.Queue
+			queue = &copied
+		}
+
+		if queue.Name == "" {
+			queue.Name = reg.queueName
+		}
+
+		topology.Exchanges = append(topology.Exchanges, reg.options.Exchanges...)
+		topology.Queues = append(topology.Queues, queue)
+		topology.ExchangeBindings = append(topology.ExchangeBindings, reg.options.ExchangeBindings...)
+
+		for _, binding := range reg.options.QueueBindings {
+			copied := *binding
+			if copied.QueueName == "" {
+				copied.QueueName = reg.queueName
+			}
+
+			topology.QueueBindings = append(topology.QueueBindings, &copied)
+		}
+	}
+
+	return topology
+}
+
+// registeredConsumer finds the Consumer configured under the registration's consumer name or creates one.
+func (rs *RabbitService) registeredConsumer(reg *registration) *Consumer {
+
+	consumerName := reg.options.ConsumerName
+	if consumerName == "" {
+		consumerName = reg.queueName
+	}
+
+	rs.serviceLock.Lock()
+	defer rs.serviceLock.Unlock()
+
+	if consumer, ok := rs.consumers[consumerName]; ok {
+		return consumer // a disabled config entry keeps the handler from starting
+	}
+
+	config := &ConsumerConfig{}
+	if reg.options.ConsumerConfig != nil {
+		copied := *reg.options.ConsumerConfig
+		config = &copied
+	}
+
+	config.Enabled = true
+	config.QueueName = rs.naming.Queue(reg.queueName)
+	config.ConsumerName = consumerName
+
+	consumer := NewConsumerFromConfig(config, rs.ConnectionPool)
+	if hostName, err := os.Hostname(); err == nil {
+		consumer.ConsumerName = hostName + "-" + consumer.ConsumerName
+	}
+
+	rs.consumers[consumerName] = consumer
+
+	return consumer
+}
@@ -0,0 +1,250 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+)
+
+// ReloadResult lists the settings a ReloadConfig found changed, named by their path in the config (like
+// PoolConfig.MaxCacheChannelCount). Applied settings are live, the ones in RequiresRestart keep their current
+// values until the pool, consumer, or service is recreated.
+type ReloadResult struct {
+	Applied         []string
+	RequiresRestart []string
+}
+
+// RestartRequired reports whether any changed setting only takes effect after a restart.
+func (rr *ReloadResult) RestartRequired() bool {
+	return len(rr.RequiresRestart) > 0
+}
+
+// merge adds the settings of other, prefixing their names.
+func (rr *ReloadResult) merge(prefix string, other *ReloadResult) {
+
+	for _, setting := range other.Applied {
+		rr.Applied = append(rr.Applied, prefix+setting)
+	}
+
+	for _, setting := range other.RequiresRestart {
+		rr.RequiresRestart = append(rr.RequiresRestart, prefix+setting)
+	}
+}
+
+// changedSettings names the exported fields that differ between two configs of the same struct type, descending
+// into nested config structs. Fields not loaded from JSON (tagged "-") are skipped.
+func changedSettings(prefix string, current, next reflect.Value) []string {
+
+	var changed []string
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		name := prefix + field.Name
+		currentValue, nextValue := current.Field(i), next.Field(i)
+
+		if field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct &&
+			!currentValue.IsNil() && !nextValue.IsNil() {
+			changed = append(changed, changedSettings(name+".", currentValue.Elem(), nextValue.Elem())...)
+			continue
+		}
+
+		if !reflect.DeepEqual(currentValue.Interface(), nextValue.Interface()) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
+
+// ReloadConfig applies the settings of config that can change on a running pool and reports the rest as requiring
+// a restart. MaxCacheChannelCount is live up to the count the pool was created with: idle channels over a lowered
+// count are closed right away and the rest as they are returned, a raised count creates its channels before
+// returning, unless channels are created on demand.
+func (cp *ConnectionPool) ReloadConfig(config *PoolConfig) (*ReloadResult, error) {
+
+	if config == nil {
+		return nil, errors.New("can't reload a nil pool config")
+	}
+
+	if cp.closed() {
+		return nil, ErrPoolClosed
+	}
+
+	current := cp.Config
+	current.MaxCacheChannelCount = atomic.LoadUint64(&cp.channelLimit)
+
+	result := &ReloadResult{}
+	for _, setting := range changedSettings("", reflect.ValueOf(current), reflect.ValueOf(*config)) {
+		switch {
+		case setting == "MaxCacheChannelCount" && config.MaxCacheChannelCount > 0 &&
+			config.MaxCacheChannelCount <= uint64(cap(cp.channels)):
+			cp.resizeChannels(config.MaxCacheChannelCount)
+			result.Applied = append(result.Applied, setting)
+		default:
+			result.RequiresRestart = append(result.RequiresRestart, setting)
+		}
+	}
+
+	if len(result.Applied) > 0 {
+		cp.logger.Info("connectionpool %s reloaded %v", cp.Config.ConnectionName, result.Applied)
+	}
+
+	return result, nil
+}
+
+// resizeChannels changes the channel limit, closing idle channels over it or creating channels up to it.
+func (cp *ConnectionPool) resizeChannels(limit uint64) {
+
+	atomic.StoreUint64(&cp.channelLimit, limit)
+
+TrimLoop:
+	for cp.overChannelLimit() {
+		select {
+		case chanHost := <-cp.channels:
+			cp.retireChannel(chanHost)
+		default:
+			atomic.AddUint64(&cp.channelCount, 1) // the rest are in use, retired by ReturnChannel
+			break TrimLoop
+		}
+	}
+
+	if cp.Config.LazyChannels || cp.maxChannelIdle > 0 {
+		return
+	}
+
+	for !cp.closed() {
+		count := atomic.LoadUint64(&cp.channelCount)
+		if count >= limit {
+			return
+		}
+
+		if atomic.CompareAndSwapUint64(&cp.channelCount, count, count+1) {
+			chanHost, err := cp.createCacheChannel(atomic.AddUint64(&cp.channelID, 1) - 1)
+			if err != nil {
+				atomic.AddUint64(&cp.channelCount, ^uint64(0)) // GetChannelFromPool creates it on demand
+				return
+			}
+
+			cp.cacheChannel(chanHost)
+		}
+	}
+}
+
+// ReloadConfig applies the settings of config that can change on a running Consumer and reports the rest as
+// requiring a restart. QosCountOverride is re-issued on the consuming channel, QuarantineConfig.MaxProcessAttempts
+// applies to the next delivery, and RetryConfig.MaxAttempts can be lowered (raising it needs new retry queues).
+func (con *Consumer) ReloadConfig(config *ConsumerConfig) *ReloadResult {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	result := &ReloadResult{}
+	if config == nil {
+		return result
+	}
+
+	reloaded := *con.Config
+
+	for _, setting := range changedSettings("", reflect.ValueOf(*con.Config), reflect.ValueOf(*config)) {
+		switch {
+		case setting == "QosCountOverride":
+			con.qosCountOverride = config.QosCountOverride
+			reloaded.QosCountOverride = config.QosCountOverride
+
+		FlushLoop:
+			for {
+				select {
+				case <-con.qosChange:
+				default:
+					break FlushLoop
+				}
+			}
+			con.qosChange <- config.QosCountOverride
+
+		case setting == "RetryConfig.MaxAttempts" && con.retry != nil &&
+			config.RetryConfig.MaxAttempts > 0 && int(config.RetryConfig.MaxAttempts) <= len(con.retry.delays):
+			atomic.StoreUint32(&con.retry.maxAttempts, config.RetryConfig.MaxAttempts)
+			retryConfig := *reloaded.RetryConfig
+			retryConfig.MaxAttempts = config.RetryConfig.MaxAttempts
+			reloaded.RetryConfig = &retryConfig
+
+		case setting == "QuarantineConfig.MaxProcessAttempts" && con.quarantine != nil &&
+			config.QuarantineConfig.MaxProcessAttempts > 0:
+			atomic.StoreUint32(&con.quarantine.maxAttempts, config.QuarantineConfig.MaxProcessAttempts)
+			quarantineConfig := *reloaded.QuarantineConfig
+			quarantineConfig.MaxProcessAttempts = config.QuarantineConfig.MaxProcessAttempts
+			reloaded.QuarantineConfig = &quarantineConfig
+
+		default:
+			result.RequiresRestart = append(result.RequiresRestart, setting)
+			continue
+		}
+
+		result.Applied = append(result.Applied, setting)
+	}
+
+	con.Config = &reloaded
+
+	return result
+}
+
+// ReloadConfig applies the settings of config that can change while the service runs, to its ConnectionPool and
+// Consumers, and reports the rest as requiring a restart. Only the pool and consumer settings listed on their own
+// ReloadConfig are live, everything else (added or removed consumers included) needs the service recreated.
+func (rs *RabbitService) ReloadConfig(config *RabbitSeasoning) (*ReloadResult, error) {
+
+	if config == nil || config.PoolConfig == nil {
+		return nil, errors.New("can't reload a nil config or pool config")
+	}
+
+	rs.serviceLock.Lock()
+	defer rs.serviceLock.Unlock()
+
+	result := &ReloadResult{}
+
+	poolResult, err := rs.ConnectionPool.ReloadConfig(config.PoolConfig)
+	if err != nil {
+		return nil, err
+	}
+	result.merge("PoolConfig.", poolResult)
+
+	for consumerName, consumerConfig := range config.ConsumerConfigs {
+		prefix := fmt.Sprintf("ConsumerConfigs[%s]", consumerName)
+
+		consumer, ok := rs.consumers[consumerName]
+		if !ok || consumerConfig == nil {
+			result.RequiresRestart = append(result.RequiresRestart, prefix)
+			continue
+		}
+
+		result.merge(prefix+".", consumer.ReloadConfig(consumerConfig))
+	}
+
+	for consumerName := range rs.consumers {
+		if _, ok := config.ConsumerConfigs[consumerName]; !ok {
+			result.RequiresRestart = append(result.RequiresRestart, fmt.Sprintf("ConsumerConfigs[%s]", consumerName))
+		}
+	}
+
+	// Everything else is only read when the service is created.
+	current, next := *rs.Config, *config
+	current.PoolConfig, next.PoolConfig = nil, nil
+	current.ConsumerConfigs, next.ConsumerConfigs = nil, nil
+
+	if current.EncryptionConfig != nil && next.EncryptionConfig != nil {
+		encryption := *next.EncryptionConfig
+		encryption.Hashkey = current.EncryptionConfig.Hashkey // derived from the passphrase, not the file
+		next.EncryptionConfig = &encryption
+	}
+
+	result.RequiresRestart = append(result.RequiresRestart, changedSettings("", reflect.ValueOf(current), reflect.ValueOf(next))...)
+
+	sort.Strings(result.Applied)
+	sort.Strings(result.RequiresRestart)
+
+	return result, nil
+}
@@ -0,0 +1,169 @@
+package tcr
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// DispositionNone indicates the handler never acked, nacked, or rejected the message.
+	DispositionNone = "none"
+
+	// DispositionAck indicates the message was acknowledged.
+	DispositionAck = "ack"
+
+	// DispositionNack indicates the message was negatively acknowledged.
+	DispositionNack = "nack"
+
+	// DispositionReject indicates the message was rejected.
+	DispositionReject = "reject"
+)
+
+// RecordedDelivery is a serializable copy of an amqp.Delivery for replaying through a Consumer without a broker.
+type RecordedDelivery struct {
+	Exchange      string     `json:"Exchange"`
+	RoutingKey    string     `json:"RoutingKey"`
+	ContentType   string     `json:"ContentType,omitempty"`
+	MessageID     string     `json:"MessageID,omitempty"`
+	CorrelationID string     `json:"CorrelationID,omitempty"`
+	Timestamp     time.Time  `json:"Timestamp,omitempty"`
+	Redelivered   bool       `json:"Redelivered"`
+	DeliveryTag   uint64     `json:"DeliveryTag"`
+	Headers       amqp.Table `json:"Headers,omitempty"`
+	Body          []byte     `json:"Body"` // base64 in JSON
+}
+
+// ReplayResult is the outcome of a single replayed delivery, suitable for golden file comparisons.
+type ReplayResult struct {
+	DeliveryTag uint64 `json:"DeliveryTag"`
+	RoutingKey  string `json:"RoutingKey"`
+	Disposition string `json:"Disposition"`
+	Requeue     bool   `json:"Requeue"`
+}
+
+// NewRecordedDelivery copies an amqp.Delivery for later replay.
+func NewRecordedDelivery(delivery *amqp.Delivery) *RecordedDelivery {
+
+	return &RecordedDelivery{
+		Exchange:      delivery.Exchange,
+		RoutingKey:    delivery.RoutingKey,
+		ContentType:   delivery.ContentType,
+		MessageID:     delivery.MessageId,
+		CorrelationID: delivery.CorrelationId,
+		Timestamp:     delivery.Timestamp,
+		Redelivered:   delivery.Redelivered,
+		DeliveryTag:   delivery.DeliveryTag,
+		Headers:       delivery.Headers,
+		Body:          delivery.Body,
+	}
+}
+
+// LoadRecordedDeliveries opens a file.json (array of RecordedDelivery) for replay.
+func LoadRecordedDeliveries(fileNamePath string) ([]*RecordedDelivery, error) {
+
+	byteValue, err := ioutil.ReadFile(fileNamePath)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*RecordedDelivery, 0)
+	var json = jsoniter.ConfigFastest
+	err = json.Unmarshal(byteValue, &deliveries)
+
+	return deliveries, err
+}
+
+// SaveRecordedDeliveries writes the deliveries to a file.json fixture.
+func SaveRecordedDeliveries(fileNamePath string, deliveries []*RecordedDelivery) error {
+
+	var json = jsoniter.ConfigFastest
+	data, err := json.Marshal(deliveries)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fileNamePath, data, 0644)
+}
+
+// Replay feeds recorded deliveries, in order, through the same conversion and handling path as live consuming
+// and reports how the action disposed of each message. No broker connection is used.
+func (con *Consumer) Replay(deliveries []*RecordedDelivery, action func(*ReceivedMessage)) ([]*ReplayResult, error) {
+
+	if action == nil {
+		return nil, errors.New("can't replay deliveries without an action")
+	}
+
+	results := make([]*ReplayResult, len(deliveries))
+	for i, recorded := range deliveries {
+
+		deliveryTag := recorded.DeliveryTag
+		if deliveryTag == 0 {
+			deliveryTag = uint64(i + 1)
+		}
+
+		acknowledger := &replayAcknowledger{disposition: DispositionNone, ackLock: &sync.Mutex{}}
+		delivery := &amqp.Delivery{
+			Acknowledger:  acknowledger,
+			Exchange:      recorded.Exchange,
+			RoutingKey:    recorded.RoutingKey,
+			ContentType:   recorded.ContentType,
+			MessageId:     recorded.MessageID,
+			CorrelationId: recorded.CorrelationID,
+			Timestamp:     recorded.Timestamp,
+			Redelivered:   recorded.Redelivered,
+			DeliveryTag:   deliveryTag,
+			Headers:       recorded.Headers,
+			Body:          recorded.Body,
+		}
+
+		con.handleDelivery(delivery, acknowledger, action)
+
+		acknowledger.ackLock.Lock()
+		results[i] = &ReplayResult{
+			DeliveryTag: deliveryTag,
+			RoutingKey:  recorded.RoutingKey,
+			Disposition: acknowledger.disposition,
+			Requeue:     acknowledger.requeue,
+		}
+		acknowledger.ackLock.Unlock()
+	}
+
+	return results, nil
+}
+
+// replayAcknowledger records the disposition of a replayed delivery.
+type replayAcknowledger struct {
+	disposition string
+	requeue     bool
+	ackLock     *sync.Mutex
+}
+
+func (ra *replayAcknowledger) Ack(tag uint64, multiple bool) error {
+	return ra.record(DispositionAck, false)
+}
+
+func (ra *replayAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	return ra.record(DispositionNack, requeue)
+}
+
+func (ra *replayAcknowledger) Reject(tag uint64, requeue bool) error {
+	return ra.record(DispositionReject, requeue)
+}
+
+func (ra *replayAcknowledger) record(disposition string, requeue bool) error {
+	ra.ackLock.Lock()
+	defer ra.ackLock.Unlock()
+
+	if ra.disposition != DispositionNone {
+		return errors.New("delivery was already acknowledged")
+	}
+
+	ra.disposition = disposition
+	ra.requeue = requeue
+	return nil
+}
@@ -0,0 +1,161 @@
+package tcr
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const (
+	// HeaderRetryCount is the number of times a message has been sent back for retry.
+	HeaderRetryCount = "x-retry-count"
+
+	// HeaderRetryError is the handler error of the most recent attempt.
+	HeaderRetryError = "x-retry-error"
+)
+
+// retryPolicy routes failed messages through delayed retry queues and finally to a parking lot queue.
+// Each retry queue holds messages for its TTL and then dead letters them back onto the consumed queue.
+type retryPolicy struct {
+	queueName      string
+	parkingLot     string
+	maxAttempts    uint32
+	delays         []time.Duration // delay of attempt n at index n-1
+	publishTimeout time.Duration
+}
+
+// newRetryPolicy creates a retryPolicy for the queue from config. Returns nil when not enabled.
+func newRetryPolicy(queueName string, config *RetryConfig) *retryPolicy {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	rp := &retryPolicy{
+		queueName:      queueName,
+		parkingLot:     config.ParkingLotQueue,
+		maxAttempts:    config.MaxAttempts,
+		publishTimeout: time.Duration(config.PublishTimeOutInterval) * time.Millisecond,
+	}
+
+	if rp.parkingLot == "" {
+		rp.parkingLot = queueName + ".parkinglot"
+	}
+
+	if rp.maxAttempts == 0 {
+		rp.maxAttempts = 3
+	}
+
+	if rp.publishTimeout == 0 {
+		rp.publishTimeout = 5 * time.Second
+	}
+
+	initialDelay := time.Duration(config.InitialDelay) * time.Millisecond
+	if initialDelay == 0 {
+		initialDelay = time.Second
+	}
+
+	multiplier := config.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	backoff := &ExponentialBackoff{
+		Initial:    initialDelay,
+		Multiplier: multiplier,
+		Max:        time.Duration(config.MaxDelay) * time.Millisecond,
+	}
+
+	for attempt := uint32(1); attempt <= rp.maxAttempts; attempt++ {
+		rp.delays = append(rp.delays, backoff.Delay(int(attempt)).Round(time.Millisecond))
+	}
+
+	return rp
+}
+
+// retryQueue is named after its delay so attempts sharing a delay share a queue, and changing delays
+// creates new queues rather than conflicting with the TTL of existing ones.
+func (rp *retryPolicy) retryQueue(attempt uint32) string {
+	return fmt.Sprintf("%s.retry.%s", rp.queueName, rp.delays[attempt-1])
+}
+
+// topology declares every retry queue and the parking lot queue.
+func (rp *retryPolicy) topology() *TopologyConfig {
+
+	topology := &TopologyConfig{}
+	declared := make(map[string]bool)
+
+	for attempt := uint32(1); attempt <= uint32(len(rp.delays)); attempt++ {
+		name := rp.retryQueue(attempt)
+		if declared[name] {
+			continue
+		}
+		declared[name] = true
+
+		topology.Queues = append(topology.Queues, &Queue{
+			Name:    name,
+			Durable: true,
+			Args: amqp.Table{
+				"x-message-ttl":             int64(rp.delays[attempt-1] / time.Millisecond),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": rp.queueName,
+			},
+		})
+	}
+
+	topology.Queues = append(topology.Queues, &Queue{Name: rp.parkingLot, Durable: true})
+
+	return topology
+}
+
+// route is where a message failing for the attempt'th time goes, a retry queue or the parking lot.
+func (rp *retryPolicy) route(attempt uint32) string {
+
+	if attempt > atomic.LoadUint32(&rp.maxAttempts) {
+		return rp.parkingLot
+	}
+
+	return rp.retryQueue(attempt)
+}
+
+// republish sends the failed message, with its properties, to its next retry queue, or the parking lot once attempts
+// run out.
+func (rp *retryPolicy) republish(cp *ConnectionPool, msg *ReceivedMessage, handlerErr error) error {
+
+	attempt := GetRetryCount(msg.Headers) + 1
+
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+
+	headers[HeaderRetryCount] = int64(attempt)
+	headers[HeaderRetryError] = handlerErr.Error()
+
+	return publishConfirmed(cp, &Letter{
+		Body: msg.Body,
+		Envelope: &Envelope{
+			RoutingKey:      rp.route(attempt),
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			Headers:         headers,
+			DeliveryMode:    amqp.Persistent,
+			Priority:        msg.Priority,
+			CorrelationID:   msg.CorrelationID,
+			ReplyTo:         msg.ReplyTo,
+			MessageID:       msg.MessageID,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			AppID:           msg.AppID,
+		},
+	}, rp.publishTimeout)
+}
+
+// GetRetryCount reads the HeaderRetryCount header, zero when missing.
+func GetRetryCount(headers amqp.Table) uint32 {
+
+	count, _ := Headers(headers).GetInt64(HeaderRetryCount)
+	return uint32(count)
+}
@@ -0,0 +1,161 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const (
+	// ExchangeTypeDirect routes on an exact routing key match.
+	ExchangeTypeDirect = "direct"
+
+	// ExchangeTypeFanout routes to every binding, ignoring the routing key.
+	ExchangeTypeFanout = "fanout"
+
+	// ExchangeTypeTopic routes on routing key patterns, where * matches one word and # zero or more.
+	ExchangeTypeTopic = "topic"
+
+	// ExchangeTypeHeaders routes on message headers instead of the routing key.
+	ExchangeTypeHeaders = "headers"
+
+	// HeadersMatchAll requires every header of a headers binding to match.
+	HeadersMatchAll = "all"
+
+	// HeadersMatchAny requires at least one header of a headers binding to match.
+	HeadersMatchAny = "any"
+)
+
+// validHeadersMatch holds the x-match values RabbitMQ accepts, the -with-x variants also compare x- headers.
+var validHeadersMatch = map[string]bool{
+	HeadersMatchAll: true,
+	HeadersMatchAny: true,
+	"all-with-x":    true,
+	"any-with-x":    true,
+}
+
+// bindingArgs merges a binding's Match and Headers into its Args, the form a headers exchange binds with.
+// Args are returned as is when neither is set.
+func bindingArgs(args amqp.Table, match string, headers amqp.Table) amqp.Table {
+
+	if match == "" && len(headers) == 0 {
+		return args
+	}
+
+	merged := make(amqp.Table, len(args)+len(headers)+1)
+	for key, value := range args {
+		merged[key] = value
+	}
+
+	for key, value := range headers {
+		merged[key] = value
+	}
+
+	if match != "" {
+		merged["x-match"] = match
+	}
+
+	return merged
+}
+
+// exchangeArgs is an exchange's Args with its AlternateExchange, when set.
+func exchangeArgs(exchange *Exchange) amqp.Table {
+
+	if exchange.AlternateExchange == "" {
+		return exchange.Args
+	}
+
+	args := make(amqp.Table, len(exchange.Args)+1)
+	for key, value := range exchange.Args {
+		args[key] = value
+	}
+	args["alternate-exchange"] = exchange.AlternateExchange
+
+	return args
+}
+
+// ValidateTopicPattern checks a topic binding key: dot separated words, where * and # must be whole words.
+func ValidateTopicPattern(pattern string) error {
+
+	if len(pattern) > 255 {
+		return fmt.Errorf("topic pattern %q is longer than 255 bytes", pattern)
+	}
+
+	for _, word := range strings.Split(pattern, ".") {
+		if word == "*" || word == "#" {
+			continue
+		}
+
+		if strings.ContainsAny(word, "*#") {
+			return fmt.Errorf("topic pattern %q has a wildcard inside the word %q, wildcards must be whole words", pattern, word)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the config for mistakes the broker would accept silently or reject one declaration at a
+// time: unknown exchange types, exchanges that are their own alternate, malformed topic patterns, and headers
+// binding settings on bindings to exchanges that aren't headers exchanges. Bindings to exchanges not declared in the config are checked as far
+// as their type allows. Every problem found is returned, joined.
+func (config *TopologyConfig) Validate() error {
+
+	exchangeTypes := make(map[string]string, len(config.Exchanges))
+	var errs []error
+
+	for _, exchange := range config.Exchanges {
+		switch exchange.Type {
+		case ExchangeTypeDirect, ExchangeTypeFanout, ExchangeTypeTopic, ExchangeTypeHeaders:
+		default:
+			if !exchange.PassiveDeclare && !strings.HasPrefix(exchange.Type, "x-") { // plugin exchange types
+				errs = append(errs, fmt.Errorf("exchange %s has unknown type %q", exchange.Name, exchange.Type))
+			}
+		}
+
+		if exchange.AlternateExchange != "" && exchange.AlternateExchange == exchange.Name {
+			errs = append(errs, fmt.Errorf("exchange %s can't be its own alternate exchange", exchange.Name))
+		}
+
+		exchangeTypes[exchange.Name] = exchange.Type
+	}
+
+	for _, binding := range config.QueueBindings {
+		name := fmt.Sprintf("queue binding %s->%s", binding.ExchangeName, binding.QueueName)
+		errs = append(errs, validateBinding(name, exchangeTypes[binding.ExchangeName], binding.RoutingKey, binding.Match, binding.Headers)...)
+	}
+
+	for _, binding := range config.ExchangeBindings {
+		name := fmt.Sprintf("exchange binding %s->%s", binding.ParentExchangeName, binding.ExchangeName)
+		errs = append(errs, validateBinding(name, exchangeTypes[binding.ParentExchangeName], binding.RoutingKey, binding.Match, binding.Headers)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateBinding checks one binding against the type of the exchange it binds from, empty when unknown.
+func validateBinding(name, exchangeType, routingKey, match string, headers amqp.Table) []error {
+
+	var errs []error
+
+	if match != "" && !validHeadersMatch[match] {
+		errs = append(errs, fmt.Errorf("%s has Match %q, expected %q or %q", name, match, HeadersMatchAll, HeadersMatchAny))
+	}
+
+	if exchangeType == "" {
+		return errs
+	}
+
+	if (match != "" || len(headers) > 0) && exchangeType != ExchangeTypeHeaders {
+		errs = append(errs, fmt.Errorf("%s sets Match or Headers but the exchange is %s, not headers", name, exchangeType))
+	}
+
+	if exchangeType == ExchangeTypeTopic {
+		if err := ValidateTopicPattern(routingKey); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errs
+}
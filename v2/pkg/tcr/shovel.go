@@ -0,0 +1,319 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// ShovelAckMode is when a Shovel acknowledges messages on the source queue.
+type ShovelAckMode int
+
+const (
+	// ShovelAckOnConfirm acks source messages once the target broker confirms them, at least once delivery.
+	ShovelAckOnConfirm ShovelAckMode = iota
+
+	// ShovelAckOnPublish acks source messages as soon as they are published, without waiting for confirmation.
+	ShovelAckOnPublish
+
+	// ShovelNoAck consumes with auto ack, at most once delivery.
+	ShovelNoAck
+)
+
+// ShovelConfig describes where a Shovel moves messages and how.
+type ShovelConfig struct {
+	SourceQueue      string
+	TargetExchange   string
+	TargetRoutingKey string        // empty keeps each message's original routing key
+	BatchSize        int           // messages published before waiting for confirmations, defaults to 100
+	AckMode          ShovelAckMode // defaults to ShovelAckOnConfirm
+	PublishTimeout   time.Duration // confirmation timeout per batch, defaults to 5 seconds
+
+	// Transform, when set, may modify or replace each letter before it is republished. Returning a nil letter
+	// drops the message (it is still acked), and an error rejects it on the source without requeueing.
+	Transform func(*Letter) (*Letter, error) `json:"-"`
+}
+
+// Shovel consumes from a queue through one ConnectionPool and republishes to an exchange through another,
+// for migrations and cross cluster replication without the shovel plugin. The pools may be the same.
+type Shovel struct {
+	source      *ConnectionPool
+	target      *ConnectionPool
+	config      ShovelConfig
+	transferred uint64
+	dropped     uint64
+	rejected    uint64
+}
+
+// NewShovel creates a Shovel from the source pool's queue to the target pool's exchange.
+func NewShovel(source, target *ConnectionPool, config *ShovelConfig) (*Shovel, error) {
+
+	if source == nil || target == nil {
+		return nil, errors.New("shovel requires a source and target connectionpool")
+	}
+
+	if config == nil || config.SourceQueue == "" {
+		return nil, errors.New("shovel requires a source queue")
+	}
+
+	shovel := &Shovel{source: source, target: target, config: *config}
+
+	if shovel.config.BatchSize <= 0 {
+		shovel.config.BatchSize = 100
+	}
+
+	if shovel.config.PublishTimeout <= 0 {
+		shovel.config.PublishTimeout = 5 * time.Second
+	}
+
+	return shovel, nil
+}
+
+// Transferred is the number of messages republished and confirmed (or acked, per AckMode).
+func (shovel *Shovel) Transferred() uint64 {
+	return atomic.LoadUint64(&shovel.transferred)
+}
+
+// Dropped is the number of messages the Transform discarded.
+func (shovel *Shovel) Dropped() uint64 {
+	return atomic.LoadUint64(&shovel.dropped)
+}
+
+// Rejected is the number of messages the Transform failed on.
+func (shovel *Shovel) Rejected() uint64 {
+	return atomic.LoadUint64(&shovel.rejected)
+}
+
+// Run moves messages until ctx is done, returning nil, or until either side fails, returning the error.
+// Unconfirmed messages are requeued on the source, so Run can simply be called again after an error.
+func (shovel *Shovel) Run(ctx context.Context) error {
+
+	channel, err := shovel.source.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	if err := channel.Qos(shovel.config.BatchSize, 0, false); err != nil {
+		return fmt.Errorf("shovel unable to set prefetch: %w", err)
+	}
+
+	deliveries, err := channel.Consume(shovel.config.SourceQueue, "", shovel.config.AckMode == ShovelNoAck, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("shovel unable to consume %s: %w", shovel.config.SourceQueue, err)
+	}
+
+	chanHost, err := shovel.target.GetChannelFromPoolContext(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		return err
+	}
+
+	for {
+		batch, ok := shovel.nextBatch(ctx, deliveries)
+		if !ok {
+			shovel.target.ReturnChannel(chanHost, false)
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("shovel source channel for %s closed", shovel.config.SourceQueue)
+		}
+
+		if err = shovel.transfer(chanHost, batch); err != nil {
+			shovel.target.ReturnChannel(chanHost, true)
+			return err
+		}
+	}
+}
+
+// nextBatch waits for a delivery and then takes whatever else is ready, up to BatchSize.
+func (shovel *Shovel) nextBatch(ctx context.Context, deliveries <-chan amqp.Delivery) ([]amqp.Delivery, bool) {
+
+	var batch []amqp.Delivery
+
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case delivery, ok := <-deliveries:
+		if !ok {
+			return nil, false
+		}
+		batch = append(batch, delivery)
+	}
+
+	for len(batch) < shovel.config.BatchSize {
+		select {
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return batch, true // settle what we have, the closure surfaces on the next call
+			}
+			batch = append(batch, delivery)
+		default:
+			return batch, true
+		}
+	}
+
+	return batch, true
+}
+
+// transfer republishes the batch and settles it on the source according to the AckMode.
+func (shovel *Shovel) transfer(chanHost *ChannelHost, batch []amqp.Delivery) error {
+
+	pending := make(map[uint64]amqp.Delivery, len(batch)) // target delivery tag to source delivery
+
+	for _, delivery := range batch {
+		letter, err := shovel.letter(delivery)
+		if err != nil {
+			atomic.AddUint64(&shovel.rejected, 1)
+			shovel.settle(delivery, false, false)
+			continue
+		}
+
+		if letter == nil {
+			atomic.AddUint64(&shovel.dropped, 1)
+			shovel.settle(delivery, true, false)
+			continue
+		}
+
+		deliveryTag, err := chanHost.publish(letter)
+		if err != nil {
+			shovel.requeue(batch)
+			return fmt.Errorf("shovel unable to publish to %s: %w", publishTarget(letter.Envelope), err)
+		}
+
+		if shovel.config.AckMode != ShovelAckOnConfirm {
+			atomic.AddUint64(&shovel.transferred, 1)
+			shovel.settle(delivery, true, false)
+			shovel.discardConfirmations(chanHost)
+			continue
+		}
+
+		pending[deliveryTag] = delivery
+	}
+
+	if shovel.config.AckMode != ShovelAckOnConfirm || len(pending) == 0 {
+		return nil
+	}
+
+	timeout := time.After(shovel.config.PublishTimeout)
+	for len(pending) > 0 {
+		select {
+		case <-timeout:
+			for _, delivery := range pending {
+				shovel.settle(delivery, false, true)
+			}
+			return fmt.Errorf("shovel publish confirmations for %d messages weren't received in a timely manner", len(pending))
+
+		case confirmation, ok := <-chanHost.Confirmations:
+			if !ok {
+				for _, delivery := range pending {
+					shovel.settle(delivery, false, true)
+				}
+				return errors.New("shovel target channel closed while awaiting publish confirmation")
+			}
+
+			delivery, found := pending[confirmation.DeliveryTag]
+			if !found {
+				continue // confirms an earlier publish on this channel
+			}
+			delete(pending, confirmation.DeliveryTag)
+
+			if confirmation.Ack {
+				atomic.AddUint64(&shovel.transferred, 1)
+			}
+
+			shovel.settle(delivery, confirmation.Ack, true) // nacked messages go back on the source
+		}
+	}
+
+	return nil
+}
+
+// letter converts a source delivery into the letter republished to the target, applying the Transform.
+func (shovel *Shovel) letter(delivery amqp.Delivery) (*Letter, error) {
+
+	routingKey := shovel.config.TargetRoutingKey
+	if routingKey == "" {
+		routingKey = delivery.RoutingKey
+	}
+
+	letter := &Letter{
+		LetterID: atomic.AddUint64(&globalLetterID, 1) - 1,
+		Body:     delivery.Body,
+		Envelope: &Envelope{
+			Exchange:        shovel.config.TargetExchange,
+			RoutingKey:      routingKey,
+			ContentType:     delivery.ContentType,
+			ContentEncoding: delivery.ContentEncoding,
+			Headers:         delivery.Headers,
+			DeliveryMode:    delivery.DeliveryMode,
+			Priority:        delivery.Priority,
+			CorrelationID:   delivery.CorrelationId,
+			ReplyTo:         delivery.ReplyTo,
+			MessageID:       delivery.MessageId,
+			Timestamp:       delivery.Timestamp,
+			Type:            delivery.Type,
+			UserID:          delivery.UserId,
+			AppID:           delivery.AppId,
+		},
+	}
+
+	if delivery.Expiration != "" {
+		if expiration, err := time.ParseDuration(delivery.Expiration + "ms"); err == nil {
+			letter.Envelope.Expiration = expiration
+		}
+	}
+
+	if shovel.config.Transform == nil {
+		return letter, nil
+	}
+
+	return shovel.config.Transform(letter)
+}
+
+// discardConfirmations drains confirmations nobody waits for, a full Confirmations buffer stalls the connection.
+func (shovel *Shovel) discardConfirmations(chanHost *ChannelHost) {
+
+FlushLoop:
+	for {
+		select {
+		case <-chanHost.Confirmations:
+		default:
+			break FlushLoop
+		}
+	}
+}
+
+// settle acks, or nacks with requeue, a source delivery. Nothing to do when consuming with auto ack.
+func (shovel *Shovel) settle(delivery amqp.Delivery, ack bool, requeue bool) {
+
+	if shovel.config.AckMode == ShovelNoAck {
+		return
+	}
+
+	if ack {
+		_ = delivery.Ack(false)
+		return
+	}
+
+	_ = delivery.Nack(false, requeue)
+}
+
+// requeue returns the unsettled part of a failed batch to the source queue.
+func (shovel *Shovel) requeue(batch []amqp.Delivery) {
+
+	if shovel.config.AckMode == ShovelNoAck || len(batch) == 0 {
+		return
+	}
+
+	// Multiple nack requeues every unsettled delivery up to the last, those already settled are unaffected.
+	_ = batch[len(batch)-1].Nack(true, true)
+}
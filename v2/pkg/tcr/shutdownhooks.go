@@ -0,0 +1,78 @@
+package tcr
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ShutdownStage is a point in the teardown sequence of a RabbitService or ConnectionPool.
+type ShutdownStage int
+
+const (
+	// ShutdownPreDrain runs before publishing and consuming stop (ConnectionPool: before channels close).
+	ShutdownPreDrain ShutdownStage = iota
+
+	// ShutdownPostDrain runs after publishing and consuming stop but before connections close
+	// (ConnectionPool: after channels close).
+	ShutdownPostDrain
+
+	// ShutdownPostClose runs after all connections are closed.
+	ShutdownPostClose
+)
+
+// String allows you to quickly log the ShutdownStage.
+func (ss ShutdownStage) String() string {
+
+	switch ss {
+	case ShutdownPreDrain:
+		return "pre-drain"
+	case ShutdownPostDrain:
+		return "post-drain"
+	case ShutdownPostClose:
+		return "post-close"
+	}
+
+	return fmt.Sprintf("stage-%d", int(ss))
+}
+
+type shutdownHook struct {
+	name string
+	hook func() error
+}
+
+// shutdownHooks runs registered hooks per stage in registration order.
+type shutdownHooks struct {
+	hooks    map[ShutdownStage][]*shutdownHook
+	hookLock *sync.Mutex
+}
+
+func newShutdownHooks() *shutdownHooks {
+
+	return &shutdownHooks{
+		hooks:    make(map[ShutdownStage][]*shutdownHook),
+		hookLock: &sync.Mutex{},
+	}
+}
+
+func (sh *shutdownHooks) add(stage ShutdownStage, name string, hook func() error) {
+	sh.hookLock.Lock()
+	defer sh.hookLock.Unlock()
+
+	sh.hooks[stage] = append(sh.hooks[stage], &shutdownHook{name: name, hook: hook})
+}
+
+// run invokes every hook of the stage, even when earlier hooks fail, and returns their errors.
+func (sh *shutdownHooks) run(stage ShutdownStage) []error {
+	sh.hookLock.Lock()
+	hooks := sh.hooks[stage]
+	sh.hookLock.Unlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook.hook(); err != nil {
+			errs = append(errs, fmt.Errorf("%s shutdown hook %q failed: %w", stage, hook.name, err))
+		}
+	}
+
+	return errs
+}
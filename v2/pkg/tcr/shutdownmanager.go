@@ -0,0 +1,256 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// shutdownOrder is the order a ShutdownManager shuts components down in, dependents first.
+type shutdownOrder int
+
+const (
+	shutdownConsumers shutdownOrder = iota
+	shutdownPublishers
+	shutdownChannelPools
+	shutdownConnectionPools
+	shutdownOrders
+)
+
+// managedComponent is a component tracked by a ShutdownManager. key dedupes components tracked twice.
+type managedComponent struct {
+	kind     string
+	name     string
+	key      interface{}
+	shutdown func() error
+}
+
+// ShutdownManager shuts down the consumers, publishers, ChannelPools, and ConnectionPools of one or more services
+// with a single call, in dependency order: consumers stop first, then publishers, then ChannelPools, then
+// ConnectionPools, so nothing loses its channels while still in use. Components of an order shut down
+// concurrently, and one failing doesn't stop the others.
+type ShutdownManager struct {
+	components  [shutdownOrders][]*managedComponent
+	managerLock *sync.Mutex
+}
+
+// NewShutdownManager creates an empty ShutdownManager.
+func NewShutdownManager() *ShutdownManager {
+
+	return &ShutdownManager{
+		managerLock: &sync.Mutex{},
+	}
+}
+
+// AddService tracks a RabbitService: its consumers, including those registered later, stop with the other
+// consumers, and the rest of it (Publisher, Outbox, broker targets, ConnectionPool) shuts down with
+// RabbitService.Shutdown alongside the other ConnectionPools, after every tracked publisher and ChannelPool.
+func (sm *ShutdownManager) AddService(rs *RabbitService) {
+
+	// The service shuts its ConnectionPool down, after its Publisher, so it replaces the pool if tracked.
+	sm.remove(rs.ConnectionPool)
+	sm.add(shutdownConnectionPools, &managedComponent{
+		kind: "service",
+		name: rs.ConnectionPool.Config.ConnectionName,
+		key:  rs.ConnectionPool,
+		shutdown: func() error {
+			rs.Shutdown(false)
+			return nil
+		},
+	})
+
+	sm.add(shutdownConsumers, &managedComponent{
+		kind: "service consumers",
+		name: rs.ConnectionPool.Config.ConnectionName,
+		key:  rs,
+		shutdown: func() error {
+			var errs []error
+			for _, con := range rs.consumerList() {
+				if con.consuming() {
+					if err := con.StopConsuming(false, false); err != nil {
+						errs = append(errs, fmt.Errorf("consumer %s: %w", con.ConsumerName, err))
+					}
+				}
+			}
+
+			return errors.Join(errs...)
+		},
+	})
+}
+
+// AddConsumer tracks a Consumer and its ConnectionPool. A Consumer that isn't consuming at shutdown is skipped.
+func (sm *ShutdownManager) AddConsumer(con *Consumer) {
+
+	sm.add(shutdownConsumers, &managedComponent{
+		kind: "consumer",
+		name: con.ConsumerName,
+		key:  con,
+		shutdown: func() error {
+			if !con.consuming() {
+				return nil
+			}
+
+			return con.StopConsuming(false, false)
+		},
+	})
+
+	sm.AddConnectionPool(con.ConnectionPool)
+}
+
+// AddConsumerGroup tracks a ConsumerGroup and its ConnectionPool. A group that isn't consuming at shutdown is
+// skipped.
+func (sm *ShutdownManager) AddConsumerGroup(group *ConsumerGroup) {
+
+	sm.add(shutdownConsumers, &managedComponent{
+		kind: "consumer group",
+		name: group.config.ConsumerName,
+		key:  group,
+		shutdown: func() error {
+			if !group.Started() {
+				return nil
+			}
+
+			return group.StopConsuming(false, false)
+		},
+	})
+
+	sm.AddConnectionPool(group.connectionPool)
+}
+
+// AddPublisher tracks a Publisher and its ConnectionPool. The Publisher shuts down without its ConnectionPool,
+// which shuts down with the other ConnectionPools.
+func (sm *ShutdownManager) AddPublisher(pub *Publisher) {
+
+	sm.add(shutdownPublishers, &managedComponent{
+		kind: "publisher",
+		name: pub.ConnectionPool.Config.ConnectionName,
+		key:  pub,
+		shutdown: func() error {
+			pub.Shutdown(false)
+			return nil
+		},
+	})
+
+	sm.AddConnectionPool(pub.ConnectionPool)
+}
+
+// AddChannelPool tracks a ChannelPool.
+func (sm *ShutdownManager) AddChannelPool(cp *ChannelPool) {
+
+	name := ""
+	if cp.config != nil {
+		name = cp.config.ConnectionName
+	}
+
+	sm.add(shutdownChannelPools, &managedComponent{
+		kind: "channelpool",
+		name: name,
+		key:  cp,
+		shutdown: func() error {
+			cp.Shutdown()
+			return nil
+		},
+	})
+}
+
+// AddConnectionPool tracks a ConnectionPool. Tracking a pool more than once, ex. shared by a Publisher and a
+// Consumer, shuts it down once.
+func (sm *ShutdownManager) AddConnectionPool(cp *ConnectionPool) {
+
+	sm.add(shutdownConnectionPools, &managedComponent{
+		kind: "connectionpool",
+		name: cp.Config.ConnectionName,
+		key:  cp,
+		shutdown: func() error {
+			cp.Shutdown()
+			if cp.State() != PoolShutdown {
+				return fmt.Errorf("still %s", cp.State())
+			}
+
+			return nil
+		},
+	})
+}
+
+func (sm *ShutdownManager) add(order shutdownOrder, component *managedComponent) {
+	sm.managerLock.Lock()
+	defer sm.managerLock.Unlock()
+
+	for _, components := range sm.components {
+		for _, tracked := range components {
+			if tracked.key == component.key {
+				return
+			}
+		}
+	}
+
+	sm.components[order] = append(sm.components[order], component)
+}
+
+func (sm *ShutdownManager) remove(key interface{}) {
+	sm.managerLock.Lock()
+	defer sm.managerLock.Unlock()
+
+	for order, components := range sm.components {
+		for i, tracked := range components {
+			if tracked.key == key {
+				sm.components[order] = append(components[:i:i], components[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Shutdown shuts down every tracked component in dependency order and returns the failures of all of them joined,
+// each naming its component, or nil. Components are forgotten once shut down, so calling Shutdown again only
+// shuts down those added since.
+func (sm *ShutdownManager) Shutdown() error {
+
+	sm.managerLock.Lock()
+	orders := sm.components
+	sm.components = [shutdownOrders][]*managedComponent{}
+	sm.managerLock.Unlock()
+
+	var errs []error
+	for _, components := range orders {
+		errs = append(errs, shutdownComponents(components)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// shutdownComponents shuts the components down concurrently, returning their failures in the order tracked.
+// A panicking component is a failure.
+func shutdownComponents(components []*managedComponent) []error {
+
+	failures := make([]error, len(components))
+	wg := &sync.WaitGroup{}
+
+	for i, component := range components {
+		wg.Add(1)
+
+		go func(i int, component *managedComponent) {
+			defer wg.Done()
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					failures[i] = fmt.Errorf("%s %s panicked during shutdown: %v", component.kind, component.name, recovered)
+				}
+			}()
+
+			if err := component.shutdown(); err != nil {
+				failures[i] = fmt.Errorf("%s %s unable to shut down: %w", component.kind, component.name, err)
+			}
+		}(i, component)
+	}
+
+	wg.Wait()
+
+	var errs []error
+	for _, err := range failures {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
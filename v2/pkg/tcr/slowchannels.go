@@ -0,0 +1,371 @@
+package tcr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowChannels keeps the latest publishes of each cached channel to find those far slower, or failing far more,
+// than the rest of the pool. A publish is sampled when its channel is returned, from its start to the return, so
+// a confirmation that never comes counts as slow as the publisher waited for it.
+type slowChannels struct {
+	multiple     float64
+	minLatency   time.Duration
+	maxErrorRate float64
+	windowSize   int
+	minSamples   int
+	interval     time.Duration
+	channels     map[uint64]*channelSamples // by channel ID
+	replaced     uint64
+	slowLock     *sync.Mutex
+}
+
+// channelSamples is a ring of a channel's latest publishes.
+type channelSamples struct {
+	chanHost  *ChannelHost
+	latencies []time.Duration
+	failed    []bool
+	next      int  // oldest sample once the ring is full
+	slow      bool // replaced the next time the channel is returned or found idle in the cache
+}
+
+// slowChannel is a channel found slow and why.
+type slowChannel struct {
+	chanHost *ChannelHost
+	reason   string
+}
+
+func newSlowChannels(config *SlowChannelConfig) *slowChannels {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	sc := &slowChannels{
+		multiple:     config.LatencyMultiple,
+		minLatency:   time.Duration(config.MinLatency) * time.Millisecond,
+		maxErrorRate: config.MaxErrorRate,
+		windowSize:   int(config.WindowSize),
+		minSamples:   int(config.MinSamples),
+		interval:     time.Duration(config.CheckInterval) * time.Second,
+		channels:     make(map[uint64]*channelSamples),
+		slowLock:     &sync.Mutex{},
+	}
+
+	if sc.multiple <= 0 {
+		sc.multiple = 5
+	}
+
+	if sc.minLatency == 0 {
+		sc.minLatency = 100 * time.Millisecond
+	}
+
+	if sc.maxErrorRate <= 0 {
+		sc.maxErrorRate = 0.5
+	}
+
+	if sc.windowSize == 0 {
+		sc.windowSize = 100
+	}
+
+	if sc.minSamples == 0 {
+		sc.minSamples = 20
+	}
+
+	if sc.minSamples > sc.windowSize {
+		sc.minSamples = sc.windowSize
+	}
+
+	if sc.interval == 0 {
+		sc.interval = 10 * time.Second
+	}
+
+	return sc
+}
+
+// sample records the latest publish of a returned channel, if it published since it was last sampled.
+func (sc *slowChannels) sample(chanHost *ChannelHost, erred bool) {
+
+	if sc == nil {
+		return
+	}
+
+	chanHost.chanLock.Lock()
+	started := chanHost.publishStarted
+	chanHost.publishStarted = time.Time{}
+	chanHost.chanLock.Unlock()
+
+	if started.IsZero() {
+		return
+	}
+
+	latency := time.Since(started)
+
+	sc.slowLock.Lock()
+	defer sc.slowLock.Unlock()
+
+	samples, ok := sc.channels[chanHost.ID]
+	if !ok {
+		samples = &channelSamples{chanHost: chanHost}
+		sc.channels[chanHost.ID] = samples
+	}
+
+	if len(samples.latencies) < sc.windowSize {
+		samples.latencies = append(samples.latencies, latency)
+		samples.failed = append(samples.failed, erred)
+		return
+	}
+
+	samples.latencies[samples.next] = latency
+	samples.failed[samples.next] = erred
+	samples.next = (samples.next + 1) % sc.windowSize
+}
+
+// check judges every channel with MinSamples publishes against the rest of the pool, flagging and returning those
+// newly found slow, and the connections whose every judged channel is slow while another connection's isn't.
+func (sc *slowChannels) check() ([]*slowChannel, []*ConnectionHost) {
+	sc.slowLock.Lock()
+	defer sc.slowLock.Unlock()
+
+	judged := make([]*channelSamples, 0, len(sc.channels))
+	for _, samples := range sc.channels {
+		if len(samples.latencies) >= sc.minSamples {
+			judged = append(judged, samples)
+		}
+	}
+
+	var found []*slowChannel
+	for _, samples := range judged {
+		if samples.slow {
+			continue
+		}
+
+		if reason := sc.judge(samples, judged); reason != "" {
+			found = append(found, &slowChannel{chanHost: samples.chanHost, reason: reason})
+		}
+	}
+
+	for _, slow := range found {
+		sc.channels[slow.chanHost.ID].slow = true
+	}
+
+	return found, sc.slowConnections(judged)
+}
+
+// judge returns why the channel is slow compared to the other judged channels, empty when it isn't.
+func (sc *slowChannels) judge(samples *channelSamples, judged []*channelSamples) string {
+
+	failures := 0
+	for _, failed := range samples.failed {
+		if failed {
+			failures++
+		}
+	}
+
+	if float64(failures)/float64(len(samples.failed)) > sc.maxErrorRate {
+		return fmt.Sprintf("failed %d of its last %d publishes", failures, len(samples.failed))
+	}
+
+	p99 := percentile(samples.latencies, 0.99)
+	if p99 <= sc.minLatency {
+		return ""
+	}
+
+	var rest []time.Duration
+	for _, other := range judged {
+		if other != samples && !other.slow {
+			rest = append(rest, other.latencies...)
+		}
+	}
+
+	if len(rest) == 0 {
+		return ""
+	}
+
+	median := percentile(rest, 0.5)
+	if float64(p99) <= sc.multiple*float64(median) {
+		return ""
+	}
+
+	return fmt.Sprintf("has a p99 publish latency of %s, the rest of the pool a median of %s",
+		p99.Round(time.Microsecond), median.Round(time.Microsecond))
+}
+
+// slowConnections are the connections whose every judged channel is slow while some other connection has a
+// judged channel that isn't, the mark of a half-dead connection rather than a slow broker.
+func (sc *slowChannels) slowConnections(judged []*channelSamples) []*ConnectionHost {
+
+	allSlow := make(map[*ConnectionHost]bool)
+	for _, samples := range judged {
+		connHost := samples.chanHost.connHost
+		if slow, ok := allSlow[connHost]; !ok || slow {
+			allSlow[connHost] = samples.slow
+		}
+	}
+
+	healthy := false
+	for _, slow := range allSlow {
+		healthy = healthy || !slow
+	}
+
+	if !healthy {
+		return nil
+	}
+
+	var connections []*ConnectionHost
+	for connHost, slow := range allSlow {
+		if slow {
+			connections = append(connections, connHost)
+		}
+	}
+
+	return connections
+}
+
+// takeSlow reports whether the channel was found slow, forgetting its samples so its replacement starts over.
+func (sc *slowChannels) takeSlow(chanHost *ChannelHost) bool {
+
+	if sc == nil {
+		return false
+	}
+
+	sc.slowLock.Lock()
+	defer sc.slowLock.Unlock()
+
+	samples, ok := sc.channels[chanHost.ID]
+	if !ok || !samples.slow {
+		return false
+	}
+
+	delete(sc.channels, chanHost.ID)
+	sc.replaced++
+
+	return true
+}
+
+// forget drops the samples of a channel closed for good.
+func (sc *slowChannels) forget(chanHost *ChannelHost) {
+
+	if sc == nil {
+		return
+	}
+
+	sc.slowLock.Lock()
+	defer sc.slowLock.Unlock()
+
+	delete(sc.channels, chanHost.ID)
+}
+
+// forgetConnection drops the samples of every channel on a connection being replaced, counting those found slow
+// as replaced.
+func (sc *slowChannels) forgetConnection(connHost *ConnectionHost) {
+	sc.slowLock.Lock()
+	defer sc.slowLock.Unlock()
+
+	for id, samples := range sc.channels {
+		if samples.chanHost.connHost == connHost {
+			if samples.slow {
+				sc.replaced++
+			}
+
+			delete(sc.channels, id)
+		}
+	}
+}
+
+// replacedCount is how many slow channels were replaced.
+func (sc *slowChannels) replacedCount() uint64 {
+
+	if sc == nil {
+		return 0
+	}
+
+	sc.slowLock.Lock()
+	defer sc.slowLock.Unlock()
+
+	return sc.replaced
+}
+
+// percentile is the nearest rank percentile of the latencies, which it leaves unsorted.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+// watchSlowChannels checks for slow channels every CheckInterval until stopped.
+func (cp *ConnectionPool) watchSlowChannels(stop chan struct{}) {
+
+	ticker := time.NewTicker(cp.slowChannels.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			cp.replaceSlowChannels(stop)
+		}
+	}
+}
+
+// replaceSlowChannels recycles the connections whose every channel is slow, then rebuilds the slow channels idle
+// in the cache. Slow channels checked out are rebuilt when they are returned.
+func (cp *ConnectionPool) replaceSlowChannels(stop chan struct{}) {
+
+	found, connections := cp.slowChannels.check()
+	for _, slow := range found {
+		cp.logger.Warn("connectionpool %s channel %d %s, replacing it", cp.Config.ConnectionName, slow.chanHost.ID, slow.reason)
+		cp.notify(EventSlowChannel, slow.chanHost.ConnectionID, fmt.Sprintf("channel %d %s, replacing it", slow.chanHost.ID, slow.reason))
+	}
+
+	for _, connHost := range connections {
+		if cp.closed() {
+			return
+		}
+
+		cp.slowChannels.forgetConnection(connHost)
+		cp.recycleConnection(connHost, "with every channel on it slow", stop)
+	}
+
+	for i := len(cp.channels); i > 0 && !cp.closed(); i-- {
+		var chanHost *ChannelHost
+		select {
+		case chanHost = <-cp.channels:
+		default:
+			return
+		}
+
+		if cp.slowChannels.takeSlow(chanHost) && cp.rebuildSlowChannel(chanHost) != nil {
+			cp.dropChannel(chanHost)
+			continue
+		}
+
+		cp.channels <- chanHost // keeps its cachedAt
+	}
+}
+
+// rebuildSlowChannel closes a channel found slow and makes it again.
+func (cp *ConnectionPool) rebuildSlowChannel(chanHost *ChannelHost) error {
+
+	cp.logger.Debug("connectionpool %s rebuilding slow channel %d", cp.Config.ConnectionName, chanHost.ID)
+	cp.channelHooks.run(&cp.channelHooks.flagged, chanHost)
+
+	func() {
+		defer func() { _ = recover() }()
+		chanHost.Close()
+	}()
+
+	return cp.reconnectChannel(chanHost)
+}
@@ -0,0 +1,125 @@
+package tcr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const (
+	// StreamOffsetFirst starts consuming a stream from the first message still stored.
+	StreamOffsetFirst = "first"
+
+	// StreamOffsetLast starts consuming a stream from the last chunk written to it.
+	StreamOffsetLast = "last"
+
+	// StreamOffsetNext starts consuming a stream with the next message published, the broker's default.
+	StreamOffsetNext = "next"
+
+	// HeaderStreamOffset is the consume argument selecting where a stream is read from, and the header carrying
+	// each delivered message's offset in the stream.
+	HeaderStreamOffset = "x-stream-offset"
+
+	// defaultStreamPrefetch is used when a stream consumer has no prefetch configured, the broker requires one.
+	defaultStreamPrefetch = 100
+)
+
+// streamInterval matches the broker's relative offsets, like 7D or 12h (Y, M, D, h, m, or s).
+var streamInterval = regexp.MustCompile(`^[0-9]+[YMDhms]$`)
+
+// ParseStreamOffset converts an offset (first, last, next, a numeric offset, an RFC3339 timestamp, or an interval
+// such as 1D) to the x-stream-offset consume argument.
+func ParseStreamOffset(offset string) (interface{}, error) {
+
+	switch offset {
+	case StreamOffsetFirst, StreamOffsetLast, StreamOffsetNext:
+		return offset, nil
+	case "":
+		return StreamOffsetNext, nil
+	}
+
+	if numeric, err := strconv.ParseInt(offset, 10, 64); err == nil {
+		if numeric < 0 {
+			return nil, fmt.Errorf("stream offset %d can't be negative", numeric)
+		}
+		return numeric, nil
+	}
+
+	if timestamp, err := time.Parse(time.RFC3339, offset); err == nil {
+		return timestamp, nil
+	}
+
+	if streamInterval.MatchString(offset) {
+		return offset, nil
+	}
+
+	return nil, fmt.Errorf("invalid stream offset %q", offset)
+}
+
+// streamPosition tracks where a Consumer is in a stream queue, so consuming after a channel or connection
+// failure resumes after the last delivered message instead of replaying from the configured offset again.
+type streamPosition struct {
+	start interface{}
+	last  int64
+	seen  int32
+}
+
+// newStreamPosition creates a streamPosition from config. Returns nil when not consuming a stream.
+// An invalid offset is logged and the stream is consumed from the next message.
+func newStreamPosition(consumerName string, config *StreamConfig, cp *ConnectionPool) *streamPosition {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	start, err := ParseStreamOffset(config.Offset)
+	if err != nil {
+		if cp != nil {
+			cp.logger.Warn("consumer %s streamconfig is invalid, consuming from %s: %s", consumerName, StreamOffsetNext, err)
+		}
+		start = StreamOffsetNext
+	}
+
+	return &streamPosition{start: start}
+}
+
+// consumeArgs copies args and adds the x-stream-offset to consume from.
+func (sp *streamPosition) consumeArgs(args amqp.Table) amqp.Table {
+
+	table := make(amqp.Table, len(args)+1)
+	for key, value := range args {
+		table[key] = value
+	}
+
+	if atomic.LoadInt32(&sp.seen) == 1 {
+		table[HeaderStreamOffset] = atomic.LoadInt64(&sp.last) + 1
+	} else {
+		table[HeaderStreamOffset] = sp.start
+	}
+
+	return table
+}
+
+// observe records the stream offset of a delivery.
+func (sp *streamPosition) observe(delivery *amqp.Delivery) {
+
+	if offset, ok := delivery.Headers[HeaderStreamOffset].(int64); ok {
+		atomic.StoreInt64(&sp.last, offset)
+		atomic.StoreInt32(&sp.seen, 1)
+	}
+}
+
+// StreamOffset is the offset of the last message delivered from a stream queue, useful as a checkpoint to
+// replay from later. Returns false when the Consumer isn't consuming a stream or nothing has been delivered yet.
+func (con *Consumer) StreamOffset() (int64, bool) {
+
+	if con.stream == nil || atomic.LoadInt32(&con.stream.seen) == 0 {
+		return 0, false
+	}
+
+	return atomic.LoadInt64(&con.stream.last), true
+}
@@ -0,0 +1,112 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SubPool is a set of cached channels carved out of a ConnectionPool for dedicated use.
+// Channels are returned to the parent ConnectionPool on Close.
+type SubPool struct {
+	parent   *ConnectionPool
+	channels chan *ChannelHost
+	size     uint64
+	done     chan struct{}
+	closed   bool
+	subLock  *sync.Mutex
+}
+
+// SubPool takes n cached channels out of the ConnectionPool into an independently closable SubPool.
+// Blocks until n channels are available, returning ErrPoolClosed when the ConnectionPool shuts down first. Close
+// the SubPool before shutting down the ConnectionPool.
+func (cp *ConnectionPool) SubPool(n uint64) (*SubPool, error) {
+
+	if n == 0 {
+		return nil, errors.New("subpool size can't be 0")
+	}
+
+	if n > cp.Config.MaxCacheChannelCount {
+		return nil, fmt.Errorf("subpool size %d can't exceed the connectionpool's MaxCacheChannelCount %d", n, cp.Config.MaxCacheChannelCount)
+	}
+
+	sp := &SubPool{
+		parent:   cp,
+		channels: make(chan *ChannelHost, n),
+		size:     n,
+		done:     make(chan struct{}),
+		subLock:  &sync.Mutex{},
+	}
+
+	for i := uint64(0); i < n; i++ {
+		chanHost, err := cp.getChannel()
+		if err != nil {
+			for ; i > 0; i-- {
+				cp.ReturnChannel(<-sp.channels, false) // closed, the pool has shut down
+			}
+			return nil, err
+		}
+
+		sp.channels <- chanHost
+	}
+
+	cp.logger.Debug("connectionpool %s carved out a subpool of %d channels", cp.Config.ConnectionName, n)
+
+	return sp, nil
+}
+
+// GetChannelFromPool gets a channel from the SubPool, blocking until one is available.
+// Errors when the SubPool has been closed.
+func (sp *SubPool) GetChannelFromPool() (*ChannelHost, error) {
+
+	select {
+	case <-sp.done:
+		return nil, errors.New("can't get a channel from a closed subpool")
+	default:
+	}
+
+	select {
+	case chanHost := <-sp.channels:
+		return chanHost, nil
+	case <-sp.done:
+		return nil, errors.New("can't get a channel from a closed subpool")
+	}
+}
+
+// ReturnChannel returns a channel to the SubPool, rebuilding it first if erred.
+func (sp *SubPool) ReturnChannel(chanHost *ChannelHost, erred bool) {
+
+	if erred {
+		// A channel the broker refused is kept all the same, the SubPool's size is fixed. Its next return retries.
+		_ = sp.parent.reconnectChannel(chanHost) // <- blocking operation
+	} else {
+		chanHost.FlushConfirms()
+	}
+
+	sp.channels <- chanHost
+}
+
+// Size is the number of channels owned by the SubPool.
+func (sp *SubPool) Size() uint64 {
+	return sp.size
+}
+
+// Close stops the SubPool from handing out channels, waits for all outstanding channels to be returned,
+// and gives them back to the parent ConnectionPool.
+func (sp *SubPool) Close() {
+	sp.subLock.Lock()
+	defer sp.subLock.Unlock()
+
+	if sp.closed {
+		return
+	}
+
+	sp.closed = true
+	close(sp.done)
+
+	for i := uint64(0); i < sp.size; i++ {
+		sp.parent.cacheChannel(<-sp.channels)
+	}
+
+	sp.parent.logger.Debug("connectionpool %s subpool of %d channels closed", sp.parent.Config.ConnectionName, sp.size)
+}
@@ -0,0 +1,299 @@
+package tcr
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const defaultTemporaryQueueBufferSize = 100
+
+// TemporaryQueueConfig describes a TemporaryQueue.
+type TemporaryQueueConfig struct {
+	Name       string                 // empty lets the broker name the queue, a new name each time it is re-created
+	Bindings   []*QueueBinding        // bound to the queue each time it is created, their QueueName is ignored
+	Args       map[string]interface{} // queue arguments
+	AutoAck    bool                   // deliveries are acked by the broker, as reply queues usually are
+	Prefetch   int                    // QoS when not AutoAck, 0 is unlimited
+	BufferSize int                    // deliveries buffered for the reader, defaults to 100
+
+	// OnRecreate, when set, is called with the queue's name each time the queue is re-created after its channel
+	// or connection was lost. Messages sent to a server-named queue's old name are gone.
+	OnRecreate func(name string) `json:"-"`
+}
+
+// TemporaryQueue is an exclusive, auto-delete queue for request/reply and per-instance event streams. The broker
+// deletes such a queue with the connection that declared it, and refuses it to every other connection, so it is
+// declared, bound, and consumed on a channel of its own instead of the pool's shared ones. When that channel or
+// its connection is lost, the queue is declared, bound, and consumed again on a new one.
+type TemporaryQueue struct {
+	ConnectionPool *ConnectionPool
+	config         TemporaryQueueConfig
+	name           string
+	chanHost       *ChannelHost
+	deliveries     chan *ReceivedMessage
+	stop           chan struct{}
+	done           chan struct{}
+	closed         bool
+	queueLock      *sync.Mutex
+}
+
+// NewTemporaryQueue declares the TemporaryQueue and starts consuming it, so Name is ready for a ReplyTo on return.
+func NewTemporaryQueue(cp *ConnectionPool, config *TemporaryQueueConfig) (*TemporaryQueue, error) {
+
+	if cp == nil {
+		return nil, errors.New("temporary queue requires a connectionpool")
+	}
+
+	if config == nil {
+		config = &TemporaryQueueConfig{}
+	}
+
+	tq := &TemporaryQueue{
+		ConnectionPool: cp,
+		config:         *config,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+		queueLock:      &sync.Mutex{},
+	}
+
+	if tq.config.BufferSize <= 0 {
+		tq.config.BufferSize = defaultTemporaryQueueBufferSize
+	}
+	tq.deliveries = make(chan *ReceivedMessage, tq.config.BufferSize)
+
+	deliveries, err := tq.create()
+	if err != nil {
+		return nil, err
+	}
+
+	go tq.consumeLoop(deliveries)
+
+	return tq, nil
+}
+
+// Name is the queue's current name, for the ReplyTo of requests. It changes when a server-named queue is re-created.
+func (tq *TemporaryQueue) Name() string {
+	tq.queueLock.Lock()
+	defer tq.queueLock.Unlock()
+
+	return tq.name
+}
+
+// Deliveries returns the messages delivered to the queue. The channel closes once the TemporaryQueue is closed,
+// or its ConnectionPool shut down.
+func (tq *TemporaryQueue) Deliveries() <-chan *ReceivedMessage {
+	return tq.deliveries
+}
+
+// Close stops consuming and deletes the queue, waiting out a re-creation in progress. Messages still buffered in
+// Deliveries can be read until it closes.
+func (tq *TemporaryQueue) Close() {
+	tq.queueLock.Lock()
+
+	if tq.closed {
+		tq.queueLock.Unlock()
+		return
+	}
+
+	tq.closed = true
+	close(tq.stop)
+	tq.queueLock.Unlock()
+
+	<-tq.done
+}
+
+// create declares and binds the queue on a new channel of its own and starts consuming it. Returns ErrPoolClosed
+// once the pool has begun to Shutdown.
+func (tq *TemporaryQueue) create() (<-chan amqp.Delivery, error) {
+
+	connHost, err := tq.ConnectionPool.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	chanHost, err := NewChannelHost(connHost, 0, connHost.ConnectionID, false, false)
+	tq.ConnectionPool.ReturnConnection(connHost, err != nil)
+	if err != nil {
+		return nil, fmt.Errorf("temporary queue unable to open a channel: %w", err)
+	}
+
+	deliveries, err := tq.declare(chanHost)
+	if err != nil {
+		chanHost.Close()
+		return nil, err
+	}
+
+	tq.queueLock.Lock()
+	tq.chanHost = chanHost
+	tq.queueLock.Unlock()
+
+	return deliveries, nil
+}
+
+// declare declares, binds, and consumes the queue on the channel.
+func (tq *TemporaryQueue) declare(chanHost *ChannelHost) (<-chan amqp.Delivery, error) {
+
+	chanHost.setOperation("queue.declare", tq.config.Name)
+	queue, err := chanHost.Channel.QueueDeclare(tq.config.Name, false, true, true, false, amqp.Table(tq.config.Args))
+	if err != nil {
+		return nil, fmt.Errorf("temporary queue unable to declare %q: %w", tq.config.Name, err)
+	}
+
+	for _, binding := range tq.config.Bindings {
+		chanHost.setOperation("queue.bind", queue.Name)
+		err = chanHost.Channel.QueueBind(
+			queue.Name,
+			binding.RoutingKey,
+			binding.ExchangeName,
+			binding.NoWait,
+			bindingArgs(binding.Args, binding.Match, binding.Headers))
+		if err != nil {
+			return nil, fmt.Errorf("temporary queue unable to bind %s to %s: %w", queue.Name, binding.ExchangeName, err)
+		}
+	}
+
+	if !tq.config.AutoAck && tq.config.Prefetch > 0 {
+		chanHost.setOperation("basic.qos", queue.Name)
+		if err = chanHost.Channel.Qos(tq.config.Prefetch, 0, false); err != nil {
+			return nil, fmt.Errorf("temporary queue unable to set prefetch: %w", err)
+		}
+	}
+
+	chanHost.setOperation("basic.consume", queue.Name)
+	deliveries, err := chanHost.Channel.Consume(queue.Name, "", tq.config.AutoAck, true, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("temporary queue unable to consume %s: %w", queue.Name, err)
+	}
+
+	tq.queueLock.Lock()
+	tq.name = queue.Name
+	tq.queueLock.Unlock()
+
+	return deliveries, nil
+}
+
+// consumeLoop hands deliveries to the reader, re-creating the queue whenever its channel is lost.
+func (tq *TemporaryQueue) consumeLoop(deliveries <-chan amqp.Delivery) {
+
+	defer close(tq.done)
+	defer close(tq.deliveries)
+
+	for {
+		select {
+		case <-tq.stop:
+			tq.delete()
+			return
+		case delivery, ok := <-deliveries:
+			if ok {
+				if !tq.deliver(&delivery) {
+					tq.delete()
+					return
+				}
+				continue
+			}
+
+			if deliveries = tq.recreate(); deliveries == nil {
+				return
+			}
+		}
+	}
+}
+
+// deliver hands the delivery to the reader, returning false when closed first.
+func (tq *TemporaryQueue) deliver(delivery *amqp.Delivery) bool {
+
+	msg := &ReceivedMessage{
+		IsAckable:       !tq.config.AutoAck,
+		Body:            delivery.Body,
+		Headers:         delivery.Headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		MessageID:       delivery.MessageId,
+		CorrelationID:   delivery.CorrelationId,
+		ReplyTo:         delivery.ReplyTo,
+		Type:            delivery.Type,
+		AppID:           delivery.AppId,
+		Priority:        delivery.Priority,
+		Timestamp:       delivery.Timestamp,
+		Exchange:        delivery.Exchange,
+		RoutingKey:      delivery.RoutingKey,
+		deliveryTag:     delivery.DeliveryTag,
+		acknowledger:    delivery.Acknowledger,
+	}
+
+	select {
+	case tq.deliveries <- msg:
+		return true
+	case <-tq.stop:
+		return false
+	}
+}
+
+// recreate declares the queue on a new channel after the old one was lost, retrying until it succeeds or the
+// TemporaryQueue is closed. Returns nil when closed, or the pool has shut down.
+func (tq *TemporaryQueue) recreate() <-chan amqp.Delivery {
+
+	tq.queueLock.Lock()
+	lost := tq.chanHost
+	tq.queueLock.Unlock()
+
+	select {
+	case amqpError := <-lost.Errors:
+		if amqpError != nil && !tq.ConnectionPool.closed() {
+			tq.ConnectionPool.reportChannelException(NewChannelException(lost, amqpError))
+		}
+	default:
+	}
+
+	go func() {
+		defer func() { _ = recover() }()
+
+		lost.Close()
+	}()
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-tq.stop:
+			return nil
+		default:
+		}
+
+		deliveries, err := tq.create()
+		if err == nil {
+			name := tq.Name()
+			tq.ConnectionPool.logger.Info("temporary queue %s re-created", name)
+			if tq.config.OnRecreate != nil {
+				tq.config.OnRecreate(name)
+			}
+
+			return deliveries
+		}
+
+		if errors.Is(err, ErrPoolClosed) {
+			return nil
+		}
+
+		tq.ConnectionPool.logger.Warn("unable to re-create temporary queue, retrying: %s", err)
+		tq.ConnectionPool.errors.send(NewErrorEvent(SubsystemChannel, "declare", attempt, err))
+		sleepBackoff(tq.ConnectionPool.backoff, attempt)
+	}
+}
+
+// delete removes the queue and closes its channel.
+func (tq *TemporaryQueue) delete() {
+
+	tq.queueLock.Lock()
+	chanHost, name := tq.chanHost, tq.name
+	tq.queueLock.Unlock()
+
+	defer func() { _ = recover() }()
+
+	if _, err := chanHost.Channel.QueueDelete(name, false, false, false); err != nil {
+		tq.ConnectionPool.logger.Debug("unable to delete temporary queue %s: %s", name, err)
+	}
+
+	chanHost.Close()
+}
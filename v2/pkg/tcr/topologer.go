@@ -1,9 +1,10 @@
 package tcr
 
 import (
+	"context"
 	"errors"
 
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 )
 
 const (
@@ -12,11 +13,16 @@ const (
 
 	// QueueTypeClassic indicates a queue of type classic.
 	QueueTypeClassic = "classic"
+
+	// QueueTypeStream indicates a queue of type stream.
+	QueueTypeStream = "stream"
 )
 
 // Topologer allows you to build RabbitMQ topology backed by a ConnectionPool.
 type Topologer struct {
 	ConnectionPool *ConnectionPool
+	naming         *NamingConvention
+	inspector      TopologyInspector
 }
 
 // NewTopologer builds you a new Topologer.
@@ -27,10 +33,51 @@ func NewTopologer(cp *ConnectionPool) *Topologer {
 	}
 }
 
+// SetNamingConvention lints declared exchanges, queues, and bindings, and decorates the name of every exchange
+// and queue used with its prefix and suffix. Nil removes the convention.
+// Passive declares are not checked so existing topology can still be verified.
+func (top *Topologer) SetNamingConvention(naming *NamingConvention) {
+	top.naming = naming
+}
+
+// BuildTopologyContext is BuildToplogy, stopping on the first error, and with ctx's error before the next kind
+// of entity once ctx is done. What was declared by then stays.
+func (top *Topologer) BuildTopologyContext(ctx context.Context, config *TopologyConfig) error {
+
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	steps := []func() error{
+		func() error { return top.BuildExchanges(config.Exchanges, false) },
+		func() error { return top.BuildQueues(config.Queues, false) },
+		func() error { return top.BindQueues(config.QueueBindings, false) },
+		func() error { return top.BindExchanges(config.ExchangeBindings, false) },
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := step(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // BuildToplogy builds a topology based on a ToplogyConfig - stops on first error.
+// The config is validated first and nothing is built when it is invalid, unless ignoring errors.
 func (top *Topologer) BuildToplogy(config *TopologyConfig, ignoreErrors bool) error {
 
-	err := top.BuildExchanges(config.Exchanges, ignoreErrors)
+	err := config.Validate()
+	if err != nil && !ignoreErrors {
+		return err
+	}
+
+	err = top.BuildExchanges(config.Exchanges, ignoreErrors)
 	if err != nil && !ignoreErrors {
 		return err
 	}
@@ -121,6 +168,108 @@ func (top *Topologer) BindExchanges(bindings []*ExchangeBinding, ignoreErrors bo
 	return nil
 }
 
+// TeardownTopology removes what BuildToplogy creates, in reverse: exchange bindings, queue bindings, queues,
+// then exchanges - stops on first error. Passively declared exchanges and queues belong to someone else and
+// are left alone. Queues are deleted even when they hold messages or have consumers.
+func (top *Topologer) TeardownTopology(config *TopologyConfig, ignoreErrors bool) error {
+
+	err := top.UnbindExchanges(config.ExchangeBindings, ignoreErrors)
+	if err != nil && !ignoreErrors {
+		return err
+	}
+
+	err = top.UnbindQueues(config.QueueBindings, ignoreErrors)
+	if err != nil && !ignoreErrors {
+		return err
+	}
+
+	_, err = top.DeleteQueues(config.Queues, false, false, ignoreErrors)
+	if err != nil && !ignoreErrors {
+		return err
+	}
+
+	err = top.DeleteExchanges(config.Exchanges, false, ignoreErrors)
+	if err != nil && !ignoreErrors {
+		return err
+	}
+
+	return nil
+}
+
+// UnbindExchanges loops through and removes Exchange to Exchange bindings - stops on first error.
+func (top *Topologer) UnbindExchanges(bindings []*ExchangeBinding, ignoreErrors bool) error {
+
+	for _, exchangeBinding := range bindings {
+		err := top.ExchangeUnbind(
+			exchangeBinding.ExchangeName,
+			exchangeBinding.RoutingKey,
+			exchangeBinding.ParentExchangeName,
+			exchangeBinding.NoWait,
+			bindingArgs(exchangeBinding.Args, exchangeBinding.Match, exchangeBinding.Headers))
+		if err != nil && !ignoreErrors {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnbindQueues loops through and removes Queue to Exchange bindings - stops on first error.
+func (top *Topologer) UnbindQueues(bindings []*QueueBinding, ignoreErrors bool) error {
+
+	for _, queueBinding := range bindings {
+		err := top.UnbindQueue(
+			queueBinding.QueueName,
+			queueBinding.RoutingKey,
+			queueBinding.ExchangeName,
+			bindingArgs(queueBinding.Args, queueBinding.Match, queueBinding.Headers))
+		if err != nil && !ignoreErrors {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteQueues loops through and deletes Queues, skipping passive ones, and returns the messages purged
+// with them - stops on first error. ifUnused and ifEmpty make the broker refuse queues with consumers or messages.
+func (top *Topologer) DeleteQueues(queues []*Queue, ifUnused, ifEmpty, ignoreErrors bool) (int, error) {
+
+	total := 0
+	for _, queue := range queues {
+		if queue.PassiveDeclare {
+			continue
+		}
+
+		count, err := top.QueueDelete(queue.Name, ifUnused, ifEmpty, queue.NoWait)
+		if err != nil && !ignoreErrors {
+			return total, err
+		}
+
+		total += count
+	}
+
+	return total, nil
+}
+
+// DeleteExchanges loops through and deletes Exchanges, skipping passive ones - stops on first error.
+// ifUnused makes the broker refuse exchanges that still have bindings.
+func (top *Topologer) DeleteExchanges(exchanges []*Exchange, ifUnused, ignoreErrors bool) error {
+
+	for _, exchange := range exchanges {
+		if exchange.PassiveDeclare {
+			continue
+		}
+
+		err := top.ExchangeDelete(exchange.Name, ifUnused, exchange.NoWait)
+		if err != nil && !ignoreErrors {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // CreateExchange builds an Exchange topology.
 func (top *Topologer) CreateExchange(
 	exchangeName string,
@@ -128,7 +277,18 @@ func (top *Topologer) CreateExchange(
 	passiveDeclare, durable, autoDelete, internal, noWait bool,
 	args map[string]interface{}) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	if !passiveDeclare {
+		if err := top.naming.enforce(top.ConnectionPool.logger, NameKindExchange, exchangeName); err != nil {
+			return err
+		}
+	}
+
+	exchangeName = top.naming.Exchange(exchangeName)
+
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
 	if passiveDeclare {
@@ -141,42 +301,65 @@ func (top *Topologer) CreateExchange(
 // CreateExchangeFromConfig builds an Exchange toplogy from a config Exchange element.
 func (top *Topologer) CreateExchangeFromConfig(exchange *Exchange) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	if !exchange.PassiveDeclare {
+		if err := top.naming.enforce(top.ConnectionPool.logger, NameKindExchange, exchange.Name); err != nil {
+			return err
+		}
+	}
+
+	exchangeName := top.naming.Exchange(exchange.Name)
+
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
 	if exchange.PassiveDeclare {
 		return channel.ExchangeDeclarePassive(
-			exchange.Name,
+			exchangeName,
 			exchange.Type,
 			exchange.Durable,
 			exchange.AutoDelete,
 			exchange.InternalOnly,
 			exchange.NoWait,
-			exchange.Args)
+			exchangeArgs(exchange))
 	}
 
 	return channel.ExchangeDeclare(
-		exchange.Name,
+		exchangeName,
 		exchange.Type,
 		exchange.Durable,
 		exchange.AutoDelete,
 		exchange.InternalOnly,
 		exchange.NoWait,
-		exchange.Args)
+		exchangeArgs(exchange))
 }
 
 // ExchangeBind binds an exchange to an Exchange.
 func (top *Topologer) ExchangeBind(exchangeBinding *ExchangeBinding) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	err := top.naming.enforce(
+		top.ConnectionPool.logger,
+		NameKindExchange, exchangeBinding.ExchangeName,
+		NameKindExchange, exchangeBinding.ParentExchangeName,
+		NameKindRoutingKey, exchangeBinding.RoutingKey)
+	if err != nil {
+		return err
+	}
+
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
 	return channel.ExchangeBind(
-		exchangeBinding.ExchangeName,
+		top.naming.Exchange(exchangeBinding.ExchangeName),
 		exchangeBinding.RoutingKey,
-		exchangeBinding.ParentExchangeName,
+		top.naming.Exchange(exchangeBinding.ParentExchangeName),
 		exchangeBinding.NoWait,
-		exchangeBinding.Args)
+		bindingArgs(exchangeBinding.Args, exchangeBinding.Match, exchangeBinding.Headers))
 }
 
 // ExchangeDelete removes the exchange from the server.
@@ -184,22 +367,28 @@ func (top *Topologer) ExchangeDelete(
 	exchangeName string,
 	ifUnused, noWait bool) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
-	return channel.ExchangeDelete(exchangeName, ifUnused, noWait)
+	return channel.ExchangeDelete(top.naming.Exchange(exchangeName), ifUnused, noWait)
 }
 
 // ExchangeUnbind removes the binding of an Exchange to an Exchange.
 func (top *Topologer) ExchangeUnbind(exchangeName, routingKey, parentExchangeName string, noWait bool, args map[string]interface{}) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
 	return channel.ExchangeUnbind(
-		exchangeName,
+		top.naming.Exchange(exchangeName),
 		routingKey,
-		parentExchangeName,
+		top.naming.Exchange(parentExchangeName),
 		noWait,
 		amqp.Table(args))
 }
@@ -214,7 +403,18 @@ func (top *Topologer) CreateQueue(
 	noWait bool,
 	args map[string]interface{}) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	if !passiveDeclare {
+		if err := top.naming.enforce(top.ConnectionPool.logger, NameKindQueue, queueName); err != nil {
+			return err
+		}
+	}
+
+	queueName = top.naming.Queue(queueName)
+
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
 	if passiveDeclare {
@@ -222,18 +422,42 @@ func (top *Topologer) CreateQueue(
 		return err
 	}
 
-	_, err := channel.QueueDeclare(queueName, durable, autoDelete, exclusive, noWait, amqp.Table(args))
+	_, err = channel.QueueDeclare(queueName, durable, autoDelete, exclusive, noWait, amqp.Table(args))
 	return err
 }
 
 // CreateQueueFromConfig builds a Queue topology from a config Exchange element.
 func (top *Topologer) CreateQueueFromConfig(queue *Queue) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	if !queue.PassiveDeclare {
+		if err := top.naming.enforce(top.ConnectionPool.logger, NameKindQueue, queue.Name); err != nil {
+			return err
+		}
+	}
+
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
-	// classic is automatic and supports all classic properties, quorum type does not so this helps keep things functional
-	if queue.Type == QueueTypeQuorum {
+	normalizeQueue(queue)
+	queueName := top.naming.Queue(queue.Name)
+
+	if queue.PassiveDeclare {
+		_, err := channel.QueueDeclarePassive(queueName, queue.Durable, queue.AutoDelete, queue.Exclusive, queue.NoWait, queue.Args)
+		return err
+	}
+
+	_, err = channel.QueueDeclare(queueName, queue.Durable, queue.AutoDelete, queue.Exclusive, queue.NoWait, queue.Args)
+	return err
+}
+
+// normalizeQueue adjusts a quorum or stream queue's properties to ones the broker accepts.
+func normalizeQueue(queue *Queue) {
+
+	// classic is automatic and supports all classic properties, quorum and stream types do not so this helps keep things functional
+	if queue.Type == QueueTypeQuorum || queue.Type == QueueTypeStream {
 		queue.Exclusive = false
 		queue.Durable = true
 		queue.NoWait = false
@@ -245,37 +469,44 @@ func (top *Topologer) CreateQueueFromConfig(queue *Queue) error {
 			}
 		}
 	}
-
-	if queue.PassiveDeclare {
-		_, err := channel.QueueDeclarePassive(queue.Name, queue.Durable, queue.AutoDelete, queue.Exclusive, queue.NoWait, queue.Args)
-		return err
-	}
-
-	_, err := channel.QueueDeclare(queue.Name, queue.Durable, queue.AutoDelete, queue.Exclusive, queue.NoWait, queue.Args)
-	return err
 }
 
 // QueueDelete removes the queue from the server (and all bindings) and returns messages purged (count).
 func (top *Topologer) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return 0, err
+	}
 	defer channel.Close()
 
-	return channel.QueueDelete(name, ifUnused, ifEmpty, noWait)
+	return channel.QueueDelete(top.naming.Queue(name), ifUnused, ifEmpty, noWait)
 }
 
 // QueueBind binds an Exchange to a Queue.
 func (top *Topologer) QueueBind(queueBinding *QueueBinding) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	err := top.naming.enforce(
+		top.ConnectionPool.logger,
+		NameKindQueue, queueBinding.QueueName,
+		NameKindExchange, queueBinding.ExchangeName,
+		NameKindRoutingKey, queueBinding.RoutingKey)
+	if err != nil {
+		return err
+	}
+
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
 	return channel.QueueBind(
-		queueBinding.QueueName,
+		top.naming.Queue(queueBinding.QueueName),
 		queueBinding.RoutingKey,
-		queueBinding.ExchangeName,
+		top.naming.Exchange(queueBinding.ExchangeName),
 		queueBinding.NoWait,
-		queueBinding.Args)
+		bindingArgs(queueBinding.Args, queueBinding.Match, queueBinding.Headers))
 }
 
 // PurgeQueues purges each Queue provided.
@@ -301,23 +532,55 @@ func (top *Topologer) PurgeQueues(queueNames []string, noWait bool) (int, error)
 // PurgeQueue removes all messages from the Queue that are not waiting to be Acknowledged and returns the count.
 func (top *Topologer) PurgeQueue(queueName string, noWait bool) (int, error) {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return 0, err
+	}
 	defer channel.Close()
 
 	return channel.QueuePurge(
-		queueName,
+		top.naming.Queue(queueName),
 		noWait)
 }
 
+// QueueDepth is the count of the Queue's messages ready for delivery, read with a passive declare.
+func (top *Topologer) QueueDepth(queueName string) (int, error) {
+
+	var depth int
+	err := top.withTransientChannel(func(channel *amqp.Channel) error {
+		queue, err := channel.QueueDeclarePassive(top.naming.Queue(queueName), false, false, false, false, nil)
+		depth = queue.Messages
+		return err
+	})
+
+	return depth, err
+}
+
+// QueueCounts is the count of the Queue's messages ready for delivery and of its consumers, read with a passive
+// declare.
+func (top *Topologer) QueueCounts(queueName string) (messages int, consumers int, err error) {
+
+	err = top.withTransientChannel(func(channel *amqp.Channel) error {
+		queue, err := channel.QueueDeclarePassive(top.naming.Queue(queueName), false, false, false, false, nil)
+		messages, consumers = queue.Messages, queue.Consumers
+		return err
+	})
+
+	return messages, consumers, err
+}
+
 // UnbindQueue removes the binding of a Queue to an Exchange.
 func (top *Topologer) UnbindQueue(queueName, routingKey, exchangeName string, args map[string]interface{}) error {
 
-	channel := top.ConnectionPool.GetTransientChannel(false)
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
 	defer channel.Close()
 
 	return channel.QueueUnbind(
-		queueName,
+		top.naming.Queue(queueName),
 		routingKey,
-		exchangeName,
+		top.naming.Exchange(exchangeName),
 		amqp.Table(args))
 }
@@ -1,6 +1,6 @@
 package tcr
 
-import "github.com/streadway/amqp"
+import "github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 
 // Exchange allows for you to create Exchange topology.
 type Exchange struct {
@@ -12,6 +12,9 @@ type Exchange struct {
 	InternalOnly   bool       `json:"InternalOnly"`
 	NoWait         bool       `json:"NoWait"`
 	Args           amqp.Table `json:"Args,omitempty"` // map[string]interface()
+
+	// AlternateExchange receives the messages this exchange can't route, sets the alternate-exchange argument.
+	AlternateExchange string `json:"AlternateExchange,omitempty"`
 }
 
 // Queue allows for you to create Queue topology.
@@ -32,7 +35,9 @@ type QueueBinding struct {
 	ExchangeName string     `json:"ExchangeName"`
 	RoutingKey   string     `json:"RoutingKey"`
 	NoWait       bool       `json:"NoWait"`
-	Args         amqp.Table `json:"Args,omitempty"` // map[string]interface()
+	Args         amqp.Table `json:"Args,omitempty"`    // map[string]interface()
+	Match        string     `json:"Match,omitempty"`   // headers exchanges only, "all" or "any" headers must match
+	Headers      amqp.Table `json:"Headers,omitempty"` // headers exchanges only, the header values to match
 }
 
 // ExchangeBinding allows for you to create Bindings between an Exchange and Exchange.
@@ -41,5 +46,7 @@ type ExchangeBinding struct {
 	ParentExchangeName string     `json:"ParentExchangeName"`
 	RoutingKey         string     `json:"RoutingKey"`
 	NoWait             bool       `json:"NoWait"`
-	Args               amqp.Table `json:"Args,omitempty"` // map[string]interface()
+	Args               amqp.Table `json:"Args,omitempty"`    // map[string]interface()
+	Match              string     `json:"Match,omitempty"`   // headers exchanges only, "all" or "any" headers must match
+	Headers            amqp.Table `json:"Headers,omitempty"` // headers exchanges only, the header values to match
 }
@@ -0,0 +1,156 @@
+package tcr
+
+import (
+	"context"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+const (
+	// TraceHeader is the header carrying a message's trail of TraceHops.
+	TraceHeader = "x-trace"
+
+	// TraceActionPublish is the action recorded by a Publisher unless the context carries another.
+	TraceActionPublish = "publish"
+
+	defaultTraceMaxHops = 32
+)
+
+// traceActionKey and traceTrailKey are the context keys for the action to record and the trail to continue.
+type traceActionKey struct{}
+type traceTrailKey struct{}
+
+// TraceHop is one service's record in a message's trail.
+type TraceHop struct {
+	Service     string    `json:"Service"`
+	Action      string    `json:"Action"`
+	UTCDateTime time.Time `json:"UTCDateTime"`
+}
+
+// tracer appends the Publisher's hop to the trail of every letter it publishes.
+type tracer struct {
+	service string
+	maxHops int
+}
+
+// newTracer creates a tracer from config, naming hops after service when the config doesn't. Returns nil when
+// not enabled.
+func newTracer(config *TraceConfig, service string) *tracer {
+
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	tr := &tracer{service: config.Service, maxHops: int(config.MaxHops)}
+	if tr.service == "" {
+		tr.service = service
+	}
+
+	if tr.maxHops <= 0 {
+		tr.maxHops = defaultTraceMaxHops
+	}
+
+	return tr
+}
+
+// apply appends a hop to the letter's trail, which continues the trail carried by ctx when the letter has none.
+func (tr *tracer) apply(ctx context.Context, letter *Letter) {
+
+	if tr == nil || letter.Envelope == nil {
+		return
+	}
+
+	trail := traceHops(letter.Envelope.Headers)
+	if len(trail) == 0 && ctx != nil {
+		trail, _ = ctx.Value(traceTrailKey{}).([]TraceHop)
+	}
+
+	action := TraceActionPublish
+	if ctx != nil {
+		if contextAction, ok := ctx.Value(traceActionKey{}).(string); ok && contextAction != "" {
+			action = contextAction
+		}
+	}
+
+	hops := make([]TraceHop, 0, len(trail)+1)
+	hops = append(hops, trail...)
+	hops = append(hops, TraceHop{Service: tr.service, Action: action, UTCDateTime: time.Now().UTC()})
+	if len(hops) > tr.maxHops {
+		hops = hops[len(hops)-tr.maxHops:] // the oldest are dropped
+	}
+
+	// Copied, so headers shared between letters don't share a trail.
+	headers := make(amqp.Table, len(letter.Envelope.Headers)+1)
+	for key, value := range letter.Envelope.Headers {
+		headers[key] = value
+	}
+	headers[TraceHeader] = encodeTrace(hops)
+	letter.Envelope.Headers = headers
+}
+
+// WithTraceAction returns a copy of ctx carrying the action recorded in the hop of letters published with it,
+// ex. "approve" or "forward", instead of TraceActionPublish.
+func WithTraceAction(ctx context.Context, action string) context.Context {
+	return context.WithValue(ctx, traceActionKey{}, action)
+}
+
+// Trace is the trail of TraceHops the message has accumulated, oldest first. Empty when it wasn't traced.
+func (msg *ReceivedMessage) Trace() []TraceHop {
+	return traceHops(msg.Headers)
+}
+
+// WithTrace returns a copy of ctx carrying the message's trail, so letters published while handling it, through
+// PublishWithConfirmationContext or PublishAndWait, continue the trail instead of starting a new one.
+func (msg *ReceivedMessage) WithTrace(ctx context.Context) context.Context {
+
+	trail := msg.Trace()
+	if len(trail) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, traceTrailKey{}, trail)
+}
+
+// encodeTrace converts hops into the header's array of tables.
+func encodeTrace(hops []TraceHop) []interface{} {
+
+	encoded := make([]interface{}, 0, len(hops))
+	for _, hop := range hops {
+		encoded = append(encoded, amqp.Table{
+			"service":   hop.Service,
+			"action":    hop.Action,
+			"timestamp": hop.UTCDateTime.Format(time.RFC3339Nano),
+		})
+	}
+
+	return encoded
+}
+
+// traceHops parses the trail in the headers, skipping hops it can't read.
+func traceHops(headers amqp.Table) []TraceHop {
+
+	encoded, ok := headers[TraceHeader].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	hops := make([]TraceHop, 0, len(encoded))
+	for _, value := range encoded {
+		table, ok := value.(amqp.Table)
+		if !ok {
+			continue
+		}
+
+		hop := TraceHop{}
+		hop.Service, _ = table["service"].(string)
+		hop.Action, _ = table["action"].(string)
+		if timestamp, ok := table["timestamp"].(string); ok {
+			hop.UTCDateTime, _ = time.Parse(time.RFC3339Nano, timestamp)
+		}
+
+		hops = append(hops, hop)
+	}
+
+	return hops
+}
@@ -0,0 +1,58 @@
+package tcr
+
+import (
+	"fmt"
+	"time"
+)
+
+// ttlPolicies applies the default expiration of the first matching TTLPolicy to letters without one.
+type ttlPolicies struct {
+	policies []*TTLPolicy
+}
+
+// newTTLPolicies creates ttlPolicies from the policies. Returns nil when there are none.
+func newTTLPolicies(policies []*TTLPolicy) (*ttlPolicies, error) {
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	tp := &ttlPolicies{policies: make([]*TTLPolicy, 0, len(policies))}
+	for _, policy := range policies {
+		if policy == nil {
+			continue
+		}
+
+		if policy.RoutingKey != "" {
+			if err := ValidateTopicPattern(policy.RoutingKey); err != nil {
+				return nil, fmt.Errorf("invalid ttl policy for exchange %q: %w", policy.Exchange, err)
+			}
+		}
+
+		tp.policies = append(tp.policies, policy)
+	}
+
+	return tp, nil
+}
+
+// apply sets the letter's Expiration from the first policy matching its exchange and routing key, leaving
+// letters with an Expiration of their own as they are.
+func (tp *ttlPolicies) apply(letter *Letter) {
+
+	if tp == nil || letter.Envelope == nil || letter.Envelope.Expiration > 0 {
+		return
+	}
+
+	for _, policy := range tp.policies {
+		if policy.Exchange != AnyExchange && policy.Exchange != letter.Envelope.Exchange {
+			continue
+		}
+
+		if policy.RoutingKey != "" && !matchTopic(policy.RoutingKey, letter.Envelope.RoutingKey) {
+			continue
+		}
+
+		letter.Envelope.Expiration = time.Duration(policy.Expiration) * time.Millisecond
+		return
+	}
+}
@@ -0,0 +1,78 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// ErrUndecodable is matched by the error a typed handler returns for a message whose Body it couldn't decode.
+var ErrUndecodable = errors.New("message body could not be decoded")
+
+// DeliveryMeta is what a typed handler gets to know about a message besides its decoded Body.
+type DeliveryMeta struct {
+	MessageID       string
+	CorrelationID   string
+	ContentType     string
+	ContentEncoding string
+	Exchange        string
+	RoutingKey      string
+	Queue           string
+	Headers         amqp.Table
+	Message         *ReceivedMessage // settled for the handler, don't acknowledge it
+}
+
+// Consume starts the Consumer with a handler decoding each message's Body into a T, with the Codec registered for
+// its ContentType, and calling handler with it. Messages are acknowledged when handler returns nil, otherwise
+// they're nacked or retried as in StartConsumingWithHandler. One that can't be decoded fails with ErrUndecodable
+// without calling handler.
+func Consume[T any](con *Consumer, handler func(ctx context.Context, value T, meta DeliveryMeta) error) error {
+	return con.StartConsumingWithHandler(TypedHandler(handler))
+}
+
+// TypedHandler adapts a typed handler to a handler of ReceivedMessages, for a ConsumerGroup or Dispatcher route.
+// The ctx handed to it is the message's Context, carrying its correlation ID and trace, so letters published with
+// it continue the message's lineage. A pointer T, ex. a protobuf message, is allocated before decoding.
+func TypedHandler[T any](handler func(ctx context.Context, value T, meta DeliveryMeta) error) func(*ReceivedMessage) error {
+
+	return func(msg *ReceivedMessage) error {
+
+		value, err := decodeAs[T](msg)
+		if err != nil {
+			return err
+		}
+
+		ctx := msg.WithTrace(msg.WithCorrelation(msg.Context()))
+		return handler(ctx, value, DeliveryMeta{
+			MessageID:       msg.MessageID,
+			CorrelationID:   msg.CorrelationID,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			Exchange:        msg.Exchange,
+			RoutingKey:      msg.RoutingKey,
+			Queue:           msg.Queue,
+			Headers:         msg.Headers,
+			Message:         msg,
+		})
+	}
+}
+
+// decodeAs decodes the message's Body into a new T.
+func decodeAs[T any](msg *ReceivedMessage) (T, error) {
+
+	var value T
+	var output interface{} = &value
+	if valueType := reflect.TypeOf(value); valueType != nil && valueType.Kind() == reflect.Ptr {
+		value = reflect.New(valueType.Elem()).Interface().(T)
+		output = value
+	}
+
+	if err := msg.Decode(output); err != nil {
+		return value, fmt.Errorf("%w into %T: %s", ErrUndecodable, value, err)
+	}
+
+	return value, nil
+}
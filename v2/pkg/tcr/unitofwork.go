@@ -0,0 +1,163 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnitOfWorkDone is returned when staging, committing, or rolling back a UnitOfWork that was already
+// committed or rolled back.
+var ErrUnitOfWorkDone = errors.New("unit of work already committed or rolled back")
+
+// UnitOfWork ties a consumed message to the letters published while handling it. Letters are staged instead of
+// published, Commit publishes them all and only acknowledges the message once every one is confirmed, otherwise
+// the message is requeued. A crash or failure between the two means the message is redelivered and some letters
+// may be published twice, so downstream consumers should dedupe by MessageID.
+type UnitOfWork struct {
+	Message   *ReceivedMessage
+	publisher *Publisher
+	staged    []*Letter
+	done      bool
+	workLock  *sync.Mutex
+}
+
+// NewUnitOfWork creates a UnitOfWork for the message, publishing its staged letters with the publisher.
+func NewUnitOfWork(msg *ReceivedMessage, publisher *Publisher) *UnitOfWork {
+
+	return &UnitOfWork{
+		Message:   msg,
+		publisher: publisher,
+		workLock:  &sync.Mutex{},
+	}
+}
+
+// Stage adds the letter to the publishes of the Commit.
+func (uow *UnitOfWork) Stage(letter *Letter) error {
+	uow.workLock.Lock()
+	defer uow.workLock.Unlock()
+
+	if uow.done {
+		return ErrUnitOfWorkDone
+	}
+
+	uow.staged = append(uow.staged, letter)
+	return nil
+}
+
+// Staged is the number of letters staged.
+func (uow *UnitOfWork) Staged() int {
+	uow.workLock.Lock()
+	defer uow.workLock.Unlock()
+
+	return len(uow.staged)
+}
+
+// Commit publishes the staged letters, waiting for each to be confirmed, then acknowledges the message. When any
+// publish fails, or ctx is done first, the message is nacked and requeued and the failures returned. Letters
+// carry the message's correlation ID and trace. Without a message to acknowledge (AutoAck), Commit only publishes.
+func (uow *UnitOfWork) Commit(ctx context.Context) error {
+
+	letters, err := uow.finish()
+	if err != nil {
+		return err
+	}
+
+	ctx = uow.Message.WithTrace(uow.Message.WithCorrelation(ctx))
+
+	futures := make([]*PublishFuture, 0, len(letters))
+	for _, letter := range letters {
+		futures = append(futures, uow.publisher.PublishAsync(ctx, letter))
+	}
+
+	var failures []error
+	for _, future := range futures {
+		if err := future.Wait(ctx); err != nil {
+			failures = append(failures, fmt.Errorf("letter %d: %w", future.LetterID, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		err = fmt.Errorf("unit of work publishes failed: %w", errors.Join(failures...))
+		if uow.Message.IsAckable {
+			if nackErr := uow.Message.Nack(true); nackErr != nil {
+				return errors.Join(err, fmt.Errorf("unable to requeue message: %w", nackErr))
+			}
+		}
+
+		return err
+	}
+
+	if !uow.Message.IsAckable {
+		return nil
+	}
+
+	if err := uow.Message.Acknowledge(); err != nil {
+		return fmt.Errorf("unit of work published but unable to acknowledge message: %w", err)
+	}
+
+	return nil
+}
+
+// Rollback discards the staged letters and nacks the message, requeueing it when asked to.
+func (uow *UnitOfWork) Rollback(requeue bool) error {
+
+	if _, err := uow.finish(); err != nil {
+		return err
+	}
+
+	if !uow.Message.IsAckable {
+		return nil
+	}
+
+	return uow.Message.Nack(requeue)
+}
+
+// finish marks the UnitOfWork done and hands back its staged letters.
+func (uow *UnitOfWork) finish() ([]*Letter, error) {
+	uow.workLock.Lock()
+	defer uow.workLock.Unlock()
+
+	if uow.done {
+		return nil, ErrUnitOfWorkDone
+	}
+
+	uow.done = true
+	letters := uow.staged
+	uow.staged = nil
+
+	return letters, nil
+}
+
+// finished reports whether the UnitOfWork was committed or rolled back.
+func (uow *UnitOfWork) finished() bool {
+	uow.workLock.Lock()
+	defer uow.workLock.Unlock()
+
+	return uow.done
+}
+
+// StartConsumingWithUnitOfWork starts the Consumer, handing each message to handler in a UnitOfWork whose staged
+// letters are published with the publisher. The UnitOfWork is committed when handler returns nil. When handler
+// returns an error the staged letters are discarded and the message is nacked, or retried with a RetryConfig, as in
+// StartConsumingWithHandler. The ctx handed to handler is the message's Context, carrying its correlation ID and
+// trace.
+func (con *Consumer) StartConsumingWithUnitOfWork(publisher *Publisher, handler func(ctx context.Context, uow *UnitOfWork) error) error {
+
+	return con.StartConsumingWithHandler(func(msg *ReceivedMessage) error {
+
+		uow := NewUnitOfWork(msg, publisher)
+		ctx := msg.WithTrace(msg.WithCorrelation(msg.Context()))
+		if err := handler(ctx, uow); err != nil {
+			_, _ = uow.finish()
+			return err
+		}
+
+		if uow.finished() {
+			return nil // committed or rolled back by handler
+		}
+
+		return uow.Commit(ctx) // settles the message itself
+	})
+}
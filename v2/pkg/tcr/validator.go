@@ -0,0 +1,165 @@
+package tcr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// AnyExchange registers a Validator for letters published to every exchange, including the default one.
+const AnyExchange = "*"
+
+// Validator checks a letter before it is published. Plug in a JSON Schema library, or use the JSONValidator and
+// ProtobufValidator provided, so malformed events are rejected at the producer instead of poisoning consumers.
+type Validator interface {
+	Validate(letter *Letter) error
+}
+
+// ValidatorFunc lets an ordinary function be a Validator.
+type ValidatorFunc func(letter *Letter) error
+
+// Validate calls the function.
+func (fn ValidatorFunc) Validate(letter *Letter) error {
+	return fn(letter)
+}
+
+// ValidationError is a letter a Validator rejected. Publishing returns it without sending the letter.
+type ValidationError struct {
+	LetterID   uint64
+	Exchange   string
+	RoutingKey string
+	Err        error
+}
+
+// Error allows you to quickly log the ValidationError struct as a string.
+func (ve *ValidationError) Error() string {
+	return fmt.Sprintf("letter %d for %s/%s failed validation: %s", ve.LetterID, ve.Exchange, ve.RoutingKey, ve.Err)
+}
+
+// Unwrap returns the Validator's error.
+func (ve *ValidationError) Unwrap() error {
+	return ve.Err
+}
+
+type validatorRoute struct {
+	exchange   string
+	routingKey string
+	validator  Validator
+}
+
+// Validators picks the Validators for a letter by its exchange and routing key. Register them before publishing.
+type Validators struct {
+	routes []validatorRoute
+}
+
+// NewValidators creates an empty set of Validators.
+func NewValidators() *Validators {
+	return &Validators{}
+}
+
+// Add registers a Validator for letters published to the exchange (AnyExchange for all) whose routing key
+// matches the topic style pattern, where * matches one word and # zero or more. Returns the Validators to chain.
+func (vs *Validators) Add(exchange, routingKeyPattern string, validator Validator) *Validators {
+
+	vs.routes = append(vs.routes, validatorRoute{exchange: exchange, routingKey: routingKeyPattern, validator: validator})
+	return vs
+}
+
+// Validate runs every matching Validator in the order added, returning a ValidationError for the first failure.
+func (vs *Validators) Validate(letter *Letter) error {
+
+	if vs == nil {
+		return nil
+	}
+
+	for _, route := range vs.routes {
+		if route.exchange != AnyExchange && route.exchange != letter.Envelope.Exchange {
+			continue
+		}
+
+		if !matchTopic(route.routingKey, letter.Envelope.RoutingKey) {
+			continue
+		}
+
+		if err := route.validator.Validate(letter); err != nil {
+			return &ValidationError{
+				LetterID:   letter.LetterID,
+				Exchange:   letter.Envelope.Exchange,
+				RoutingKey: letter.Envelope.RoutingKey,
+				Err:        err,
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchTopic reports whether the routing key matches the topic exchange style pattern.
+func matchTopic(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+	}
+}
+
+// JSONValidator requires letter bodies to be JSON, and JSON objects to have the required top level fields.
+func JSONValidator(requiredFields ...string) Validator {
+
+	return ValidatorFunc(func(letter *Letter) error {
+
+		if len(requiredFields) == 0 {
+			if !json.Valid(letter.Body) {
+				return errors.New("body is not valid json")
+			}
+			return nil
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(letter.Body, &fields); err != nil {
+			return fmt.Errorf("body is not a json object: %w", err)
+		}
+
+		for _, field := range requiredFields {
+			if _, ok := fields[field]; !ok {
+				return fmt.Errorf("body is missing required field %q", field)
+			}
+		}
+
+		return nil
+	})
+}
+
+// ProtobufValidator requires letter bodies to unmarshal as the message's type, with its required fields set.
+func ProtobufValidator(message proto.Message) Validator {
+
+	return ValidatorFunc(func(letter *Letter) error {
+
+		decoded := message.ProtoReflect().New().Interface()
+		if err := proto.Unmarshal(letter.Body, decoded); err != nil {
+			return fmt.Errorf("body is not a valid %s: %w", message.ProtoReflect().Descriptor().FullName(), err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,426 @@
+package tcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+)
+
+// TopologyIssue is how a configured entity differs from the broker.
+type TopologyIssue string
+
+const (
+	// TopologyMissing means the exchange or queue doesn't exist, or a binding references one that doesn't.
+	TopologyMissing TopologyIssue = "missing"
+
+	// TopologyMismatched means the entity exists with different durability, flags, or arguments.
+	TopologyMismatched TopologyIssue = "mismatched"
+
+	// TopologyUnverified means the entity exists but its properties and arguments couldn't be compared, without a
+	// TopologyInspector or when the inspector failed.
+	TopologyUnverified TopologyIssue = "unverified"
+)
+
+// TopologyInspector reads the properties and arguments of an existing exchange or queue, by its declared name,
+// like tcrmgmt's Client through the management API. AMQP has no way to read them.
+type TopologyInspector interface {
+	InspectExchange(ctx context.Context, name string) (*Exchange, error)
+	InspectQueue(ctx context.Context, name string) (*Queue, error)
+}
+
+// SetTopologyInspector lets VerifyTopology compare the properties and arguments of existing exchanges and queues.
+// Without one they're reported as unverified. Nil removes the inspector.
+func (top *Topologer) SetTopologyInspector(inspector TopologyInspector) {
+	top.inspector = inspector
+}
+
+// TopologyDifference is one configured entity that doesn't match the broker.
+type TopologyDifference struct {
+	Kind   string // "exchange", "queue", "queue binding", or "exchange binding"
+	Name   string
+	Issue  TopologyIssue
+	Detail string // the broker's reason when it gave one
+}
+
+// TopologyDiff is the result of VerifyTopology, empty when the broker matches the config.
+type TopologyDiff struct {
+	Differences []*TopologyDifference
+}
+
+// Empty is true when nothing is missing, mismatched, or unverified.
+func (diff *TopologyDiff) Empty() bool {
+	return len(diff.Differences) == 0
+}
+
+// Issues returns the differences with the given issue.
+func (diff *TopologyDiff) Issues(issue TopologyIssue) []*TopologyDifference {
+
+	var differences []*TopologyDifference
+	for _, difference := range diff.Differences {
+		if difference.Issue == issue {
+			differences = append(differences, difference)
+		}
+	}
+
+	return differences
+}
+
+// String lists each difference on its own line.
+func (diff *TopologyDiff) String() string {
+
+	sb := &strings.Builder{}
+	for _, difference := range diff.Differences {
+		fmt.Fprintf(sb, "%s %s %s", difference.Kind, difference.Name, difference.Issue)
+		if difference.Detail != "" {
+			fmt.Fprintf(sb, ": %s", difference.Detail)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func (diff *TopologyDiff) add(kind, name string, issue TopologyIssue, detail string) {
+	diff.Differences = append(diff.Differences, &TopologyDifference{Kind: kind, Name: name, Issue: issue, Detail: detail})
+}
+
+// VerifyTopology checks the config against the broker without creating anything and returns what differs.
+// Exchanges and queues are only declared passively, to find what's missing, so no configure permission is needed.
+// The properties and arguments of those that exist are compared through the TopologyInspector, and reported as
+// unverified without one. AMQP can't inspect bindings, so bindings are only checked for exchanges and queues that
+// don't exist. The error is reserved for failures other than a difference.
+func (top *Topologer) VerifyTopology(config *TopologyConfig) (*TopologyDiff, error) {
+	return top.VerifyTopologyContext(context.Background(), config)
+}
+
+// VerifyTopologyContext is VerifyTopology, stopping with ctx's error once ctx is done. The TopologyInspector is
+// called with ctx.
+func (top *Topologer) VerifyTopologyContext(ctx context.Context, config *TopologyConfig) (*TopologyDiff, error) {
+
+	diff := &TopologyDiff{}
+	exists := map[string]bool{} // keyed by kind and name so exchanges and queues can share names
+
+	for _, exchange := range config.Exchanges {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		found, err := top.verifyExchange(ctx, diff, exchange)
+		if err != nil {
+			return nil, err
+		}
+
+		exists["exchange "+exchange.Name] = found
+	}
+
+	for _, queue := range config.Queues {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		found, err := top.verifyQueue(ctx, diff, queue)
+		if err != nil {
+			return nil, err
+		}
+
+		exists["queue "+queue.Name] = found
+	}
+
+	for _, binding := range config.QueueBindings {
+		name := fmt.Sprintf("%s->%s (%s)", binding.ExchangeName, binding.QueueName, binding.RoutingKey)
+
+		for _, endpoint := range []struct{ kind, name string }{{"exchange", binding.ExchangeName}, {"queue", binding.QueueName}} {
+			found, err := top.endpointExists(exists, endpoint.kind, endpoint.name)
+			if err != nil {
+				return nil, err
+			}
+
+			if !found {
+				diff.add("queue binding", name, TopologyMissing, endpoint.kind+" "+endpoint.name+" not found")
+			}
+		}
+	}
+
+	for _, binding := range config.ExchangeBindings {
+		name := fmt.Sprintf("%s->%s (%s)", binding.ParentExchangeName, binding.ExchangeName, binding.RoutingKey)
+
+		for _, exchangeName := range []string{binding.ParentExchangeName, binding.ExchangeName} {
+			found, err := top.endpointExists(exists, "exchange", exchangeName)
+			if err != nil {
+				return nil, err
+			}
+
+			if !found {
+				diff.add("exchange binding", name, TopologyMissing, "exchange "+exchangeName+" not found")
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// verifyExchange records any difference for the exchange and reports whether it exists.
+func (top *Topologer) verifyExchange(ctx context.Context, diff *TopologyDiff, exchange *Exchange) (bool, error) {
+
+	found, err := top.exchangeExists(exchange.Name)
+	if err != nil || !found {
+		if err == nil {
+			diff.add("exchange", exchange.Name, TopologyMissing, "")
+		}
+		return false, err
+	}
+
+	if top.inspector == nil {
+		diff.add("exchange", exchange.Name, TopologyUnverified, "no TopologyInspector to compare its properties and arguments")
+		return true, nil
+	}
+
+	actual, err := top.inspector.InspectExchange(ctx, top.naming.Exchange(exchange.Name))
+	if err != nil {
+		diff.add("exchange", exchange.Name, TopologyUnverified, err.Error())
+		return true, nil
+	}
+
+	expected := &Exchange{
+		Type:         exchange.Type,
+		Durable:      exchange.Durable,
+		AutoDelete:   exchange.AutoDelete,
+		InternalOnly: exchange.InternalOnly,
+		Args:         exchangeArgs(exchange),
+	}
+
+	mismatches := compareProperties(
+		[]string{"type", "durable", "auto delete", "internal"},
+		[]interface{}{expected.Type, expected.Durable, expected.AutoDelete, expected.InternalOnly},
+		[]interface{}{actual.Type, actual.Durable, actual.AutoDelete, actual.InternalOnly})
+	mismatches = append(mismatches, compareArgs(expected.Args, actual.Args)...)
+
+	if len(mismatches) > 0 {
+		diff.add("exchange", exchange.Name, TopologyMismatched, strings.Join(mismatches, ", "))
+	}
+
+	return true, nil
+}
+
+// verifyQueue records any difference for the queue and reports whether it exists.
+func (top *Topologer) verifyQueue(ctx context.Context, diff *TopologyDiff, queue *Queue) (bool, error) {
+
+	found, err := top.queueExists(queue.Name)
+	if err != nil || !found {
+		if err == nil {
+			diff.add("queue", queue.Name, TopologyMissing, "")
+		}
+		return false, err
+	}
+
+	if top.inspector == nil {
+		diff.add("queue", queue.Name, TopologyUnverified, "no TopologyInspector to compare its properties and arguments")
+		return true, nil
+	}
+
+	actual, err := top.inspector.InspectQueue(ctx, top.naming.Queue(queue.Name))
+	if err != nil {
+		diff.add("queue", queue.Name, TopologyUnverified, err.Error())
+		return true, nil
+	}
+
+	expected := *queue
+	normalizeQueue(&expected)
+
+	mismatches := compareProperties(
+		[]string{"type", "durable", "auto delete", "exclusive"},
+		[]interface{}{queueType(&expected), expected.Durable, expected.AutoDelete, expected.Exclusive},
+		[]interface{}{queueType(actual), actual.Durable, actual.AutoDelete, actual.Exclusive})
+	mismatches = append(mismatches, compareArgs(withoutQueueType(expected.Args), withoutQueueType(actual.Args))...)
+
+	if len(mismatches) > 0 {
+		diff.add("queue", queue.Name, TopologyMismatched, strings.Join(mismatches, ", "))
+	}
+
+	return true, nil
+}
+
+// queueType is the queue's type, from its Type or x-queue-type argument, classic when neither is set.
+func queueType(queue *Queue) string {
+
+	if queue.Type != "" {
+		return queue.Type
+	}
+
+	if queueType, ok := queue.Args["x-queue-type"].(string); ok && queueType != "" {
+		return queueType
+	}
+
+	return QueueTypeClassic
+}
+
+// withoutQueueType drops the x-queue-type argument, compared as the queue's type instead.
+func withoutQueueType(args amqp.Table) amqp.Table {
+
+	if _, ok := args["x-queue-type"]; !ok {
+		return args
+	}
+
+	copied := make(amqp.Table, len(args))
+	for key, value := range args {
+		if key != "x-queue-type" {
+			copied[key] = value
+		}
+	}
+
+	return copied
+}
+
+// compareProperties describes each named property whose expected and actual values differ.
+func compareProperties(names []string, expected, actual []interface{}) []string {
+
+	var mismatches []string
+	for i, name := range names {
+		if expected[i] != actual[i] {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %v, expected %v", name, actual[i], expected[i]))
+		}
+	}
+
+	return mismatches
+}
+
+// compareArgs describes each argument missing, extra, or different. Numbers compare by value, whatever their type,
+// since the management API returns them all as floats.
+func compareArgs(expected, actual amqp.Table) []string {
+
+	var mismatches []string
+	for key, value := range expected {
+		actualValue, ok := actual[key]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("argument %s is missing, expected %v", key, value))
+		case !argEqual(value, actualValue):
+			mismatches = append(mismatches, fmt.Sprintf("argument %s is %v, expected %v", key, actualValue, value))
+		}
+	}
+
+	for key, value := range actual {
+		if _, ok := expected[key]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("argument %s is %v, expected none", key, value))
+		}
+	}
+
+	return mismatches
+}
+
+func argEqual(expected, actual interface{}) bool {
+
+	expectedNumber, expectedOk := argNumber(expected)
+	actualNumber, actualOk := argNumber(actual)
+	if expectedOk && actualOk {
+		return expectedNumber == actualNumber
+	}
+
+	return reflect.DeepEqual(expected, actual)
+}
+
+func argNumber(value interface{}) (float64, bool) {
+
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
+
+// endpointExists looks up a binding endpoint, passively declaring the ones not in the config.
+func (top *Topologer) endpointExists(exists map[string]bool, kind, name string) (bool, error) {
+
+	if found, ok := exists[kind+" "+name]; ok {
+		return found, nil
+	}
+
+	var found bool
+	var err error
+	if kind == "exchange" {
+		found, err = top.exchangeExists(name)
+	} else {
+		found, err = top.queueExists(name)
+	}
+
+	if err == nil {
+		exists[kind+" "+name] = found
+	}
+
+	return found, err
+}
+
+func (top *Topologer) exchangeExists(name string) (bool, error) {
+
+	if name == "" || strings.HasPrefix(name, "amq.") {
+		return true, nil // the default and built-in exchanges always exist
+	}
+
+	return top.passiveExists(func(channel *amqp.Channel) error {
+		return channel.ExchangeDeclarePassive(top.naming.Exchange(name), "", false, false, false, false, nil)
+	})
+}
+
+func (top *Topologer) queueExists(name string) (bool, error) {
+
+	return top.passiveExists(func(channel *amqp.Channel) error {
+		_, err := channel.QueueDeclarePassive(top.naming.Queue(name), false, false, false, false, nil)
+		return err
+	})
+}
+
+// passiveExists runs a passive declare, treating NOT_FOUND as absent. The broker closes the channel on
+// any failure, so each check uses its own transient channel.
+func (top *Topologer) passiveExists(declare func(*amqp.Channel) error) (bool, error) {
+
+	err := top.withTransientChannel(declare)
+
+	var amqpError *amqp.Error
+	if errors.As(err, &amqpError) {
+		switch amqpError.Code {
+		case amqp.NotFound:
+			return false, nil
+		case amqp.ResourceLocked: // exclusive to another connection, but it's there
+			return true, nil
+		}
+	}
+
+	return err == nil, err
+}
+
+// withTransientChannel runs one declare on its own transient channel, closed afterwards.
+func (top *Topologer) withTransientChannel(declare func(*amqp.Channel) error) error {
+
+	channel, err := top.ConnectionPool.createTransientChannel(false, false)
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	return declare(channel)
+}
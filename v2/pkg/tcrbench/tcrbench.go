@@ -0,0 +1,295 @@
+// Package tcrbench drives configurable publish and consume load through a tcr.ConnectionPool and reports
+// throughput, latency percentiles, and error counts. Use it to size pools or to regression test tcr itself.
+package tcrbench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
+)
+
+// SentHeader carries the publish time (unix nanoseconds) used to measure end to end latency.
+const SentHeader = "x-tcrbench-sent"
+
+// Config describes the load to generate.
+type Config struct {
+	QueueName         string        // declared as a non-durable auto-delete queue, defaults to "TcrBench"
+	MessageSize       int           // body size in bytes, defaults to 1024
+	MessagesPerSecond float64       // total publish rate across all publishers, 0 is unlimited
+	Duration          time.Duration // how long to publish, defaults to 10 seconds
+	DrainTimeout      time.Duration // how long to wait for consumers to catch up afterwards, defaults to 5 seconds
+	Publishers        int           // concurrent publishers using PublishWithConfirmation, defaults to 1
+	Consumers         int           // concurrent auto-ack consumers, defaults to 1
+	PublishTimeout    time.Duration // confirmation timeout per publish, defaults to 5 seconds
+}
+
+// Report is the outcome of a Run.
+type Report struct {
+	Published       uint64
+	PublishErrors   uint64
+	Consumed        uint64
+	ConsumeErrors   uint64
+	Duration        time.Duration
+	PublishLatency  *tcr.HistogramSnapshot // publish to broker confirmation
+	EndToEndLatency *tcr.HistogramSnapshot // publish to consumer receipt
+}
+
+// PublishRate is confirmed publishes per second.
+func (r *Report) PublishRate() float64 {
+	return rate(r.Published, r.Duration)
+}
+
+// ConsumeRate is received messages per second.
+func (r *Report) ConsumeRate() float64 {
+	return rate(r.Consumed, r.Duration)
+}
+
+// PublishErrorRate is the fraction of publish attempts that failed.
+func (r *Report) PublishErrorRate() float64 {
+
+	attempts := r.Published + r.PublishErrors
+	if attempts == 0 {
+		return 0
+	}
+
+	return float64(r.PublishErrors) / float64(attempts)
+}
+
+// String summarizes the Report for printing.
+func (r *Report) String() string {
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "duration:    %s\n", r.Duration)
+	fmt.Fprintf(sb, "published:   %d (%.1f msg/s, %d errors, %.2f%% error rate)\n", r.Published, r.PublishRate(), r.PublishErrors, r.PublishErrorRate()*100)
+	fmt.Fprintf(sb, "consumed:    %d (%.1f msg/s, %d errors)\n", r.Consumed, r.ConsumeRate(), r.ConsumeErrors)
+	fmt.Fprintf(sb, "publish:     p50 <= %s, p99 <= %s, max %s\n", r.PublishLatency.Percentile(0.5), r.PublishLatency.Percentile(0.99), r.PublishLatency.Max)
+	fmt.Fprintf(sb, "end to end:  p50 <= %s, p99 <= %s, max %s\n", r.EndToEndLatency.Percentile(0.5), r.EndToEndLatency.Percentile(0.99), r.EndToEndLatency.Max)
+
+	return sb.String()
+}
+
+func rate(count uint64, duration time.Duration) float64 {
+
+	if duration <= 0 {
+		return 0
+	}
+
+	return float64(count) / duration.Seconds()
+}
+
+// latencyBuckets are finer than tcr.DefaultLatencyBuckets since publishes are usually sub-millisecond to seconds.
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Run publishes and consumes on cp for the configured duration, then waits for consumers to drain.
+// The channel and connection counts under test are those of cp's PoolConfig.
+func Run(ctx context.Context, cp *tcr.ConnectionPool, config *Config) (*Report, error) {
+
+	if cp == nil {
+		return nil, errors.New("tcrbench requires a connectionpool")
+	}
+
+	config = withDefaults(config)
+
+	topologer := tcr.NewTopologer(cp)
+	if err := topologer.CreateQueue(config.QueueName, false, false, true, false, false, nil); err != nil {
+		return nil, fmt.Errorf("tcrbench unable to declare queue %s: %w", config.QueueName, err)
+	}
+
+	b := &bench{
+		config:          config,
+		cp:              cp,
+		publishLatency:  tcr.NewHistogram(latencyBuckets),
+		endToEndLatency: tcr.NewHistogram(latencyBuckets),
+		rateLimiter:     tcr.NewRateLimiter(&tcr.RateLimitConfig{MessagesPerSecond: config.MessagesPerSecond}),
+	}
+
+	consumers := b.startConsumers()
+
+	publishCtx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	start := time.Now()
+	b.publish(publishCtx)
+	duration := time.Since(start)
+
+	b.drain(ctx, consumers)
+
+	return &Report{
+		Published:       atomic.LoadUint64(&b.published),
+		PublishErrors:   atomic.LoadUint64(&b.publishErrors),
+		Consumed:        atomic.LoadUint64(&b.consumed),
+		ConsumeErrors:   atomic.LoadUint64(&b.consumeErrors),
+		Duration:        duration,
+		PublishLatency:  b.publishLatency.Snapshot(),
+		EndToEndLatency: b.endToEndLatency.Snapshot(),
+	}, nil
+}
+
+func withDefaults(config *Config) *Config {
+
+	copied := Config{}
+	if config != nil {
+		copied = *config
+	}
+
+	if copied.QueueName == "" {
+		copied.QueueName = "TcrBench"
+	}
+
+	if copied.MessageSize <= 0 {
+		copied.MessageSize = 1024
+	}
+
+	if copied.Duration <= 0 {
+		copied.Duration = 10 * time.Second
+	}
+
+	if copied.DrainTimeout <= 0 {
+		copied.DrainTimeout = 5 * time.Second
+	}
+
+	if copied.Publishers <= 0 {
+		copied.Publishers = 1
+	}
+
+	if copied.Consumers <= 0 {
+		copied.Consumers = 1
+	}
+
+	if copied.PublishTimeout <= 0 {
+		copied.PublishTimeout = 5 * time.Second
+	}
+
+	return &copied
+}
+
+type bench struct {
+	config          *Config
+	cp              *tcr.ConnectionPool
+	rateLimiter     *tcr.RateLimiter
+	publishLatency  *tcr.Histogram
+	endToEndLatency *tcr.Histogram
+	published       uint64
+	publishErrors   uint64
+	consumed        uint64
+	consumeErrors   uint64
+}
+
+// publish runs the publishers until ctx is done.
+func (b *bench) publish(ctx context.Context) {
+
+	body := tcr.RandomBytes(b.config.MessageSize)
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < b.config.Publishers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			publisher := tcr.NewPublisher(b.cp, 0, 0, b.config.PublishTimeout)
+			receipts := publisher.PublishReceipts()
+
+			for ctx.Err() == nil {
+				if b.rateLimiter != nil && b.rateLimiter.Wait(ctx, len(body)) != nil {
+					return
+				}
+
+				letter := tcr.CreateLetter(0, "", b.config.QueueName, body)
+				letter.Envelope.DeliveryMode = amqp.Transient
+				letter.Envelope.Headers = amqp.Table{SentHeader: time.Now().UnixNano()}
+
+				sent := time.Now()
+				publisher.PublishWithConfirmation(letter, b.config.PublishTimeout)
+
+				if receipt := <-receipts; receipt.Success {
+					b.publishLatency.Observe(time.Since(sent))
+					atomic.AddUint64(&b.published, 1)
+				} else {
+					atomic.AddUint64(&b.publishErrors, 1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// startConsumers starts auto-ack consumers recording end to end latency.
+func (b *bench) startConsumers() []*tcr.Consumer {
+
+	consumers := make([]*tcr.Consumer, b.config.Consumers)
+	for i := range consumers {
+
+		consumers[i] = tcr.NewConsumerFromConfig(&tcr.ConsumerConfig{
+			Enabled:      true,
+			QueueName:    b.config.QueueName,
+			ConsumerName: fmt.Sprintf("tcrbench-%d", i),
+			AutoAck:      true,
+		}, b.cp)
+
+		consumers[i].StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+			if sent, ok := msg.Headers[SentHeader].(int64); ok {
+				b.endToEndLatency.Observe(time.Since(time.Unix(0, sent)))
+			}
+
+			atomic.AddUint64(&b.consumed, 1)
+		})
+	}
+
+	return consumers
+}
+
+// drain waits for consumers to receive everything published, up to the DrainTimeout, then stops them.
+func (b *bench) drain(ctx context.Context, consumers []*tcr.Consumer) {
+
+	deadline := time.After(b.config.DrainTimeout)
+
+DrainLoop:
+	for atomic.LoadUint64(&b.consumed) < atomic.LoadUint64(&b.published) {
+		select {
+		case <-ctx.Done():
+			break DrainLoop
+		case <-deadline:
+			break DrainLoop
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	for _, consumer := range consumers {
+	ErrorLoop:
+		for {
+			select {
+			case <-consumer.Errors():
+				atomic.AddUint64(&b.consumeErrors, 1)
+			default:
+				break ErrorLoop
+			}
+		}
+
+		_ = consumer.StopConsuming(true, true)
+	}
+}
@@ -0,0 +1,373 @@
+// Package tcrmgmt is a small client for the RabbitMQ management HTTP API. It reuses the credentials and
+// virtual host of an AMQP URI so applications can read queue depths, consumers, connections, and node
+// health (e.g. to skip publishing when a queue is backed up) without another library.
+package tcrmgmt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
+)
+
+const (
+	// DefaultPort is the management plugin's port for plain AMQP URIs.
+	DefaultPort = "15672"
+
+	// DefaultTLSPort is the management plugin's port for AMQPS URIs.
+	DefaultTLSPort = "15671"
+)
+
+// ErrNotFound is returned when the requested queue (or other resource) doesn't exist.
+var ErrNotFound = errors.New("management api resource not found")
+
+// APIError is a non-2xx response from the management API.
+type APIError struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("management api returned %d: %s", e.StatusCode, e.Reason)
+}
+
+// Is makes a 404 APIError match ErrNotFound.
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Client calls the management API of a single broker for a single virtual host.
+type Client struct {
+	BaseURL    string // e.g. http://localhost:15672
+	Username   string
+	Password   string
+	VHost      string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Client. A nil httpClient uses one with a 10 second timeout.
+func NewClient(baseURL, username, password, vhost string, httpClient *http.Client) *Client {
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if vhost == "" {
+		vhost = "/"
+	}
+
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Username:   username,
+		Password:   password,
+		VHost:      vhost,
+		HTTPClient: httpClient,
+	}
+}
+
+// NewClientFromURI creates a Client with the host, credentials, and virtual host of an AMQP URI.
+// amqp URIs map to http on DefaultPort and amqps URIs to https on DefaultTLSPort.
+func NewClientFromURI(uri string) (*Client, error) {
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse amqp uri: %w", err)
+	}
+
+	scheme, port := "http", DefaultPort
+	switch parsed.Scheme {
+	case "amqp":
+	case "amqps":
+		scheme, port = "https", DefaultTLSPort
+	default:
+		return nil, fmt.Errorf("unsupported amqp uri scheme %q", parsed.Scheme)
+	}
+
+	username, password := "guest", "guest"
+	if parsed.User != nil {
+		username = parsed.User.Username()
+		password, _ = parsed.User.Password()
+	}
+
+	vhost := strings.TrimPrefix(parsed.Path, "/") // an AMQP path of "/" or "" is the default vhost
+	if vhost == "" {
+		vhost = "/"
+	}
+
+	baseURL := scheme + "://" + net.JoinHostPort(parsed.Hostname(), port)
+	return NewClient(baseURL, username, password, vhost, nil), nil
+}
+
+// NewClientFromPool creates a Client for the broker the ConnectionPool is currently connected to.
+func NewClientFromPool(cp *tcr.ConnectionPool) (*Client, error) {
+
+	if cp == nil {
+		return nil, errors.New("tcrmgmt requires a connectionpool")
+	}
+
+	return NewClientFromURI(cp.ActiveURI())
+}
+
+// Queue is the state of a queue as reported by the management API.
+type Queue struct {
+	Name                   string                 `json:"name"`
+	VHost                  string                 `json:"vhost"`
+	Type                   string                 `json:"type"`
+	State                  string                 `json:"state"`
+	Node                   string                 `json:"node"`
+	Durable                bool                   `json:"durable"`
+	AutoDelete             bool                   `json:"auto_delete"`
+	Exclusive              bool                   `json:"exclusive"`
+	Arguments              map[string]interface{} `json:"arguments"`
+	Messages               int                    `json:"messages"`
+	MessagesReady          int                    `json:"messages_ready"`
+	MessagesUnacknowledged int                    `json:"messages_unacknowledged"`
+	Consumers              int                    `json:"consumers"`
+}
+
+// Exchange is the state of an exchange as reported by the management API.
+type Exchange struct {
+	Name       string                 `json:"name"`
+	VHost      string                 `json:"vhost"`
+	Type       string                 `json:"type"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Internal   bool                   `json:"internal"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+var _ tcr.TopologyInspector = (*Client)(nil)
+
+// Consumer is a consumer subscribed to a queue in the virtual host.
+type Consumer struct {
+	ConsumerTag   string `json:"consumer_tag"`
+	AckRequired   bool   `json:"ack_required"`
+	Exclusive     bool   `json:"exclusive"`
+	PrefetchCount int    `json:"prefetch_count"`
+	Queue         struct {
+		Name  string `json:"name"`
+		VHost string `json:"vhost"`
+	} `json:"queue"`
+	ChannelDetails struct {
+		Name           string `json:"name"`
+		ConnectionName string `json:"connection_name"`
+		PeerHost       string `json:"peer_host"`
+	} `json:"channel_details"`
+}
+
+// Connection is a client connection to the virtual host.
+type Connection struct {
+	Name             string                 `json:"name"`
+	VHost            string                 `json:"vhost"`
+	User             string                 `json:"user"`
+	State            string                 `json:"state"`
+	Channels         int                    `json:"channels"`
+	PeerHost         string                 `json:"peer_host"`
+	ClientProperties map[string]interface{} `json:"client_properties"`
+}
+
+// Node is a broker node in the cluster.
+type Node struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Running       bool   `json:"running"`
+	MemAlarm      bool   `json:"mem_alarm"`
+	DiskFreeAlarm bool   `json:"disk_free_alarm"`
+	MemUsed       int64  `json:"mem_used"`
+	MemLimit      int64  `json:"mem_limit"`
+	DiskFree      int64  `json:"disk_free"`
+	DiskFreeLimit int64  `json:"disk_free_limit"`
+	Uptime        int64  `json:"uptime"` // milliseconds
+}
+
+// Queues lists the queues in the virtual host.
+func (c *Client) Queues(ctx context.Context) ([]*Queue, error) {
+
+	var queues []*Queue
+	err := c.get(ctx, "/api/queues/"+url.PathEscape(c.VHost), &queues)
+
+	return queues, err
+}
+
+// Queue gets a single queue, ErrNotFound when it doesn't exist.
+func (c *Client) Queue(ctx context.Context, name string) (*Queue, error) {
+
+	queue := &Queue{}
+	if err := c.get(ctx, "/api/queues/"+url.PathEscape(c.VHost)+"/"+url.PathEscape(name), queue); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// Exchange gets a single exchange, ErrNotFound when it doesn't exist.
+func (c *Client) Exchange(ctx context.Context, name string) (*Exchange, error) {
+
+	exchange := &Exchange{}
+	if err := c.get(ctx, "/api/exchanges/"+url.PathEscape(c.VHost)+"/"+url.PathEscape(name), exchange); err != nil {
+		return nil, err
+	}
+
+	return exchange, nil
+}
+
+// InspectExchange reads the exchange's properties and arguments for tcr's Topologer.VerifyTopology.
+func (c *Client) InspectExchange(ctx context.Context, name string) (*tcr.Exchange, error) {
+
+	exchange, err := c.Exchange(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tcr.Exchange{
+		Name:         exchange.Name,
+		Type:         exchange.Type,
+		Durable:      exchange.Durable,
+		AutoDelete:   exchange.AutoDelete,
+		InternalOnly: exchange.Internal,
+		Args:         exchange.Arguments,
+	}, nil
+}
+
+// InspectQueue reads the queue's properties and arguments for tcr's Topologer.VerifyTopology.
+func (c *Client) InspectQueue(ctx context.Context, name string) (*tcr.Queue, error) {
+
+	queue, err := c.Queue(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tcr.Queue{
+		Name:       queue.Name,
+		Type:       queue.Type,
+		Durable:    queue.Durable,
+		AutoDelete: queue.AutoDelete,
+		Exclusive:  queue.Exclusive,
+		Args:       queue.Arguments,
+	}, nil
+}
+
+// QueueDepth is the number of messages in the queue, ready and unacknowledged. The management API
+// samples statistics every few seconds, so the depth may trail the broker slightly.
+func (c *Client) QueueDepth(ctx context.Context, name string) (int, error) {
+
+	queue, err := c.Queue(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return queue.Messages, nil
+}
+
+// QueueCounts is the number of messages in the queue, ready and unacknowledged, and of its consumers, for a
+// tcr.QueueMonitorConfig.
+func (c *Client) QueueCounts(ctx context.Context, name string) (int, int, error) {
+
+	queue, err := c.Queue(ctx, name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return queue.Messages, queue.Consumers, nil
+}
+
+// Consumers lists the consumers in the virtual host.
+func (c *Client) Consumers(ctx context.Context) ([]*Consumer, error) {
+
+	var consumers []*Consumer
+	err := c.get(ctx, "/api/consumers/"+url.PathEscape(c.VHost), &consumers)
+
+	return consumers, err
+}
+
+// Connections lists the connections to the virtual host.
+func (c *Client) Connections(ctx context.Context) ([]*Connection, error) {
+
+	var connections []*Connection
+	err := c.get(ctx, "/api/vhosts/"+url.PathEscape(c.VHost)+"/connections", &connections)
+
+	return connections, err
+}
+
+// Nodes lists the cluster's nodes.
+func (c *Client) Nodes(ctx context.Context) ([]*Node, error) {
+
+	var nodes []*Node
+	err := c.get(ctx, "/api/nodes", &nodes)
+
+	return nodes, err
+}
+
+// Healthy returns nil when no node is down or in a memory or disk alarm, otherwise an error naming them.
+func (c *Client) Healthy(ctx context.Context) error {
+
+	nodes, err := c.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, node := range nodes {
+		switch {
+		case !node.Running:
+			problems = append(problems, node.Name+" is not running")
+		case node.MemAlarm:
+			problems = append(problems, node.Name+" has a memory alarm")
+		case node.DiskFreeAlarm:
+			problems = append(problems, node.Name+" has a disk alarm")
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("broker unhealthy: " + strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// get requests the path and decodes the json response into out.
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(c.Username, c.Password)
+	request.Header.Set("Accept", "application/json")
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return &APIError{StatusCode: response.StatusCode, Reason: apiReason(body, response.Status)}
+	}
+
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// apiReason pulls the reason out of a management API error body, falling back to the status.
+func apiReason(body []byte, status string) string {
+
+	apiErr := struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}{}
+
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Reason != "" {
+		return apiErr.Reason
+	}
+
+	return status
+}
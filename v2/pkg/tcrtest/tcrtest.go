@@ -0,0 +1,623 @@
+// Package tcrtest provides in-memory doubles of the tcr publishing and consuming interfaces, so applications
+// can unit test their publish and consume logic without a RabbitMQ broker. A Broker routes letters from
+// Publishers to queues and tracks how Consumers settle them.
+//
+// The doubles stand in for tcr.Publisherer and tcr.Consumerer rather than the pools, because a
+// ChannelHost wraps a live amqp.Channel. Code that takes a tcr.ChannelProvider directly still needs a broker,
+// for which StartRabbitMQ runs a throwaway one in docker.
+package tcrtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
+)
+
+// MatchAll is the binding key that matches every routing key published to an exchange.
+const MatchAll = "#"
+
+// ErrUnroutable is returned (or receipted) when a letter matches no queue.
+var ErrUnroutable = errors.New("letter matched no bound queue")
+
+type binding struct {
+	queue      string
+	routingKey string
+}
+
+type message struct {
+	letter      *tcr.Letter
+	deliveryTag uint64
+}
+
+type queue struct {
+	messages []*message
+	ready    chan struct{} // signalled when a message is enqueued
+}
+
+// Broker is an in-memory stand in for RabbitMQ. The default exchange ("") routes to the queue named by the
+// routing key, other exchanges route to queues bound with the same routing key or MatchAll.
+type Broker struct {
+	queues      map[string]*queue
+	bindings    map[string][]binding
+	unacked     map[uint64]string // delivery tag to queue name
+	published   []*tcr.Letter
+	deliveryTag uint64
+	acked       uint64
+	nacked      uint64
+	rejected    uint64
+	brokerLock  *sync.Mutex
+}
+
+// NewBroker creates an empty Broker.
+func NewBroker() *Broker {
+
+	return &Broker{
+		queues:     make(map[string]*queue),
+		bindings:   make(map[string][]binding),
+		unacked:    make(map[uint64]string),
+		brokerLock: &sync.Mutex{},
+	}
+}
+
+// DeclareQueue creates the queue if it doesn't exist.
+func (b *Broker) DeclareQueue(name string) {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	b.declareQueue(name)
+}
+
+func (b *Broker) hasQueue(name string) bool {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	_, ok := b.queues[name]
+	return ok
+}
+
+func (b *Broker) declareQueue(name string) *queue {
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = &queue{ready: make(chan struct{}, 1)}
+		b.queues[name] = q
+	}
+
+	return q
+}
+
+// Bind declares the queue and routes the exchange's letters with the routing key (or all, with MatchAll) to it.
+func (b *Broker) Bind(queueName, exchange, routingKey string) {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	b.declareQueue(queueName)
+	b.bindings[exchange] = append(b.bindings[exchange], binding{queue: queueName, routingKey: routingKey})
+}
+
+// Publish routes a letter to its queues, returning ErrUnroutable when none match.
+func (b *Broker) Publish(letter *tcr.Letter) error {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	b.published = append(b.published, letter)
+
+	var queueNames []string
+	if letter.Envelope.Exchange == "" {
+		if _, ok := b.queues[letter.Envelope.RoutingKey]; ok {
+			queueNames = append(queueNames, letter.Envelope.RoutingKey)
+		}
+	}
+
+	for _, binding := range b.bindings[letter.Envelope.Exchange] {
+		if binding.routingKey == MatchAll || binding.routingKey == letter.Envelope.RoutingKey {
+			queueNames = append(queueNames, binding.queue)
+		}
+	}
+
+	if len(queueNames) == 0 {
+		return ErrUnroutable
+	}
+
+	for _, queueName := range queueNames {
+		b.enqueue(b.queues[queueName], &message{letter: letter})
+	}
+
+	return nil
+}
+
+func (b *Broker) enqueue(q *queue, msg *message) {
+
+	q.messages = append(q.messages, msg)
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// dequeue takes the next message off the queue, tracking it as unacked. The returned channel is signalled
+// when the queue was empty and a message arrives.
+func (b *Broker) dequeue(queueName string) (*message, <-chan struct{}) {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	q := b.declareQueue(queueName)
+	if len(q.messages) == 0 {
+		return nil, q.ready
+	}
+
+	msg := q.messages[0]
+	q.messages[0] = nil
+	q.messages = q.messages[1:]
+
+	b.deliveryTag++
+	msg.deliveryTag = b.deliveryTag
+	b.unacked[msg.deliveryTag] = queueName
+
+	return msg, q.ready
+}
+
+// settle removes an unacked delivery, putting it back on its queue when requeued.
+func (b *Broker) settle(msg *message, requeue bool) error {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	queueName, ok := b.unacked[msg.deliveryTag]
+	if !ok {
+		return errors.New("unknown delivery tag")
+	}
+	delete(b.unacked, msg.deliveryTag)
+
+	if requeue {
+		b.enqueue(b.queues[queueName], &message{letter: msg.letter})
+	}
+
+	return nil
+}
+
+// Published returns every letter published to the Broker, routed or not, in order.
+func (b *Broker) Published() []*tcr.Letter {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	return append([]*tcr.Letter(nil), b.published...)
+}
+
+// QueueDepth is the number of messages waiting in the queue, excluding unacked deliveries.
+func (b *Broker) QueueDepth(queueName string) int {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	if q, ok := b.queues[queueName]; ok {
+		return len(q.messages)
+	}
+
+	return 0
+}
+
+// Unacked is the number of deliveries not yet acked, nacked, or rejected.
+func (b *Broker) Unacked() int {
+	b.brokerLock.Lock()
+	defer b.brokerLock.Unlock()
+
+	return len(b.unacked)
+}
+
+// Acked is the number of deliveries acked.
+func (b *Broker) Acked() uint64 {
+	return atomic.LoadUint64(&b.acked)
+}
+
+// Nacked is the number of deliveries nacked, requeued or not.
+func (b *Broker) Nacked() uint64 {
+	return atomic.LoadUint64(&b.nacked)
+}
+
+// Rejected is the number of deliveries rejected, requeued or not.
+func (b *Broker) Rejected() uint64 {
+	return atomic.LoadUint64(&b.rejected)
+}
+
+// acknowledger settles the deliveries of one Consumer, like the channel it would have consumed on.
+type acknowledger struct {
+	broker   *Broker
+	messages map[uint64]*message
+	acked    uint64
+	nacked   uint64 // nacked or rejected
+	requeued uint64
+	ackLock  *sync.Mutex
+}
+
+func (a *acknowledger) track(msg *message) {
+	a.ackLock.Lock()
+	defer a.ackLock.Unlock()
+
+	a.messages[msg.deliveryTag] = msg
+}
+
+func (a *acknowledger) settle(tag uint64, multiple bool, requeue bool, brokerCounter *uint64, counter *uint64) error {
+	a.ackLock.Lock()
+	defer a.ackLock.Unlock()
+
+	var settled []*message
+	for deliveryTag, msg := range a.messages {
+		if deliveryTag == tag || (multiple && deliveryTag < tag) {
+			settled = append(settled, msg)
+		}
+	}
+
+	if len(settled) == 0 {
+		return errors.New("unknown delivery tag")
+	}
+
+	for _, msg := range settled {
+		delete(a.messages, msg.deliveryTag)
+		if err := a.broker.settle(msg, requeue); err != nil {
+			return err
+		}
+		atomic.AddUint64(brokerCounter, 1)
+		atomic.AddUint64(counter, 1)
+		if requeue {
+			atomic.AddUint64(&a.requeued, 1)
+		}
+	}
+
+	return nil
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	return a.settle(tag, multiple, false, &a.broker.acked, &a.acked)
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	return a.settle(tag, multiple, requeue, &a.broker.nacked, &a.nacked)
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.settle(tag, false, requeue, &a.broker.rejected, &a.nacked)
+}
+
+var _ amqp.Acknowledger = (*acknowledger)(nil)
+
+// Publisher is an in-memory tcr.Publisherer publishing to a Broker.
+type Publisher struct {
+	broker          *Broker
+	publishReceipts chan *tcr.PublishReceipt
+	err             error
+	pubLock         *sync.Mutex
+}
+
+// NewPublisher creates a Publisher for the Broker.
+func NewPublisher(broker *Broker) *Publisher {
+
+	return &Publisher{
+		broker:          broker,
+		publishReceipts: make(chan *tcr.PublishReceipt, 1000),
+		pubLock:         &sync.Mutex{},
+	}
+}
+
+// FailWith makes every following publish fail with err, without reaching the Broker. Nil clears it.
+func (pub *Publisher) FailWith(err error) {
+	pub.pubLock.Lock()
+	defer pub.pubLock.Unlock()
+
+	pub.err = err
+}
+
+func (pub *Publisher) publish(letter *tcr.Letter) error {
+	pub.pubLock.Lock()
+	err := pub.err
+	pub.pubLock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return pub.broker.Publish(letter)
+}
+
+// Publish publishes the letter, sending a receipt unless skipReceipt is set.
+func (pub *Publisher) Publish(letter *tcr.Letter, skipReceipt bool) {
+
+	err := pub.publish(letter)
+	if !skipReceipt {
+		pub.publishReceipt(letter, err)
+	}
+}
+
+// PublishWithConfirmationContext publishes the letter and sends a receipt.
+func (pub *Publisher) PublishWithConfirmationContext(ctx context.Context, letter *tcr.Letter) {
+
+	if err := ctx.Err(); err != nil {
+		pub.publishReceipt(letter, err)
+		return
+	}
+
+	pub.publishReceipt(letter, pub.publish(letter))
+}
+
+// PublishAndWait publishes the letter and returns the outcome.
+func (pub *Publisher) PublishAndWait(ctx context.Context, letter *tcr.Letter) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return pub.publish(letter)
+}
+
+// PublishAsync publishes the letter and returns a PublishFuture already completed with the outcome.
+func (pub *Publisher) PublishAsync(ctx context.Context, letter *tcr.Letter) *tcr.PublishFuture {
+	return tcr.NewCompletedPublishFuture(letter.LetterID, pub.PublishAndWait(ctx, letter))
+}
+
+// PublishToQueue publishes the letter to the queue through the default exchange. With verifyQueue it returns
+// tcr.ErrQueueNotFound, like the real Publisher, when the Broker has no such queue.
+func (pub *Publisher) PublishToQueue(ctx context.Context, queueName string, letter *tcr.Letter, verifyQueue bool) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if letter.Envelope == nil {
+		letter.Envelope = &tcr.Envelope{}
+	}
+
+	letter.Envelope.Exchange = ""
+	letter.Envelope.RoutingKey = queueName
+
+	if verifyQueue && !pub.broker.hasQueue(queueName) {
+		return fmt.Errorf("%w: %s", tcr.ErrQueueNotFound, queueName)
+	}
+
+	return pub.publish(letter)
+}
+
+// QueueLetter publishes the letter right away and sends a receipt, there is no auto publishing loop to queue for.
+func (pub *Publisher) QueueLetter(letter *tcr.Letter) bool {
+
+	pub.Publish(letter, false)
+	return true
+}
+
+// StartAutoPublishing does nothing, QueueLetter publishes right away.
+func (pub *Publisher) StartAutoPublishing() {}
+
+// Shutdown does nothing, there is no loop or pool to stop. shutdownPools is accepted for parity with tcr.Publisher.
+func (pub *Publisher) Shutdown(shutdownPools bool) {}
+
+// PublishReceipts yields the receipts of publishes that asked for one.
+func (pub *Publisher) PublishReceipts() <-chan *tcr.PublishReceipt {
+	return pub.publishReceipts
+}
+
+func (pub *Publisher) publishReceipt(letter *tcr.Letter, err error) {
+
+	publishReceipt := &tcr.PublishReceipt{
+		LetterID: letter.LetterID,
+		Error:    err,
+	}
+
+	if err == nil {
+		publishReceipt.Success = true
+	} else {
+		publishReceipt.FailedLetter = letter
+	}
+
+	if letter.OnReceipt != nil {
+		letter.OnReceipt(publishReceipt)
+	}
+
+	pub.publishReceipts <- publishReceipt
+}
+
+// Consumer is an in-memory tcr.Consumerer consuming a Broker queue. Its messages are ackable and
+// settle on the Broker.
+type Consumer struct {
+	broker           *Broker
+	queueName        string
+	acknowledger     *acknowledger
+	received         uint64
+	processed        uint64
+	receivedMessages chan *tcr.ReceivedMessage
+	errors           chan error
+	consumeStop      chan struct{}
+	consumeDone      chan struct{}
+	conLock          *sync.Mutex
+}
+
+// NewConsumer creates a Consumer for the Broker's queue, declaring it.
+func NewConsumer(broker *Broker, queueName string) *Consumer {
+
+	broker.DeclareQueue(queueName)
+
+	return &Consumer{
+		broker:    broker,
+		queueName: queueName,
+		acknowledger: &acknowledger{
+			broker:   broker,
+			messages: make(map[uint64]*message),
+			ackLock:  &sync.Mutex{},
+		},
+		receivedMessages: make(chan *tcr.ReceivedMessage, 1000),
+		errors:           make(chan error, 1000),
+		conLock:          &sync.Mutex{},
+	}
+}
+
+// StartConsuming starts the Consumer sending messages to ReceivedMessages.
+func (con *Consumer) StartConsuming() {
+	con.StartConsumingWithAction(nil)
+}
+
+// StartConsumingWithAction starts the Consumer invoking a method on every ReceivedMessage.
+func (con *Consumer) StartConsumingWithAction(action func(*tcr.ReceivedMessage)) {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	if con.consumeStop != nil {
+		return
+	}
+
+	con.consumeStop = make(chan struct{})
+	con.consumeDone = make(chan struct{})
+	go con.consumeLoop(action, con.consumeStop, con.consumeDone)
+}
+
+// StartConsumingWithHandler starts the Consumer, acknowledging each message whose handler returns nil and
+// nacking, without requeueing, the others.
+func (con *Consumer) StartConsumingWithHandler(handler func(*tcr.ReceivedMessage) error) error {
+
+	con.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+
+		if err := handler(msg); err != nil {
+			con.sendError("handle", err)
+
+			if err := msg.Nack(false); err != nil {
+				con.sendError("nack", err)
+			}
+			return
+		}
+
+		if err := msg.Acknowledge(); err != nil {
+			con.sendError("ack", err)
+		}
+	})
+
+	return nil
+}
+
+func (con *Consumer) consumeLoop(action func(*tcr.ReceivedMessage), consumeStop, consumeDone chan struct{}) {
+
+	defer close(consumeDone)
+
+	for {
+		msg, ready := con.broker.dequeue(con.queueName)
+		if msg == nil {
+			select {
+			case <-consumeStop:
+				return
+			case <-ready:
+				continue
+			}
+		}
+
+		con.acknowledger.track(msg)
+		atomic.AddUint64(&con.received, 1)
+		receivedMessage := tcr.NewMessageWithAcknowledger(true, msg.letter.Body, msg.letter.Envelope.Headers, msg.deliveryTag, con.acknowledger)
+		receivedMessage.ContentType = msg.letter.Envelope.ContentType
+		receivedMessage.Exchange = msg.letter.Envelope.Exchange
+		receivedMessage.RoutingKey = msg.letter.Envelope.RoutingKey
+
+		if action != nil {
+			action(receivedMessage)
+			atomic.AddUint64(&con.processed, 1)
+			continue
+		}
+
+		select {
+		case <-consumeStop:
+			_ = con.acknowledger.Nack(msg.deliveryTag, false, true)
+			return
+		case con.receivedMessages <- receivedMessage:
+		}
+	}
+}
+
+// StopConsuming stops the Consumer and waits for its loop to finish. Unsettled messages stay unacked until
+// settled. FlushMessages requeues the buffered messages not yet read from ReceivedMessages. immediate is
+// accepted for parity with tcr.Consumer.
+func (con *Consumer) StopConsuming(immediate bool, flushMessages bool) error {
+	con.conLock.Lock()
+	defer con.conLock.Unlock()
+
+	if con.consumeStop == nil {
+		return errors.New("can't stop a stopped consumer")
+	}
+
+	close(con.consumeStop)
+	<-con.consumeDone
+	con.consumeStop = nil
+
+	if flushMessages {
+	FlushLoop:
+		for {
+			select {
+			case msg := <-con.receivedMessages:
+				_ = msg.Nack(true)
+			default:
+				break FlushLoop
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReceivedMessages yields the messages received when consuming without an action.
+func (con *Consumer) ReceivedMessages() <-chan *tcr.ReceivedMessage {
+	return con.receivedMessages
+}
+
+// ConsumeBatch reads up to maxCount messages from ReceivedMessages, returning early once maxWait has elapsed.
+func (con *Consumer) ConsumeBatch(maxCount int, maxWait time.Duration) tcr.MessageBatch {
+
+	if maxCount < 1 {
+		maxCount = 1
+	}
+
+	batch := make(tcr.MessageBatch, 0, maxCount)
+	timeout := time.NewTimer(maxWait)
+	defer timeout.Stop()
+
+	for len(batch) < maxCount {
+		select {
+		case msg := <-con.receivedMessages:
+			batch = append(batch, msg)
+		case <-timeout.C:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// Errors yields handler and settlement errors, as ErrorEvents like tcr.Consumer.
+func (con *Consumer) Errors() <-chan error {
+	return con.errors
+}
+
+// Counters reads the Consumer's deliveries and settlements. The double doesn't time handlers or age messages,
+// so its HandlerLatency and MessageAges are nil.
+func (con *Consumer) Counters() *tcr.ConsumerCounters {
+
+	return &tcr.ConsumerCounters{
+		QueueName: con.queueName,
+		Received:  atomic.LoadUint64(&con.received),
+		Processed: atomic.LoadUint64(&con.processed),
+		Acked:     atomic.LoadUint64(&con.acknowledger.acked),
+		Nacked:    atomic.LoadUint64(&con.acknowledger.nacked),
+		Requeued:  atomic.LoadUint64(&con.acknowledger.requeued),
+	}
+}
+
+func (con *Consumer) sendError(operation string, err error) {
+
+	select {
+	case con.errors <- tcr.NewErrorEvent(tcr.SubsystemConsumer, operation, 0, err):
+	default:
+	}
+}
+
+var (
+	_ tcr.Publisherer = (*Publisher)(nil)
+	_ tcr.Consumerer  = (*Consumer)(nil)
+)
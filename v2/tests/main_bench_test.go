@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcrbench"
 )
 
 func verifyAccuracyB(b *testing.B, conMap cmap.ConcurrentMap) {
@@ -273,3 +274,26 @@ ConsumeLoop:
 
 	done <- true
 }
+
+func TestBenchReport(t *testing.T) {
+
+	latency := tcr.NewHistogram([]time.Duration{time.Millisecond, 10 * time.Millisecond})
+	for i := 0; i < 99; i++ {
+		latency.Observe(500 * time.Microsecond)
+	}
+	latency.Observe(5 * time.Millisecond)
+
+	report := &tcrbench.Report{
+		Published:       100,
+		PublishErrors:   0,
+		Consumed:        50,
+		Duration:        2 * time.Second,
+		PublishLatency:  latency.Snapshot(),
+		EndToEndLatency: latency.Snapshot(),
+	}
+
+	assert.Equal(t, 50.0, report.PublishRate())
+	assert.Equal(t, 25.0, report.ConsumeRate())
+	assert.Equal(t, 0.0, report.PublishErrorRate())
+	assert.Contains(t, report.String(), "p50 <= 1ms, p99 <= 1ms")
+}
@@ -1,8 +1,13 @@
 package main_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/fortytw2/leaktest"
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
@@ -64,3 +69,790 @@ func TestConsumerGet(t *testing.T) {
 
 	TestCleanup(t)
 }
+
+func TestConsumerReplay(t *testing.T) {
+
+	deliveries, err := tcr.LoadRecordedDeliveries("testreplay.json")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(deliveries))
+
+	consumer := tcr.NewConsumerFromConfig(&tcr.ConsumerConfig{QueueName: "TcrTestQueue", AutoAck: false}, nil)
+
+	results, err := consumer.Replay(deliveries, func(msg *tcr.ReceivedMessage) {
+		switch {
+		case strings.Contains(string(msg.Body), `"ack"`):
+			assert.NoError(t, msg.Acknowledge())
+		case strings.Contains(string(msg.Body), `"nack"`):
+			assert.NoError(t, msg.Nack(true))
+		}
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, tcr.DispositionAck, results[0].Disposition)
+	assert.Equal(t, tcr.DispositionNack, results[1].Disposition)
+	assert.True(t, results[1].Requeue)
+	assert.Equal(t, tcr.DispositionNone, results[2].Disposition)
+}
+
+func TestByteBudgetPrefetch(t *testing.T) {
+
+	prefetch := tcr.NewByteBudgetPrefetch(64 * 1024 * 1024)
+	assert.Equal(t, 1, prefetch.Prefetch())
+
+	count, changed := prefetch.Observe(1024 * 1024)
+	assert.True(t, changed)
+	assert.Equal(t, 64, count)
+
+	// Small drift is ignored.
+	count, changed = prefetch.Observe(1024*1024 + 1024)
+	assert.False(t, changed)
+	assert.Equal(t, 64, count)
+
+	// Sustained larger messages shrink the prefetch.
+	for i := 0; i < 50; i++ {
+		count, changed = prefetch.Observe(8 * 1024 * 1024)
+		if changed {
+			assert.Less(t, count, 64)
+		}
+	}
+	assert.InDelta(t, 8, prefetch.Prefetch(), 2) // within the drift threshold of 64MB / 8MB
+
+	// Tiny messages are capped at the AMQP maximum.
+	tiny := tcr.NewByteBudgetPrefetch(64 * 1024 * 1024)
+	count, _ = tiny.Observe(1)
+	assert.Equal(t, 65535, count)
+}
+
+func TestConsumerDeduplication(t *testing.T) {
+
+	deduper, err := tcr.NewMemoryDeduper(2, time.Minute)
+	assert.NoError(t, err)
+
+	consumer := tcr.NewConsumerFromConfig(&tcr.ConsumerConfig{QueueName: "TcrTestQueue", Deduper: deduper}, nil)
+
+	deliveries := []*tcr.RecordedDelivery{
+		{MessageID: "A", Body: []byte("first")},
+		{MessageID: "B", Body: []byte("nacked")},
+		{MessageID: "A", Body: []byte("duplicate")},
+		{MessageID: "B", Body: []byte("redelivered")},
+		{Body: []byte("no message id")},
+	}
+
+	handled := make([]string, 0)
+	results, err := consumer.Replay(deliveries, func(msg *tcr.ReceivedMessage) {
+		handled = append(handled, string(msg.Body))
+		if string(msg.Body) == "nacked" {
+			assert.NoError(t, msg.Nack(true))
+			return
+		}
+		assert.NoError(t, msg.Acknowledge())
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"first", "nacked", "redelivered", "no message id"}, handled)
+	assert.Equal(t, tcr.DispositionAck, results[2].Disposition) // duplicate acked without the handler
+	assert.Equal(t, uint64(1), consumer.Duplicates())
+
+	// Least recently used keys are evicted.
+	assert.NoError(t, deduper.MarkProcessed("C"))
+	assert.NoError(t, deduper.MarkProcessed("D"))
+	duplicate, err := deduper.IsDuplicate("A")
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+}
+
+func TestConsumerPauseAndResume(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	consumer := tcr.NewConsumerFromConfig(ConsumerConfig, ConnectionPool)
+	assert.Error(t, consumer.PauseConsuming()) // not started
+
+	consumer.StartConsuming()
+	assert.NoError(t, consumer.PauseConsuming())
+	assert.True(t, consumer.Paused())
+
+	time.Sleep(time.Millisecond * 500) // let the consume loop cancel on the broker
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	letter := tcr.CreateMockRandomLetter(ConsumerConfig.QueueName)
+	publisher.PublishWithConfirmation(letter, time.Millisecond*500)
+	<-publisher.PublishReceipts()
+
+	select {
+	case <-consumer.ReceivedMessages():
+		assert.Fail(t, "paused consumer received a message")
+	case <-time.After(time.Second):
+	}
+
+	assert.NoError(t, consumer.ResumeConsuming())
+	assert.False(t, consumer.Paused())
+
+	select {
+	case msg := <-consumer.ReceivedMessages():
+		assert.Equal(t, letter.Body, msg.Body)
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "resumed consumer never received the message")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, false))
+
+	TestCleanup(t)
+}
+
+func TestConsumerDrain(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for i := 0; i < 3; i++ {
+		publisher.PublishWithConfirmation(tcr.CreateMockRandomLetter(ConsumerConfig.QueueName), time.Millisecond*500)
+		<-publisher.PublishReceipts()
+	}
+
+	consumer := tcr.NewConsumerFromConfig(ConsumerConfig, ConnectionPool)
+	handled := make(chan struct{}, 3)
+	assert.NoError(t, consumer.StartConsumingWithHandler(func(msg *tcr.ReceivedMessage) error {
+		time.Sleep(time.Millisecond * 50) // in flight when the drain begins
+		handled <- struct{}{}
+		return nil
+	}))
+
+	<-handled
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	result, err := consumer.Drain(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), result.Requeued)
+	assert.Error(t, consumer.StopConsuming(false, false)) // already stopped
+
+	_, err = consumer.Drain(ctx)
+	assert.Error(t, err)
+
+	TestCleanup(t)
+}
+
+func TestConsumerHandlerRetry(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *ConsumerConfig
+	config.RetryConfig = &tcr.RetryConfig{
+		Enabled:      true,
+		MaxAttempts:  2,
+		InitialDelay: 100,
+	}
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	letter := tcr.CreateMockRandomLetter(config.QueueName)
+	letter.Envelope.MessageID = "TcrRetryMessage"
+	letter.Envelope.CorrelationID = "TcrRetryCorrelation"
+	letter.Envelope.Timestamp = time.Unix(1700000000, 0)
+	letter.Envelope.Priority = 3
+	letter.Envelope.Type = "TcrRetryType"
+	letter.Envelope.ContentEncoding = "identity"
+	letter.Envelope.ReplyTo = "TcrRetryReplyTo"
+	letter.Envelope.AppID = "TcrRetryApp"
+	publisher.PublishWithConfirmation(letter, time.Millisecond*500)
+	<-publisher.PublishReceipts()
+
+	attempts := make(chan uint32, 10)
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	assert.NoError(t, consumer.StartConsumingWithHandler(func(msg *tcr.ReceivedMessage) error {
+		attempts <- tcr.GetRetryCount(msg.Headers)
+		return errors.New("handler failed")
+	}))
+
+	for expected := uint32(0); expected <= config.RetryConfig.MaxAttempts; expected++ {
+		select {
+		case attempt := <-attempts:
+			assert.Equal(t, expected, attempt)
+		case <-time.After(time.Second * 5):
+			assert.Fail(t, "message was never retried")
+		}
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	parked, err := tcr.NewConsumerFromConfig(&config, ConnectionPool).Get(config.QueueName + ".parkinglot")
+	assert.NoError(t, err)
+	if assert.NotNil(t, parked) {
+		assert.Equal(t, uint32(3), tcr.GetRetryCount(parked.Headers))
+		assert.Equal(t, letter.Body, parked.Body)
+		assert.Equal(t, letter.Envelope.MessageID, parked.MessageId)
+		assert.Equal(t, letter.Envelope.CorrelationID, parked.CorrelationId)
+		assert.True(t, letter.Envelope.Timestamp.Equal(parked.Timestamp))
+		assert.Equal(t, letter.Envelope.Priority, parked.Priority)
+		assert.Equal(t, letter.Envelope.Type, parked.Type)
+		assert.Equal(t, letter.Envelope.ContentEncoding, parked.ContentEncoding)
+		assert.Equal(t, letter.Envelope.ReplyTo, parked.ReplyTo)
+		assert.Equal(t, letter.Envelope.AppID, parked.AppId)
+	}
+
+	TestCleanup(t)
+}
+
+func TestConsumerGroup(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	group, err := tcr.NewConsumerGroup(ConsumerConfig, ConnectionPool, 3)
+	assert.NoError(t, err)
+	assert.Len(t, group.Consumers, 3)
+	assert.NoError(t, group.StartConsuming())
+	assert.Error(t, group.StartConsuming())
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	count := 30
+	for i := 0; i < count; i++ {
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter(ConsumerConfig.QueueName)))
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-group.ReceivedMessages():
+		case <-time.After(time.Second * 5):
+			assert.Fail(t, "consumer group stopped receiving messages")
+			i = count
+		}
+	}
+
+	assert.NoError(t, group.StopConsuming(false, true))
+	assert.False(t, group.Started())
+
+	TestCleanup(t)
+}
+
+func TestConsumerGroupAutoScale(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	var depth int64 = 5000
+	config := *ConsumerConfig
+	config.AutoScaleConfig = &tcr.AutoScaleConfig{
+		Enabled:             true,
+		MinConsumers:        1,
+		MaxConsumers:        4,
+		MessagesPerConsumer: 1000,
+		PollInterval:        1,
+		QueueDepth: func(ctx context.Context, queueName string) (int, error) {
+			return int(atomic.LoadInt64(&depth)), nil
+		},
+	}
+
+	group, err := tcr.NewConsumerGroup(&config, ConnectionPool, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, group.Size()) // clamped to MaxConsumers
+	assert.NoError(t, group.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) { _ = msg.Acknowledge() }))
+
+	atomic.StoreInt64(&depth, 0)
+	assert.Eventually(t, func() bool { return group.Size() == 1 }, time.Second*10, time.Millisecond*100)
+
+	atomic.StoreInt64(&depth, 2500)
+	assert.Eventually(t, func() bool { return group.Size() == 3 }, time.Second*5, time.Millisecond*100)
+
+	assert.NoError(t, group.StopConsuming(false, true))
+
+	TestCleanup(t)
+}
+
+func TestDispatcher(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	var handled []string
+	handle := func(name string) func(*tcr.ReceivedMessage) error {
+		return func(*tcr.ReceivedMessage) error {
+			handled = append(handled, name)
+			return nil
+		}
+	}
+
+	dispatcher := tcr.NewDispatcher().
+		RegisterHeader("x-event-type", "refund", handle("refund")).
+		Register("order.created", handle("created")).
+		Register("order.#", handle("order"))
+
+	assert.NoError(t, dispatcher.Handle(&tcr.ReceivedMessage{RoutingKey: "order.created"}))
+	assert.NoError(t, dispatcher.Handle(&tcr.ReceivedMessage{RoutingKey: "order.shipped.eu"}))
+	assert.NoError(t, dispatcher.Handle(&tcr.ReceivedMessage{
+		RoutingKey: "order.created",
+		Headers:    map[string]interface{}{"x-event-type": []byte("refund")},
+	}))
+	assert.Equal(t, []string{"created", "order", "refund"}, handled)
+
+	err := dispatcher.Handle(&tcr.ReceivedMessage{RoutingKey: "invoice.paid"})
+	assert.True(t, errors.Is(err, tcr.ErrNoHandler), err)
+
+	dispatcher.Fallback(handle("fallback"))
+	assert.NoError(t, dispatcher.Handle(&tcr.ReceivedMessage{RoutingKey: "invoice.paid"}))
+	assert.Equal(t, "fallback", handled[len(handled)-1])
+
+	TestCleanup(t)
+}
+
+func TestConsumerHandlerPanic(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *ConsumerConfig
+	config.OnPanic = tcr.OnPanicAck
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter(config.QueueName)))
+	}
+
+	handled := make(chan struct{}, 2)
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	assert.NoError(t, consumer.StartConsumingWithHandler(func(msg *tcr.ReceivedMessage) error {
+		handled <- struct{}{}
+		panic("handler bug")
+	}))
+
+	for i := 0; i < 2; i++ { // the consumer survives the first panic
+		select {
+		case err := <-consumer.Errors():
+			var panicErr *tcr.PanicError
+			assert.True(t, errors.As(err, &panicErr), err)
+			assert.Equal(t, "handler bug", panicErr.Value)
+			assert.NotEmpty(t, panicErr.Stack)
+		case <-time.After(time.Second * 5):
+			assert.Fail(t, "handler panic was never reported")
+		}
+	}
+	assert.Len(t, handled, 2)
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	TestCleanup(t)
+}
+
+func TestConsumerHandlerTimeout(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *AckableConsumerConfig
+	config.HandlerTimeout = 100
+	config.OnHandlerTimeout = tcr.OnPanicDeadLetter
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter(config.QueueName)))
+
+	deadlines := make(chan bool, 1)
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	assert.NoError(t, consumer.StartConsumingWithHandler(func(msg *tcr.ReceivedMessage) error {
+		ctx := msg.Context()
+		_, hasDeadline := ctx.Deadline()
+		deadlines <- hasDeadline
+
+		<-ctx.Done() // stuck until the library gives up on it
+		return ctx.Err()
+	}))
+
+	select {
+	case err := <-consumer.Errors():
+		assert.True(t, errors.Is(err, tcr.ErrHandlerTimeout), err)
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "handler timeout was never reported")
+	}
+	assert.True(t, <-deadlines)
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	TestCleanup(t)
+}
+
+func TestConsumerCounters(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	count := 10
+	for i := 0; i < count; i++ {
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter(AckableConsumerConfig.QueueName)))
+	}
+
+	handled := make(chan struct{}, count)
+	consumer := tcr.NewConsumerFromConfig(AckableConsumerConfig, ConnectionPool)
+	assert.NoError(t, consumer.StartConsumingWithHandler(func(msg *tcr.ReceivedMessage) error {
+		defer func() { handled <- struct{}{} }()
+		return nil
+	}))
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second * 5):
+			assert.FailNow(t, "messages were never handled")
+		}
+	}
+
+	// started consumers are in the pool's counters too, for a single exporter
+	assert.Contains(t, ConnectionPool.Counters().Consumers, AckableConsumerConfig.ConsumerName)
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	counters := consumer.Counters()
+	assert.Equal(t, uint64(count), counters.Received)
+	assert.Equal(t, uint64(count), counters.Processed)
+	assert.Equal(t, uint64(count), counters.Acked)
+	assert.Equal(t, uint64(0), counters.Nacked)
+	assert.Equal(t, uint64(count), counters.HandlerLatency.Count)
+	assert.NotContains(t, ConnectionPool.Counters().Consumers, AckableConsumerConfig.ConsumerName)
+
+	TestCleanup(t)
+}
+
+func TestConsumeBatch(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	count := 25
+	for i := 0; i < count; i++ {
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter(AckableConsumerConfig.QueueName)))
+	}
+
+	consumer := tcr.NewConsumerFromConfig(AckableConsumerConfig, ConnectionPool)
+	consumer.StartConsuming()
+
+	received := 0
+	deadline := time.Now().Add(time.Second * 10)
+	for received < count && time.Now().Before(deadline) {
+		batch := consumer.ConsumeBatch(10, time.Millisecond*500)
+		assert.LessOrEqual(t, len(batch), 10)
+		assert.NoError(t, batch.Acknowledge())
+		received += len(batch)
+	}
+	assert.Equal(t, count, received)
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	TestCleanup(t)
+}
+
+func TestConsumerMessages(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	count := 10
+	for i := 0; i < count; i++ {
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter(AckableConsumerConfig.QueueName)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// the range over func loop of Go 1.23, written out
+	consumer := tcr.NewConsumerFromConfig(AckableConsumerConfig, ConnectionPool)
+	received := 0
+	consumer.Messages(ctx)(func(msg *tcr.ReceivedMessage, err error) bool {
+		if !assert.NoError(t, err) {
+			return false
+		}
+
+		assert.NoError(t, msg.Acknowledge())
+		received++
+		return received < count/2
+	})
+	assert.Equal(t, count/2, received)
+	assert.False(t, consumer.Started, "exiting the loop stops the consumer")
+
+	chanCtx, chanCancel := context.WithCancel(ctx)
+	for result := range consumer.MessagesChan(chanCtx) {
+		if result.Err != nil {
+			break
+		}
+
+		assert.NoError(t, result.Message.Acknowledge())
+		received++
+		if received == count {
+			chanCancel()
+		}
+	}
+	chanCancel()
+	assert.Equal(t, count, received)
+
+	TestCleanup(t)
+}
+
+func TestConsumerAckBatch(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *AckableConsumerConfig
+	config.AckBatchConfig = &tcr.AckBatchConfig{
+		Enabled:  true,
+		Size:     10,
+		Interval: 50,
+	}
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	count := 25
+	for i := 0; i < count; i++ {
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter(config.QueueName)))
+	}
+
+	handled := make(chan struct{}, count)
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	assert.NoError(t, consumer.StartConsumingWithHandler(func(msg *tcr.ReceivedMessage) error {
+		handled <- struct{}{}
+		return nil
+	}))
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second * 10):
+			t.Fatal("messages weren't consumed")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, err := consumer.Drain(ctx) // sends the acks still held back
+	assert.NoError(t, err)
+
+	depth, err := tcr.NewTopologer(ConnectionPool).QueueDepth(config.QueueName)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, depth)
+
+	TestCleanup(t)
+}
+
+func TestConsumerQuarantine(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *ConsumerConfig
+	config.QuarantineConfig = &tcr.QuarantineConfig{
+		Enabled:            true,
+		MaxProcessAttempts: 2,
+	}
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	letter := tcr.CreateMockRandomLetter(config.QueueName)
+	publisher.PublishWithConfirmation(letter, time.Millisecond*500)
+	<-publisher.PublishReceipts()
+
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	consumer.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+		_ = msg.Nack(true) // poison, requeued every time
+	})
+
+	select {
+	case err := <-consumer.Errors():
+		assert.True(t, errors.Is(err, tcr.ErrMessageQuarantined), err.Error())
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "message was never quarantined")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+	assert.Equal(t, uint64(1), consumer.Quarantined())
+
+	quarantined, err := tcr.NewConsumerFromConfig(&config, ConnectionPool).Get(config.QueueName + ".quarantine")
+	assert.NoError(t, err)
+	if assert.NotNil(t, quarantined) {
+		assert.Equal(t, letter.Body, quarantined.Body)
+		assert.Equal(t, config.QueueName, quarantined.Headers[tcr.HeaderQuarantineSourceQueue])
+	}
+
+	TestCleanup(t)
+}
+
+func TestConsumerStreamReplay(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+	queue := &tcr.Queue{Name: "TcrTestStream", Type: tcr.QueueTypeStream}
+	assert.NoError(t, topologer.CreateQueueFromConfig(queue))
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, publisher.PublishToQueue(context.Background(), queue.Name, tcr.CreateMockRandomLetter(""), false))
+	}
+
+	config := *ConsumerConfig
+	config.QueueName = queue.Name
+	config.AutoAck = false
+	config.StreamConfig = &tcr.StreamConfig{Enabled: true, Offset: tcr.StreamOffsetFirst}
+
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	replayed := make(chan struct{}, 3)
+	consumer.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+		_ = msg.Acknowledge()
+		replayed <- struct{}{}
+	})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-replayed:
+		case <-time.After(time.Second * 5):
+			assert.Fail(t, "stream history was not replayed")
+		}
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	offset, ok := consumer.StreamOffset()
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), offset)
+
+	_, err := topologer.QueueDelete(queue.Name, false, false, false)
+	assert.NoError(t, err)
+
+	TestCleanup(t)
+}
+
+func TestConsumerMultipleQueues(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+	for _, queueName := range []string{"TcrTestQueueA", "TcrTestQueueB"} {
+		assert.NoError(t, topologer.CreateQueue(queueName, false, true, false, false, false, nil))
+	}
+
+	config := *ConsumerConfig
+	config.QueueName = "TcrTestQueueA"
+	config.QueueNames = []string{"TcrTestQueueB", "TcrTestQueueA"}
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for _, queueName := range []string{"TcrTestQueueA", "TcrTestQueueB"} {
+		assert.NoError(t, publisher.PublishToQueue(context.Background(), queueName, tcr.CreateMockRandomLetter(""), false))
+	}
+
+	consumer := tcr.NewConsumerFromConfig(&config, ConnectionPool)
+	assert.Equal(t, []string{"TcrTestQueueA", "TcrTestQueueB"}, consumer.Queues())
+
+	retrying := config
+	retrying.RetryConfig = &tcr.RetryConfig{Enabled: true, MaxAttempts: 2}
+	assert.Error(t, tcr.NewConsumerFromConfig(&retrying, ConnectionPool).StartConsumingWithHandler(func(*tcr.ReceivedMessage) error { return nil }))
+
+	consumed := make(chan string, 2)
+	consumer.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+		_ = msg.Acknowledge()
+		consumed <- msg.Queue
+	})
+
+	queues := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case queueName := <-consumed:
+			queues[queueName] = true
+		case <-time.After(time.Second * 5):
+			assert.Fail(t, "a queue was not consumed")
+		}
+	}
+
+	assert.True(t, queues["TcrTestQueueA"] && queues["TcrTestQueueB"])
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	TestCleanup(t)
+}
+
+type TestOrder struct {
+	OrderID string `json:"OrderID" msgpack:"OrderID"`
+	Amount  int    `json:"Amount" msgpack:"Amount"`
+}
+
+func TestConsumeTyped(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	letter, err := tcr.CreateEncodedLetter(1, "", ConsumerConfig.QueueName, &TestOrder{OrderID: "A-1", Amount: 42}, tcr.MsgPackCodec{})
+	assert.NoError(t, err)
+	publisher.PublishWithConfirmation(letter, time.Millisecond*500)
+	<-publisher.PublishReceipts()
+
+	consumer := tcr.NewConsumerFromConfig(ConsumerConfig, ConnectionPool)
+	orders := make(chan *TestOrder, 1)
+	assert.NoError(t, tcr.Consume(consumer, func(ctx context.Context, order *TestOrder, meta tcr.DeliveryMeta) error {
+		assert.Equal(t, tcr.ContentTypeMsgPack, meta.ContentType)
+		assert.Equal(t, meta.MessageID, tcr.CorrelationIDFromContext(ctx)) // starts the lineage
+		orders <- order
+		return nil
+	}))
+
+	select {
+	case order := <-orders:
+		assert.Equal(t, &TestOrder{OrderID: "A-1", Amount: 42}, order)
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "order was never consumed")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	err = tcr.TypedHandler(func(context.Context, int, tcr.DeliveryMeta) error { return nil })(&tcr.ReceivedMessage{Body: []byte(`{"OrderID":"A-1"}`)})
+	assert.True(t, errors.Is(err, tcr.ErrUndecodable), err)
+
+	TestCleanup(t)
+}
+
+func TestConsumerUnitOfWork(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+	assert.NoError(t, topologer.CreateQueue("TcrTestQueueOut", false, true, false, false, false, nil))
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	inbound := tcr.CreateMockRandomLetter(ConsumerConfig.QueueName)
+	publisher.PublishWithConfirmation(inbound, time.Millisecond*500)
+	<-publisher.PublishReceipts()
+
+	consumer := tcr.NewConsumerFromConfig(AckableConsumerConfig, ConnectionPool)
+	committed := make(chan struct{}, 1)
+	assert.NoError(t, consumer.StartConsumingWithUnitOfWork(publisher, func(ctx context.Context, uow *tcr.UnitOfWork) error {
+		assert.NoError(t, uow.Stage(tcr.CreateMockRandomLetter("TcrTestQueueOut")))
+		committed <- struct{}{}
+		return nil
+	}))
+
+	select {
+	case <-committed:
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "message was never consumed")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	outbound, err := consumer.Get("TcrTestQueueOut")
+	assert.NoError(t, err)
+	if assert.NotNil(t, outbound) {
+		assert.Equal(t, inbound.Envelope.MessageID, outbound.CorrelationId) // published in the inbound message's lineage
+	}
+
+	TestCleanup(t)
+}
+
+func TestConsumerArguments(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	low := *AckableConsumerConfig
+	low.ConsumerName = "TcrTestConsumerLow"
+	low.Priority = 1
+
+	high := low
+	high.ConsumerName = "TcrTestConsumerHigh"
+	high.Priority = 10
+	high.ConsumerTimeout = 60000
+
+	received := make(chan string, 2)
+	consumers := []*tcr.Consumer{tcr.NewConsumerFromConfig(&low, ConnectionPool), tcr.NewConsumerFromConfig(&high, ConnectionPool)}
+	for _, consumer := range consumers {
+		consumer := consumer
+		consumer.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+			_ = msg.Acknowledge()
+			received <- consumer.ConsumerName
+		})
+	}
+	time.Sleep(time.Millisecond * 500) // both subscribed
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.PublishWithConfirmation(tcr.CreateMockRandomLetter(low.QueueName), time.Millisecond*500)
+	<-publisher.PublishReceipts()
+
+	select {
+	case consumerName := <-received:
+		assert.Equal(t, high.ConsumerName, consumerName) // the higher priority consumer has room
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "message was never consumed")
+	}
+
+	for _, consumer := range consumers {
+		assert.NoError(t, consumer.StopConsuming(false, true))
+	}
+
+	TestCleanup(t)
+}
@@ -0,0 +1,49 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramObserveAndPercentile(t *testing.T) {
+
+	histogram := tcr.NewHistogram([]time.Duration{10 * time.Millisecond, 100 * time.Millisecond, time.Second})
+
+	for i := 0; i < 90; i++ {
+		histogram.Observe(5 * time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		histogram.Observe(50 * time.Millisecond)
+	}
+	histogram.Observe(2 * time.Second)
+
+	snapshot := histogram.Snapshot()
+	assert.Equal(t, uint64(100), snapshot.Count)
+	assert.Equal(t, []uint64{90, 9, 0, 1}, snapshot.Counts)
+	assert.Equal(t, 10*time.Millisecond, snapshot.Percentile(0.5))
+	assert.Equal(t, 100*time.Millisecond, snapshot.Percentile(0.99))
+	assert.Equal(t, 2*time.Second, snapshot.Percentile(1.0))
+	assert.Equal(t, 2*time.Second, snapshot.Max)
+}
+
+func TestGetMessageAge(t *testing.T) {
+
+	delivery := &amqp.Delivery{Timestamp: time.Now().Add(-time.Minute)}
+	age, ok := tcr.GetMessageAge(delivery)
+	assert.True(t, ok)
+	assert.True(t, age >= time.Minute)
+
+	delivery = &amqp.Delivery{
+		Headers: amqp.Table{tcr.HeaderPublishedAt: time.Now().Add(-time.Second).UnixNano() / int64(time.Millisecond)},
+	}
+	age, ok = tcr.GetMessageAge(delivery)
+	assert.True(t, ok)
+	assert.True(t, age >= time.Second && age < time.Minute)
+
+	_, ok = tcr.GetMessageAge(&amqp.Delivery{})
+	assert.False(t, ok)
+}
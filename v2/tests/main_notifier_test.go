@@ -0,0 +1,63 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifierBuildPayloads(t *testing.T) {
+
+	event := &tcr.PoolEvent{
+		Type:           tcr.EventConnectionLost,
+		ConnectionName: "TurboCookedRabbit",
+		ConnectionID:   3,
+		Message:        "connection is unhealthy",
+		UTCDateTime:    time.Now().UTC(),
+	}
+
+	notifier, err := tcr.NewNotifier(&tcr.WebhookConfig{URL: "http://localhost", Template: tcr.WebhookTemplateSlack})
+	assert.NoError(t, err)
+
+	payload, err := notifier.BuildPayload(event)
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), `"text"`)
+
+	notifier, err = tcr.NewNotifier(&tcr.WebhookConfig{URL: "http://localhost", Template: tcr.WebhookTemplatePagerDuty, RoutingKey: "abc"})
+	assert.NoError(t, err)
+
+	payload, err = notifier.BuildPayload(event)
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), `"event_action":"trigger"`)
+	assert.Contains(t, string(payload), `"routing_key":"abc"`)
+
+	notifier, err = tcr.NewNotifier(&tcr.WebhookConfig{URL: "http://localhost", CustomTemplate: "{{.Type}}:{{.ConnectionID}}"})
+	assert.NoError(t, err)
+
+	payload, err = notifier.BuildPayload(event)
+	assert.NoError(t, err)
+	assert.Equal(t, "connection-lost:3", string(payload))
+}
+
+func TestNotifierSend(t *testing.T) {
+
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer server.Close()
+
+	notifier, err := tcr.NewNotifier(&tcr.WebhookConfig{URL: server.URL, Template: tcr.WebhookTemplateGeneric})
+	assert.NoError(t, err)
+
+	err = notifier.Send(&tcr.PoolEvent{Type: tcr.EventPoolDegraded, Message: "unable to create channel"})
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(<-received, tcr.EventPoolDegraded))
+}
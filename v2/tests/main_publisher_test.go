@@ -1,13 +1,20 @@
 package main_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
-	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -191,3 +198,742 @@ WaitLoop:
 
 	TestCleanup(t)
 }
+
+func TestPublishInTransaction(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+
+	letters := make([]*tcr.Letter, 10)
+	for i := 0; i < len(letters); i++ {
+		letters[i] = tcr.CreateMockRandomLetter("TcrTestQueue")
+	}
+
+	err := publisher.PublishInTransaction(letters)
+	assert.NoError(t, err)
+
+	err = publisher.PublishInTransaction(nil)
+	assert.Error(t, err)
+
+	TestCleanup(t)
+}
+
+func TestPublishWithReceiptCallback(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+
+	receipts := make(chan *tcr.PublishReceipt, 1)
+	letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+	letter.OnReceipt = func(receipt *tcr.PublishReceipt) { receipts <- receipt }
+
+	publisher.PublishWithConfirmation(letter, time.Millisecond*500)
+
+	select {
+	case receipt := <-receipts:
+		assert.True(t, receipt.Success)
+		assert.Equal(t, letter.LetterID, receipt.LetterID)
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "receipt callback was never called")
+	}
+
+	<-publisher.PublishReceipts() // still delivered to the shared stream
+
+	TestCleanup(t)
+}
+
+func TestPublishReceiptsDropOldest(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	cp, err := tcr.NewConnectionPool(Seasoning.PoolConfig)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, cp)
+	for i := 0; i < 1005; i++ {
+		letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+		letter.LetterID = uint64(i)
+		publisher.Publish(letter, false)
+	}
+
+	assert.Equal(t, uint64(5), publisher.DroppedReceipts())
+	assert.Len(t, publisher.PublishReceipts(), 1000)
+
+	receipt := <-publisher.PublishReceipts()
+	assert.Equal(t, uint64(5), receipt.LetterID) // the oldest went first
+	assert.True(t, receipt.Success)
+
+	for len(publisher.PublishReceipts()) > 0 {
+		<-publisher.PublishReceipts()
+	}
+
+	cp.Shutdown() // every publish fails fast with a receipt, none of them may be dropped
+
+	for i := 0; i < 1005; i++ {
+		publisher.Publish(tcr.CreateMockRandomLetter("TcrTestQueue"), false)
+	}
+
+	assert.Equal(t, uint64(5), publisher.DroppedReceipts())
+	for i := 0; i < 1005; i++ {
+		select {
+		case receipt := <-publisher.PublishReceipts():
+			assert.False(t, receipt.Success)
+			assert.NotNil(t, receipt.FailedLetter)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("failed receipt %d of 1005 was dropped", i+1)
+		}
+	}
+
+	TestCleanup(t)
+}
+
+func TestPublisherStrictOrdering(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	assert.NoError(t, err)
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.SetStrictOrdering(true)
+	publisher.StartAutoPublishing()
+
+	count := 100
+	for i := 0; i < count; i++ {
+		letter := tcr.CreateMockRandomLetter(queue.Name)
+		letter.Body = []byte(strconv.Itoa(i))
+		assert.True(t, publisher.QueueLetter(letter))
+	}
+
+	for i := 0; i < count; i++ {
+		receipt := <-publisher.PublishReceipts()
+		assert.True(t, receipt.Success)
+	}
+
+	publisher.Shutdown(false)
+
+	for i := 0; i < count; i++ {
+		delivery, ok, err := channel.Get(queue.Name, true)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, strconv.Itoa(i), string(delivery.Body))
+	}
+
+	TestCleanup(t)
+}
+
+func TestPublisherOrderingShards(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queueNames := make([]string, 4)
+	for i := range queueNames {
+		queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+		assert.NoError(t, err)
+		queueNames[i] = queue.Name
+	}
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.SetStrictOrdering(true)
+	publisher.SetOrderingShards(3)
+	publisher.StartAutoPublishing()
+
+	count := 50
+	for i := 0; i < count; i++ {
+		for _, queueName := range queueNames {
+			letter := tcr.CreateMockRandomLetter(queueName)
+			letter.Body = []byte(strconv.Itoa(i))
+			assert.True(t, publisher.QueueLetter(letter))
+		}
+	}
+
+	for i := 0; i < count*len(queueNames); i++ {
+		receipt := <-publisher.PublishReceipts()
+		assert.True(t, receipt.Success)
+	}
+
+	publisher.Shutdown(false)
+
+	for _, queueName := range queueNames {
+		for i := 0; i < count; i++ {
+			delivery, ok, err := channel.Get(queueName, true)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, strconv.Itoa(i), string(delivery.Body))
+		}
+	}
+
+	TestCleanup(t)
+}
+
+func TestPublisherOrderingChannelError(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	config := *Seasoning.PoolConfig
+	config.MaxCacheChannelCount = 0
+
+	cp, err := tcr.NewConnectionPool(&config)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, shards := range []int{1, 3} {
+		publisher := tcr.NewPublisherFromConfig(Seasoning, cp)
+		publisher.SetStrictOrdering(true)
+		publisher.SetOrderingShards(shards)
+		publisher.StartAutoPublishing()
+
+		assert.True(t, publisher.QueueLetter(tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+		receipt := <-publisher.PublishReceipts()
+		assert.True(t, errors.Is(receipt.Error, tcr.ErrNoCachedChannels), receipt.Error) // not ErrPoolClosed
+
+		publisher.Shutdown(false)
+	}
+
+	cp.Shutdown()
+	TestCleanup(t)
+}
+
+func TestPublishAndWait(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+
+	// Leave an unread confirmation on every cached channel so PublishAndWait has stale tags to skip.
+	for i := uint64(0); i < Seasoning.PoolConfig.MaxCacheChannelCount; i++ {
+		publisher.Publish(tcr.CreateMockRandomLetter("TcrTestQueue"), true)
+	}
+
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		assert.NoError(t, publisher.PublishAndWait(ctx, tcr.CreateMockRandomLetter("TcrTestQueue")))
+		cancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, publisher.PublishAndWait(ctx, tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+	TestCleanup(t)
+}
+
+func TestPublishEnvelopeProperties(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	assert.NoError(t, err)
+
+	letter := tcr.CreateMockRandomLetter(queue.Name)
+	letter.Envelope.Headers = amqp.Table{"x-tenant": "tcr"}
+	letter.Envelope.Expiration = time.Minute
+	letter.Envelope.Priority = 5
+	letter.Envelope.CorrelationID = "correlation"
+	letter.Envelope.ReplyTo = "TcrReplies"
+	letter.Envelope.MessageID = "message"
+	letter.Envelope.Type = "test.event"
+	letter.Envelope.AppID = "tcr-tests"
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	delivery, ok, err := channel.Get(queue.Name, true)
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.Equal(t, "tcr", delivery.Headers["x-tenant"])
+		assert.Equal(t, "60000", delivery.Expiration)
+		assert.Equal(t, uint8(5), delivery.Priority)
+		assert.Equal(t, "correlation", delivery.CorrelationId)
+		assert.Equal(t, "TcrReplies", delivery.ReplyTo)
+		assert.Equal(t, "message", delivery.MessageId)
+		assert.Equal(t, "test.event", delivery.Type)
+		assert.Equal(t, "tcr-tests", delivery.AppId)
+	}
+
+	TestCleanup(t)
+}
+
+func TestBoltOutboxStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tcr-outbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := tcr.NewBoltOutboxStore(filepath.Join(dir, "outbox.db"))
+	assert.NoError(t, err)
+
+	for i := uint64(1); i <= 3; i++ {
+		assert.NoError(t, store.Save(tcr.CreateLetter(i, "", "TcrTestQueue", []byte("SuperStreetFighter2Turbo"))))
+	}
+
+	count, err := store.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	entries, err := store.Load(2)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, uint64(1), entries[0].Letter.LetterID)
+	assert.Equal(t, "TcrTestQueue", entries[0].Letter.Envelope.RoutingKey)
+	assert.Equal(t, []byte("SuperStreetFighter2Turbo"), entries[0].Letter.Body)
+
+	assert.NoError(t, store.Delete(entries[0].ID))
+	assert.NoError(t, store.Close())
+
+	// Letters survive a restart.
+	store, err = tcr.NewBoltOutboxStore(filepath.Join(dir, "outbox.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	entries, err = store.Load(10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, uint64(2), entries[0].Letter.LetterID)
+}
+
+func TestRateLimiter(t *testing.T) {
+
+	assert.Nil(t, tcr.NewRateLimiter(&tcr.RateLimitConfig{}))
+
+	limiter := tcr.NewRateLimiter(&tcr.RateLimitConfig{MessagesPerSecond: 10, NonBlocking: true})
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, limiter.Take(context.Background(), 100))
+	}
+	assert.Equal(t, tcr.ErrRateLimited, limiter.Take(context.Background(), 100))
+
+	// Blocking waits for a token to refill (1 every 100ms).
+	limiter = tcr.NewRateLimiter(&tcr.RateLimitConfig{MessagesPerSecond: 10, MessageBurst: 1})
+	start := time.Now()
+	assert.NoError(t, limiter.Take(context.Background(), 100))
+	assert.NoError(t, limiter.Take(context.Background(), 100))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(90*time.Millisecond))
+
+	// Bytes per second, including a message larger than the burst.
+	limiter = tcr.NewRateLimiter(&tcr.RateLimitConfig{BytesPerSecond: 1000, NonBlocking: true})
+	assert.True(t, limiter.Allow(5000))
+	assert.False(t, limiter.Allow(1))
+
+	// Waiting respects the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, limiter.Wait(ctx, 1000))
+}
+
+func TestPublisherOnBlocked(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	assert.False(t, ConnectionPool.Blocked()) // no memory or disk alarm on the test broker
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+
+	publisher.SetOnBlocked(tcr.BlockedActionFail)
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+	publisher.SetOnBlocked(tcr.BlockedActionWait)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, publisher.PublishAndWait(ctx, tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+	TestCleanup(t)
+}
+
+func TestPublisherValidators(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.SetValidators(tcr.NewValidators().Add("", "TcrTestQueue", tcr.JSONValidator("LetterID")))
+
+	letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+	letter.Body = []byte(`{"LetterID": 1}`)
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	letter.Body = []byte(`{"Missing": true}`)
+	err := publisher.PublishAndWait(context.Background(), letter)
+	var validationErr *tcr.ValidationError
+	assert.True(t, errors.As(err, &validationErr), err)
+
+	other := tcr.CreateMockRandomLetter("TcrOtherQueue") // no validator registered for its routing key
+	other.Body = []byte("not json")
+	publisher.SetValidators(tcr.NewValidators().Add("", "TcrTestQueue", tcr.JSONValidator()))
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), other))
+
+	TestCleanup(t)
+}
+
+func TestPublisherTTLPolicies(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	assert.NoError(t, err)
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	assert.Error(t, publisher.SetTTLPolicies([]*tcr.TTLPolicy{{Exchange: tcr.AnyExchange, RoutingKey: "orders.#x"}}))
+	assert.NoError(t, publisher.SetTTLPolicies([]*tcr.TTLPolicy{
+		{Exchange: "", RoutingKey: "TcrTestQueue", Expiration: 0}, // exempt
+		{Exchange: tcr.AnyExchange, Expiration: 60000},
+	}))
+
+	letter := tcr.CreateMockRandomLetter(queue.Name)
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+	assert.Equal(t, time.Minute, letter.Envelope.Expiration)
+
+	delivery, ok, err := channel.Get(queue.Name, true)
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.Equal(t, "60000", delivery.Expiration)
+	}
+
+	explicit := tcr.CreateMockRandomLetter(queue.Name)
+	explicit.Envelope.Expiration = 5 * time.Second
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), explicit))
+	assert.Equal(t, 5*time.Second, explicit.Envelope.Expiration)
+
+	exempt := tcr.CreateMockRandomLetter("TcrTestQueue")
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), exempt))
+	assert.Zero(t, exempt.Envelope.Expiration)
+
+	TestCleanup(t)
+}
+
+func TestPublisherEnvelopeDefaults(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	assert.NoError(t, err)
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	assert.Error(t, publisher.SetEnvelopeDefaults(&tcr.EnvelopeDefaults{DeliveryMode: 3}))
+	assert.NoError(t, publisher.SetEnvelopeDefaults(&tcr.EnvelopeDefaults{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		AppID:        "orders",
+	}))
+
+	letter := &tcr.Letter{
+		Body:     []byte(`{"id":1}`),
+		Envelope: &tcr.Envelope{RoutingKey: queue.Name},
+	}
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	delivery, ok, err := channel.Get(queue.Name, true)
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.Equal(t, "application/json", delivery.ContentType)
+		assert.Equal(t, amqp.Persistent, delivery.DeliveryMode)
+		assert.Equal(t, "orders", delivery.AppId)
+	}
+
+	explicit := &tcr.Letter{
+		Body:     []byte("plain"),
+		Envelope: &tcr.Envelope{RoutingKey: queue.Name, ContentType: "text/plain", DeliveryMode: amqp.Transient},
+	}
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), explicit))
+	assert.Equal(t, "text/plain", explicit.Envelope.ContentType)
+	assert.Equal(t, amqp.Transient, explicit.Envelope.DeliveryMode)
+	assert.Equal(t, "orders", explicit.Envelope.AppID)
+
+	TestCleanup(t)
+}
+
+func TestPublisherOrderByKey(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	assert.NoError(t, err)
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.SetOrderByKey(true)
+
+	// Publish and PublishWithTransient wait for their confirmation, so each is on the queue before the next is sent.
+	for i := 0; i < 10; i++ {
+		letter := tcr.CreateMockRandomLetter(queue.Name)
+		letter.Body = []byte(strconv.Itoa(i))
+		if i%2 == 0 {
+			publisher.Publish(letter, true)
+		} else {
+			assert.NoError(t, publisher.PublishWithTransient(letter))
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter(queue.Name)))
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		delivery, ok, err := channel.Get(queue.Name, true)
+		assert.NoError(t, err)
+		if assert.True(t, ok) {
+			assert.Equal(t, strconv.Itoa(i), string(delivery.Body))
+		}
+	}
+
+	TestCleanup(t)
+}
+
+func TestPublisherTrace(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	assert.NoError(t, err)
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.SetTraceConfig(&tcr.TraceConfig{Enabled: true, Service: "orders"})
+
+	letter := tcr.CreateMockRandomLetter(queue.Name)
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	delivery, ok, err := channel.Get(queue.Name, true)
+	assert.NoError(t, err)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	received := tcr.NewMessage(false, delivery.Body, delivery.Headers, delivery.DeliveryTag, nil)
+	if assert.Len(t, received.Trace(), 1) {
+		assert.Equal(t, "orders", received.Trace()[0].Service)
+		assert.Equal(t, tcr.TraceActionPublish, received.Trace()[0].Action)
+	}
+
+	// Letters published while handling a message continue its trail.
+	publisher.SetTraceConfig(&tcr.TraceConfig{Enabled: true, Service: "billing"})
+	ctx := tcr.WithTraceAction(received.WithTrace(context.Background()), "invoice")
+	assert.NoError(t, publisher.PublishAndWait(ctx, tcr.CreateMockRandomLetter(queue.Name)))
+
+	delivery, ok, err = channel.Get(queue.Name, true)
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		trail := tcr.NewMessage(false, delivery.Body, delivery.Headers, delivery.DeliveryTag, nil).Trace()
+		if assert.Len(t, trail, 2) {
+			assert.Equal(t, "orders", trail[0].Service)
+			assert.Equal(t, "billing", trail[1].Service)
+			assert.Equal(t, "invoice", trail[1].Action)
+		}
+	}
+
+	TestCleanup(t)
+}
+
+func TestPublisherStampingAndCorrelation(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	assert.NoError(t, err)
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	received := &tcr.ReceivedMessage{MessageID: tcr.NewMessageID()} // starts the lineage
+	ctx := received.WithCorrelation(context.Background())
+
+	letter := tcr.CreateMockRandomLetter(queue.Name)
+	assert.NoError(t, publisher.PublishAndWait(ctx, letter))
+
+	delivery, ok, err := channel.Get(queue.Name, true)
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.Len(t, delivery.MessageId, 26)
+		assert.Equal(t, letter.Envelope.MessageID, delivery.MessageId)
+		assert.False(t, delivery.Timestamp.IsZero())
+		assert.Equal(t, received.MessageID, delivery.CorrelationId)
+	}
+
+	publisher.SetStamping(false)
+	assert.NoError(t, publisher.PublishAndWait(ctx, tcr.CreateMockRandomLetter(queue.Name)))
+
+	delivery, ok, err = channel.Get(queue.Name, true)
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.Empty(t, delivery.MessageId)
+		assert.Empty(t, delivery.CorrelationId)
+	}
+
+	TestCleanup(t)
+}
+
+func TestPublisherEvents(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	seasoning := *Seasoning
+	publisherConfig := *Seasoning.PublisherConfig
+	publisherConfig.EventBuffer = 10
+	seasoning.PublisherConfig = &publisherConfig
+
+	publisher := tcr.NewPublisherFromConfig(&seasoning, ConnectionPool)
+	publisher.SetValidators(tcr.NewValidators().Add(tcr.AnyExchange, "invalid", tcr.JSONValidator()))
+
+	letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	invalid := tcr.CreateMockRandomLetter("invalid")
+	invalid.Body = []byte("not json")
+	assert.Error(t, publisher.PublishAndWait(context.Background(), invalid))
+
+	publisher.StartAutoPublishing()
+	publisher.Shutdown(false)
+
+	expected := []string{
+		tcr.PublisherEventPublished,
+		tcr.PublisherEventFailed,
+		tcr.PublisherEventStarted,
+		tcr.PublisherEventShutdown,
+	}
+
+	for _, eventType := range expected {
+		event := <-publisher.Events()
+		assert.Equal(t, eventType, event.Type)
+	}
+	assert.Equal(t, uint64(0), publisher.DroppedEvents())
+
+	assert.Nil(t, tcr.NewPublisherFromConfig(Seasoning, ConnectionPool).Events()) // disabled by default
+
+	TestCleanup(t)
+}
+
+func TestPublishToQueue(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+
+	letter := tcr.CreateMockRandomLetter("")
+	letter.Envelope.Exchange = "MyTestExchange" // replaced by the default exchange
+	assert.NoError(t, publisher.PublishToQueue(context.Background(), "TcrTestQueue", letter, true))
+	assert.Equal(t, "", letter.Envelope.Exchange)
+	assert.Equal(t, "TcrTestQueue", letter.Envelope.RoutingKey)
+
+	err := publisher.PublishToQueue(context.Background(), "TcrMissingQueue", tcr.CreateMockRandomLetter(""), true)
+	assert.True(t, errors.Is(err, tcr.ErrQueueNotFound), err)
+
+	// Unverified, the broker confirms and drops it.
+	assert.NoError(t, publisher.PublishToQueue(context.Background(), "TcrMissingQueue", tcr.CreateMockRandomLetter(""), false))
+
+	TestCleanup(t)
+}
+
+func TestPublishAsync(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	futures := make([]*tcr.PublishFuture, 0, 100)
+	for i := 0; i < 100; i++ {
+		futures = append(futures, publisher.PublishAsync(ctx, tcr.CreateMockRandomLetter("TcrTestQueue")))
+	}
+
+	for _, future := range futures {
+		select {
+		case <-future.Done():
+			assert.NoError(t, future.Err())
+			assert.True(t, future.Confirmed())
+		case <-ctx.Done():
+			assert.Fail(t, "publish never completed", "LetterID %d", future.LetterID)
+		}
+	}
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	assert.Error(t, publisher.PublishAsync(canceled, tcr.CreateMockRandomLetter("TcrTestQueue")).Wait(context.Background()))
+
+	TestCleanup(t)
+}
+
+func TestPublishBuffer(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	seasoning := *Seasoning
+	publisherConfig := *Seasoning.PublisherConfig
+	publisherConfig.PublishBufferConfig = &tcr.PublishBufferConfig{Size: 10, OverflowPolicy: tcr.OverflowDropNew}
+	seasoning.PublisherConfig = &publisherConfig
+
+	publisher := tcr.NewPublisherFromConfig(&seasoning, ConnectionPool)
+
+	const burst = 1000
+	for i := 0; i < burst; i++ {
+		publisher.Publish(tcr.CreateMockRandomLetter("TcrTestQueue"), true)
+	}
+
+	stats := publisher.PublishBufferStats()
+	assert.Equal(t, 10, stats.Capacity)
+	assert.LessOrEqual(t, stats.MaxDepth, stats.Capacity)
+
+	publisher.Shutdown(false) // publishes what is still buffered
+	assert.Equal(t, 0, publisher.PublishBufferStats().Depth)
+
+	dropped := publisher.PublishBufferStats().Dropped
+	assert.Less(t, dropped, uint64(burst))
+
+	TestCleanup(t)
+}
+
+func TestPublisherReceiptSink(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	channel := ConnectionPool.GetTransientChannel(false)
+	defer channel.Close()
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	assert.NoError(t, err)
+
+	type outcome struct {
+		letterID    uint64
+		success     bool
+		err         error
+		confirmedAt time.Time
+	}
+
+	outcomes := make(chan outcome, 2)
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.SetReceiptSink(tcr.ReceiptSinkFunc(func(letterID uint64, success bool, err error, confirmedAt time.Time) {
+		outcomes <- outcome{letterID, success, err, confirmedAt}
+	}))
+
+	letter := tcr.CreateMockRandomLetter(queue.Name)
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	recorded := <-outcomes // recorded before PublishAndWait returned
+	assert.Equal(t, letter.LetterID, recorded.letterID)
+	assert.True(t, recorded.success)
+	assert.False(t, recorded.confirmedAt.IsZero())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	failed := tcr.CreateMockRandomLetter(queue.Name)
+	assert.Error(t, publisher.PublishAndWait(ctx, failed))
+
+	recorded = <-outcomes
+	assert.Equal(t, failed.LetterID, recorded.letterID)
+	assert.False(t, recorded.success)
+	assert.Error(t, recorded.err)
+	assert.True(t, recorded.confirmedAt.IsZero())
+
+	TestCleanup(t)
+}
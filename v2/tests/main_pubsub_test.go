@@ -1,10 +1,12 @@
 package main_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
 	"github.com/stretchr/testify/assert"
 )
@@ -219,3 +221,144 @@ func TestLargePublishConfirmation(t *testing.T) {
 
 	TestCleanup(t)
 }
+
+// TestShovel moves messages from one queue to another through the default exchange.
+func TestShovel(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+	for _, queueName := range []string{"TcrShovelSource", "TcrShovelTarget"} {
+		assert.NoError(t, topologer.CreateQueue(queueName, false, false, false, false, false, nil))
+	}
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	count := 50
+	for i := 0; i < count; i++ {
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter("TcrShovelSource")))
+	}
+
+	shovel, err := tcr.NewShovel(ConnectionPool, ConnectionPool, &tcr.ShovelConfig{
+		SourceQueue:      "TcrShovelSource",
+		TargetRoutingKey: "TcrShovelTarget",
+		BatchSize:        10,
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		for shovel.Transferred() < uint64(count) && ctx.Err() == nil {
+			time.Sleep(50 * time.Millisecond)
+		}
+		cancel()
+	}()
+
+	assert.NoError(t, shovel.Run(ctx))
+	assert.Equal(t, uint64(count), shovel.Transferred())
+
+	moved, err := topologer.QueueDelete("TcrShovelTarget", false, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, count, moved)
+
+	_, err = topologer.QueueDelete("TcrShovelSource", false, false, false)
+	assert.NoError(t, err)
+
+	TestCleanup(t)
+}
+
+// TestTemporaryQueue replies to a request through a server-named TemporaryQueue.
+func TestTemporaryQueue(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	replies, err := tcr.NewTemporaryQueue(ConnectionPool, &tcr.TemporaryQueueConfig{AutoAck: true})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, replies.Name())
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	letter := tcr.CreateMockRandomLetter(replies.Name())
+	letter.Envelope.CorrelationID = "TcrTemporaryQueue"
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	select {
+	case msg := <-replies.Deliveries():
+		assert.Equal(t, "TcrTemporaryQueue", msg.CorrelationID)
+	case <-time.After(5 * time.Second):
+		t.Error("no reply delivered to the temporary queue")
+	}
+
+	replies.Close()
+	replies.Close()
+
+	_, ok := <-replies.Deliveries()
+	assert.False(t, ok)
+
+	TestCleanup(t)
+}
+
+// TestChunkedPublishing publishes a body larger than the ChunkSize and consumes it back in one piece.
+func TestChunkedPublishing(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	publisher.SetChunkSize(1024)
+
+	letter := tcr.CreateMockRandomLetter(ConsumerConfig.QueueName)
+	letter.Body = make([]byte, 10*1024+1) // eleven chunks
+	for i := range letter.Body {
+		letter.Body[i] = byte(i)
+	}
+
+	consumer := tcr.NewConsumerFromConfig(ConsumerConfig, ConnectionPool)
+	consumer.StartConsuming()
+
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	select {
+	case msg := <-consumer.ReceivedMessages():
+		assert.Equal(t, letter.Body, msg.Body)
+		assert.NotContains(t, msg.Headers, tcr.HeaderChunkID)
+		if msg.IsAckable {
+			assert.NoError(t, msg.Acknowledge())
+		}
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "chunked message was not reassembled")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	TestCleanup(t)
+}
+
+func TestChunkTimeout(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+
+	letter := tcr.CreateMockRandomLetter(ConsumerConfig.QueueName)
+	letter.Envelope.Headers = amqp.Table{ // the first of two chunks, the second never comes
+		tcr.HeaderChunkID:    "TcrChunkTimeout",
+		tcr.HeaderChunkIndex: int32(0),
+		tcr.HeaderChunkCount: int32(2),
+	}
+
+	consumerConfig := *ConsumerConfig
+	consumerConfig.ChunkTimeout = 1
+	consumer := tcr.NewConsumerFromConfig(&consumerConfig, ConnectionPool)
+	consumer.StartConsuming()
+
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+
+	for _, settled := range []string{"requeued", "rejected"} { // requeued first, rejected once redelivered
+		select {
+		case err := <-consumer.Errors():
+			assert.Contains(t, err.Error(), "consumer "+settled+" chunked message TcrChunkTimeout")
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "chunk timeout was not reported", settled)
+		}
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, true))
+
+	TestCleanup(t)
+}
@@ -7,8 +7,8 @@ import (
 	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
-	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -1,7 +1,10 @@
 package main_test
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/fortytw2/leaktest"
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
@@ -57,6 +60,41 @@ func TestRabbitServicePublishLetter(t *testing.T) {
 	service.Shutdown(true)
 }
 
+func TestRabbitServiceFinalReceipt(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	service, err := tcr.NewRabbitService(Seasoning, "", "", nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	attempts := 0
+	service.Publisher.SetValidators(tcr.NewValidators().Add("", "TcrTestQueue", tcr.ValidatorFunc(func(*tcr.Letter) error {
+		if attempts++; attempts < 3 {
+			return errors.New("not yet") // failed twice, retried by the service
+		}
+		return nil
+	})))
+
+	receipts := make(chan *tcr.PublishReceipt, 3)
+	letter := tcr.CreateMockRandomLetter("TcrTestQueue")
+	letter.OnReceipt = func(receipt *tcr.PublishReceipt) { receipts <- receipt }
+
+	service.Publisher.Publish(letter, false)
+
+	select {
+	case receipt := <-receipts:
+		assert.True(t, receipt.Success) // the failures before it weren't final
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "final receipt was never received")
+	}
+
+	time.Sleep(time.Second)
+	assert.Empty(t, receipts)
+
+	service.Shutdown(true)
+}
+
 func TestRabbitServicePublishAndConsumeLetter(t *testing.T) {
 	defer leaktest.Check(t)() // Fail on leaked goroutines.
 
@@ -70,3 +108,239 @@ func TestRabbitServicePublishAndConsumeLetter(t *testing.T) {
 
 	service.Shutdown(true)
 }
+
+func TestRabbitServiceTopologyAndStartConsumer(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	seasoning := *Seasoning
+	seasoning.EncryptionConfig = &tcr.EncryptionConfig{}
+	seasoning.TopologyConfig = &tcr.TopologyConfig{
+		Queues: []*tcr.Queue{{Name: "TcrServiceQueue", Durable: true}},
+	}
+	seasoning.ConsumerConfigs = map[string]*tcr.ConsumerConfig{
+		"ServiceConsumer": {Enabled: true, QueueName: "TcrServiceQueue", ConsumerName: "ServiceConsumer"},
+	}
+
+	service, err := tcr.NewRabbitService(&seasoning, "", "", nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	handled := make(chan []byte, 1)
+	assert.NoError(t, service.StartConsumer("ServiceConsumer", func(msg *tcr.ReceivedMessage) error {
+		handled <- msg.Body
+		return nil
+	}))
+	assert.Error(t, service.StartConsumer("MissingConsumer", nil))
+
+	letter := tcr.CreateMockRandomLetter("TcrServiceQueue")
+	assert.NoError(t, service.Publisher.PublishAndWait(context.Background(), letter))
+
+	select {
+	case body := <-handled:
+		assert.Equal(t, letter.Body, body)
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "message was never consumed")
+	}
+
+	service.Shutdown(true)
+
+	_, err = tcr.NewTopologer(ConnectionPool).QueueDelete("TcrServiceQueue", false, false, false)
+	assert.NoError(t, err)
+}
+
+func TestRabbitServiceShutdownHooks(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	service, err := tcr.NewRabbitService(Seasoning, "", "", nil, nil)
+	assert.NoError(t, err)
+
+	stages := make([]string, 0)
+	record := func(name string) func() error {
+		return func() error {
+			stages = append(stages, name)
+			return nil
+		}
+	}
+
+	service.OnShutdown(tcr.ShutdownPostClose, "deregister", record("service post-close"))
+	service.OnShutdown(tcr.ShutdownPreDrain, "stop-accepting", record("service pre-drain"))
+	service.OnShutdown(tcr.ShutdownPostDrain, "flush-buffers", record("service post-drain"))
+	service.ConnectionPool.OnShutdown(tcr.ShutdownPreDrain, "pool", record("pool pre-drain"))
+	service.ConnectionPool.OnShutdown(tcr.ShutdownPostClose, "pool", record("pool post-close"))
+
+	service.Shutdown(true)
+
+	assert.Equal(t, []string{
+		"service pre-drain",
+		"service post-drain",
+		"pool pre-drain",
+		"pool post-close",
+		"service post-close",
+	}, stages)
+	assert.Equal(t, "post-drain", tcr.ShutdownPostDrain.String())
+}
+
+func TestRegisterAndStart(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	received := make(chan *tcr.ReceivedMessage, 1)
+	handler := func(message *tcr.ReceivedMessage) {
+		_ = message.Acknowledge()
+		received <- message
+	}
+
+	tcr.Register("TcrRegisteredQueue", handler, &tcr.RegisterOptions{
+		Queue: &tcr.Queue{AutoDelete: true},
+	})
+	tcr.Register("TcrRegisteredQueue", handler, nil)
+	tcr.Register("TcrNilHandlerQueue", nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := tcr.Start(ctx, Seasoning)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "register called twice")
+		assert.Contains(t, err.Error(), "register handler is nil")
+	}
+
+	service, err := tcr.Start(ctx, Seasoning) // the errors were returned once, the first registration stands
+	assert.NoError(t, err)
+
+	consumer, err := service.GetConsumer("TcrRegisteredQueue")
+	assert.NoError(t, err)
+	assert.True(t, consumer.Started)
+
+	err = service.Publish("registered", "", "TcrRegisteredQueue", "", false, nil)
+	assert.NoError(t, err)
+
+	select {
+	case message := <-received:
+		assert.Equal(t, `"registered"`, string(message.Body))
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "registered handler never received the message")
+	}
+
+	cancel()
+	time.Sleep(time.Second * 3) // shutdown on cancel is asynchronous
+}
+
+func TestRabbitServiceReloadConfig(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	seasoning := *Seasoning
+	poolConfig := *Seasoning.PoolConfig
+	poolConfig.MaxCacheChannelCount = 10
+	seasoning.PoolConfig = &poolConfig
+	seasoning.EncryptionConfig = &tcr.EncryptionConfig{}
+	seasoning.ConsumerConfigs = map[string]*tcr.ConsumerConfig{
+		"ReloadConsumer": {Enabled: true, QueueName: "TcrTestQueue", ConsumerName: "ReloadConsumer", QosCountOverride: 10},
+	}
+
+	service, err := tcr.NewRabbitService(&seasoning, "", "", nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	reloaded := seasoning
+	reloadedPool := poolConfig
+	reloadedPool.MaxCacheChannelCount = 5
+	reloadedPool.ConnectionName = "TcrReloaded"
+	reloaded.PoolConfig = &reloadedPool
+	reloaded.ConsumerConfigs = map[string]*tcr.ConsumerConfig{
+		"ReloadConsumer": {Enabled: true, QueueName: "TcrTestQueue", ConsumerName: "ReloadConsumer", QosCountOverride: 20},
+	}
+
+	result, err := service.ReloadConfig(&reloaded)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ConsumerConfigs[ReloadConsumer].QosCountOverride", "PoolConfig.MaxCacheChannelCount"}, result.Applied)
+	assert.Equal(t, []string{"PoolConfig.ConnectionName"}, result.RequiresRestart)
+	assert.Equal(t, uint64(5), service.ConnectionPool.GetPoolStats().MaxCacheChannelCount)
+
+	consumer, err := service.GetConsumer("ReloadConsumer")
+	assert.NoError(t, err)
+	assert.Equal(t, 20, consumer.Prefetch())
+
+	reloadedPool.MaxCacheChannelCount = 50 // more than the pool was created with
+	result, err = service.ReloadConfig(&reloaded)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Applied)
+	assert.Contains(t, result.RequiresRestart, "PoolConfig.MaxCacheChannelCount")
+
+	service.Shutdown(true)
+}
+
+func TestRabbitServiceBrokerTargets(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	seasoning := *Seasoning
+	auditPool := *Seasoning.PoolConfig
+	auditPool.ConnectionName = "TcrAudit"
+	seasoning.BrokerTargets = map[string]*tcr.BrokerTargetConfig{
+		"audit": {PoolConfig: &auditPool},
+	}
+
+	service, err := tcr.NewRabbitService(&seasoning, "", "", nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"audit"}, service.Brokers.Names())
+
+	publisher, err := service.Brokers.Publisher("audit")
+	assert.NoError(t, err)
+	assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter("TcrTestQueue")))
+
+	pool, err := service.Brokers.ConnectionPool("audit")
+	assert.NoError(t, err)
+	assert.Equal(t, "TcrAudit", pool.GetPoolStats().ConnectionName)
+
+	_, err = service.Brokers.Publisher("billing")
+	assert.True(t, errors.Is(err, tcr.ErrBrokerNotFound), err)
+
+	service.Shutdown(true)
+
+	seasoning.BrokerTargets["billing"] = &tcr.BrokerTargetConfig{} // no PoolConfig
+	_, err = tcr.NewRabbitService(&seasoning, "", "", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestShutdownManager(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	service, err := tcr.NewRabbitService(Seasoning, "", "", nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	poolConfig := *Seasoning.PoolConfig
+	poolConfig.ConnectionName = "TcrShutdownManager"
+	cp, err := tcr.NewConnectionPool(&poolConfig)
+	if !assert.NoError(t, err) {
+		service.Shutdown(true)
+		return
+	}
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, cp)
+	consumerConfig := *Seasoning.ConsumerConfigs["TurboCookedRabbitConsumer-Ackable"]
+	consumer := tcr.NewConsumerFromConfig(&consumerConfig, cp)
+	consumer.StartConsuming()
+
+	stopped := make([]string, 0)
+	cp.OnShutdown(tcr.ShutdownPreDrain, "order", func() error {
+		stopped = append(stopped, "pool")
+		return nil
+	})
+
+	manager := tcr.NewShutdownManager()
+	manager.AddConnectionPool(cp)
+	manager.AddService(service)
+	manager.AddPublisher(publisher)
+	manager.AddConsumer(consumer)
+
+	assert.NoError(t, manager.Shutdown())
+	assert.Equal(t, []string{"pool"}, stopped) // the pool shared by the publisher and consumer shut down once
+	assert.Equal(t, tcr.PoolShutdown, cp.State())
+	assert.Equal(t, tcr.PoolShutdown, service.ConnectionPool.State())
+
+	assert.NoError(t, manager.Shutdown()) // nothing left to shut down
+}
@@ -0,0 +1,233 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcrtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// publishOrder stands in for application code that only knows the interface.
+func publishOrder(publisher tcr.LetterPublisher, body string) error {
+	return publisher.PublishAndWait(context.Background(), &tcr.Letter{
+		Body:     []byte(body),
+		Envelope: &tcr.Envelope{Exchange: "Orders", RoutingKey: "order.created", ContentType: "text/plain"},
+	})
+}
+
+func TestInMemoryPublishAndConsume(t *testing.T) {
+
+	broker := tcrtest.NewBroker()
+	broker.Bind("TcrTestOrders", "Orders", tcrtest.MatchAll)
+
+	publisher := tcrtest.NewPublisher(broker)
+	assert.NoError(t, publishOrder(publisher, "good"))
+	assert.NoError(t, publishOrder(publisher, "bad"))
+
+	publisher.FailWith(errors.New("broker down"))
+	assert.Error(t, publishOrder(publisher, "lost"))
+	publisher.FailWith(nil)
+
+	assert.Equal(t, 2, len(broker.Published()))
+	assert.Equal(t, 2, broker.QueueDepth("TcrTestOrders"))
+
+	var consumer tcr.MessageConsumer = tcrtest.NewConsumer(broker, "TcrTestOrders")
+	handled := make(chan string, 2)
+	assert.NoError(t, consumer.StartConsumingWithHandler(func(msg *tcr.ReceivedMessage) error {
+		handled <- string(msg.Body)
+		if string(msg.Body) == "bad" {
+			return errors.New("bad order")
+		}
+		return nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("messages weren't consumed")
+		}
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, false))
+	assert.Equal(t, uint64(1), broker.Acked())
+	assert.Equal(t, uint64(1), broker.Nacked())
+	assert.Equal(t, 0, broker.Unacked())
+}
+
+func TestTcrtestPublishToQueue(t *testing.T) {
+
+	broker := tcrtest.NewBroker()
+	broker.DeclareQueue("TcrTestOrders")
+
+	var publisher tcr.LetterPublisher = tcrtest.NewPublisher(broker)
+	assert.NoError(t, publisher.PublishToQueue(context.Background(), "TcrTestOrders", tcr.CreateMockRandomLetter(""), true))
+	assert.Equal(t, 1, broker.QueueDepth("TcrTestOrders"))
+
+	err := publisher.PublishToQueue(context.Background(), "TcrMissingOrders", tcr.CreateMockRandomLetter(""), true)
+	assert.True(t, errors.Is(err, tcr.ErrQueueNotFound), err)
+
+	future := publisher.PublishAsync(context.Background(), tcr.CreateMockRandomLetter("TcrTestOrders"))
+	<-future.Done()
+	assert.True(t, future.Confirmed())
+	assert.Equal(t, 2, broker.QueueDepth("TcrTestOrders"))
+}
+
+func TestTcrtestConsumeBatch(t *testing.T) {
+
+	broker := tcrtest.NewBroker()
+	broker.Bind("TcrTestOrders", "Orders", tcrtest.MatchAll)
+
+	publisher := tcrtest.NewPublisher(broker)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, publishOrder(publisher, "order"))
+	}
+
+	var consumer tcr.MessageConsumer = tcrtest.NewConsumer(broker, "TcrTestOrders")
+	consumer.StartConsuming()
+
+	batch := consumer.ConsumeBatch(3, time.Second)
+	assert.Len(t, batch, 3)
+	assert.NoError(t, batch.Acknowledge())
+
+	batch = consumer.ConsumeBatch(3, time.Millisecond*100) // only 2 left
+	assert.Len(t, batch, 2)
+	assert.NoError(t, batch.Nack(false))
+
+	assert.NoError(t, consumer.StopConsuming(false, false))
+	assert.Equal(t, uint64(3), broker.Acked())
+	assert.Equal(t, uint64(2), broker.Nacked())
+	assert.Equal(t, 0, broker.Unacked())
+}
+
+// countingPublisher stands in for an instrumented decorator bound in place of the Publisher.
+type countingPublisher struct {
+	tcr.Publisherer
+	published int
+}
+
+func (cp *countingPublisher) PublishAndWait(ctx context.Context, letter *tcr.Letter) error {
+
+	cp.published++
+	return cp.Publisherer.PublishAndWait(ctx, letter)
+}
+
+func TestTcrtestInjectedInterfaces(t *testing.T) {
+
+	broker := tcrtest.NewBroker()
+	broker.Bind("TcrTestOrders", "Orders", tcrtest.MatchAll)
+
+	publisher := &countingPublisher{Publisherer: tcrtest.NewPublisher(broker)}
+	publisher.StartAutoPublishing()
+	defer publisher.Shutdown(false)
+
+	assert.NoError(t, publishOrder(publisher, "good"))
+	assert.NoError(t, publishOrder(publisher, "bad"))
+	assert.NoError(t, publishOrder(publisher, "retry"))
+	assert.Equal(t, 3, publisher.published)
+
+	var consumer tcr.Consumerer = tcrtest.NewConsumer(broker, "TcrTestOrders")
+	handled := make(chan struct{}, 4)
+	retried := false
+	consumer.StartConsumingWithAction(func(msg *tcr.ReceivedMessage) {
+		defer func() { handled <- struct{}{} }()
+
+		switch string(msg.Body) {
+		case "good":
+			assert.NoError(t, msg.Acknowledge())
+		case "bad":
+			assert.NoError(t, msg.Reject(false))
+		default:
+			if retried {
+				assert.NoError(t, msg.Acknowledge())
+				return
+			}
+			retried = true
+			assert.NoError(t, msg.Nack(true))
+		}
+	})
+
+	for i := 0; i < 4; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("messages weren't consumed")
+		}
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, false))
+
+	counters := consumer.Counters()
+	assert.Equal(t, "TcrTestOrders", counters.QueueName)
+	assert.Equal(t, uint64(4), counters.Received)
+	assert.Equal(t, uint64(4), counters.Processed)
+	assert.Equal(t, uint64(2), counters.Acked)
+	assert.Equal(t, uint64(2), counters.Nacked)
+	assert.Equal(t, uint64(1), counters.Requeued)
+}
+
+func TestTcrtestErrorEvents(t *testing.T) {
+
+	broker := tcrtest.NewBroker()
+	broker.Bind("TcrTestErrors", "Orders", tcrtest.MatchAll)
+	assert.NoError(t, publishOrder(tcrtest.NewPublisher(broker), "bad"))
+
+	errBadOrder := errors.New("bad order")
+	consumer := tcrtest.NewConsumer(broker, "TcrTestErrors")
+	assert.NoError(t, consumer.StartConsumingWithHandler(func(msg *tcr.ReceivedMessage) error {
+		return errBadOrder
+	}))
+
+	select {
+	case err := <-consumer.Errors():
+		assert.True(t, errors.Is(err, errBadOrder), err)
+
+		event, ok := tcr.AsErrorEvent(err)
+		assert.True(t, ok)
+		assert.Equal(t, tcr.SubsystemConsumer, event.Subsystem)
+		assert.Equal(t, "handle", event.Operation)
+		assert.False(t, event.Timestamp.IsZero())
+
+		data, err := event.MarshalJSON()
+		assert.NoError(t, err)
+		assert.True(t, strings.Contains(string(data), `"Error":"bad order"`), string(data))
+		assert.True(t, strings.Contains(string(data), `"Subsystem":"consumer"`), string(data))
+	case <-time.After(time.Second):
+		t.Fatal("handler error was never reported")
+	}
+
+	assert.NoError(t, consumer.StopConsuming(false, false))
+}
+
+func TestTcrtestContainer(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("starts a RabbitMQ container")
+	}
+
+	container := tcrtest.RabbitMQ(t, nil) // skipped without docker
+
+	seasoning := container.Seasoning()
+	seasoning.ConsumerConfigs["Orders"] = &tcr.ConsumerConfig{Enabled: true, QueueName: "Orders", ConsumerName: "Orders"}
+
+	service, err := tcr.NewRabbitService(seasoning, "", "", nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer service.Shutdown(true)
+
+	assert.NoError(t, service.Topologer.CreateQueue("Orders", false, true, false, false, false, nil))
+	assert.NoError(t, service.Publisher.PublishToQueue(context.Background(), "Orders", tcr.CreateMockRandomLetter(""), true))
+
+	consumer, err := service.GetConsumer("Orders")
+	if assert.NoError(t, err) {
+		message, err := consumer.Get("Orders")
+		assert.NoError(t, err)
+		assert.NotNil(t, message)
+	}
+}
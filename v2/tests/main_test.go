@@ -1,10 +1,13 @@
 package main_test
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"testing"
 
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcrtest"
 )
 
 var Seasoning *tcr.RabbitSeasoning
@@ -21,29 +24,56 @@ func TestMain(m *testing.M) {
 		return
 	}
 
+	// TCR_TEST_DOCKER=1 runs the tests against a throwaway broker instead of one on localhost.
+	if os.Getenv("TCR_TEST_DOCKER") != "" {
+		container, err := tcrtest.StartRabbitMQ(context.Background(), nil)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		Seasoning.PoolConfig.URI = container.URI
+		code := runTests(m)
+		_ = container.Close()
+		if code < 0 {
+			code = 1 // the container's broker should be reachable
+		}
+		os.Exit(code)
+	}
+
+	if code := runTests(m); code >= 0 {
+		os.Exit(code)
+	}
+}
+
+// runTests sets up the service and runs the tests, returning -1 without running them when the broker is unreachable.
+func runTests(m *testing.M) int {
+
+	var err error
+
 	RabbitService, err = tcr.NewRabbitService(Seasoning, "", "", nil, nil)
 	if err != nil {
-		return
+		return -1
 	}
 
 	ConnectionPool = RabbitService.ConnectionPool
 
 	AckableConsumerConfig, err = RabbitService.GetConsumerConfig("TurboCookedRabbitConsumer-Ackable")
 	if err != nil {
-		return
+		return -1
 	}
 
 	ConsumerConfig, err = RabbitService.GetConsumerConfig("TurboCookedRabbitConsumer")
 	if err != nil {
-		return
+		return -1
 	}
 
 	err = RabbitService.Topologer.CreateQueue("TcrTestQueue", false, true, false, false, false, nil)
 	if err != nil {
-		return
+		return -1
 	}
 
-	os.Exit(m.Run())
+	return m.Run()
 }
 
 func TestCleanup(t *testing.T) {
@@ -1,13 +1,16 @@
 package main_test
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/fortytw2/leaktest"
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
-	"github.com/streadway/amqp"
+	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcrmgmt"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -96,3 +99,263 @@ func TestCreateQuorumQueue(t *testing.T) {
 	_, err = topologer.QueueDelete("TcrTestQuorumQueue", false, false, false)
 	assert.NoError(t, err)
 }
+
+func TestNamingConvention(t *testing.T) {
+
+	naming, err := tcr.NewNamingConvention(&tcr.NamingConfig{
+		Strict:            true,
+		ExchangePattern:   "{domain}.events",
+		QueuePattern:      `[a-z]+(-[a-z]+)*`,
+		RoutingKeyPattern: "{domain}.{entity}.{action}",
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, naming.Validate(tcr.NameKindExchange, "orders.events"))
+	assert.Error(t, naming.Validate(tcr.NameKindExchange, "orders.events.extra"))
+	assert.Error(t, naming.Validate(tcr.NameKindExchange, "ordersXevents")) // literal dot
+	assert.NoError(t, naming.Validate(tcr.NameKindQueue, "order-created"))
+	assert.Error(t, naming.Validate(tcr.NameKindQueue, "OrderCreated"))
+	assert.NoError(t, naming.Validate(tcr.NameKindRoutingKey, "orders.order.created"))
+
+	err = naming.Validate(tcr.NameKindRoutingKey, "orders.created")
+	violation, ok := err.(*tcr.NamingViolation)
+	assert.True(t, ok)
+	assert.Equal(t, tcr.NameKindRoutingKey, violation.Kind)
+	assert.Equal(t, "orders.created", violation.Name)
+
+	_, err = tcr.NewNamingConvention(&tcr.NamingConfig{QueuePattern: "("})
+	assert.Error(t, err)
+}
+
+func TestNamingConventionPrefix(t *testing.T) {
+
+	naming, err := tcr.NewNamingConvention(&tcr.NamingConfig{
+		Prefix:    "{env}.{service}.",
+		Suffix:    "-{TCR_TEST_RUN}",
+		Variables: map[string]string{"env": "test", "service": "billing", "TCR_TEST_RUN": "42"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "test.billing.orders-42", naming.Queue("orders"))
+	assert.Equal(t, "test.billing.orders-42", naming.Queue("test.billing.orders-42")) // already decorated
+	assert.Equal(t, "test.billing.events-42", naming.Exchange("events"))
+	assert.Equal(t, "", naming.Exchange(""))
+	assert.Equal(t, "amq.topic", naming.Exchange("amq.topic"))
+	assert.Equal(t, "", naming.Queue(""))
+
+	var none *tcr.NamingConvention
+	assert.Equal(t, "orders", none.Queue("orders"))
+
+	_, err = tcr.NewNamingConvention(&tcr.NamingConfig{Prefix: "{tcr_undefined_variable}."})
+	assert.Error(t, err)
+}
+
+func TestVerifyTopology(t *testing.T) {
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+
+	config := &tcr.TopologyConfig{
+		Exchanges: []*tcr.Exchange{{Name: "TcrVerifyExchange", Type: "direct", Durable: true}},
+		Queues:    []*tcr.Queue{{Name: "TcrVerifyQueue", Durable: true}},
+		QueueBindings: []*tcr.QueueBinding{
+			{QueueName: "TcrVerifyQueue", ExchangeName: "TcrVerifyExchange", RoutingKey: "verify"},
+		},
+	}
+
+	diff, err := topologer.VerifyTopology(config)
+	assert.NoError(t, err)
+	assert.Len(t, diff.Issues(tcr.TopologyMissing), 4) // exchange, queue, and both ends of the binding
+
+	assert.NoError(t, topologer.BuildToplogy(config, false))
+
+	diff, err = topologer.VerifyTopology(config)
+	assert.NoError(t, err)
+	assert.Len(t, diff.Issues(tcr.TopologyUnverified), 2) // exists, but nothing to compare them with
+
+	topologer.SetTopologyInspector(managementClient(t))
+
+	diff, err = topologer.VerifyTopology(config)
+	assert.NoError(t, err)
+	assert.True(t, diff.Empty(), diff.String())
+
+	config.Queues[0].Durable = false
+	config.Queues[0].Args = amqp.Table{"x-max-length": 10}
+	diff, err = topologer.VerifyTopology(config)
+	assert.NoError(t, err)
+	if assert.Len(t, diff.Issues(tcr.TopologyMismatched), 1) {
+		assert.Equal(t, "TcrVerifyQueue", diff.Differences[0].Name)
+		assert.Contains(t, diff.Differences[0].Detail, "durable is true, expected false")
+		assert.Contains(t, diff.Differences[0].Detail, "argument x-max-length is missing")
+	}
+
+	_, err = topologer.QueueDelete("TcrVerifyQueue", false, false, false)
+	assert.NoError(t, err)
+	assert.NoError(t, topologer.ExchangeDelete("TcrVerifyExchange", false, false))
+}
+
+func TestTeardownTopology(t *testing.T) {
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+
+	config := &tcr.TopologyConfig{
+		Exchanges: []*tcr.Exchange{
+			{Name: "TcrTeardownExchange", Type: "direct", Durable: true},
+			{Name: "TcrTeardownParent", Type: "fanout", Durable: true},
+		},
+		Queues: []*tcr.Queue{{Name: "TcrTeardownQueue", Durable: true}},
+		QueueBindings: []*tcr.QueueBinding{
+			{QueueName: "TcrTeardownQueue", ExchangeName: "TcrTeardownExchange", RoutingKey: "teardown"},
+		},
+		ExchangeBindings: []*tcr.ExchangeBinding{
+			{ExchangeName: "TcrTeardownExchange", ParentExchangeName: "TcrTeardownParent", RoutingKey: "teardown"},
+		},
+	}
+
+	assert.NoError(t, topologer.BuildToplogy(config, false))
+
+	topologer.SetTopologyInspector(managementClient(t))
+	diff, err := topologer.VerifyTopology(config)
+	assert.NoError(t, err)
+	assert.True(t, diff.Empty(), diff.String())
+
+	assert.NoError(t, topologer.TeardownTopology(config, false))
+
+	diff, err = topologer.VerifyTopology(config)
+	assert.NoError(t, err)
+	assert.Len(t, diff.Issues(tcr.TopologyMissing), len(diff.Differences))
+	assert.Len(t, diff.Differences, 7) // both exchanges, the queue, and both ends of each binding
+}
+
+func TestValidateTopology(t *testing.T) {
+
+	config := &tcr.TopologyConfig{
+		Exchanges: []*tcr.Exchange{
+			{Name: "TcrTopicExchange", Type: tcr.ExchangeTypeTopic},
+			{Name: "TcrHeadersExchange", Type: tcr.ExchangeTypeHeaders},
+		},
+		QueueBindings: []*tcr.QueueBinding{
+			{QueueName: "TcrTestQueue", ExchangeName: "TcrTopicExchange", RoutingKey: "orders.*.#"},
+			{
+				QueueName:    "TcrTestQueue",
+				ExchangeName: "TcrHeadersExchange",
+				Match:        tcr.HeadersMatchAll,
+				Headers:      amqp.Table{"format": "pdf", "type": "report"},
+			},
+		},
+	}
+	assert.NoError(t, config.Validate())
+
+	assert.Error(t, tcr.ValidateTopicPattern("orders.eu*"))
+	assert.NoError(t, tcr.ValidateTopicPattern("orders.#"))
+
+	config.QueueBindings[0].RoutingKey = "orders.eu*"
+	config.QueueBindings[1].Match = "most"
+	config.Exchanges = append(config.Exchanges, &tcr.Exchange{Name: "TcrBadExchange", Type: "drect"})
+	assert.Error(t, config.Validate())
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+	assert.Error(t, topologer.BuildToplogy(config, false)) // nothing declared
+}
+
+func TestAlternateExchangeAndAuditFanout(t *testing.T) {
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+
+	config := &tcr.TopologyConfig{
+		Exchanges: []*tcr.Exchange{
+			{Name: "TcrOrders", Type: tcr.ExchangeTypeDirect, Durable: true, AlternateExchange: "TcrUnrouted"},
+			{Name: "TcrUnrouted", Type: tcr.ExchangeTypeFanout, Durable: true},
+			{Name: "TcrAudit", Type: tcr.ExchangeTypeFanout, Durable: true},
+		},
+		Queues: []*tcr.Queue{
+			{Name: "TcrUnroutedQueue", Durable: true},
+			{Name: "TcrAuditQueue", Durable: true},
+		},
+		QueueBindings: []*tcr.QueueBinding{
+			{QueueName: "TcrUnroutedQueue", ExchangeName: "TcrUnrouted"},
+			{QueueName: "TcrAuditQueue", ExchangeName: "TcrAudit"},
+		},
+		ExchangeBindings: []*tcr.ExchangeBinding{
+			{ExchangeName: "TcrAudit", ParentExchangeName: "TcrOrders", RoutingKey: "order.created"},
+		},
+	}
+
+	assert.NoError(t, topologer.BuildToplogy(config, false))
+
+	topologer.SetTopologyInspector(managementClient(t))
+	diff, err := topologer.VerifyTopology(config)
+	assert.NoError(t, err)
+	assert.True(t, diff.Empty(), diff.String())
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for _, routingKey := range []string{"order.created", "order.unknown"} {
+		letter := tcr.CreateMockRandomLetter("")
+		letter.Envelope.Exchange = "TcrOrders"
+		letter.Envelope.RoutingKey = routingKey
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), letter))
+	}
+
+	consumer := tcr.NewConsumerFromConfig(ConsumerConfig, ConnectionPool)
+	for _, queueName := range []string{"TcrAuditQueue", "TcrUnroutedQueue"} {
+		delivery, err := consumer.Get(queueName)
+		assert.NoError(t, err)
+		assert.NotNil(t, delivery, queueName)
+	}
+
+	assert.NoError(t, topologer.TeardownTopology(config, false))
+}
+
+func TestQueueMonitor(t *testing.T) {
+	defer leaktest.Check(t)() // Fail on leaked goroutines.
+
+	topologer := tcr.NewTopologer(ConnectionPool)
+	assert.NoError(t, topologer.CreateQueue("TcrMonitorQueue", false, true, false, false, false, nil))
+	defer func() { _, _ = topologer.QueueDelete("TcrMonitorQueue", false, false, false) }()
+
+	publisher := tcr.NewPublisherFromConfig(Seasoning, ConnectionPool)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, publisher.PublishAndWait(context.Background(), tcr.CreateMockRandomLetter("TcrMonitorQueue")))
+	}
+
+	messages, consumers, err := topologer.QueueCounts("TcrMonitorQueue")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, messages)
+	assert.Equal(t, 0, consumers)
+
+	monitor, err := tcr.NewQueueMonitor(ConnectionPool, &tcr.QueueMonitorConfig{
+		Queues: []*tcr.QueueThreshold{
+			{QueueName: "TcrMonitorQueue", MaxMessages: 2, MinConsumers: 1},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	events := make([]string, 0)
+	monitor.OnEvent(func(event *tcr.QueueEvent) { events = append(events, event.Type) })
+
+	assert.NoError(t, monitor.Check(context.Background()))
+	assert.NoError(t, monitor.Check(context.Background())) // no new crossings
+	assert.Equal(t, []string{tcr.QueueEventBacklog, tcr.QueueEventConsumersLow}, events)
+
+	_, err = topologer.PurgeQueue("TcrMonitorQueue", false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, monitor.Check(context.Background()))
+	assert.Equal(t, tcr.QueueEventBacklogCleared, events[len(events)-1])
+
+	monitor.Start()
+	monitor.Stop()
+
+	_, err = tcr.NewQueueMonitor(ConnectionPool, &tcr.QueueMonitorConfig{})
+	assert.Error(t, err)
+}
+
+// managementClient is a management API client for the test broker, to inspect topology.
+func managementClient(t *testing.T) *tcrmgmt.Client {
+
+	client, err := tcrmgmt.NewClientFromPool(ConnectionPool)
+	assert.NoError(t, err)
+
+	return client
+}
@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"log"
 	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/houseofcat/turbocookedrabbit/v2/internal/amqp"
 	"github.com/houseofcat/turbocookedrabbit/v2/pkg/tcr"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestCompressAndDecompressWithGzip(t *testing.T) {
@@ -30,6 +33,41 @@ func TestCompressAndDecompressWithGzip(t *testing.T) {
 	assert.Equal(t, data, buffer.String())
 }
 
+func BenchmarkCompressors(b *testing.B) {
+
+	records := make([]map[string]interface{}, 100)
+	for i := range records {
+		records[i] = map[string]interface{}{"OrderID": i, "Customer": tcr.RandomString(8), "Status": "Shipped"}
+	}
+
+	data, err := jsoniter.ConfigFastest.Marshal(records)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, compressionType := range []string{tcr.GzipCompressionType, tcr.ZstdCompressionType} {
+		compressor, err := tcr.GetCompressor(compressionType)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(compressionType, func(b *testing.B) {
+			var compressed []byte
+			for i := 0; i < b.N; i++ {
+				if compressed, err = compressor.Compress(data); err != nil {
+					b.Fatal(err)
+				}
+
+				if _, err = compressor.Decompress(compressed); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(len(compressed)), "wire-bytes")
+		})
+	}
+}
+
 func TestCompressAndDecompressWithZstd(t *testing.T) {
 
 	data := "SuperStreetFighter2TurboMBisonDidNothingWrong"
@@ -341,6 +379,98 @@ func TestCreateAndReadLZCompressedEncryptedPayload(t *testing.T) {
 	assert.Equal(t, test.PropertyString4, outputData.PropertyString4)
 }
 
+func TestCompressionThresholdAndNegotiation(t *testing.T) {
+
+	compression := &tcr.CompressionConfig{
+		Enabled:         true,
+		Type:            tcr.GzipCompressionType,
+		MinCompressSize: 1024,
+	}
+
+	assert.Equal(t, "", tcr.SelectCompression(compression, 100, ""))
+	assert.Equal(t, tcr.GzipCompressionType, tcr.SelectCompression(compression, 2048, ""))
+	assert.Equal(t, tcr.ZstdCompressionType, tcr.SelectCompression(compression, 2048, "br, zstd, gzip"))
+	assert.Equal(t, "", tcr.SelectCompression(compression, 2048, "identity, gzip"))
+	assert.Equal(t, "", tcr.SelectCompression(compression, 2048, "br"))
+
+	encrypt := &tcr.EncryptionConfig{Enabled: false}
+	for _, input := range []string{"small", tcr.RandomString(5000)} {
+		data, err := tcr.CreatePayload(input, compression, encrypt)
+		assert.NoError(t, err)
+		if len(input) < compression.MinCompressSize {
+			assert.Equal(t, "", tcr.DetectCompression(data))
+		} else {
+			assert.Equal(t, tcr.GzipCompressionType, tcr.DetectCompression(data))
+		}
+
+		buffer := bytes.NewBuffer(data)
+		assert.NoError(t, tcr.ReadPayload(buffer, compression, encrypt))
+
+		var output string
+		assert.NoError(t, jsoniter.ConfigFastest.Unmarshal(buffer.Bytes(), &output))
+		assert.Equal(t, input, output)
+	}
+}
+
+type reverseCompressor struct{}
+
+func (reverseCompressor) Compress(data []byte) ([]byte, error) {
+
+	output := make([]byte, len(data))
+	for i := range data {
+		output[len(data)-1-i] = data[i]
+	}
+
+	return output, nil
+}
+
+func (c reverseCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.Compress(data)
+}
+
+type upperCodec struct{}
+
+func (upperCodec) ContentType() string { return "text/upper" }
+
+func (upperCodec) Marshal(input interface{}) ([]byte, error) {
+	return bytes.ToUpper([]byte(fmt.Sprint(input))), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, output interface{}) error {
+	*output.(*string) = string(data)
+	return nil
+}
+
+func TestCodecAndCompressorRegistries(t *testing.T) {
+
+	tcr.RegisterCompressor("reverse", reverseCompressor{})
+	tcr.RegisterCodec("text/upper; charset=utf-8", upperCodec{})
+
+	compression := &tcr.CompressionConfig{Enabled: true, Type: "reverse"}
+	assert.Equal(t, "reverse", tcr.SelectCompression(compression, 10, ""))
+	assert.Equal(t, "reverse", tcr.SelectCompression(compression, 10, "br, reverse"))
+
+	encrypt := &tcr.EncryptionConfig{Enabled: false}
+	data, err := tcr.CreatePayload("payload", compression, encrypt)
+	assert.NoError(t, err)
+	assert.Equal(t, `"daolyap"`, string(data))
+
+	buffer := bytes.NewBuffer(data)
+	assert.NoError(t, tcr.ReadEncodedPayload(buffer, "reverse", compression, encrypt))
+	assert.Equal(t, `"payload"`, buffer.String())
+
+	assert.Error(t, tcr.ReadEncodedPayload(bytes.NewBuffer(data), "br", compression, encrypt))
+
+	letter, err := tcr.CreateEncodedLetter(1, "", "queue", "hello", upperCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, "HELLO", string(letter.Body))
+
+	msg := &tcr.ReceivedMessage{Body: letter.Body, ContentType: letter.Envelope.ContentType}
+	var output string
+	assert.NoError(t, msg.Decode(&output))
+	assert.Equal(t, "HELLO", output)
+}
+
 func TestRandomString(t *testing.T) {
 
 	randoString := tcr.RandomString(20)
@@ -370,3 +500,131 @@ func TestRandomStringFromSource(t *testing.T) {
 
 	assert.NotEqual(t, randoString, anotherRandoString)
 }
+
+func TestStdLoggerLevels(t *testing.T) {
+
+	buffer := &bytes.Buffer{}
+	logger := tcr.NewStdLogger(log.New(buffer, "", 0), tcr.LogLevelWarn)
+
+	logger.Debug("debug %d", 1)
+	logger.Info("info %d", 2)
+	logger.Warn("warn %d", 3)
+	logger.Error("error %d", 4)
+
+	assert.Equal(t, "WARN: warn 3\nERROR: error 4\n", buffer.String())
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+
+	type order struct {
+		OrderID  uint64 `json:"OrderID" msgpack:"OrderID"`
+		Customer string `json:"Customer" msgpack:"Customer"`
+	}
+
+	input := &order{OrderID: 42, Customer: "M. Bison"}
+
+	for _, codec := range []tcr.Codec{tcr.JSONCodec{}, tcr.MsgPackCodec{}} {
+
+		letter, err := tcr.CreateEncodedLetter(1, "", "OrderQueue", input, codec)
+		assert.NoError(t, err)
+		assert.Equal(t, codec.ContentType(), letter.Envelope.ContentType)
+
+		msg := &tcr.ReceivedMessage{Body: letter.Body, ContentType: letter.Envelope.ContentType}
+
+		output := &order{}
+		assert.NoError(t, msg.Decode(output))
+		assert.Equal(t, input, output)
+	}
+
+	letter, err := tcr.CreateEncodedLetter(1, "", "OrderQueue", wrapperspb.String("Shadaloo"), tcr.ProtobufCodec{})
+	assert.NoError(t, err)
+
+	msg := &tcr.ReceivedMessage{Body: letter.Body, ContentType: letter.Envelope.ContentType + "; charset=binary"}
+
+	output := &wrapperspb.StringValue{}
+	assert.NoError(t, msg.Decode(output))
+	assert.Equal(t, "Shadaloo", output.GetValue())
+
+	_, err = tcr.CreateEncodedLetter(1, "", "OrderQueue", input, tcr.ProtobufCodec{})
+	assert.Error(t, err)
+
+	_, err = tcr.GetCodec("text/plain")
+	assert.Error(t, err)
+}
+
+func TestGetAndReleaseLetter(t *testing.T) {
+
+	letter := tcr.GetLetter()
+	assert.NotNil(t, letter.Envelope)
+
+	letter.LetterID = 42
+	letter.Body = []byte("pooled")
+	letter.Envelope.RoutingKey = "TcrTestQueue"
+	letter.Envelope.Headers = map[string]interface{}{"shared": true}
+	headers := letter.Envelope.Headers
+	letter.Release()
+
+	for i := 0; i < 10; i++ {
+		reused := tcr.GetLetter()
+		assert.Equal(t, uint64(0), reused.LetterID)
+		assert.Nil(t, reused.Body)
+		assert.NotNil(t, reused.Envelope)
+		assert.Equal(t, "", reused.Envelope.RoutingKey)
+		assert.Nil(t, reused.Envelope.Headers)
+		reused.Release()
+	}
+
+	assert.Len(t, headers, 1) // released headers are dropped, not cleared
+}
+
+func TestHeadersTypedAccessors(t *testing.T) {
+
+	published := time.Now().Add(-time.Second)
+	headers := tcr.HeadersFromTable(amqp.Table{
+		"count":     int16(3),
+		"name":      []byte("orders"),
+		"published": published.UnixMilli(),
+		"x-death": []interface{}{
+			amqp.Table{"queue": "orders", "count": int64(2)},
+		},
+	})
+
+	count, ok := headers.GetInt64("count")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), count)
+
+	name, ok := headers.GetString("name")
+	assert.True(t, ok)
+	assert.Equal(t, "orders", name)
+
+	publishedAt, ok := headers.GetTime("published")
+	assert.True(t, ok)
+	assert.Equal(t, published.UnixMilli(), publishedAt.UnixMilli())
+
+	deaths, ok := headers.GetTables("x-death")
+	assert.True(t, ok)
+	assert.Len(t, deaths, 1)
+	queue, _ := deaths[0].GetString("queue")
+	assert.Equal(t, "orders", queue)
+
+	// wrong types and missing headers report false instead of panicking
+	_, ok = headers.GetInt64("name")
+	assert.False(t, ok)
+	_, ok = headers.GetBool("missing")
+	assert.False(t, ok)
+	_, ok = tcr.Headers(nil).GetString("name")
+	assert.False(t, ok)
+
+	// nested maps are set as tables AMQP can encode
+	nested := tcr.NewHeaders()
+	nested.Set("tenant", map[string]interface{}{"id": "acme", "tags": []string{"a", "b"}})
+	assert.NoError(t, nested.Validate())
+
+	tenant, ok := nested.GetTable("tenant")
+	assert.True(t, ok)
+	tags, ok := tenant.GetStrings("tags")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, tags)
+
+	assert.Equal(t, uint32(3), tcr.GetRetryCount(amqp.Table{tcr.HeaderRetryCount: int32(3)}))
+}